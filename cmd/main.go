@@ -5,14 +5,23 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/config"
 	"github.com/pinokiochan/social-network-render/internal/database"
 	"github.com/pinokiochan/social-network-render/internal/handlers"
 	"github.com/pinokiochan/social-network-render/internal/logger" // Импортируем пакет logger
 	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/oidc"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+	"github.com/pinokiochan/social-network-render/internal/store/postgres"
+	"github.com/pinokiochan/social-network-render/internal/timeline"
 
 	"github.com/sirupsen/logrus"
 )
@@ -20,6 +29,19 @@ import (
 var wg sync.WaitGroup
 
 func main() {
+	// Подкоманда для управления миграциями: go run ./cmd migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	// Отчёт по алгоритмам хэшей паролей: go run ./cmd password-hashes
+	if len(os.Args) > 1 && os.Args[1] == "password-hashes" {
+		os.Exit(runPasswordHashes(os.Args[2:]))
+	}
+	// Заполнение и перестройка лент подписок: go run ./cmd timelines backfill|rebuild|trim
+	if len(os.Args) > 1 && os.Args[1] == "timelines" {
+		os.Exit(runTimelines(os.Args[2:]))
+	}
+
 	// Открытие/создание файла для логирования
 	logFile, err := os.OpenFile("app.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
@@ -34,24 +56,120 @@ func main() {
 	// Логируем начало работы приложения
 	logger.Log.Info("Starting application")
 
-	// Подключение к базе данных
-	db, err := database.ConnectToDB()
+	// Выбор хранилища: STORAGE=memory запускает сервер без PostgreSQL
+	var st *store.Store
+	if os.Getenv("STORAGE") == "memory" {
+		logger.Log.Warn("Using in-memory storage, data will be lost on restart")
+		st = memory.New()
+	} else {
+		// Подключение к базе данных
+		db, err := database.ConnectToDB()
+		if err != nil {
+			logger.Log.WithError(err).Fatal("Failed to connect to database")
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				logger.Log.WithError(err).Error("Failed to close database connection")
+			}
+		}()
+
+		logger.Log.Info("Database connection established")
+
+		// Применение миграций при старте (отключается через AUTO_MIGRATE=false)
+		if os.Getenv("AUTO_MIGRATE") != "false" {
+			applied, err := database.Migrate(db)
+			if err != nil {
+				logger.Log.WithError(err).Fatal("Failed to apply database migrations")
+			}
+			logger.Log.WithField("applied", applied).Info("Database migrations are up to date")
+		}
+
+		st = postgres.New(db)
+	}
+
+	// Ключи подписи JWT: текущий из JWT_SIGNING_KEY(_FILE), старые из JWT_RETIRED_KEY_FILES
+	keys, ephemeral, err := auth.LoadKeysFromEnv()
 	if err != nil {
-		logger.Log.WithError(err).Fatal("Failed to connect to database")
+		logger.Log.WithError(err).Fatal("Failed to load JWT signing keys")
+	}
+	if ephemeral {
+		logger.Log.Warn("No JWT signing key configured, using an ephemeral key; tokens will not survive a restart")
+	}
+	auth.UseKeys(keys)
+	logger.Log.WithFields(logrus.Fields{
+		"kid": keys.Current().ID,
+		"alg": keys.Current().Algorithm,
+	}).Info("JWT signing key loaded")
+
+	// Алгоритм и параметры хэширования паролей; слабые хэши обновляются при входе
+	hashParams, err := auth.HashParamsFromEnv()
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Invalid password hash settings")
+	}
+	if err := auth.UseHashParams(hashParams); err != nil {
+		logger.Log.WithError(err).Fatal("Invalid password hash settings")
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			logger.Log.WithError(err).Error("Failed to close database connection")
-		}
-	}()
 
-	logger.Log.Info("Database connection established")
+	// Кто может регистрироваться: все, адреса разрешенных доменов или по приглашению
+	registration, err := auth.RegistrationPolicyFromEnv()
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Invalid registration settings")
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"mode":    registration.Mode,
+		"domains": strings.Join(registration.AllowedDomains, ","),
+	}).Info("Registration mode")
+
+	// Ленты подписок: fan-out при записи, посты популярных авторов читаются при запросе
+	timelineConfig, err := timeline.ConfigFromEnv()
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Invalid timeline settings")
+	}
+	timelines := timeline.NewService(st, timelineConfig, &wg)
+	// Разросшиеся ленты периодически обрезаются до TIMELINE_MAX_ENTRIES
+	trimContext, stopTrimming := context.WithCancel(context.Background())
+	go timelines.RunTrimmer(trimContext)
+
+	// Лайк и набор эмодзи-реакций из REACTIONS
+	reactions, err := config.Reactions()
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Invalid reaction settings")
+	}
+
+	// Сессии с ротацией refresh-токенов
+	sessions := auth.NewSessionManager(st)
+	// Права ролей из таблицы role_permissions
+	permissions := auth.NewPermissions(st)
+
+	// Вход через внешних OpenID Connect провайдеров из OIDC_PROVIDERS
+	oidcProviders, err := oidc.LoadProvidersFromEnv(config.BaseURL() + "/api/oauth/callback")
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Failed to load OIDC providers")
+	}
+	for _, p := range oidcProviders {
+		logger.Log.WithField("provider", p.Name()).Info("OIDC provider configured")
+	}
+
+	// Общий счётчик неудачных входов: пароль и коды 2FA расходуют один лимит
+	loginGuard := auth.NewLoginGuard(st)
 
 	// Инициализация обработчиков
-	userHandler := handlers.NewUserHandler(db)
-	postHandler := handlers.NewPostHandler(db)
-	commentHandler := handlers.NewCommentHandler(db)
-	adminHandler := handlers.NewAdminHandler(db, &wg)
+	userHandler := handlers.NewUserHandler(st, sessions, loginGuard, &wg)
+	sessionHandler := handlers.NewSessionHandler(sessions)
+	passwordHandler := handlers.NewPasswordHandler(st, sessions, &wg)
+	loginLinkHandler := handlers.NewLoginLinkHandler(st, sessions, &wg)
+	twoFactorHandler := handlers.NewTwoFactorHandler(st, sessions, loginGuard)
+	accessTokenHandler := handlers.NewAccessTokenHandler(st, sessions, permissions)
+	postHandler := handlers.NewPostHandler(st, permissions, timelines)
+	commentHandler := handlers.NewCommentHandler(st, permissions)
+	jwksHandler := handlers.NewJWKSHandler(keys)
+	oauthHandler := handlers.NewOAuthHandler(st, sessions, oidcProviders)
+	adminHandler := handlers.NewAdminHandler(st, sessions, permissions, &wg)
+	inviteHandler := handlers.NewInviteHandler(st)
+	followHandler := handlers.NewFollowHandler(st, timelines)
+	postReactionHandler := handlers.NewReactionHandler(st, models.ReactionTargetPost, reactions)
+	commentReactionHandler := handlers.NewReactionHandler(st, models.ReactionTargetComment, reactions)
+	authMiddleware := middleware.NewAuth(sessions, permissions)
 
 	// Создание нового ServeMux (роутера)
 	mux := http.NewServeMux()
@@ -63,31 +181,95 @@ func main() {
 	mux.Handle("/img/", http.StripPrefix("/img/", fsImg))
 
 	// Настройка API-роутов
+	// Публичные ключи для проверки access-токенов
+	mux.HandleFunc("/.well-known/jwks.json", jwksHandler.ServeJWKS)
+
 	mux.HandleFunc("/api/register", userHandler.Register)
+	mux.HandleFunc("/api/registration", userHandler.Registration)
 	mux.HandleFunc("/api/login", userHandler.Login)
+	mux.HandleFunc("/api/login/2fa", twoFactorHandler.LoginChallenge)
+	// Вход по одноразовой ссылке из письма, без пароля
+	mux.HandleFunc("/api/login/link/request", loginLinkHandler.Request)
+	mux.HandleFunc("/api/login/link", loginLinkHandler.Login)
+	// Вход через OpenID Connect: authorization code + PKCE
+	mux.HandleFunc("/api/oauth/providers", oauthHandler.Providers)
+	mux.HandleFunc("/api/oauth/start", oauthHandler.Start)
+	mux.HandleFunc("/api/oauth/callback", oauthHandler.Callback)
 	mux.HandleFunc("/api/verify", userHandler.Verify)
-	mux.HandleFunc("/api/index/users", middleware.JWT(userHandler.GetUsers))
-	mux.HandleFunc("/api/index/posts", middleware.JWT(postHandler.GetPosts))
-	mux.HandleFunc("/api/index/posts/create", middleware.JWT(postHandler.CreatePost))
-	mux.HandleFunc("/api/index/posts/update", middleware.JWT(postHandler.UpdatePost))
-	mux.HandleFunc("/api/index/posts/delete", middleware.JWT(postHandler.DeletePost))
-	mux.HandleFunc("/api/index/comments", middleware.JWT(commentHandler.GetComments))
-	mux.HandleFunc("/api/index/comments/create", middleware.JWT(commentHandler.CreateComment))
-	mux.HandleFunc("/api/index/comments/update", middleware.JWT(commentHandler.UpdateComment))
-	mux.HandleFunc("/api/index/comments/delete", middleware.JWT(commentHandler.DeleteComment))
-
-	// Админ-роуты (ограничены пользователями с правами администратора)
+	mux.HandleFunc("/api/verify/resend", userHandler.ResendVerification)
+	mux.HandleFunc("/api/password/forgot", passwordHandler.Forgot)
+	mux.HandleFunc("/api/password/reset", passwordHandler.Reset)
+	mux.HandleFunc("/api/token/refresh", sessionHandler.Refresh)
+	mux.HandleFunc("/api/logout", sessionHandler.Logout)
+	// Активные сессии (устройства) текущего пользователя
+	mux.HandleFunc("/api/sessions", authMiddleware.JWT(sessionHandler.List))
+	mux.HandleFunc("/api/sessions/revoke", authMiddleware.JWT(sessionHandler.Revoke))
+	mux.HandleFunc("/api/sessions/revoke-all", authMiddleware.JWT(sessionHandler.RevokeAll))
+
+	// Двухфакторная аутентификация (TOTP)
+	mux.HandleFunc("/api/2fa/status", authMiddleware.JWT(twoFactorHandler.Status))
+	mux.HandleFunc("/api/2fa/enroll", authMiddleware.JWT(twoFactorHandler.Enroll))
+	mux.HandleFunc("/api/2fa/confirm", authMiddleware.JWT(twoFactorHandler.Confirm))
+	mux.HandleFunc("/api/2fa/disable", authMiddleware.JWT(twoFactorHandler.Disable))
+	mux.HandleFunc("/api/2fa/recovery-codes", authMiddleware.JWT(twoFactorHandler.RegenerateRecoveryCodes))
+
+	// Personal access tokens для скриптов; маршруты ниже указывают нужный scope
+	mux.HandleFunc("/api/tokens", authMiddleware.JWT(accessTokenHandler.List))
+	mux.HandleFunc("/api/tokens/create", authMiddleware.JWT(accessTokenHandler.Create))
+	mux.HandleFunc("/api/tokens/revoke", authMiddleware.JWT(accessTokenHandler.Revoke))
+
+	mux.HandleFunc("/api/index/users", authMiddleware.JWTScope(auth.ScopeUsersRead, userHandler.GetUsers))
+	mux.HandleFunc("/api/index/posts", authMiddleware.JWTScope(auth.ScopePostsRead, postHandler.GetPosts))
+	mux.HandleFunc("/api/index/posts/create", authMiddleware.JWTScope(auth.ScopePostsWrite, postHandler.CreatePost))
+	mux.HandleFunc("/api/index/posts/update", authMiddleware.JWTScope(auth.ScopePostsWrite, postHandler.UpdatePost))
+	mux.HandleFunc("/api/index/posts/delete", authMiddleware.JWTScope(auth.ScopePostsWrite, postHandler.DeletePost))
+	mux.HandleFunc("/api/index/comments", authMiddleware.JWTScope(auth.ScopeCommentsRead, commentHandler.GetComments))
+	mux.HandleFunc("/api/index/comments/thread", authMiddleware.JWTScope(auth.ScopeCommentsRead, commentHandler.GetThread))
+	mux.HandleFunc("/api/index/comments/create", authMiddleware.JWTScope(auth.ScopeCommentsWrite, commentHandler.CreateComment))
+	mux.HandleFunc("/api/index/comments/update", authMiddleware.JWTScope(auth.ScopeCommentsWrite, commentHandler.UpdateComment))
+	mux.HandleFunc("/api/index/comments/delete", authMiddleware.JWTScope(auth.ScopeCommentsWrite, commentHandler.DeleteComment))
+
+	// Реакции на посты и комментарии: добавить, убрать, кто отреагировал
+	mux.HandleFunc("/api/reactions", authMiddleware.JWT(postReactionHandler.Available))
+	mux.HandleFunc("/api/index/posts/reactions", authMiddleware.JWTScope(auth.ScopePostsRead, postReactionHandler.List))
+	mux.HandleFunc("/api/index/posts/reactions/add", authMiddleware.JWTScope(auth.ScopePostsWrite, postReactionHandler.Add))
+	mux.HandleFunc("/api/index/posts/reactions/remove", authMiddleware.JWTScope(auth.ScopePostsWrite, postReactionHandler.Remove))
+	mux.HandleFunc("/api/index/comments/reactions", authMiddleware.JWTScope(auth.ScopeCommentsRead, commentReactionHandler.List))
+	mux.HandleFunc("/api/index/comments/reactions/add", authMiddleware.JWTScope(auth.ScopeCommentsWrite, commentReactionHandler.Add))
+	mux.HandleFunc("/api/index/comments/reactions/remove", authMiddleware.JWTScope(auth.ScopeCommentsWrite, commentReactionHandler.Remove))
+
+	// Подписки и домашняя лента: посты своих подписок и свои, с курсорной пагинацией
+	mux.HandleFunc("/api/feed/home", authMiddleware.JWTScope(auth.ScopePostsRead, postHandler.HomeFeed))
+	mux.HandleFunc("/api/users/profile", authMiddleware.JWTScope(auth.ScopeUsersRead, followHandler.Profile))
+	mux.HandleFunc("/api/users/followers", authMiddleware.JWTScope(auth.ScopeUsersRead, followHandler.Followers))
+	mux.HandleFunc("/api/users/following", authMiddleware.JWTScope(auth.ScopeUsersRead, followHandler.Following))
+	mux.HandleFunc("/api/users/follow", authMiddleware.JWT(followHandler.Follow))
+	mux.HandleFunc("/api/users/unfollow", authMiddleware.JWT(followHandler.Unfollow))
+
+	// Админ-роуты: каждый требует право из матрицы ролей
 	mux.HandleFunc("/admin", handlers.ServeAdminHTML)
-	mux.HandleFunc("/api/admin/stats", middleware.AdminOnly(adminHandler.GetStats))
-	mux.HandleFunc("/api/admin/broadcast-to-selected", adminHandler.BroadcastEmailToSelectedUsers)
-	mux.HandleFunc("/api/admin/users", middleware.AdminOnly(adminHandler.GetUsers))
-	mux.HandleFunc("/api/admin/users/delete", middleware.AdminOnly(adminHandler.DeleteUser))
-	mux.HandleFunc("/api/admin/users/edit", middleware.AdminOnly(adminHandler.EditUser))
+	mux.HandleFunc("/api/admin/stats", authMiddleware.Require(models.PermStatsRead, adminHandler.GetStats))
+	mux.HandleFunc("/api/admin/broadcast-to-selected", authMiddleware.Require(models.PermEmailBroadcast, adminHandler.BroadcastEmailToSelectedUsers))
+	mux.HandleFunc("/api/admin/users", authMiddleware.Require(models.PermUsersRead, adminHandler.GetUsers))
+	mux.HandleFunc("/api/admin/users/delete", authMiddleware.Require(models.PermUsersDelete, adminHandler.DeleteUser))
+	mux.HandleFunc("/api/admin/users/edit", authMiddleware.Require(models.PermUsersEdit, adminHandler.EditUser))
+	mux.HandleFunc("/api/admin/users/role", authMiddleware.Require(models.PermUsersEdit, adminHandler.SetUserRole))
+	mux.HandleFunc("/api/admin/users/revoke-sessions", authMiddleware.Require(models.PermUsersRevokeSessions, adminHandler.RevokeUserSessions))
+	mux.HandleFunc("/api/admin/users/unlock", authMiddleware.Require(models.PermUsersEdit, adminHandler.UnlockUser))
+	mux.HandleFunc("/api/admin/users/impersonate", authMiddleware.Require(models.PermUsersImpersonate, adminHandler.Impersonate))
+	mux.HandleFunc("/api/admin/impersonation-log", authMiddleware.Require(models.PermUsersImpersonate, adminHandler.ImpersonationLog))
+	mux.HandleFunc("/api/admin/invites", authMiddleware.Require(models.PermInvitesManage, inviteHandler.List))
+	mux.HandleFunc("/api/admin/invites/create", authMiddleware.Require(models.PermInvitesManage, inviteHandler.Create))
+	mux.HandleFunc("/api/admin/invites/revoke", authMiddleware.Require(models.PermInvitesManage, inviteHandler.Revoke))
+	mux.HandleFunc("/api/admin/invites/redemptions", authMiddleware.Require(models.PermInvitesManage, inviteHandler.Redemptions))
+	mux.HandleFunc("/api/admin/roles", authMiddleware.Require(models.PermUsersRead, adminHandler.GetRoles))
+	mux.HandleFunc("/api/admin/roles/permissions", authMiddleware.Require(models.PermRolesManage, adminHandler.SetRolePermission))
 
 	mux.HandleFunc("/user-profile", handlers.ServeUserProfileHTML)
-	mux.HandleFunc("/api/user-profile/data", userHandler.UserData)
-	mux.HandleFunc("/api/user-profile/edit", userHandler.UserUpdate)
-	mux.HandleFunc("/api/user-profile/posts", userHandler.UserPosts)
+	// Профиль текущего пользователя из токена
+	mux.HandleFunc("/api/user-profile/data", authMiddleware.JWT(userHandler.UserData))
+	mux.HandleFunc("/api/user-profile/edit", authMiddleware.JWT(userHandler.UserUpdate))
+	mux.HandleFunc("/api/user-profile/posts", authMiddleware.JWT(userHandler.UserPosts))
 
 	// Регулярные HTML-страницы
 	mux.HandleFunc("/", handlers.ServeHTML)
@@ -103,7 +285,7 @@ func main() {
 
 	srv := &http.Server{
 		Addr:         ":" + port, // Используем динамический порт
-		Handler:      middleware.LoggingMiddleware(middleware.RateLimitMiddleware(mux)),
+		Handler:      middleware.LoggingMiddleware(middleware.RateLimitMiddleware(middleware.ClientMiddleware(mux))),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 	}
@@ -137,6 +319,7 @@ func main() {
 
 	// Ожидание завершения фоновых задач перед полным завершением
 	logger.Log.Info("Waiting for background tasks to complete...")
+	stopTrimming()
 	wg.Wait()
 
 	// Логируем успешное завершение работы
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pinokiochan/social-network-render/internal/database"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and whether they are applied`
+
+// runMigrate implements the "migrate" subcommand and returns the process
+// exit code.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := database.ConnectToDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to the database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.Migrate(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "Invalid number of steps: %q\n", args[1])
+				return 2
+			}
+		}
+		rolledBack, err := database.MigrateDown(db, steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Rollback failed: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", rolledBack)
+
+	case "status":
+		statuses, err := database.MigrationStatuses(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %v\n", err)
+			return 1
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/database"
+	"github.com/pinokiochan/social-network-render/internal/store/postgres"
+)
+
+const passwordHashesUsage = `usage: main password-hashes
+
+Reports how many accounts use each password hash algorithm and cost, and
+which of them are upgraded on the next login under the current
+PASSWORD_HASH_* settings.`
+
+// runPasswordHashes implements the "password-hashes" subcommand and returns
+// the process exit code.
+func runPasswordHashes(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, passwordHashesUsage)
+		return 2
+	}
+
+	params, err := auth.HashParamsFromEnv()
+	if err == nil {
+		err = auth.UseHashParams(params)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid password hash settings: %v\n", err)
+		return 1
+	}
+
+	db, err := database.ConnectToDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to the database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	users, err := postgres.New(db).Users.List(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list users: %v\n", err)
+		return 1
+	}
+
+	type row struct {
+		info   auth.HashInfo
+		rehash bool
+		count  int
+	}
+	rows := map[auth.HashInfo]*row{}
+	for _, u := range users {
+		info := auth.DescribeHash(u.Password)
+		if rows[info] == nil {
+			rows[info] = &row{info: info, rehash: auth.NeedsRehash(u.Password)}
+		}
+		rows[info].count++
+	}
+	sorted := make([]*row, 0, len(rows))
+	for _, r := range rows {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].info.Algorithm != sorted[j].info.Algorithm {
+			return sorted[i].info.Algorithm < sorted[j].info.Algorithm
+		}
+		return sorted[i].info.Params < sorted[j].info.Params
+	})
+
+	fmt.Printf("Current policy: %s\n", describeHashParams(params))
+	fmt.Printf("Unknown emails timed against: %s\n\n", params.DummyAlgorithm)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ALGORITHM\tPARAMETERS\tACCOUNTS\tSTATUS")
+	for _, r := range sorted {
+		status := "current"
+		if r.rehash {
+			status = "rehash on login"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", r.info.Algorithm, r.info.Params, r.count, status)
+	}
+	tw.Flush()
+	fmt.Printf("\nTotal: %d account(s)\n", len(users))
+	return 0
+}
+
+func describeHashParams(p auth.HashParams) string {
+	if p.Algorithm == auth.AlgorithmBcrypt {
+		return fmt.Sprintf("bcrypt cost=%d", p.BcryptCost)
+	}
+	return fmt.Sprintf("argon2id m=%d,t=%d,p=%d", p.Argon2Memory, p.Argon2Time, p.Argon2Threads)
+}
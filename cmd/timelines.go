@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pinokiochan/social-network-render/internal/database"
+	"github.com/pinokiochan/social-network-render/internal/store/postgres"
+	"github.com/pinokiochan/social-network-render/internal/timeline"
+)
+
+const timelinesUsage = `usage: main timelines <command>
+
+commands:
+  backfill          build the home timelines that have not been built yet
+  rebuild [id...]   rebuild the timelines of the given users (default: all)
+  trim              keep only the newest TIMELINE_MAX_ENTRIES posts of each timeline`
+
+// runTimelines implements the "timelines" subcommand and returns the
+// process exit code.
+func runTimelines(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, timelinesUsage)
+		return 2
+	}
+	command := args[0]
+	if command != "backfill" && command != "rebuild" && command != "trim" {
+		fmt.Fprintln(os.Stderr, timelinesUsage)
+		return 2
+	}
+	if command != "rebuild" && len(args) > 1 {
+		fmt.Fprintln(os.Stderr, timelinesUsage)
+		return 2
+	}
+
+	var userIDs []int
+	for _, arg := range args[1:] {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid user ID: %q\n", arg)
+			return 2
+		}
+		userIDs = append(userIDs, id)
+	}
+
+	config, err := timeline.ConfigFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid timeline settings: %v\n", err)
+		return 1
+	}
+
+	db, err := database.ConnectToDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to the database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	st := postgres.New(db)
+	timelines := timeline.NewService(st, config, nil)
+
+	if len(userIDs) == 0 {
+		users, err := st.Users.List(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list users: %v\n", err)
+			return 1
+		}
+		for _, u := range users {
+			userIDs = append(userIDs, u.ID)
+		}
+	}
+
+	done, failed := 0, 0
+	for _, id := range userIDs {
+		switch command {
+		case "backfill":
+			built, err := st.Timelines.Built(ctx, id)
+			if err == nil && built {
+				continue
+			}
+			if err == nil {
+				err = timelines.Rebuild(ctx, id)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "User %d: %v\n", id, err)
+				failed++
+				continue
+			}
+			done++
+		case "rebuild":
+			if err := timelines.Rebuild(ctx, id); err != nil {
+				fmt.Fprintf(os.Stderr, "User %d: %v\n", id, err)
+				failed++
+				continue
+			}
+			done++
+		case "trim":
+			if err := st.Timelines.Trim(ctx, id, config.MaxEntries); err != nil {
+				fmt.Fprintf(os.Stderr, "User %d: %v\n", id, err)
+				failed++
+				continue
+			}
+			done++
+		}
+	}
+
+	fmt.Printf("Processed %d timeline(s), %d failed\n", done, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
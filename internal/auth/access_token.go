@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+// AccessTokenPrefix starts every personal access token so it can be told
+// apart from a session JWT in the Authorization header.
+const AccessTokenPrefix = "pat_"
+
+// Scopes that can be granted to personal access tokens. Routes declare the
+// scope they need; session tokens are not limited by scopes.
+const (
+	ScopeUsersRead     = "users:read"
+	ScopePostsRead     = "posts:read"
+	ScopePostsWrite    = "posts:write"
+	ScopeCommentsRead  = "comments:read"
+	ScopeCommentsWrite = "comments:write"
+	ScopeAdminRead     = "admin:read"
+	ScopeAdminWrite    = "admin:write"
+)
+
+// Scopes lists every known scope.
+var Scopes = []string{
+	ScopeUsersRead,
+	ScopePostsRead,
+	ScopePostsWrite,
+	ScopeCommentsRead,
+	ScopeCommentsWrite,
+	ScopeAdminRead,
+	ScopeAdminWrite,
+}
+
+// accessTokenTouchInterval limits how often last_used_at is written for a
+// token that is used continuously.
+const accessTokenTouchInterval = time.Minute
+
+// ErrInvalidAccessToken is returned for unknown, revoked or expired personal
+// access tokens and for tokens whose owner no longer exists.
+var ErrInvalidAccessToken = errors.New("invalid personal access token")
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdminScope reports whether the scope grants access to admin routes.
+func IsAdminScope(scope string) bool {
+	return strings.HasPrefix(scope, "admin:")
+}
+
+// adminScopePermissions lists the permissions of the admin routes each admin
+// scope opens: the GET routes for admin:read and the others for admin:write.
+var adminScopePermissions = map[string][]string{
+	ScopeAdminRead: {
+		models.PermStatsRead, models.PermUsersRead, models.PermUsersImpersonate, models.PermInvitesManage,
+	},
+	ScopeAdminWrite: {
+		models.PermUsersEdit, models.PermUsersDelete, models.PermUsersRevokeSessions, models.PermEmailBroadcast,
+		models.PermUsersImpersonate, models.PermInvitesManage, models.PermRolesManage,
+	},
+}
+
+// IsAccessToken reports whether the bearer token looks like a personal
+// access token rather than a JWT.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// CreateAccessToken generates a personal access token for the user and
+// stores its hash. The returned plain token is not recoverable later.
+func (m *SessionManager) CreateAccessToken(ctx context.Context, t *models.PersonalAccessToken) (string, error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := AccessTokenPrefix + secret
+
+	t.TokenHash = HashToken(token)
+	t.Prefix = token[:len(AccessTokenPrefix)+6]
+	if err := m.store.AccessTokens.Create(ctx, t); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ValidateAccessToken resolves a personal access token to claims for its
+// owner. The claims carry the token's scopes, and IsAdmin and Role reflect the
+// owner's current role rather than the role at creation time.
+func (m *SessionManager) ValidateAccessToken(ctx context.Context, token string) (*Claims, error) {
+	t, err := m.store.AccessTokens.GetByHash(ctx, HashToken(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !t.Active(now) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	user, err := m.store.Users.GetByID(ctx, t.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > accessTokenTouchInterval {
+		if err := m.store.AccessTokens.Touch(ctx, t.ID, now); err != nil {
+			logger.ErrorLogger(err, logger.Fields{
+				"error":    "Failed to update personal access token last use",
+				"token_id": t.ID,
+			})
+		}
+	}
+
+	scopes := t.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &Claims{
+		UserID:        user.ID,
+		IsAdmin:       user.IsAdmin,
+		Role:          user.Role,
+		AccessTokenID: t.ID,
+		Scopes:        scopes,
+	}, nil
+}
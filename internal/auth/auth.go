@@ -5,54 +5,86 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/pinokiochan/social-network-render/internal/models"
 )
 
-var JwtKey = []byte("your_secret_key") // В продакшн используйте переменную окружения для ключа
+// Время жизни access-токена; для продления используется refresh-токен сессии
+const AccessTokenTTL = 15 * time.Minute
 
 // Структура Claims для JWT
 type Claims struct {
-	UserID  int  `json:"user_id"`
-	IsAdmin bool `json:"is_admin"`
+	UserID       int    `json:"user_id"`
+	IsAdmin      bool   `json:"is_admin"`
+	Role         string `json:"role,omitempty"`
+	SessionID    string `json:"sid,omitempty"`
+	TokenVersion int    `json:"ver"`
+	// Сессия открыта с вторым фактором (TOTP или код восстановления)
+	MFA bool `json:"mfa,omitempty"`
+	// Токен имперсонации: ID администратора, действующего от имени UserID,
+	// и запрет изменяющих запросов
+	Impersonator int  `json:"imp,omitempty"`
+	ReadOnly     bool `json:"ro,omitempty"`
+	// Заполняются только для personal access token, в JWT не попадают
+	AccessTokenID int      `json:"-"`
+	Scopes        []string `json:"-"`
 	jwt.StandardClaims
 }
 
-// Функция хэширования пароля
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+// IsImpersonation сообщает, выдан ли токен администратору от имени пользователя
+func (c *Claims) IsImpersonation() bool {
+	return c.Impersonator != 0
 }
 
-// Функция для проверки хэшированного пароля
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// IsAccessToken сообщает, получены ли claims из personal access token
+func (c *Claims) IsAccessToken() bool {
+	return c.AccessTokenID != 0
 }
 
-// Функция генерации токена
-func GenerateToken(userID int, isAdmin bool) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// HasScope проверяет право доступа; сессионные токены не ограничены scope
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsAccessToken() {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Функция генерации access-токена, привязанного к сессии
+func GenerateToken(user *models.User, session *models.Session) (string, error) {
+	tokenID, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := &Claims{
-		UserID:  userID,
-		IsAdmin: isAdmin,
+		UserID:       user.ID,
+		IsAdmin:      user.IsAdmin,
+		Role:         user.Role,
+		SessionID:    session.ID,
+		TokenVersion: user.TokenVersion,
+		MFA:          session.MFA,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			Id:        tokenID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(AccessTokenTTL).Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JwtKey)
+	// Подпись текущим ключом из keyring, с заголовком kid
+	return Keys().Sign(claims)
 }
 
 // Функция для верификации токена
 func VerifyToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return JwtKey, nil
-	})
+	// Ключ выбирается по kid; alg токена должен совпадать с алгоритмом ключа
+	token, err := jwt.ParseWithClaims(tokenString, claims, Keys().Keyfunc)
 
 	if err != nil {
 		return nil, err
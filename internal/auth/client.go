@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// Client describes the device a request comes from. New sessions record
+// it, and the session's last-seen address follows it.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+// maxUserAgentLength matches the sessions.user_agent column.
+const maxUserAgentLength = 512
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx carrying c.
+func WithClient(ctx context.Context, c Client) context.Context {
+	// Postgres rejects invalid UTF-8, so a cut must not split a rune.
+	c.UserAgent = strings.ToValidUTF8(c.UserAgent, "")
+	if len(c.UserAgent) > maxUserAgentLength {
+		end := maxUserAgentLength
+		for end > 0 && !utf8.RuneStart(c.UserAgent[end]) {
+			end--
+		}
+		c.UserAgent = c.UserAgent[:end]
+	}
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// ClientFrom returns the client stored by WithClient, or a zero Client.
+func ClientFrom(ctx context.Context) Client {
+	c, _ := ctx.Value(clientKey{}).(Client)
+	return c
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+// ImpersonationTTL is the lifetime of an impersonation token. There is no
+// refresh token: the admin starts a new impersonation when it expires.
+const ImpersonationTTL = 10 * time.Minute
+
+// Impersonate issues an access token that acts as target on behalf of the
+// admin adminID signed in with sessionID. The token belongs to that session,
+// so it stops working when that session is revoked, and to the target's
+// token version, so "log out everywhere" of the target ends it too. A
+// read-only token is refused for anything but GET and HEAD requests.
+func (m *SessionManager) Impersonate(ctx context.Context, adminID int, sessionID string, target *models.User, readOnly bool) (string, time.Time, error) {
+	tokenID, err := RandomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ImpersonationTTL)
+	claims := &Claims{
+		UserID:       target.ID,
+		IsAdmin:      target.IsAdmin,
+		Role:         target.Role,
+		SessionID:    sessionID,
+		TokenVersion: target.TokenVersion,
+		Impersonator: adminID,
+		ReadOnly:     readOnly,
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+	token, err := Keys().Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// RecordImpersonation appends an entry to the impersonation audit log.
+func (m *SessionManager) RecordImpersonation(ctx context.Context, event *models.ImpersonationEvent) error {
+	return m.store.Impersonation.Record(ctx, event)
+}
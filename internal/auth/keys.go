@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Signing algorithms supported for access tokens.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minHMACKeyLength is the shortest accepted HS256 secret, in bytes.
+const minHMACKeyLength = 32
+
+var (
+	// ErrUnknownKey is returned for tokens whose kid is not in the keyring.
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrAlgorithmMismatch is returned for tokens whose alg header does not
+	// match the algorithm of the key named by kid.
+	ErrAlgorithmMismatch = errors.New("signing algorithm does not match key")
+)
+
+// SigningKey is a key in the keyring. Retired keys, and keys configured as a
+// public key only, can verify tokens but not sign them.
+type SigningKey struct {
+	// ID is the kid header; it is derived from the key material so the same
+	// key always gets the same ID.
+	ID        string
+	Algorithm string
+
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign reports whether the key holds private material.
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+// KeyManager signs access tokens with the current key and verifies them
+// against the current key and any retired keys.
+type KeyManager struct {
+	current *SigningKey
+	keys    map[string]*SigningKey
+	order   []string
+}
+
+// NewKeyManager builds a keyring. current must be able to sign; retired keys
+// are only used for verification.
+func NewKeyManager(current *SigningKey, retired ...*SigningKey) (*KeyManager, error) {
+	if current == nil || !current.CanSign() {
+		return nil, errors.New("current signing key must include a private key or secret")
+	}
+	m := &KeyManager{current: current, keys: make(map[string]*SigningKey)}
+	for _, k := range append([]*SigningKey{current}, retired...) {
+		if _, ok := m.keys[k.ID]; ok {
+			continue
+		}
+		m.keys[k.ID] = k
+		m.order = append(m.order, k.ID)
+	}
+	return m, nil
+}
+
+// Current returns the key new tokens are signed with.
+func (m *KeyManager) Current() *SigningKey {
+	return m.current
+}
+
+// Sign signs claims with the current key and stamps its kid header.
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.current.method, claims)
+	token.Header["kid"] = m.current.ID
+	return token.SignedString(m.current.signKey)
+}
+
+// Keyfunc resolves the verification key for a parsed token by its kid and
+// rejects tokens whose alg header differs from the key's algorithm.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys of the keyring. HS256 secrets are never
+// published, so a keyring of HMAC keys has an empty set.
+func (m *KeyManager) JWKS() []JWK {
+	keys := []JWK{}
+	for _, kid := range m.order {
+		k := m.keys[kid]
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "RSA", Kid: k.ID, Use: "sig", Alg: k.Algorithm,
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "OKP", Kid: k.ID, Use: "sig", Alg: k.Algorithm,
+				Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return keys
+}
+
+// ParseSigningKey reads key material: a PEM encoded RSA or Ed25519 private
+// key (signing), a PEM encoded public key (verification only) or, for
+// anything that is not PEM, an HS256 secret of at least 32 bytes.
+func ParseSigningKey(data []byte) (*SigningKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if key, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			return newRSAKey(key, &key.PublicKey)
+		}
+		if key, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			priv, ok := key.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("unsupported private key type")
+			}
+			return newEdDSAKey(priv, priv.Public().(ed25519.PublicKey))
+		}
+		if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			return newRSAKey(nil, key)
+		}
+		if key, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+			pub, ok := key.(ed25519.PublicKey)
+			if !ok {
+				return nil, errors.New("unsupported public key type")
+			}
+			return newEdDSAKey(nil, pub)
+		}
+		return nil, fmt.Errorf("unsupported PEM block %q: expected an RSA or Ed25519 key", block.Type)
+	}
+	return NewHMACKey(data)
+}
+
+// NewHMACKey returns an HS256 key for secret.
+func NewHMACKey(secret []byte) (*SigningKey, error) {
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) < minHMACKeyLength {
+		return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minHMACKeyLength)
+	}
+	return &SigningKey{
+		ID:        keyID([]byte("HS256:"), secret),
+		Algorithm: AlgHS256,
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}, nil
+}
+
+func newRSAKey(priv *rsa.PrivateKey, pub *rsa.PublicKey) (*SigningKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	k := &SigningKey{ID: keyID(der), Algorithm: AlgRS256, method: jwt.SigningMethodRS256, verifyKey: pub}
+	if priv != nil {
+		k.signKey = priv
+	}
+	return k, nil
+}
+
+func newEdDSAKey(priv ed25519.PrivateKey, pub ed25519.PublicKey) (*SigningKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	k := &SigningKey{ID: keyID(der), Algorithm: AlgEdDSA, method: jwt.SigningMethodEdDSA, verifyKey: pub}
+	if priv != nil {
+		k.signKey = crypto.PrivateKey(priv)
+	}
+	return k, nil
+}
+
+// keyID derives a stable kid from public key material (or a hashed secret).
+func keyID(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// LoadKeysFromEnv builds the keyring from the environment:
+//
+//	JWT_SIGNING_KEY or JWT_SIGNING_KEY_FILE  the current key
+//	JWT_RETIRED_KEY_FILES                    comma-separated files with keys
+//	                                         that still verify old tokens
+//
+// Without a configured key an ephemeral HS256 secret is generated, so tokens
+// do not survive a restart; the second return value reports this.
+func LoadKeysFromEnv() (*KeyManager, bool, error) {
+	data := []byte(os.Getenv("JWT_SIGNING_KEY"))
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		var err error
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, false, fmt.Errorf("reading JWT_SIGNING_KEY_FILE: %w", err)
+		}
+	}
+
+	ephemeral := len(data) == 0
+	var current *SigningKey
+	var err error
+	if ephemeral {
+		current, err = generateHMACKey()
+	} else {
+		current, err = ParseSigningKey(data)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("current signing key: %w", err)
+	}
+
+	var retired []*SigningKey
+	for _, path := range strings.Split(os.Getenv("JWT_RETIRED_KEY_FILES"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, false, fmt.Errorf("reading retired key: %w", err)
+		}
+		key, err := ParseSigningKey(data)
+		if err != nil {
+			return nil, false, fmt.Errorf("retired key %s: %w", path, err)
+		}
+		retired = append(retired, key)
+	}
+
+	m, err := NewKeyManager(current, retired...)
+	return m, ephemeral, err
+}
+
+func generateHMACKey() (*SigningKey, error) {
+	secret := make([]byte, 48)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return NewHMACKey([]byte(base64.RawURLEncoding.EncodeToString(secret)))
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   *KeyManager
+)
+
+// UseKeys installs the keyring used by GenerateToken and VerifyToken.
+func UseKeys(m *KeyManager) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = m
+}
+
+// Keys returns the installed keyring. If none was installed, for example in
+// tests, an ephemeral HS256 keyring is created on first use.
+func Keys() *KeyManager {
+	keysMu.RLock()
+	m := keys
+	keysMu.RUnlock()
+	if m != nil {
+		return m
+	}
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if keys == nil {
+		key, err := generateHMACKey()
+		if err != nil {
+			panic("auth: generating signing key: " + err.Error())
+		}
+		keys, _ = NewKeyManager(key)
+	}
+	return keys
+}
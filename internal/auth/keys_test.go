@@ -0,0 +1,164 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+func pemKey(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+func rsaKeys(t *testing.T) (private, public []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey returned error: %v", err)
+	}
+	pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return pemKey("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)), pemKey("PUBLIC KEY", pub)
+}
+
+func edKeys(t *testing.T) (private, public []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey returned error: %v", err)
+	}
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	return pemKey("PRIVATE KEY", privDER), pemKey("PUBLIC KEY", pubDER)
+}
+
+func mustKey(t *testing.T, data []byte) *auth.SigningKey {
+	key, err := auth.ParseSigningKey(data)
+	if err != nil {
+		t.Fatalf("ParseSigningKey returned error: %v", err)
+	}
+	return key
+}
+
+func sign(t *testing.T, keys *auth.KeyManager) string {
+	token, err := keys.Sign(&auth.Claims{
+		UserID:         1,
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	})
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	return token
+}
+
+func verify(keys *auth.KeyManager, token string) error {
+	_, err := jwt.ParseWithClaims(token, &auth.Claims{}, keys.Keyfunc)
+	return err
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaPrivate, rsaPublic := rsaKeys(t)
+	edPrivate, _ := edKeys(t)
+
+	for _, data := range [][]byte{rsaPrivate, edPrivate, []byte("an HS256 secret that is long enough")} {
+		key := mustKey(t, data)
+		keys, err := auth.NewKeyManager(key)
+		if err != nil {
+			t.Fatalf("NewKeyManager returned error: %v", err)
+		}
+		token := sign(t, keys)
+		if err := verify(keys, token); err != nil {
+			t.Errorf("%s token does not verify: %v", key.Algorithm, err)
+		}
+	}
+
+	// Tokens signed with a retired key keep working until the key is dropped.
+	old, _ := auth.NewKeyManager(mustKey(t, rsaPrivate))
+	oldToken := sign(t, old)
+	rotated, err := auth.NewKeyManager(mustKey(t, edPrivate), mustKey(t, rsaPublic))
+	if err != nil {
+		t.Fatalf("NewKeyManager returned error: %v", err)
+	}
+	if rotated.Current().Algorithm != auth.AlgEdDSA {
+		t.Fatalf("current algorithm = %s, want EdDSA", rotated.Current().Algorithm)
+	}
+	if err := verify(rotated, oldToken); err != nil {
+		t.Fatalf("token of retired key does not verify: %v", err)
+	}
+	dropped, _ := auth.NewKeyManager(mustKey(t, edPrivate))
+	if err := verify(dropped, oldToken); err == nil {
+		t.Fatal("token of a removed key still verifies")
+	}
+
+	// A public key cannot become the signing key.
+	if _, err := auth.NewKeyManager(mustKey(t, rsaPublic)); err == nil {
+		t.Error("NewKeyManager accepted a verification-only key")
+	}
+	if _, err := auth.ParseSigningKey([]byte("short")); err == nil {
+		t.Error("ParseSigningKey accepted a short HS256 secret")
+	}
+}
+
+func TestKeyfuncRejectsAlgorithmConfusion(t *testing.T) {
+	_, rsaPublic := rsaKeys(t)
+	key := mustKey(t, rsaPublic)
+	keys, _ := auth.NewKeyManager(mustKey(t, []byte("an HS256 secret that is long enough")), key)
+
+	// An HS256 token "signed" with the RSA public key as HMAC secret.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{UserID: 1})
+	forged.Header["kid"] = key.ID
+	token, err := forged.SignedString(rsaPublic)
+	if err != nil {
+		t.Fatalf("SignedString returned error: %v", err)
+	}
+	err = verify(keys, token)
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) || !errors.Is(validationErr.Inner, auth.ErrAlgorithmMismatch) {
+		t.Fatalf("verify = %v, want ErrAlgorithmMismatch", err)
+	}
+}
+
+func TestJWKSPublishesOnlyPublicKeys(t *testing.T) {
+	rsaPrivate, _ := rsaKeys(t)
+	_, edPublic := edKeys(t)
+	hmac := mustKey(t, []byte("an HS256 secret that is long enough"))
+
+	keys, _ := auth.NewKeyManager(mustKey(t, rsaPrivate), mustKey(t, edPublic), hmac)
+	jwks := keys.JWKS()
+	if len(jwks) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(jwks))
+	}
+	if jwks[0].Kty != "RSA" || jwks[0].Kid != keys.Current().ID || jwks[0].N == "" || jwks[0].E != "AQAB" {
+		t.Errorf("unexpected RSA key: %+v", jwks[0])
+	}
+	if jwks[1].Kty != "OKP" || jwks[1].Crv != "Ed25519" || jwks[1].X == "" {
+		t.Errorf("unexpected Ed25519 key: %+v", jwks[1])
+	}
+}
+
+func TestGenerateTokenUsesInstalledKeys(t *testing.T) {
+	edPrivate, _ := edKeys(t)
+	keys, _ := auth.NewKeyManager(mustKey(t, edPrivate))
+	previous := auth.Keys()
+	auth.UseKeys(keys)
+	t.Cleanup(func() { auth.UseKeys(previous) })
+
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	token, err := auth.GenerateToken(user, &models.Session{ID: "sid"})
+	if err != nil {
+		t.Fatalf("GenerateToken returned error: %v", err)
+	}
+	parsed, _, _ := new(jwt.Parser).ParseUnverified(token, &auth.Claims{})
+	if parsed.Header["kid"] != keys.Current().ID || parsed.Method.Alg() != auth.AlgEdDSA {
+		t.Errorf("unexpected header: %v", parsed.Header)
+	}
+	if _, err := auth.VerifyToken(token); err != nil {
+		t.Errorf("VerifyToken returned error: %v", err)
+	}
+}
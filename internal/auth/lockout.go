@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+// LockoutPolicy describes how failed logins slow down further attempts.
+type LockoutPolicy struct {
+	// FreeAttempts failures are allowed without any delay.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure beyond FreeAttempts. It
+	// doubles with every further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockAfter failures lock out further attempts for LockDuration. Zero
+	// disables locking.
+	LockAfter    int
+	LockDuration time.Duration
+	// ResetAfter without failures forgets the earlier ones.
+	ResetAfter time.Duration
+}
+
+var (
+	// DefaultAccountPolicy applies per account, and per email address for
+	// addresses without an account so both behave the same.
+	DefaultAccountPolicy = LockoutPolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockAfter:    10,
+		LockDuration: 30 * time.Minute,
+		ResetAfter:   24 * time.Hour,
+	}
+	// DefaultIPPolicy applies per client IP, across all accounts it tries.
+	DefaultIPPolicy = LockoutPolicy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+)
+
+// wait returns how long to wait after failures, the last one at last, before
+// another attempt is evaluated.
+func (p LockoutPolicy) wait(failures int, last, now time.Time) time.Duration {
+	if failures < p.FreeAttempts || now.Sub(last) >= p.ResetAfter {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if remaining := last.Add(delay).Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// failureCounter tracks failures of a client IP or of an email address
+// without an account.
+type failureCounter struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// LoginGuard slows down password guessing. Failures are counted per account
+// in the store, so lockouts survive restarts, and per client IP in memory.
+type LoginGuard struct {
+	store   *store.Store
+	account LockoutPolicy
+	ip      LockoutPolicy
+
+	mu       sync.Mutex
+	counters map[string]*failureCounter
+}
+
+func NewLoginGuard(s *store.Store) *LoginGuard {
+	return NewLoginGuardWithPolicy(s, DefaultAccountPolicy, DefaultIPPolicy)
+}
+
+func NewLoginGuardWithPolicy(s *store.Store, account, ip LockoutPolicy) *LoginGuard {
+	return &LoginGuard{store: s, account: account, ip: ip, counters: make(map[string]*failureCounter)}
+}
+
+// Check returns how long the client must wait before a login for email is
+// evaluated; zero means go ahead. user is nil when no account has the email.
+func (g *LoginGuard) Check(ctx context.Context, user *models.User, email, ip string) (time.Duration, error) {
+	now := time.Now()
+	wait := g.counterWait(g.ip, "ip:"+ip, now)
+
+	var accountWait time.Duration
+	if user == nil {
+		accountWait = g.counterWait(g.account, emailKey(email), now)
+	} else {
+		f, err := g.store.LoginFailures.Get(ctx, user.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return 0, err
+		}
+		if err == nil {
+			if f.Locked(now) {
+				accountWait = f.LockedUntil.Sub(now)
+			} else {
+				accountWait = g.account.wait(f.Failures, f.LastFailedAt, now)
+			}
+		}
+	}
+	if accountWait > wait {
+		wait = accountWait
+	}
+	return wait, nil
+}
+
+// Fail records a failed login. It returns the lock expiry when this failure
+// locked the account, and nil otherwise; the caller notifies the owner.
+func (g *LoginGuard) Fail(ctx context.Context, user *models.User, email, ip string) (*time.Time, error) {
+	now := time.Now()
+	g.recordCounter(g.ip, "ip:"+ip, now)
+	if user == nil {
+		g.recordCounter(g.account, emailKey(email), now)
+		return nil, nil
+	}
+
+	f, err := g.store.LoginFailures.RecordFailure(ctx, user.ID, now, now.Add(-g.account.ResetAfter))
+	if err != nil {
+		return nil, err
+	}
+	if g.account.LockAfter == 0 || f.Failures < g.account.LockAfter {
+		return nil, nil
+	}
+	// Every failure past the threshold locks again, so after a lockout the
+	// account allows one guess per LockDuration. Only the first lock of a
+	// streak is reported.
+	until := now.Add(g.account.LockDuration)
+	if err := g.store.LoginFailures.Lock(ctx, user.ID, until); err != nil {
+		return nil, err
+	}
+	if f.Failures == g.account.LockAfter {
+		return &until, nil
+	}
+	return nil, nil
+}
+
+// Succeed forgets the failures of the account after a correct password.
+// The IP counter is kept: one valid account does not vouch for guesses at
+// others.
+func (g *LoginGuard) Succeed(ctx context.Context, user *models.User) error {
+	return g.store.LoginFailures.Reset(ctx, user.ID)
+}
+
+func (g *LoginGuard) counterWait(policy LockoutPolicy, key string, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, ok := g.counters[key]
+	if !ok {
+		return 0
+	}
+	if now.Before(c.lockedUntil) {
+		return c.lockedUntil.Sub(now)
+	}
+	return policy.wait(c.failures, c.last, now)
+}
+
+func (g *LoginGuard) recordCounter(policy LockoutPolicy, key string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.counters) >= rateLimiterSweepSize {
+		for k, c := range g.counters {
+			if now.Sub(c.last) >= g.ip.ResetAfter && now.Sub(c.last) >= g.account.ResetAfter {
+				delete(g.counters, k)
+			}
+		}
+	}
+	c, ok := g.counters[key]
+	if !ok || now.Sub(c.last) >= policy.ResetAfter {
+		c = &failureCounter{}
+		g.counters[key] = c
+	}
+	c.failures++
+	c.last = now
+	if policy.LockAfter > 0 && c.failures >= policy.LockAfter {
+		c.lockedUntil = now.Add(policy.LockDuration)
+	}
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+var (
+	dummyHashesMu sync.Mutex
+	dummyHashes   = map[HashParams]string{}
+)
+
+// CheckPasswordDummy spends the same time as CheckPasswordHash for a login
+// with an unknown email, so response timing does not reveal which accounts
+// exist. It compares against a hash made with HashParams.DummyAlgorithm,
+// which should be the algorithm of most stored hashes. It always fails.
+func CheckPasswordDummy(password string) error {
+	p := currentHashParams()
+	p.Algorithm = p.DummyAlgorithm
+
+	dummyHashesMu.Lock()
+	hash, ok := dummyHashes[p]
+	if !ok {
+		hash, _ = hashPassword("dummy password for unknown accounts", p)
+		dummyHashes[p] = hash
+	}
+	dummyHashesMu.Unlock()
+
+	CheckPasswordHash(password, hash)
+	return errors.New("unknown account")
+}
@@ -0,0 +1,98 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestLoginGuardBacksOffAndLocks(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	st.Users.Create(ctx, user)
+
+	account := auth.LockoutPolicy{
+		FreeAttempts: 2,
+		BaseDelay:    time.Hour,
+		MaxDelay:     4 * time.Hour,
+		LockAfter:    4,
+		LockDuration: 24 * time.Hour,
+		ResetAfter:   48 * time.Hour,
+	}
+	guard := auth.NewLoginGuardWithPolicy(st, account, auth.DefaultIPPolicy)
+
+	for i := 1; i <= 3; i++ {
+		lockedUntil, err := guard.Fail(ctx, user, user.Email, "10.0.0.1")
+		if err != nil || lockedUntil != nil {
+			t.Fatalf("Fail #%d = %v, %v; want no lock", i, lockedUntil, err)
+		}
+		wait, err := guard.Check(ctx, user, user.Email, "10.0.0.2")
+		if err != nil {
+			t.Fatalf("Check returned error: %v", err)
+		}
+		// Two free attempts, then one hour doubling per failure.
+		want := time.Duration(0)
+		if i >= 2 {
+			want = time.Hour << uint(i-2)
+		}
+		if wait > want || wait < want-time.Minute {
+			t.Errorf("after %d failures wait = %v, want about %v", i, wait, want)
+		}
+	}
+
+	lockedUntil, err := guard.Fail(ctx, user, user.Email, "10.0.0.1")
+	if err != nil || lockedUntil == nil {
+		t.Fatalf("fourth failure = %v, %v; want a lock", lockedUntil, err)
+	}
+	if wait, _ := guard.Check(ctx, user, user.Email, "10.0.0.2"); wait < 23*time.Hour {
+		t.Errorf("locked account wait = %v, want about 24h", wait)
+	}
+	// Failures while locked extend the lock but are not reported again.
+	if lockedUntil, _ := guard.Fail(ctx, user, user.Email, "10.0.0.1"); lockedUntil != nil {
+		t.Errorf("second lock of the same streak reported: %v", lockedUntil)
+	}
+
+	if err := guard.Succeed(ctx, user); err != nil {
+		t.Fatalf("Succeed returned error: %v", err)
+	}
+	if wait, _ := guard.Check(ctx, user, user.Email, "10.0.0.2"); wait != 0 {
+		t.Errorf("wait after reset = %v, want 0", wait)
+	}
+}
+
+func TestLoginGuardUnknownEmailAndIP(t *testing.T) {
+	ctx := context.Background()
+	policy := auth.LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Hour, MaxDelay: time.Hour, ResetAfter: time.Hour}
+	guard := auth.NewLoginGuardWithPolicy(memory.New(), policy, policy)
+
+	// An unknown email is throttled like an account, case-insensitively.
+	if _, err := guard.Fail(ctx, nil, "Nobody@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Fail returned error: %v", err)
+	}
+	if wait, _ := guard.Check(ctx, nil, "nobody@example.com", "10.0.0.9"); wait == 0 {
+		t.Error("unknown email not throttled")
+	}
+	// The IP is throttled for every email it tries.
+	if wait, _ := guard.Check(ctx, nil, "other@example.com", "10.0.0.1"); wait == 0 {
+		t.Error("IP not throttled")
+	}
+	if wait, _ := guard.Check(ctx, nil, "other@example.com", "10.0.0.9"); wait != 0 {
+		t.Errorf("unrelated email and IP wait = %v, want 0", wait)
+	}
+}
+
+func TestCheckPasswordDummyAlwaysFails(t *testing.T) {
+	for _, alg := range []string{auth.AlgorithmBcrypt, auth.AlgorithmArgon2id} {
+		params := auth.DefaultHashParams
+		params.DummyAlgorithm = alg
+		useHashParams(t, params)
+		if err := auth.CheckPasswordDummy("dummy password for unknown accounts"); err == nil {
+			t.Errorf("%s: CheckPasswordDummy accepted a password", alg)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash algorithms. Hashes are stored in their self-describing
+// standard formats: bcrypt's "$2a$<cost>$..." and the PHC string
+// "$argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<key>", so every
+// hash records the algorithm and parameters it was made with.
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// HashParams selects the algorithm and cost of new password hashes.
+type HashParams struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2id parameters: passes over memory, memory in KiB and lanes.
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+	Argon2KeyLen  uint32
+	Argon2SaltLen uint32
+	// DummyAlgorithm is the algorithm logins with an unknown email are timed
+	// against. It should match most stored hashes, so it stays bcrypt until
+	// the accounts hashed before argon2id have been upgraded.
+	DummyAlgorithm string
+}
+
+// DefaultHashParams follows the OWASP recommendation for argon2id.
+var DefaultHashParams = HashParams{
+	Algorithm:     AlgorithmArgon2id,
+	BcryptCost:    bcrypt.DefaultCost,
+	Argon2Time:    2,
+	Argon2Memory:  19 * 1024,
+	Argon2Threads: 1,
+	Argon2KeyLen:  32,
+	Argon2SaltLen: 16,
+
+	DummyAlgorithm: AlgorithmBcrypt,
+}
+
+// HashParamsFromEnv returns DefaultHashParams adjusted by
+// PASSWORD_HASH_ALGORITHM (bcrypt or argon2id), PASSWORD_BCRYPT_COST,
+// PASSWORD_ARGON2_TIME, PASSWORD_ARGON2_MEMORY_KIB,
+// PASSWORD_ARGON2_THREADS and PASSWORD_DUMMY_HASH_ALGORITHM.
+func HashParamsFromEnv() (HashParams, error) {
+	params := DefaultHashParams
+	if alg := os.Getenv("PASSWORD_HASH_ALGORITHM"); alg != "" {
+		params.Algorithm = alg
+	}
+	if alg := os.Getenv("PASSWORD_DUMMY_HASH_ALGORITHM"); alg != "" {
+		params.DummyAlgorithm = alg
+	}
+
+	number := func(name string, min, max int) (int, bool, error) {
+		value := os.Getenv(name)
+		if value == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			return 0, false, fmt.Errorf("%s must be a number between %d and %d", name, min, max)
+		}
+		return n, true, nil
+	}
+	if n, ok, err := number("PASSWORD_BCRYPT_COST", bcrypt.MinCost, bcrypt.MaxCost); err != nil {
+		return params, err
+	} else if ok {
+		params.BcryptCost = n
+	}
+	if n, ok, err := number("PASSWORD_ARGON2_TIME", 1, 100); err != nil {
+		return params, err
+	} else if ok {
+		params.Argon2Time = uint32(n)
+	}
+	if n, ok, err := number("PASSWORD_ARGON2_MEMORY_KIB", 8, 4*1024*1024); err != nil {
+		return params, err
+	} else if ok {
+		params.Argon2Memory = uint32(n)
+	}
+	if n, ok, err := number("PASSWORD_ARGON2_THREADS", 1, 255); err != nil {
+		return params, err
+	} else if ok {
+		params.Argon2Threads = uint8(n)
+	}
+	return params, params.validate()
+}
+
+func (p HashParams) validate() error {
+	for _, alg := range []string{p.Algorithm, p.DummyAlgorithm} {
+		if alg != AlgorithmBcrypt && alg != AlgorithmArgon2id {
+			return fmt.Errorf("unsupported password hash algorithm %q", alg)
+		}
+	}
+	return nil
+}
+
+var (
+	hashParamsMu sync.RWMutex
+	hashParams   = DefaultHashParams
+)
+
+// UseHashParams sets the parameters of hashes made by HashPassword and the
+// policy NeedsRehash compares stored hashes with.
+func UseHashParams(p HashParams) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	hashParamsMu.Lock()
+	defer hashParamsMu.Unlock()
+	hashParams = p
+	return nil
+}
+
+func currentHashParams() HashParams {
+	hashParamsMu.RLock()
+	defer hashParamsMu.RUnlock()
+	return hashParams
+}
+
+// HashPassword hashes password with the current HashParams.
+func HashPassword(password string) (string, error) {
+	return hashPassword(password, currentHashParams())
+}
+
+func hashPassword(password string, p HashParams) (string, error) {
+	if p.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, p.Argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, p.Argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Argon2Memory, p.Argon2Time, p.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPasswordHash compares password with a hash in any supported format.
+func CheckPasswordHash(password, hash string) error {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+
+	h, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	if subtle.ConstantTimeCompare(key, h.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// HashInfo describes the algorithm and parameters of a stored hash.
+type HashInfo struct {
+	Algorithm string
+	// Params is a short description such as "cost=10" or "m=19456,t=2,p=1".
+	Params string
+}
+
+// DescribeHash returns what hash was made with. Hashes that are not in a
+// supported format are reported with Algorithm "unknown".
+func DescribeHash(hash string) HashInfo {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		h, err := parseArgon2id(hash)
+		if err != nil {
+			return HashInfo{Algorithm: "unknown"}
+		}
+		return HashInfo{Algorithm: AlgorithmArgon2id, Params: fmt.Sprintf("m=%d,t=%d,p=%d", h.memory, h.time, h.threads)}
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return HashInfo{Algorithm: "unknown"}
+	}
+	return HashInfo{Algorithm: AlgorithmBcrypt, Params: fmt.Sprintf("cost=%d", cost)}
+}
+
+// NeedsRehash reports whether hash should be replaced by a new one because
+// it uses another algorithm than the current HashParams, or weaker
+// parameters.
+func NeedsRehash(hash string) bool {
+	p := currentHashParams()
+	if p.Algorithm == AlgorithmBcrypt {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost < p.BcryptCost
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return true
+	}
+	h, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return h.memory < p.Argon2Memory || h.time < p.Argon2Time || h.threads < p.Argon2Threads ||
+		uint32(len(h.key)) < p.Argon2KeyLen || uint32(len(h.salt)) < p.Argon2SaltLen
+}
+
+type argon2idHash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+var errMalformedHash = errors.New("malformed argon2id hash")
+
+func parseArgon2id(hash string) (*argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errMalformedHash
+	}
+	h := &argon2idHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, errMalformedHash
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errMalformedHash
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, errMalformedHash
+	}
+	if h.time == 0 || h.threads == 0 {
+		return nil, errMalformedHash
+	}
+	return h, nil
+}
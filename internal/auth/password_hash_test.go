@@ -0,0 +1,82 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func useHashParams(t *testing.T, p auth.HashParams) {
+	if err := auth.UseHashParams(p); err != nil {
+		t.Fatalf("UseHashParams returned error: %v", err)
+	}
+	t.Cleanup(func() { auth.UseHashParams(auth.DefaultHashParams) })
+}
+
+func TestHashPasswordAlgorithms(t *testing.T) {
+	for _, alg := range []string{auth.AlgorithmArgon2id, auth.AlgorithmBcrypt} {
+		params := auth.DefaultHashParams
+		params.Algorithm = alg
+		params.BcryptCost = bcrypt.MinCost
+		useHashParams(t, params)
+
+		hash, err := auth.HashPassword("correct horse battery staple")
+		if err != nil {
+			t.Fatalf("%s: HashPassword returned error: %v", alg, err)
+		}
+		if info := auth.DescribeHash(hash); info.Algorithm != alg {
+			t.Errorf("%s: DescribeHash(%q) = %+v", alg, hash, info)
+		}
+		if err := auth.CheckPasswordHash("correct horse battery staple", hash); err != nil {
+			t.Errorf("%s: correct password rejected: %v", alg, err)
+		}
+		if err := auth.CheckPasswordHash("wrong horse battery staple", hash); err == nil {
+			t.Errorf("%s: wrong password accepted", alg)
+		}
+		if auth.NeedsRehash(hash) {
+			t.Errorf("%s: fresh hash needs rehash", alg)
+		}
+	}
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	useHashParams(t, auth.DefaultHashParams)
+	hash, _ := auth.HashPassword("secret")
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("unexpected hash format %q", hash)
+	}
+	for _, malformed := range []string{"$argon2id$v=19$m=1,t=1,p=1$c2FsdA", "$argon2id$v=18$m=1,t=1,p=1$c2FsdA$a2V5", "plain"} {
+		if err := auth.CheckPasswordHash("secret", malformed); err == nil {
+			t.Errorf("malformed hash %q accepted", malformed)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weakBcrypt, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	weakArgon := auth.DefaultHashParams
+	weakArgon.Argon2Memory = 1024
+	useHashParams(t, weakArgon)
+	weakArgonHash, _ := auth.HashPassword("secret")
+
+	useHashParams(t, auth.DefaultHashParams)
+	if !auth.NeedsRehash(string(weakBcrypt)) {
+		t.Error("bcrypt hash not upgraded to argon2id")
+	}
+	if !auth.NeedsRehash(weakArgonHash) {
+		t.Error("argon2id hash with less memory not upgraded")
+	}
+
+	bcryptPolicy := auth.DefaultHashParams
+	bcryptPolicy.Algorithm = auth.AlgorithmBcrypt
+	bcryptPolicy.BcryptCost = bcrypt.MinCost + 1
+	useHashParams(t, bcryptPolicy)
+	if !auth.NeedsRehash(string(weakBcrypt)) {
+		t.Error("bcrypt hash below the policy cost not upgraded")
+	}
+	if info := auth.DescribeHash(string(weakBcrypt)); info.Params != "cost=4" {
+		t.Errorf("DescribeHash = %+v, want cost=4", info)
+	}
+}
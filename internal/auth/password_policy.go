@@ -0,0 +1,164 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rules reported in PolicyViolation.Rule.
+const (
+	RuleMinLength  = "min_length"
+	RuleMaxLength  = "max_length"
+	RuleCommon     = "common_password"
+	RuleSimilarity = "similar_to_account"
+)
+
+// bcryptMaxBytes is the length after which bcrypt ignores the rest of the
+// password, or refuses it outright.
+const bcryptMaxBytes = 72
+
+// PasswordPolicy lists the requirements for new passwords.
+type PasswordPolicy struct {
+	// MinLength is counted in characters, MaxBytes in UTF-8 bytes.
+	MinLength int
+	MaxBytes  int
+	// RejectCommon refuses passwords from the bundled list of common and
+	// breached passwords, also with digits or symbols appended.
+	RejectCommon bool
+	// RejectSimilar refuses passwords built from the username or the local
+	// part of the email.
+	RejectSimilar bool
+}
+
+// PolicyViolation is a failed rule of a PasswordPolicy.
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:     8,
+	MaxBytes:      bcryptMaxBytes,
+	RejectCommon:  true,
+	RejectSimilar: true,
+}
+
+// PasswordPolicyFromEnv returns DefaultPasswordPolicy adjusted by
+// PASSWORD_MIN_LENGTH, PASSWORD_REJECT_COMMON and PASSWORD_REJECT_SIMILAR.
+// The maximum length cannot be raised above what bcrypt accepts.
+func PasswordPolicyFromEnv() PasswordPolicy {
+	policy := DefaultPasswordPolicy
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		policy.MinLength = n
+	}
+	if os.Getenv("PASSWORD_REJECT_COMMON") == "false" {
+		policy.RejectCommon = false
+	}
+	if os.Getenv("PASSWORD_REJECT_SIMILAR") == "false" {
+		policy.RejectSimilar = false
+	}
+	return policy
+}
+
+// Validate checks password, chosen by the account with username and email,
+// and returns every failed rule; none means the password is acceptable.
+func (p PasswordPolicy) Validate(password, username, email string) []PolicyViolation {
+	var violations []PolicyViolation
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must not be longer than %d bytes", p.MaxBytes),
+		})
+	}
+	if p.RejectCommon && IsCommonPassword(password) {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleCommon,
+			Message: "Password is too common and appears in lists of breached passwords",
+		})
+	}
+	if p.RejectSimilar && similarToAccount(password, username, email) {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleSimilarity,
+			Message: "Password must not be based on your username or email",
+		})
+	}
+	return violations
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = func() map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range strings.Split(commonPasswordsFile, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[line] = true
+		}
+	}
+	return set
+}()
+
+// IsCommonPassword reports whether password, ignoring case and trailing
+// digits and symbols, is in the bundled list.
+func IsCommonPassword(password string) bool {
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return true
+	}
+	stem := strings.TrimRightFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return stem != "" && commonPasswords[stem]
+}
+
+// similarToAccount reports whether password contains the username or the
+// local part of email, or the other way round, ignoring case and anything
+// but letters and digits. Parts shorter than 3 characters are not compared.
+func similarToAccount(password, username, email string) bool {
+	pw := alphanumeric(password)
+	if len(pw) < 3 {
+		return false
+	}
+	local := email
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		local = email[:i]
+	}
+	for _, part := range []string{username, local} {
+		part = alphanumeric(part)
+		if len(part) < 3 {
+			continue
+		}
+		if strings.Contains(pw, part) || strings.Contains(part, pw) || strings.Contains(pw, reverse(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+func alphanumeric(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,49 @@
+package auth_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+)
+
+func rules(violations []auth.PolicyViolation) []string {
+	names := []string{}
+	for _, v := range violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := auth.DefaultPasswordPolicy
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"correct horse battery staple", []string{}},
+		{"", []string{auth.RuleMinLength}},
+		{"short", []string{auth.RuleMinLength}},
+		{strings.Repeat("я", 37), []string{auth.RuleMaxLength}},
+		{"password", []string{auth.RuleCommon}},
+		{"Password123!", []string{auth.RuleCommon}},
+		{"qwerty", []string{auth.RuleMinLength, auth.RuleCommon}},
+		{"aigerim-2024", []string{auth.RuleSimilarity}},
+		{"miregia-secure", []string{auth.RuleSimilarity}},
+		{"a.nurlanova#1", []string{auth.RuleSimilarity}},
+	}
+	for _, tt := range tests {
+		got := rules(policy.Validate(tt.password, "Aigerim", "a.nurlanova@astanait.edu.kz"))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Validate(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordPolicyCanBeRelaxed(t *testing.T) {
+	policy := auth.PasswordPolicy{MinLength: 4, MaxBytes: 72}
+	if got := policy.Validate("password", "password", ""); len(got) != 0 {
+		t.Errorf("Validate with checks disabled = %v, want none", rules(got))
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+// permissionCacheTTL bounds how long another instance may keep using a
+// permission matrix changed elsewhere. Changes made through Grant and Revoke
+// are visible in this process immediately.
+const permissionCacheTTL = 30 * time.Second
+
+// Permissions answers whether a role holds a permission, using the matrix
+// stored in the role_permissions table.
+type Permissions struct {
+	store *store.Store
+
+	mu       sync.Mutex
+	matrix   map[string]map[string]bool
+	loadedAt time.Time
+}
+
+func NewPermissions(s *store.Store) *Permissions {
+	return &Permissions{store: s}
+}
+
+// Can reports whether role has permission.
+func (p *Permissions) Can(ctx context.Context, role, permission string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.loadLocked(ctx); err != nil {
+		return false, err
+	}
+	return p.matrix[role][permission], nil
+}
+
+// CanGrantScope reports whether role may create a personal access token with
+// scope. An admin scope needs one of the permissions behind its routes; every
+// request made with the token is still checked against the matrix.
+func (p *Permissions) CanGrantScope(ctx context.Context, role, scope string) (bool, error) {
+	if !IsAdminScope(scope) {
+		return true, nil
+	}
+	for _, permission := range adminScopePermissions[scope] {
+		if ok, err := p.Can(ctx, role, permission); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// Matrix returns the permissions granted to each role.
+func (p *Permissions) Matrix(ctx context.Context) (map[string][]string, error) {
+	return p.store.Roles.Permissions(ctx)
+}
+
+// Grant adds the permission to the role.
+func (p *Permissions) Grant(ctx context.Context, role, permission string) error {
+	if err := p.store.Roles.Grant(ctx, role, permission); err != nil {
+		return err
+	}
+	p.invalidate()
+	return nil
+}
+
+// Revoke removes the permission from the role.
+func (p *Permissions) Revoke(ctx context.Context, role, permission string) error {
+	if err := p.store.Roles.Revoke(ctx, role, permission); err != nil {
+		return err
+	}
+	p.invalidate()
+	return nil
+}
+
+func (p *Permissions) invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.matrix = nil
+}
+
+func (p *Permissions) loadLocked(ctx context.Context) error {
+	if p.matrix != nil && time.Since(p.loadedAt) <= permissionCacheTTL {
+		return nil
+	}
+	rows, err := p.store.Roles.Permissions(ctx)
+	if err != nil {
+		return err
+	}
+	matrix := make(map[string]map[string]bool, len(rows))
+	for role, permissions := range rows {
+		matrix[role] = make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			matrix[role][permission] = true
+		}
+	}
+	p.matrix = matrix
+	p.loadedAt = time.Now()
+	return nil
+}
+
+// RoleOf returns the role carried by the claims. Tokens issued before roles
+// existed only have the admin flag.
+func RoleOf(claims *Claims) string {
+	if models.ValidRole(claims.Role) {
+		return claims.Role
+	}
+	if claims.IsAdmin {
+		return models.RoleAdmin
+	}
+	return models.RoleUser
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiterSweepSize is the number of tracked keys after which stale keys
+// are swept, so unique keys (e.g. random email addresses) cannot grow the
+// map without bound.
+const rateLimiterSweepSize = 10000
+
+// RateLimiter allows at most limit events per key within a sliding window.
+// It is used to throttle endpoints that send email or accept guesses, keyed
+// by email address rather than by IP.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	events map[string][]time.Time
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit.
+// Rejected events are not recorded.
+func (l *RateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.events) >= rateLimiterSweepSize {
+		for k := range l.events {
+			l.prune(k, now)
+		}
+	}
+	recent := l.prune(key, now)
+	if len(recent) >= l.limit {
+		return false
+	}
+	l.events[key] = append(recent, now)
+	return true
+}
+
+// prune drops events outside the window and returns the remaining ones.
+// Callers must hold mu.
+func (l *RateLimiter) prune(key string, now time.Time) []time.Time {
+	events := l.events[key]
+	i := 0
+	for i < len(events) && now.Sub(events[i]) >= l.window {
+		i++
+	}
+	events = events[i:]
+	if len(events) == 0 {
+		delete(l.events, key)
+		return nil
+	}
+	l.events[key] = events
+	return events
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Registration modes, selected with REGISTRATION_MODE.
+const (
+	// RegistrationOpen lets anyone register. An invite code is optional.
+	RegistrationOpen = "open"
+	// RegistrationDomains admits email addresses at the allowed domains;
+	// other addresses need an invite code.
+	RegistrationDomains = "domains"
+	// RegistrationInvite admits only holders of an invite code.
+	RegistrationInvite = "invite"
+)
+
+// RegistrationPolicy decides who may create an account.
+type RegistrationPolicy struct {
+	Mode string
+	// AllowedDomains are matched case-insensitively, subdomains included.
+	AllowedDomains []string
+}
+
+// RegistrationPolicyFromEnv reads REGISTRATION_MODE (open by default) and
+// the comma-separated REGISTRATION_ALLOWED_DOMAINS. An invalid setting is
+// reported together with an invite-only policy, so a typo never opens
+// registration.
+func RegistrationPolicyFromEnv() (RegistrationPolicy, error) {
+	policy := RegistrationPolicy{Mode: RegistrationOpen}
+	if mode := os.Getenv("REGISTRATION_MODE"); mode != "" {
+		policy.Mode = strings.ToLower(strings.TrimSpace(mode))
+	}
+	for _, domain := range strings.Split(os.Getenv("REGISTRATION_ALLOWED_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			policy.AllowedDomains = append(policy.AllowedDomains, strings.TrimPrefix(domain, "@"))
+		}
+	}
+
+	switch policy.Mode {
+	case RegistrationOpen, RegistrationInvite:
+		return policy, nil
+	case RegistrationDomains:
+		if len(policy.AllowedDomains) == 0 {
+			return RegistrationPolicy{Mode: RegistrationInvite},
+				fmt.Errorf("REGISTRATION_MODE=domains requires REGISTRATION_ALLOWED_DOMAINS")
+		}
+		return policy, nil
+	}
+	return RegistrationPolicy{Mode: RegistrationInvite},
+		fmt.Errorf("unsupported REGISTRATION_MODE %q (use open, domains or invite)", policy.Mode)
+}
+
+// DomainAllowed reports whether email is at one of the allowed domains.
+func (p RegistrationPolicy) DomainAllowed(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range p.AllowedDomains {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsInvite reports whether email can only register with an invite code.
+func (p RegistrationPolicy) NeedsInvite(email string) bool {
+	switch p.Mode {
+	case RegistrationOpen:
+		return false
+	case RegistrationDomains:
+		return !p.DomainAllowed(email)
+	}
+	return true
+}
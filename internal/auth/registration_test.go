@@ -0,0 +1,59 @@
+package auth_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+)
+
+func TestRegistrationPolicyNeedsInvite(t *testing.T) {
+	domains := auth.RegistrationPolicy{Mode: auth.RegistrationDomains, AllowedDomains: []string{"astanait.edu.kz"}}
+	tests := []struct {
+		policy auth.RegistrationPolicy
+		email  string
+		want   bool
+	}{
+		{auth.RegistrationPolicy{Mode: auth.RegistrationOpen}, "anyone@example.com", false},
+		{auth.RegistrationPolicy{Mode: auth.RegistrationInvite}, "student@astanait.edu.kz", true},
+		{domains, "student@astanait.edu.kz", false},
+		{domains, "Student@AstanaIT.edu.kz", false},
+		{domains, "staff@mail.astanait.edu.kz", false},
+		{domains, "someone@notastanait.edu.kz", true},
+		{domains, "someone@example.com", true},
+		{domains, "astanait.edu.kz", true},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.NeedsInvite(tt.email); got != tt.want {
+			t.Errorf("%s policy: NeedsInvite(%q) = %v, want %v", tt.policy.Mode, tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestRegistrationPolicyFromEnv(t *testing.T) {
+	defer os.Unsetenv("REGISTRATION_MODE")
+	defer os.Unsetenv("REGISTRATION_ALLOWED_DOMAINS")
+
+	os.Setenv("REGISTRATION_MODE", "domains")
+	os.Setenv("REGISTRATION_ALLOWED_DOMAINS", " astanait.edu.kz, @Example.org ")
+	policy, err := auth.RegistrationPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("RegistrationPolicyFromEnv returned error: %v", err)
+	}
+	if len(policy.AllowedDomains) != 2 || policy.AllowedDomains[1] != "example.org" {
+		t.Errorf("unexpected allowed domains %q", policy.AllowedDomains)
+	}
+
+	// Invalid settings fail closed.
+	for _, mode := range []string{"opne", "domains"} {
+		os.Setenv("REGISTRATION_MODE", mode)
+		os.Setenv("REGISTRATION_ALLOWED_DOMAINS", "")
+		policy, err := auth.RegistrationPolicyFromEnv()
+		if err == nil {
+			t.Errorf("REGISTRATION_MODE=%s without domains: expected an error", mode)
+		}
+		if policy.Mode != auth.RegistrationInvite {
+			t.Errorf("REGISTRATION_MODE=%s: got mode %q, want invite", mode, policy.Mode)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+// ErrTokenRevoked is returned by Validate for access tokens that were
+// explicitly revoked, belong to a deleted user or carry an outdated token
+// version.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+const (
+	// revocationCacheTTL bounds how long another instance may keep accepting
+	// a token revoked elsewhere. Revocations made by this process are
+	// reflected in the cache immediately.
+	revocationCacheTTL = 30 * time.Second
+	// revocationCacheSize caps the number of cached entries per map.
+	revocationCacheSize = 10000
+	// sessionTouchInterval is how stale a session's last-seen time may get
+	// before a request updates it.
+	sessionTouchInterval = time.Minute
+)
+
+// Validate checks an already signature-verified access token against the
+// server-side revocation state: the jti denylist, the session it was issued
+// for and the user's current token version.
+func (m *SessionManager) Validate(ctx context.Context, claims *Claims) error {
+	if claims.SessionID != "" {
+		// Impersonation tokens live in the admin's session, so logging
+		// the admin out ends the impersonation as well.
+		owner := claims.UserID
+		if claims.IsImpersonation() {
+			owner = claims.Impersonator
+		}
+		active, err := m.sessionActive(ctx, claims.SessionID, owner)
+		if err != nil {
+			return err
+		}
+		if !active {
+			return ErrTokenRevoked
+		}
+	}
+
+	if claims.Id != "" {
+		denied, err := m.isDenied(ctx, claims.Id)
+		if err != nil {
+			return err
+		}
+		if denied {
+			return ErrTokenRevoked
+		}
+	}
+
+	version, err := m.tokenVersion(ctx, claims.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if claims.TokenVersion != version {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RevokeToken puts a single access token on the denylist until it expires.
+func (m *SessionManager) RevokeToken(ctx context.Context, claims *Claims) error {
+	if claims.Id == "" {
+		return nil
+	}
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if err := m.store.RevokedTokens.Add(ctx, claims.Id, claims.UserID, expiresAt); err != nil {
+		return err
+	}
+	m.cache.setDenied(claims.Id, true)
+
+	// Opportunistically drop entries that can no longer match a valid token.
+	return m.store.RevokedTokens.DeleteExpired(ctx, time.Now())
+}
+
+// RevokeAll logs the user out everywhere: every session is revoked and the
+// token version is bumped so outstanding access tokens stop working.
+func (m *SessionManager) RevokeAll(ctx context.Context, userID int) error {
+	if err := m.store.Sessions.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	version, err := m.store.Users.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	m.cache.setVersion(userID, version)
+	return nil
+}
+
+// RevokeAllCredentials is RevokeAll plus revoking the user's personal access
+// tokens, for the actions taken after an account may have been compromised.
+func (m *SessionManager) RevokeAllCredentials(ctx context.Context, userID int) error {
+	if err := m.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+	return m.store.AccessTokens.RevokeAllForUser(ctx, userID)
+}
+
+// Forget drops cached state for a user, e.g. after the account was deleted.
+func (m *SessionManager) Forget(userID int) {
+	m.cache.forgetVersion(userID)
+}
+
+func (m *SessionManager) isDenied(ctx context.Context, jti string) (bool, error) {
+	if denied, ok := m.cache.denied(jti); ok {
+		return denied, nil
+	}
+	denied, err := m.store.RevokedTokens.Contains(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	m.cache.setDenied(jti, denied)
+	return denied, nil
+}
+
+// sessionActive reports whether the session is still active. Looking it up
+// in the store also refreshes its last-seen time and address, so that
+// happens at most once per cache TTL.
+func (m *SessionManager) sessionActive(ctx context.Context, sessionID string, userID int) (bool, error) {
+	if active, ok := m.cache.sessionActive(sessionID); ok {
+		return active, nil
+	}
+	session, err := m.store.Sessions.GetByID(ctx, sessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		m.cache.setSessionActive(sessionID, false)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	active := session.Active(now) && session.UserID == userID
+	m.cache.setSessionActive(sessionID, active)
+
+	ip := ClientFrom(ctx).IP
+	if active && (now.Sub(session.LastUsedAt) >= sessionTouchInterval || (ip != "" && ip != session.IP)) {
+		if err := m.store.Sessions.Touch(ctx, sessionID, ip, now); err != nil {
+			logger.ErrorLogger(err, logger.Fields{
+				"error":      "Failed to update session last-seen time",
+				"session_id": sessionID,
+			})
+		}
+	}
+	return active, nil
+}
+
+func (m *SessionManager) tokenVersion(ctx context.Context, userID int) (int, error) {
+	if version, ok := m.cache.version(userID); ok {
+		return version, nil
+	}
+	user, err := m.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	m.cache.setVersion(userID, user.TokenVersion)
+	return user.TokenVersion, nil
+}
+
+type cachedVersion struct {
+	version   int
+	fetchedAt time.Time
+}
+
+type cachedSession struct {
+	active    bool
+	fetchedAt time.Time
+}
+
+type cachedDenial struct {
+	denied    bool
+	fetchedAt time.Time
+}
+
+// revocationCache is a small TTL cache in front of the revocation lookups
+// that middleware.JWT performs on every request.
+type revocationCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	versions map[int]cachedVersion
+	denials  map[string]cachedDenial
+	sessions map[string]cachedSession
+}
+
+func newRevocationCache(ttl time.Duration) *revocationCache {
+	return &revocationCache{
+		ttl:      ttl,
+		versions: make(map[int]cachedVersion),
+		denials:  make(map[string]cachedDenial),
+		sessions: make(map[string]cachedSession),
+	}
+}
+
+func (c *revocationCache) version(userID int) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.versions[userID]
+	if !ok || time.Since(entry.fetchedAt) > c.ttl {
+		return 0, false
+	}
+	return entry.version, true
+}
+
+func (c *revocationCache) setVersion(userID, version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.versions) >= revocationCacheSize {
+		c.versions = make(map[int]cachedVersion)
+	}
+	c.versions[userID] = cachedVersion{version: version, fetchedAt: time.Now()}
+}
+
+func (c *revocationCache) forgetVersion(userID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.versions, userID)
+}
+
+func (c *revocationCache) denied(jti string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.denials[jti]
+	if !ok || (!entry.denied && time.Since(entry.fetchedAt) > c.ttl) {
+		return false, false
+	}
+	return entry.denied, true
+}
+
+func (c *revocationCache) setDenied(jti string, denied bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.denials) >= revocationCacheSize {
+		c.denials = make(map[string]cachedDenial)
+	}
+	c.denials[jti] = cachedDenial{denied: denied, fetchedAt: time.Now()}
+}
+
+// sessionActive returns the cached state of a session. Like denials, a
+// revoked session stays cached: it never becomes active again.
+func (c *revocationCache) sessionActive(id string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.sessions[id]
+	if !ok || (entry.active && time.Since(entry.fetchedAt) > c.ttl) {
+		return false, false
+	}
+	return entry.active, true
+}
+
+func (c *revocationCache) setSessionActive(id string, active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.sessions) >= revocationCacheSize {
+		c.sessions = make(map[string]cachedSession)
+	}
+	c.sessions[id] = cachedSession{active: active, fetchedAt: time.Now()}
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+// RefreshTokenTTL is how long a session stays alive without being refreshed.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked
+	// refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh
+	// token is presented again. The session is revoked as a precaution.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// TokenPair is returned to clients after login and on every refresh.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	SessionID    string `json:"-"`
+}
+
+// SessionManager issues access tokens backed by server-side sessions with
+// rotating refresh tokens.
+type SessionManager struct {
+	store *store.Store
+	cache *revocationCache
+}
+
+func NewSessionManager(s *store.Store) *SessionManager {
+	return &SessionManager{store: s, cache: newRevocationCache(revocationCacheTTL)}
+}
+
+// Start opens a new session for the user and returns its first token pair.
+func (m *SessionManager) Start(ctx context.Context, user *models.User) (*TokenPair, error) {
+	return m.start(ctx, user, false)
+}
+
+// StartMFA opens a session for a user who also passed a second factor. The
+// access tokens of such a session carry the mfa claim.
+func (m *SessionManager) StartMFA(ctx context.Context, user *models.User) (*TokenPair, error) {
+	return m.start(ctx, user, true)
+}
+
+func (m *SessionManager) start(ctx context.Context, user *models.User, mfa bool) (*TokenPair, error) {
+	sessionID, err := RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	client := ClientFrom(ctx)
+	session := &models.Session{
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: HashToken(secret),
+		ExpiresAt:        time.Now().Add(RefreshTokenTTL),
+		MFA:              mfa,
+		UserAgent:        client.UserAgent,
+		IP:               client.IP,
+	}
+	if err := m.store.Sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return m.issue(user, session, secret)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented
+// refresh token becomes invalid; presenting it again revokes the session.
+func (m *SessionManager) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	sessionID, secret, ok := splitRefreshToken(refreshToken)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := m.store.Sessions.GetByID(ctx, sessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	presentedHash := HashToken(secret)
+	if session.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !TokenHashEqual(presentedHash, session.RefreshTokenHash) {
+		m.revokeReused(ctx, session)
+		return nil, ErrRefreshTokenReused
+	}
+	if !session.Active(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := m.store.Users.GetByID(ctx, session.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	newSecret, err := RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = m.store.Sessions.Rotate(ctx, session.ID, presentedHash, HashToken(newSecret), time.Now().Add(RefreshTokenTTL))
+	if errors.Is(err, store.ErrConflict) {
+		// Another request rotated the same token first.
+		m.revokeReused(ctx, session)
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.issue(user, session, newSecret)
+}
+
+// Revoke ends a session. Its refresh token and every access token issued
+// for it stop working.
+func (m *SessionManager) Revoke(ctx context.Context, sessionID string) error {
+	if err := m.store.Sessions.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+	m.cache.setSessionActive(sessionID, false)
+	return nil
+}
+
+// List returns the active sessions of the user, most recently used first.
+func (m *SessionManager) List(ctx context.Context, userID int) ([]models.Session, error) {
+	return m.store.Sessions.ListForUser(ctx, userID, time.Now())
+}
+
+// RevokeForUser ends one session of the user, e.g. a lost device. It
+// returns store.ErrNotFound if the session belongs to someone else.
+func (m *SessionManager) RevokeForUser(ctx context.Context, userID int, sessionID string) error {
+	session, err := m.store.Sessions.GetByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return store.ErrNotFound
+	}
+	return m.Revoke(ctx, sessionID)
+}
+
+// SessionIDFromRefreshToken extracts the session ID a refresh token belongs
+// to without validating it.
+func SessionIDFromRefreshToken(refreshToken string) (string, bool) {
+	sessionID, _, ok := splitRefreshToken(refreshToken)
+	return sessionID, ok
+}
+
+func (m *SessionManager) issue(user *models.User, session *models.Session, secret string) (*TokenPair, error) {
+	accessToken, err := GenerateToken(user, session)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: session.ID + "." + secret,
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		SessionID:    session.ID,
+	}, nil
+}
+
+func (m *SessionManager) revokeReused(ctx context.Context, session *models.Session) {
+	logger.WarnLogger("Refresh token reuse detected, revoking session", logger.Fields{
+		"session_id": session.ID,
+		"user_id":    session.UserID,
+	})
+	if err := m.Revoke(ctx, session.ID); err != nil {
+		logger.ErrorLogger(err, logger.Fields{
+			"error":      "Failed to revoke session after refresh token reuse",
+			"session_id": session.ID,
+		})
+	}
+}
+
+// Refresh tokens have the form "<session id>.<secret>".
+func splitRefreshToken(token string) (sessionID, secret string, ok bool) {
+	i := strings.IndexByte(token, '.')
+	if i <= 0 || i == len(token)-1 {
+		return "", "", false
+	}
+	return token[:i], token[i+1:], true
+}
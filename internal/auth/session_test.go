@@ -0,0 +1,138 @@
+package auth_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestSessionRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	if err := st.Users.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	sessions := auth.NewSessionManager(st)
+	first, err := sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+
+	claims, err := auth.VerifyToken(first.AccessToken)
+	if err != nil {
+		t.Fatalf("access token does not verify: %v", err)
+	}
+	if claims.UserID != user.ID || claims.SessionID != first.SessionID {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	second, err := sessions.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh returned error: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// Replaying the rotated token must revoke the whole session, including
+	// the refresh token issued by the legitimate rotation.
+	if _, err := sessions.Refresh(ctx, first.RefreshToken); err != auth.ErrRefreshTokenReused {
+		t.Fatalf("replayed refresh = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := sessions.Refresh(ctx, second.RefreshToken); err != auth.ErrInvalidRefreshToken {
+		t.Fatalf("refresh after reuse = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestSessionRevoke(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("bob", "bob@example.com", "hash")
+	if err := st.Users.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	sessions := auth.NewSessionManager(st)
+	pair, err := sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	if err := sessions.Revoke(ctx, pair.SessionID); err != nil {
+		t.Fatalf("Revoke returned error: %v", err)
+	}
+	if _, err := sessions.Refresh(ctx, pair.RefreshToken); err != auth.ErrInvalidRefreshToken {
+		t.Fatalf("refresh after logout = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestSessionDevicesAndRevocation(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("carol", "carol@example.com", "hash")
+	other := models.NewUser("dave", "dave@example.com", "hash")
+	st.Users.Create(ctx, user)
+	st.Users.Create(ctx, other)
+
+	sessions := auth.NewSessionManager(st)
+	laptop, err := sessions.Start(auth.WithClient(ctx, auth.Client{UserAgent: "Firefox", IP: "10.0.0.1"}), user)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	phone, _ := sessions.Start(auth.WithClient(ctx, auth.Client{UserAgent: "Safari", IP: "10.0.0.2"}), user)
+
+	list, err := sessions.List(ctx, user.ID)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("List = %v, %v; want 2 sessions", list, err)
+	}
+	for _, s := range list {
+		if (s.ID == laptop.SessionID && (s.UserAgent != "Firefox" || s.IP != "10.0.0.1")) ||
+			(s.ID == phone.SessionID && (s.UserAgent != "Safari" || s.IP != "10.0.0.2")) {
+			t.Errorf("session recorded the wrong device: %+v", s)
+		}
+	}
+
+	// A request from a new address updates where the session was last seen.
+	phoneClaims, _ := auth.VerifyToken(phone.AccessToken)
+	if err := sessions.Validate(auth.WithClient(ctx, auth.Client{IP: "10.0.0.3"}), phoneClaims); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if s, _ := st.Sessions.GetByID(ctx, phone.SessionID); s.IP != "10.0.0.3" {
+		t.Errorf("last-seen IP = %q, want 10.0.0.3", s.IP)
+	}
+
+	if err := sessions.RevokeForUser(ctx, other.ID, phone.SessionID); err == nil {
+		t.Fatal("another user revoked the session")
+	}
+	if err := sessions.RevokeForUser(ctx, user.ID, phone.SessionID); err != nil {
+		t.Fatalf("RevokeForUser returned error: %v", err)
+	}
+
+	// The access token of the revoked session stops working at once; the
+	// other session is not affected.
+	if err := sessions.Validate(ctx, phoneClaims); err != auth.ErrTokenRevoked {
+		t.Errorf("Validate after revocation = %v, want ErrTokenRevoked", err)
+	}
+	laptopClaims, _ := auth.VerifyToken(laptop.AccessToken)
+	if err := sessions.Validate(ctx, laptopClaims); err != nil {
+		t.Errorf("Validate of the other session = %v, want nil", err)
+	}
+	if list, _ := sessions.List(ctx, user.ID); len(list) != 1 || list[0].ID != laptop.SessionID {
+		t.Errorf("List after revocation = %+v", list)
+	}
+}
+
+func TestWithClientTruncatesOnRuneBoundary(t *testing.T) {
+	// 511 ASCII bytes followed by a two-byte rune straddle the limit.
+	agent := strings.Repeat("a", 511) + "ж" + "tail"
+	got := auth.ClientFrom(auth.WithClient(context.Background(), auth.Client{UserAgent: agent})).UserAgent
+	if !utf8.ValidString(got) || len(got) > 512 || got != strings.Repeat("a", 511) {
+		t.Errorf("UserAgent = %q (%d bytes), want 511 a's", got, len(got))
+	}
+}
@@ -0,0 +1,74 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+)
+
+// RFC 6238 appendix B uses the ASCII secret "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFCVectors(t *testing.T) {
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := auth.TOTPCode(rfcSecret, auth.TOTPStep(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode returned error: %v", err)
+		}
+		if got != c.code {
+			t.Errorf("at %d: expected %s, got %s", c.unix, c.code, got)
+		}
+	}
+}
+
+func TestValidateTOTPAllowsOneStepOfDrift(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	previous, _ := auth.TOTPCode(rfcSecret, auth.TOTPStep(now)-1)
+	tooOld, _ := auth.TOTPCode(rfcSecret, auth.TOTPStep(now)-2)
+
+	step, ok := auth.ValidateTOTP(rfcSecret, previous, now)
+	if !ok || step != auth.TOTPStep(now)-1 {
+		t.Errorf("code from the previous step should be accepted, got step %d ok %v", step, ok)
+	}
+	if _, ok := auth.ValidateTOTP(rfcSecret, tooOld, now); ok {
+		t.Error("code from two steps ago should be rejected")
+	}
+	if _, ok := auth.ValidateTOTP(rfcSecret, "12345", now); ok {
+		t.Error("short code should be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := auth.TOTPURI("Sonet", "alice@example.com", rfcSecret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Sonet:alice@example.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+rfcSecret) || !strings.Contains(uri, "issuer=Sonet") {
+		t.Errorf("missing parameters in %s", uri)
+	}
+}
+
+func TestRecoveryCodeHashIgnoresFormatting(t *testing.T) {
+	codes, err := auth.GenerateRecoveryCodes(2)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes returned error: %v", err)
+	}
+	if len(codes) != 2 || codes[0] == codes[1] {
+		t.Fatalf("unexpected codes: %v", codes)
+	}
+	typed := strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))
+	if auth.HashRecoveryCode(typed) != auth.HashRecoveryCode(codes[0]) {
+		t.Error("recovery code hash should ignore case, spaces and dashes")
+	}
+}
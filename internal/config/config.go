@@ -1,9 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
+	"github.com/pinokiochan/social-network-render/internal/models"
 )
 
 var (
@@ -20,4 +24,53 @@ func LoadEnvVariables() {
 	if err != nil {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+// BaseURL returns the public address of the application used in links sent
+// by email, taken from APP_BASE_URL.
+func BaseURL() string {
+	if url := os.Getenv("APP_BASE_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://127.0.0.1:8080"
+}
+
+// RequireAdminMFA reports whether admin routes require a session opened with
+// two-factor authentication. Enabled unless ADMIN_REQUIRE_2FA=false.
+func RequireAdminMFA() bool {
+	return os.Getenv("ADMIN_REQUIRE_2FA") != "false"
+}
+
+// SecureCookies reports whether session cookies carry the Secure attribute.
+// Enabled unless COOKIE_SECURE=false, for plain-HTTP development hosts other
+// than localhost.
+func SecureCookies() bool {
+	return os.Getenv("COOKIE_SECURE") != "false"
+}
+
+// DefaultReactionEmoji are the emoji reactions offered next to like when
+// REACTIONS is not set.
+const DefaultReactionEmoji = "❤️,😂,😮,😢,😡"
+
+// Reactions returns the reactions users can add to posts and comments:
+// "like" followed by the comma-separated emoji in REACTIONS.
+func Reactions() ([]string, error) {
+	setting := os.Getenv("REACTIONS")
+	if setting == "" {
+		setting = DefaultReactionEmoji
+	}
+	reactions := []string{models.ReactionLike}
+	seen := map[string]bool{models.ReactionLike: true}
+	for _, r := range strings.Split(setting, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" || seen[r] {
+			continue
+		}
+		if len(r) > 32 || strings.ContainsAny(r, " \t") {
+			return nil, fmt.Errorf("invalid reaction %q in REACTIONS", r)
+		}
+		seen[r] = true
+		reactions = append(reactions, r)
+	}
+	return reactions, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations returned error: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected at least one embedded migration")
+	}
+
+	for i, m := range migrations {
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("migration %d (%s) is missing an up or down script", m.Version, m.Name)
+		}
+		if i > 0 && migrations[i-1].Version >= m.Version {
+			t.Errorf("migrations are not strictly ordered: %d before %d", migrations[i-1].Version, m.Version)
+		}
+	}
+}
+
+func TestMigrationStatusesIsReadOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations returned error: %v", err)
+	}
+
+	// A fresh database: no CREATE TABLE, no advisory lock, all pending.
+	mock.ExpectQuery("SELECT to_regclass").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		t.Fatalf("MigrationStatuses returned error: %v", err)
+	}
+	if len(statuses) != len(migrations) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(migrations))
+	}
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			t.Errorf("migration %d reported applied on a fresh database", s.Version)
+		}
+	}
+
+	mock.ExpectQuery("SELECT to_regclass").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(migrations[0].Version, time.Now()))
+	statuses, err = MigrationStatuses(db)
+	if err != nil {
+		t.Fatalf("MigrationStatuses returned error: %v", err)
+	}
+	if statuses[0].AppliedAt == nil || (len(statuses) > 1 && statuses[1].AppliedAt != nil) {
+		t.Errorf("unexpected statuses: %+v", statuses)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS inactive_users;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,12 @@
+-- Every access token carries the user's token_version; bumping it invalidates
+-- all tokens issued before (password change, demotion, "log out everywhere").
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INT NOT NULL DEFAULT 0;
+
+-- Individually revoked access tokens, kept only until they would expire.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens (expires_at);
@@ -0,0 +1,10 @@
+DELETE FROM inactive_users;
+
+DROP INDEX IF EXISTS idx_inactive_users_email;
+CREATE INDEX IF NOT EXISTS idx_inactive_users_email ON inactive_users (email);
+
+ALTER TABLE inactive_users DROP COLUMN IF EXISTS last_sent_at;
+ALTER TABLE inactive_users DROP COLUMN IF EXISTS attempts;
+ALTER TABLE inactive_users DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE inactive_users DROP COLUMN IF EXISTS code_hash;
+ALTER TABLE inactive_users ADD COLUMN IF NOT EXISTS code INT NOT NULL;
@@ -0,0 +1,14 @@
+-- Verification codes are stored hashed with an expiry and a failed attempt
+-- counter. Existing plain-text codes cannot be carried over; affected users
+-- request a new one via /api/verify/resend.
+DELETE FROM inactive_users;
+
+ALTER TABLE inactive_users DROP COLUMN IF EXISTS code;
+ALTER TABLE inactive_users ADD COLUMN IF NOT EXISTS code_hash VARCHAR(128) NOT NULL;
+ALTER TABLE inactive_users ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP NOT NULL;
+ALTER TABLE inactive_users ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE inactive_users ADD COLUMN IF NOT EXISTS last_sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- One pending code per address; resending replaces it.
+DROP INDEX IF EXISTS idx_inactive_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inactive_users_email ON inactive_users (email);
@@ -0,0 +1,4 @@
+ALTER TABLE sessions DROP COLUMN IF EXISTS mfa;
+DROP TABLE IF EXISTS mfa_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
@@ -0,0 +1,4 @@
+UPDATE users SET is_admin = role IN ('admin', 'superadmin');
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
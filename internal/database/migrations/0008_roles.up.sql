@@ -0,0 +1,49 @@
+-- Roles replace the is_admin flag. is_admin is kept and derived from the role
+-- (admin and superadmin) so older queries and tokens keep working.
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(32) PRIMARY KEY
+);
+
+INSERT INTO roles (name) VALUES ('user'), ('moderator'), ('admin'), ('superadmin')
+ON CONFLICT DO NOTHING;
+
+-- The permission matrix; edited at runtime through /api/admin/roles.
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role VARCHAR(32) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission VARCHAR(64) NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('moderator', 'stats.read'),
+    ('moderator', 'users.read'),
+    ('moderator', 'posts.delete_any'),
+    ('moderator', 'comments.delete_any'),
+    ('admin', 'stats.read'),
+    ('admin', 'users.read'),
+    ('admin', 'users.edit'),
+    ('admin', 'users.delete'),
+    ('admin', 'users.revoke_sessions'),
+    ('admin', 'email.broadcast'),
+    ('admin', 'posts.delete_any'),
+    ('admin', 'comments.delete_any'),
+    ('superadmin', 'stats.read'),
+    ('superadmin', 'users.read'),
+    ('superadmin', 'users.edit'),
+    ('superadmin', 'users.delete'),
+    ('superadmin', 'users.revoke_sessions'),
+    ('superadmin', 'email.broadcast'),
+    ('superadmin', 'posts.delete_any'),
+    ('superadmin', 'comments.delete_any'),
+    ('superadmin', 'roles.manage')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'user' REFERENCES roles(name);
+
+UPDATE users SET role = 'admin' WHERE is_admin AND role = 'user';
+
+-- Someone has to be able to manage roles: the oldest admin account becomes
+-- the superadmin.
+UPDATE users SET role = 'superadmin'
+WHERE id = (SELECT MIN(id) FROM users WHERE is_admin)
+  AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'superadmin');
@@ -0,0 +1,25 @@
+-- Pending OpenID Connect logins. The browser only ever sees the state value;
+-- its SHA-256 is the key. nonce and the PKCE code_verifier are checked when
+-- the provider redirects back, and the row is deleted on first use.
+CREATE TABLE IF NOT EXISTS oauth_states (
+    state_hash VARCHAR(128) PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    nonce VARCHAR(128) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Accounts at external identity providers linked to local users. subject is
+-- the provider's stable "sub" claim; email is informational only.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities (user_id);
@@ -0,0 +1,4 @@
+DELETE FROM auth_tokens WHERE purpose <> 'password_reset';
+ALTER TABLE auth_tokens DROP COLUMN IF EXISTS purpose;
+ALTER INDEX IF EXISTS idx_auth_tokens_user RENAME TO idx_password_resets_user;
+ALTER TABLE auth_tokens RENAME TO password_resets;
@@ -0,0 +1,6 @@
+-- Password reset tokens become one kind of single-use emailed token. purpose
+-- tells them apart so a login link cannot reset a password and vice versa.
+ALTER TABLE password_resets RENAME TO auth_tokens;
+ALTER INDEX IF EXISTS idx_password_resets_user RENAME TO idx_auth_tokens_user;
+ALTER TABLE auth_tokens ADD COLUMN IF NOT EXISTS purpose VARCHAR(32) NOT NULL DEFAULT 'password_reset';
+ALTER TABLE auth_tokens ALTER COLUMN purpose DROP DEFAULT;
@@ -0,0 +1,9 @@
+-- Failed password logins per account, for backoff and temporary lockout.
+-- The row is removed on a successful login or when an admin unlocks the
+-- account.
+CREATE TABLE IF NOT EXISTS login_failures (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
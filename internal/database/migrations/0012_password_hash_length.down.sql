@@ -0,0 +1,2 @@
+-- Fails while any stored hash is longer than 100 characters.
+ALTER TABLE users ALTER COLUMN password TYPE VARCHAR(100);
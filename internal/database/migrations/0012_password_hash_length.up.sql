@@ -0,0 +1,3 @@
+-- argon2id hashes in PHC format ("$argon2id$v=19$m=...,t=...,p=...$salt$key")
+-- are longer than bcrypt's 60 characters and grow with the parameters.
+ALTER TABLE users ALTER COLUMN password TYPE VARCHAR(255);
@@ -0,0 +1,5 @@
+-- The device a session belongs to, shown in the session list. ip is the
+-- address the session was last seen from; last_used_at is updated while
+-- the session is in use, not only on refresh.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission = 'users.impersonate';
+DROP TABLE IF EXISTS impersonation_audit;
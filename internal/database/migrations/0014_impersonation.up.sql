@@ -0,0 +1,19 @@
+-- Audit log of admin impersonation. User IDs are not foreign keys so the
+-- log outlives deleted accounts.
+CREATE TABLE IF NOT EXISTS impersonation_audit (
+    id SERIAL PRIMARY KEY,
+    impersonator_id INT NOT NULL,
+    user_id INT NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(2048) NOT NULL,
+    status INT NOT NULL,
+    read_only BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_created ON impersonation_audit (created_at);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users.impersonate'),
+    ('superadmin', 'users.impersonate')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission = 'invites.manage';
+DROP TABLE IF EXISTS invite_redemptions;
+DROP TABLE IF EXISTS invites;
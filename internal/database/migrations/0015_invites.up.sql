@@ -0,0 +1,30 @@
+-- Registration invite codes, see REGISTRATION_MODE. Only the SHA-256 of the
+-- code is stored; code_prefix lets admins tell codes apart. max_uses = 0
+-- means unlimited.
+CREATE TABLE IF NOT EXISTS invites (
+    id SERIAL PRIMARY KEY,
+    code_hash VARCHAR(128) UNIQUE NOT NULL,
+    code_prefix VARCHAR(16) NOT NULL,
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    max_uses INT NOT NULL DEFAULT 1,
+    uses INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+-- Who registered with which invite, and so who invited whom.
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+    invite_id INT NOT NULL REFERENCES invites(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redeemed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (invite_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_redemptions_user ON invite_redemptions (user_id);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'invites.manage'),
+    ('superadmin', 'invites.manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,16 @@
+-- Who follows whom. The primary key serves "whom does X follow" (the home
+-- feed); the followee index serves follower lists and counts.
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_followee ON follows (followee_id, created_at DESC, follower_id DESC);
+CREATE INDEX IF NOT EXISTS idx_follows_follower_created ON follows (follower_id, created_at DESC, followee_id DESC);
+
+-- The home feed reads the newest posts of each followed account, paging by
+-- (created_at, id). 0001's idx_posts_user_created lacks the id column.
+CREATE INDEX IF NOT EXISTS idx_posts_user_created_id ON posts (user_id, created_at DESC, id DESC);
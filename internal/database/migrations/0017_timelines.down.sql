@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS timelines;
+DROP TABLE IF EXISTS timeline_entries;
+ALTER TABLE users DROP COLUMN IF EXISTS follower_count;
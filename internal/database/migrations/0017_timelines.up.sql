@@ -0,0 +1,25 @@
+-- Denormalized follower count, so the home feed can tell which followed
+-- accounts are too popular for fan-out without counting their followers.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS follower_count INT NOT NULL DEFAULT 0;
+UPDATE users SET follower_count = (SELECT COUNT(*) FROM follows WHERE followee_id = users.id);
+
+-- Materialized home timelines filled by fan-out on write. author_id and
+-- created_at are copied from the post so pages and unfollows need no join.
+CREATE TABLE IF NOT EXISTS timeline_entries (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    author_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_timeline_entries_page ON timeline_entries (user_id, created_at DESC, post_id DESC);
+-- Deleting a post removes it from every timeline through the cascade.
+CREATE INDEX IF NOT EXISTS idx_timeline_entries_post ON timeline_entries (post_id);
+
+-- Timelines that have been built; the others are served by the pull path
+-- until they are.
+CREATE TABLE IF NOT EXISTS timelines (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    built_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,21 @@
+-- Likes and emoji reactions. The primary key makes each reaction unique per
+-- user and item, and serves the per-item counts and "who reacted" lists.
+CREATE TABLE IF NOT EXISTS post_reactions (
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, reaction, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user ON post_reactions (user_id);
+
+CREATE TABLE IF NOT EXISTS comment_reactions (
+    comment_id INT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, reaction, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_reactions_user ON comment_reactions (user_id);
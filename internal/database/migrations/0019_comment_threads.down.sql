@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_comments_parent;
+DELETE FROM comments WHERE deleted_at IS NOT NULL;
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,7 @@
+-- Threaded comments. parent_id is NULL for top-level comments. A deleted
+-- comment that still has replies is kept as a tombstone (deleted_at set,
+-- content cleared) so its subtree stays attached to the thread.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES comments(id) ON DELETE CASCADE;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments (parent_id, created_at, id);
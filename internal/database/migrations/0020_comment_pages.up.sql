@@ -0,0 +1,3 @@
+-- Serves the per-post comment pages: the top-level comments of a post
+-- (parent_id IS NULL) and the replies to a comment, in created_at order.
+CREATE INDEX IF NOT EXISTS idx_comments_post_parent_created ON comments (post_id, parent_id, created_at, id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_comments_tombstones;
+DELETE FROM comments WHERE user_id IS NULL;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_author_or_tombstone;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_user_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE comments ALTER COLUMN user_id SET NOT NULL;
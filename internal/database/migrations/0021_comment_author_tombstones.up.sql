@@ -0,0 +1,11 @@
+-- Deleting a user turns their comments into tombstones instead of deleting
+-- them, so other users' replies beneath stay in the thread. The author link
+-- is dropped with the account; only tombstones may be without an author.
+ALTER TABLE comments ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_user_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE comments ADD CONSTRAINT comments_author_or_tombstone
+    CHECK (user_id IS NOT NULL OR deleted_at IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS idx_comments_tombstones ON comments (id) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS follows_count_followers ON follows;
+DROP FUNCTION IF EXISTS follows_count_followers();
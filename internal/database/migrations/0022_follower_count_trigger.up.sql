@@ -0,0 +1,20 @@
+-- Keep users.follower_count in step with follows from inside the database,
+-- so rows removed by ON DELETE CASCADE when an account is deleted are
+-- counted too. Recount once to repair counts that drifted before this.
+CREATE OR REPLACE FUNCTION follows_count_followers() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET follower_count = follower_count + 1 WHERE id = NEW.followee_id;
+        RETURN NEW;
+    END IF;
+    UPDATE users SET follower_count = follower_count - 1 WHERE id = OLD.followee_id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS follows_count_followers ON follows;
+CREATE TRIGGER follows_count_followers
+    AFTER INSERT OR DELETE ON follows
+    FOR EACH ROW EXECUTE PROCEDURE follows_count_followers();
+
+UPDATE users SET follower_count = (SELECT COUNT(*) FROM follows WHERE followee_id = users.id);
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/config"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+// maxAccessTokenDays caps the optional expiry of personal access tokens.
+const maxAccessTokenDays = 365
+
+type AccessTokenHandler struct {
+	store       *store.Store
+	sessions    *auth.SessionManager
+	permissions *auth.Permissions
+}
+
+func NewAccessTokenHandler(s *store.Store, sessions *auth.SessionManager, permissions *auth.Permissions) *AccessTokenHandler {
+	return &AccessTokenHandler{store: s, sessions: sessions, permissions: permissions}
+}
+
+// List returns the current user's personal access tokens without the token
+// values.
+func (h *AccessTokenHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.store.AccessTokens.ListForUser(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to list personal access tokens")
+		http.Error(w, "Error fetching tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens":           tokens,
+		"available_scopes": auth.Scopes,
+	})
+}
+
+// Create issues a new personal access token. The token is returned only in
+// this response.
+func (h *AccessTokenHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Invalid JSON format")
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len(input.Name) > 100 {
+		http.Error(w, "Token name must be between 1 and 100 characters", http.StatusBadRequest)
+		return
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxAccessTokenDays {
+		http.Error(w, "expires_in_days must be between 0 (no expiry) and 365", http.StatusBadRequest)
+		return
+	}
+
+	scopes, adminScope, problem := normalizeScopes(input.Scopes)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	if adminScope {
+		user, err := h.store.Users.GetByID(r.Context(), userID)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  err.Error(),
+				"userID": userID,
+			}).Error("Failed to fetch user")
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+		for _, scope := range scopes {
+			allowed, err := h.permissions.CanGrantScope(r.Context(), user.Role, scope)
+			if err != nil {
+				logger.Log.WithFields(logrus.Fields{
+					"error":  err.Error(),
+					"userID": userID,
+				}).Error("Failed to check permissions")
+				http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				logger.Log.WithFields(logrus.Fields{
+					"userID": userID,
+					"role":   user.Role,
+					"scope":  scope,
+				}).Warn("Role cannot grant admin scope")
+				http.Error(w, "Your role does not have the permissions of scope: "+scope, http.StatusForbidden)
+				return
+			}
+		}
+		// Admin tokens skip the 2FA check in Require, so admins may only
+		// create them from a session that passed it.
+		if config.RequireAdminMFA() && models.IsAdminRole(user.Role) {
+			principal, ok := middleware.PrincipalFrom(r.Context())
+			if !ok || !principal.MFA {
+				http.Error(w, "Two-factor authentication required to create admin tokens", http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	token := &models.PersonalAccessToken{
+		UserID: userID,
+		Name:   input.Name,
+		Scopes: scopes,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(input.ExpiresInDays) * 24 * time.Hour)
+		token.ExpiresAt = &expiresAt
+	}
+
+	raw, err := h.sessions.CreateAccessToken(r.Context(), token)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to create personal access token")
+		http.Error(w, "Error creating token", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":  userID,
+		"tokenID": token.ID,
+		"scopes":  strings.Join(scopes, " "),
+	}).Info("Personal access token created")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "success",
+		"token":        raw,
+		"access_token": token,
+	})
+}
+
+// Revoke revokes one of the current user's personal access tokens.
+func (h *AccessTokenHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	tokenID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.store.AccessTokens.Revoke(r.Context(), tokenID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":   err.Error(),
+			"tokenID": tokenID,
+		}).Error("Failed to revoke personal access token")
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":  userID,
+		"tokenID": tokenID,
+	}).Info("Personal access token revoked")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Token revoked successfully"})
+}
+
+// normalizeScopes validates and de-duplicates requested scopes and reports
+// whether any of them grants admin access. A non-empty problem describes
+// why the request is invalid.
+func normalizeScopes(requested []string) (scopes []string, admin bool, problem string) {
+	if len(requested) == 0 {
+		return nil, false, "At least one scope is required"
+	}
+	seen := make(map[string]bool)
+	for _, scope := range requested {
+		scope = strings.TrimSpace(scope)
+		if !auth.ValidScope(scope) {
+			return nil, false, "Unknown scope: " + scope
+		}
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+		if auth.IsAdminScope(scope) {
+			admin = true
+		}
+	}
+	return scopes, admin, ""
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestAdminScopesFollowRolePermissions(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	moderator := models.NewUser("moderator", "moderator@example.com", "hash")
+	moderator.SetRole(models.RoleModerator)
+	member := models.NewUser("member", "member@example.com", "hash")
+	st.Users.Create(ctx, moderator)
+	st.Users.Create(ctx, member)
+
+	sessions := auth.NewSessionManager(st)
+	permissions := auth.NewPermissions(st)
+	handler := NewAccessTokenHandler(st, sessions, permissions)
+	create := func(user *models.User, scope string) int {
+		t.Helper()
+		pair, err := sessions.Start(ctx, user)
+		if err != nil {
+			t.Fatalf("Не удалось создать сессию: %s", err)
+		}
+		rec := authorizedJSON(handler.Create, "/api/tokens/create", pair.AccessToken,
+			map[string]interface{}{"name": "script", "scopes": []string{scope}})
+		return rec.Code
+	}
+
+	// Модератор с правами чтения может выпустить admin:read, но не admin:write
+	if code := create(moderator, auth.ScopeAdminRead); code != http.StatusCreated {
+		t.Errorf("admin:read для модератора: ожидался статус 201, получен: %d", code)
+	}
+	if code := create(moderator, auth.ScopeAdminWrite); code != http.StatusForbidden {
+		t.Errorf("admin:write для модератора: ожидался статус 403, получен: %d", code)
+	}
+	if code := create(member, auth.ScopeAdminRead); code != http.StatusForbidden {
+		t.Errorf("admin:read для пользователя: ожидался статус 403, получен: %d", code)
+	}
+
+	// Изменение матрицы ролей сразу влияет на выпуск токенов
+	permissions.Revoke(ctx, models.RoleModerator, models.PermStatsRead)
+	permissions.Revoke(ctx, models.RoleModerator, models.PermUsersRead)
+	if code := create(moderator, auth.ScopeAdminRead); code != http.StatusForbidden {
+		t.Errorf("admin:read после отзыва прав: ожидался статус 403, получен: %d", code)
+	}
+}
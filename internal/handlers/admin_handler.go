@@ -1,23 +1,29 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 	"os"
 	"io"
 	"path/filepath"
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
 	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
 	"github.com/pinokiochan/social-network-render/internal/utils"
 	"github.com/pinokiochan/social-network-render/internal/logger"
 	"github.com/sirupsen/logrus"
 )
 
 type AdminHandler struct {
-	db *sql.DB
-	wg *sync.WaitGroup
+	store       *store.Store
+	sessions    *auth.SessionManager
+	permissions *auth.Permissions
+	wg          *sync.WaitGroup
 }
 
 type AdminStats struct {
@@ -27,14 +33,15 @@ type AdminStats struct {
 	ActiveUsers24h int `json:"active_users_24h"`
 }
 
-func NewAdminHandler(db *sql.DB, wg *sync.WaitGroup) *AdminHandler {
-	return &AdminHandler{db: db, wg: wg}
+func NewAdminHandler(s *store.Store, sessions *auth.SessionManager, permissions *auth.Permissions, wg *sync.WaitGroup) *AdminHandler {
+	return &AdminHandler{store: s, sessions: sessions, permissions: permissions, wg: wg}
 }
 
 func (h *AdminHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	var stats AdminStats
+	var err error
 
-	err := h.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&stats.TotalUsers)
+	stats.TotalUsers, err = h.store.Users.Count(r.Context())
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
@@ -43,7 +50,7 @@ func (h *AdminHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&stats.TotalPosts)
+	stats.TotalPosts, err = h.store.Posts.Count(r.Context())
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
@@ -52,7 +59,7 @@ func (h *AdminHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.db.QueryRow("SELECT COUNT(*) FROM comments").Scan(&stats.TotalComments)
+	stats.TotalComments, err = h.store.Comments.Count(r.Context())
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
@@ -61,14 +68,7 @@ func (h *AdminHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.db.QueryRow(`
-		SELECT COUNT(DISTINCT user_id) 
-		FROM (
-			SELECT user_id FROM posts WHERE created_at > NOW() - INTERVAL '24 hours'
-			UNION
-			SELECT user_id FROM comments WHERE created_at > NOW() - INTERVAL '24 hours'
-		) as active_users
-	`).Scan(&stats.ActiveUsers24h)
+	stats.ActiveUsers24h, err = h.store.Users.CountActiveSince(r.Context(), time.Now().Add(-24*time.Hour))
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
@@ -156,7 +156,7 @@ func (h *AdminHandler) BroadcastEmailToSelectedUsers(w http.ResponseWriter, r *h
 }
 
 func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.db.Query("SELECT id, username, email, is_admin FROM users")
+	users, err := h.store.Users.List(r.Context())
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
@@ -164,20 +164,6 @@ func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error fetching users", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var users []models.User
-	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.IsAdmin); err != nil {
-			logger.Log.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Error("Error scanning user")
-			http.Error(w, "Error scanning user", http.StatusInternalServerError)
-			return
-		}
-		users = append(users, user)
-	}
 
 	logger.Log.WithFields(logrus.Fields{
 		"user_count": len(users),
@@ -205,7 +191,20 @@ func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec("DELETE FROM users WHERE id = $1", id)
+	target, err := h.store.Users.GetByID(r.Context(), id)
+	if err == nil {
+		if _, ok := h.authorizeTarget(w, r, target); !ok {
+			return
+		}
+		err = h.store.Users.Delete(r.Context(), id)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"id": id,
+		}).Warn("User not found for deletion")
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
@@ -215,14 +214,8 @@ func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		logger.Log.WithFields(logrus.Fields{
-			"id": id,
-		}).Warn("User not found for deletion")
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
+	// Tokens of the deleted user must stop working immediately
+	h.sessions.Forget(id)
 
 	logger.Log.WithFields(logrus.Fields{
 		"id": id,
@@ -242,9 +235,11 @@ func (h *AdminHandler) EditUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var payload struct {
-		ID       int    `json:"id"`
-		Username string `json:"username"`
-		Email    string `json:"email"`
+		ID       int     `json:"id"`
+		Username string  `json:"username"`
+		Email    string  `json:"email"`
+		IsAdmin  *bool   `json:"is_admin"`
+		Role     *string `json:"role"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -265,29 +260,72 @@ func (h *AdminHandler) EditUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec(`
-		UPDATE users 
-		SET username = $1, email = $2, updated_at = NOW()
-		WHERE id = $3
-	`, payload.Username, payload.Email, payload.ID)
-	
+	target, err := h.store.Users.GetByID(r.Context(), payload.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"id": payload.ID,
+		}).Warn("User not found for update")
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
 			"id":    payload.ID,
-		}).Error("Failed to update user")
+		}).Error("Failed to fetch user")
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
 		return
 	}
+	actor, ok := h.authorizeTarget(w, r, target)
+	if !ok {
+		return
+	}
+
+	// is_admin принимается от старых клиентов: true назначает роль admin,
+	// false снимает админские права
+	role := payload.Role
+	if role == nil && payload.IsAdmin != nil && *payload.IsAdmin != target.IsAdmin {
+		legacy := models.RoleUser
+		if *payload.IsAdmin {
+			legacy = models.RoleAdmin
+		}
+		role = &legacy
+	}
+	if role != nil && !h.authorizeRoleChange(w, r, actor, target, *role) {
+		return
+	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	err = h.store.Users.UpdateAccount(r.Context(), payload.ID, payload.Username, payload.Email)
+	if errors.Is(err, store.ErrNotFound) {
 		logger.Log.WithFields(logrus.Fields{
 			"id": payload.ID,
 		}).Warn("User not found for update")
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	if errors.Is(err, store.ErrConflict) {
+		logger.Log.WithFields(logrus.Fields{
+			"id":       payload.ID,
+			"username": payload.Username,
+			"email":    payload.Email,
+		}).Warn("Username or email already taken")
+		http.Error(w, "Username or email already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    payload.ID,
+		}).Error("Failed to update user")
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	if role != nil {
+		if !h.applyRole(w, r, target, *role) {
+			return
+		}
+	}
 
 	logger.Log.WithFields(logrus.Fields{
 		"id":       payload.ID,
@@ -299,3 +337,487 @@ func (h *AdminHandler) EditUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "User updated successfully"})
 }
 
+// SetUserRole assigns a role to a user.
+func (h *AdminHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		ID   int    `json:"id"`
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to decode payload")
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.store.Users.GetByID(r.Context(), payload.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    payload.ID,
+		}).Error("Failed to fetch user")
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
+	actor, ok := h.authorizeTarget(w, r, target)
+	if !ok {
+		return
+	}
+	if !h.authorizeRoleChange(w, r, actor, target, payload.Role) {
+		return
+	}
+	if !h.applyRole(w, r, target, payload.Role) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated successfully"})
+}
+
+// authorizeTarget checks that the current user may manage target: staff can
+// only manage accounts ranked below their own role, unless their role holds
+// roles.manage. It returns the current user.
+func (h *AdminHandler) authorizeTarget(w http.ResponseWriter, r *http.Request, target *models.User) (*models.User, bool) {
+	actorID, ok := currentUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+	actor, err := h.store.Users.GetByID(r.Context(), actorID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": actorID,
+		}).Error("Failed to fetch current user")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if actor.ID == target.ID || models.RoleRank(target.Role) < models.RoleRank(actor.Role) {
+		return actor, true
+	}
+
+	manager, err := h.permissions.Can(r.Context(), actor.Role, models.PermRolesManage)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to check permission")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !manager {
+		logger.Log.WithFields(logrus.Fields{
+			"userID":   actor.ID,
+			"targetID": target.ID,
+			"path":     r.URL.Path,
+		}).Warn("Attempt to manage a user with an equal or higher role")
+		http.Error(w, "You cannot manage users with an equal or higher role", http.StatusForbidden)
+		return nil, false
+	}
+	return actor, true
+}
+
+// authorizeRoleChange validates a role assignment. Nobody can change their
+// own role, and without roles.manage only roles below one's own can be
+// assigned.
+func (h *AdminHandler) authorizeRoleChange(w http.ResponseWriter, r *http.Request, actor, target *models.User, role string) bool {
+	if !models.ValidRole(role) {
+		http.Error(w, "Unknown role: "+role, http.StatusBadRequest)
+		return false
+	}
+	if role == target.Role {
+		return true
+	}
+	if actor.ID == target.ID {
+		http.Error(w, "You cannot change your own role", http.StatusForbidden)
+		return false
+	}
+	if models.RoleRank(role) < models.RoleRank(actor.Role) {
+		return true
+	}
+
+	manager, err := h.permissions.Can(r.Context(), actor.Role, models.PermRolesManage)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to check permission")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if !manager {
+		http.Error(w, "You cannot assign a role equal to or higher than your own", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// applyRole stores the new role of target. A demoted user is logged out
+// everywhere so tokens carrying the old role stop working.
+func (h *AdminHandler) applyRole(w http.ResponseWriter, r *http.Request, target *models.User, role string) bool {
+	if role == target.Role {
+		return true
+	}
+
+	if err := h.store.Users.SetRole(r.Context(), target.ID, role); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    target.ID,
+		}).Error("Failed to update role")
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return false
+	}
+
+	if models.RoleRank(role) < models.RoleRank(target.Role) {
+		if err := h.sessions.RevokeAll(r.Context(), target.ID); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": err.Error(),
+				"id":    target.ID,
+			}).Error("Failed to revoke sessions of demoted user")
+			http.Error(w, "Failed to update role", http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"id":       target.ID,
+		"old_role": target.Role,
+		"role":     role,
+	}).Info("Role changed")
+	return true
+}
+
+// GetRoles returns the roles, the known permissions and the permission
+// matrix.
+func (h *AdminHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
+	matrix, err := h.permissions.Matrix(r.Context())
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to fetch permission matrix")
+		http.Error(w, "Error fetching roles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"roles":       models.Roles,
+		"permissions": models.Permissions,
+		"matrix":      matrix,
+	})
+}
+
+// SetRolePermission grants or revokes a permission of a role.
+func (h *AdminHandler) SetRolePermission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Role       string `json:"role"`
+		Permission string `json:"permission"`
+		Granted    bool   `json:"granted"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to decode payload")
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !models.ValidRole(payload.Role) {
+		http.Error(w, "Unknown role: "+payload.Role, http.StatusBadRequest)
+		return
+	}
+	if !models.ValidPermission(payload.Permission) {
+		http.Error(w, "Unknown permission: "+payload.Permission, http.StatusBadRequest)
+		return
+	}
+	// Иначе никто не сможет управлять ролями
+	if payload.Role == models.RoleSuperadmin && payload.Permission == models.PermRolesManage && !payload.Granted {
+		http.Error(w, "The superadmin role cannot lose roles.manage", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if payload.Granted {
+		err = h.permissions.Grant(r.Context(), payload.Role, payload.Permission)
+	} else {
+		err = h.permissions.Revoke(r.Context(), payload.Role, payload.Permission)
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":      err.Error(),
+			"role":       payload.Role,
+			"permission": payload.Permission,
+		}).Error("Failed to update permission matrix")
+		http.Error(w, "Failed to update permissions", http.StatusInternalServerError)
+		return
+	}
+
+	userID, _ := middleware.UserIDFrom(r.Context())
+	logger.Log.WithFields(logrus.Fields{
+		"userID":     userID,
+		"role":       payload.Role,
+		"permission": payload.Permission,
+		"granted":    payload.Granted,
+	}).Info("Role permission changed")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Permissions updated successfully"})
+}
+
+// RevokeUserSessions logs the given user out of every session.
+func (h *AdminHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"id": r.URL.Query().Get("id"),
+		}).Warn("Invalid user ID")
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.store.Users.GetByID(r.Context(), id)
+	if err == nil {
+		if _, ok := h.authorizeTarget(w, r, target); !ok {
+			return
+		}
+		err = h.sessions.RevokeAll(r.Context(), id)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("Failed to revoke user sessions")
+		http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"id": id,
+	}).Info("User sessions revoked by admin")
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Sessions revoked successfully"})
+}
+
+// UnlockUser clears the failed login attempts of the given user, lifting a
+// lockout before it expires.
+func (h *AdminHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"id": r.URL.Query().Get("id"),
+		}).Warn("Invalid user ID")
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.store.Users.GetByID(r.Context(), id)
+	if err == nil {
+		if _, ok := h.authorizeTarget(w, r, target); !ok {
+			return
+		}
+		err = h.store.LoginFailures.Reset(r.Context(), id)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("Failed to unlock user")
+		http.Error(w, "Error unlocking user", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"id": id,
+	}).Info("User unlocked by admin")
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User unlocked successfully"})
+}
+
+// Impersonate issues a short-lived token acting as the user ?id= on behalf
+// of the calling admin. The token is read-only unless the body sets
+// "read_only" to false; every request made with it is audited.
+func (h *AdminHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := middleware.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if principal.IsAccessToken() {
+		http.Error(w, "Impersonation requires a signed-in session", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"id": r.URL.Query().Get("id"),
+		}).Warn("Invalid user ID")
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if id == principal.UserID {
+		http.Error(w, "You cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	payload := struct {
+		ReadOnly *bool `json:"read_only"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+	readOnly := payload.ReadOnly == nil || *payload.ReadOnly
+
+	target, err := h.store.Users.GetByID(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("Failed to fetch user")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if _, ok := h.authorizeTarget(w, r, target); !ok {
+		return
+	}
+
+	token, expiresAt, err := h.sessions.Impersonate(r.Context(), principal.UserID, principal.SessionID, target, readOnly)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("Failed to issue impersonation token")
+		http.Error(w, "Error starting impersonation", http.StatusInternalServerError)
+		return
+	}
+
+	// The start is audited like the requests that follow it; without an
+	// audit entry the token is not handed out.
+	event := &models.ImpersonationEvent{
+		ImpersonatorID: principal.UserID,
+		UserID:         target.ID,
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		Status:         http.StatusOK,
+		ReadOnly:       readOnly,
+	}
+	if err := h.sessions.RecordImpersonation(r.Context(), event); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("Failed to record impersonation")
+		http.Error(w, "Error starting impersonation", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"impersonatorID": principal.UserID,
+		"userID":         target.ID,
+		"readOnly":       readOnly,
+	}).Warn("Admin started impersonating a user")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "success",
+		"token":      token,
+		"expires_in": int(time.Until(expiresAt).Seconds()),
+		"read_only":  readOnly,
+		"user":       target,
+	})
+}
+
+// ImpersonationLog returns the latest entries of the impersonation audit
+// log, at most ?limit= (100 by default).
+func (h *AdminHandler) ImpersonationLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be a number between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	events, err := h.store.Impersonation.List(r.Context(), limit)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to fetch impersonation log")
+		http.Error(w, "Error fetching impersonation log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+	})
+}
@@ -1,21 +1,25 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"errors"
+	"github.com/pinokiochan/social-network-render/internal/auth"
 	"github.com/pinokiochan/social-network-render/internal/models"
 	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/store"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type CommentHandler struct {
-	db *sql.DB
+	store       *store.Store
+	permissions *auth.Permissions
 }
 
-func NewCommentHandler(db *sql.DB) *CommentHandler {
-	return &CommentHandler{db: db}
+func NewCommentHandler(s *store.Store, permissions *auth.Permissions) *CommentHandler {
+	return &CommentHandler{store: s, permissions: permissions}
 }
 
 func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
@@ -37,20 +41,30 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := middleware.GetUserIDFromToken(r)
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Error("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	err = h.db.QueryRow(
-		"INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) RETURNING id, created_at",
-		comment.PostID, userID, comment.Content,
-	).Scan(&comment.ID, &comment.CreatedAt)
-
+	comment.UserID = userID
+	err := h.store.Comments.Create(r.Context(), &comment)
+	if errors.Is(err, store.ErrNotFound) && comment.ParentID != 0 {
+		logger.Log.WithFields(logrus.Fields{
+			"userID":   userID,
+			"postID":   comment.PostID,
+			"parentID": comment.ParentID,
+		}).Warn("Reply to a missing comment")
+		http.Error(w, "Parent comment not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"userID": userID,
+			"postID": comment.PostID,
+		}).Warn("Comment on a missing post")
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error":   err.Error(),
@@ -61,8 +75,6 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comment.UserID = userID
-
 	logger.Log.WithFields(logrus.Fields{
 		"commentID": comment.ID,
 		"userID":    userID,
@@ -73,43 +85,248 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(comment)
 }
 
+// maxCommentPosts caps how many posts one GetComments call may ask for with
+// post_ids.
+const maxCommentPosts = 50
+
+// commentPage is one post's page of comments in a GetComments response.
+type commentPage struct {
+	PostID     int              `json:"post_id"`
+	Comments   []models.Comment `json:"comments"`
+	Total      int              `json:"total"`
+	NextCursor string           `json:"next_cursor"`
+}
+
+// GetComments returns a page of a post's top-level comments, or with
+// parent_id of the replies to a comment, together with the post's total
+// comment count. ?sort= is oldest (default), newest or top; pass the
+// returned next_cursor as ?cursor= to get the next page. A feed page can ask
+// for the first page of several posts at once with post_ids=1,2,3, and gets
+// one page per post under "posts".
 func (h *CommentHandler) GetComments(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.db.Query(`
-		SELECT comments.id, comments.post_id, comments.user_id, comments.content, 
-		       comments.created_at, users.username 
-		FROM comments 
-		JOIN users ON comments.user_id = users.id
-	`)
-	if err != nil {
+	if r.Method != http.MethodGet {
 		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Error("Failed to fetch comments")
-		http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var postIDs []int
+	if v := query.Get("post_id"); v != "" {
+		postID, err := strconv.Atoi(v)
+		if err != nil || postID <= 0 {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+		postIDs = []int{postID}
+	} else if v := query.Get("post_ids"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			postID, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || postID <= 0 {
+				http.Error(w, "Invalid post ID", http.StatusBadRequest)
+				return
+			}
+			postIDs = append(postIDs, postID)
+		}
+		if len(postIDs) > maxCommentPosts {
+			http.Error(w, "Too many post IDs", http.StatusBadRequest)
+			return
+		}
+	} else {
+		http.Error(w, "post_id or post_ids is required", http.StatusBadRequest)
+		return
+	}
+	single := query.Get("post_id") != ""
+
+	parentID := 0
+	if v := query.Get("parent_id"); v != "" {
+		var err error
+		parentID, err = strconv.Atoi(v)
+		if err != nil || parentID <= 0 || !single {
+			http.Error(w, "Invalid parent comment ID", http.StatusBadRequest)
+			return
+		}
+	}
+	order := query.Get("sort")
+	switch order {
+	case "":
+		order = store.CommentsOldest
+	case store.CommentsOldest, store.CommentsNewest, store.CommentsTop:
+	default:
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
+	cursor, limit, err := pageParams(r)
+	if err != nil || (!cursor.IsZero() && !single) {
+		http.Error(w, "Invalid cursor or limit", http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	var comments []models.Comment
-	for rows.Next() {
-		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, 
-			&comment.Content, &comment.CreatedAt, &comment.Username)
+	pages := make([]commentPage, len(postIDs))
+	var all []models.Comment
+	for i, postID := range postIDs {
+		comments, err := h.store.Comments.ListByPost(r.Context(), postID, parentID, order, cursor, limit)
 		if err != nil {
 			logger.Log.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Error("Error scanning comment")
-			http.Error(w, "Error scanning comment", http.StatusInternalServerError)
+				"error":  err.Error(),
+				"postID": postID,
+			}).Error("Failed to fetch comments")
+			http.Error(w, "Error fetching comments", http.StatusInternalServerError)
 			return
 		}
-		comments = append(comments, comment)
+		pages[i] = commentPage{PostID: postID, Comments: comments}
+		all = append(all, comments...)
+	}
+
+	// Reactions and totals are fetched once for the whole response
+	totals, err := h.store.Comments.CountByPost(r.Context(), postIDs)
+	if err == nil {
+		err = attachCommentReactions(r.Context(), h.store, viewerID(r), all)
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to fetch comment totals or reactions")
+		http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+		return
+	}
+	offset := 0
+	for i := range pages {
+		page := &pages[i]
+		page.Comments = all[offset : offset+len(page.Comments)]
+		offset += len(page.Comments)
+		page.Total = totals[page.PostID]
+		if page.Comments == nil {
+			page.Comments = []models.Comment{}
+		}
+		if len(page.Comments) == limit {
+			last := page.Comments[len(page.Comments)-1]
+			next := store.Cursor{Time: last.CreatedAt, ID: last.ID}
+			if order == store.CommentsTop {
+				next.Score = reactionTotal(last.Reactions)
+			}
+			page.NextCursor = encodeCursor(next)
+		}
 	}
 
 	logger.Log.WithFields(logrus.Fields{
-		"count": len(comments),
+		"posts": len(postIDs),
+		"count": len(all),
 	}).Info("Comments fetched successfully")
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(comments)
+	if single {
+		json.NewEncoder(w).Encode(pages[0])
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts": pages,
+	})
+}
+
+// reactionTotal is the number of reactions in a summary, the score
+// CommentsTop sorts by.
+func reactionTotal(summary *models.ReactionSummary) int {
+	total := 0
+	if summary != nil {
+		for _, n := range summary.Counts {
+			total += n
+		}
+	}
+	return total
+}
+
+// Default and maximum number of reply levels returned by GetThread.
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+)
+
+// GetThread returns the comments of a post as a tree. With parent_id it
+// returns the replies under that comment instead, which is how clients
+// expand a branch cut off at depth: its reply_count is set but its replies
+// are not included.
+func (h *CommentHandler) GetThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	postID, err := strconv.Atoi(query.Get("post_id"))
+	if err != nil || postID <= 0 {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	parentID := 0
+	if v := query.Get("parent_id"); v != "" {
+		parentID, err = strconv.Atoi(v)
+		if err != nil || parentID <= 0 {
+			http.Error(w, "Invalid parent comment ID", http.StatusBadRequest)
+			return
+		}
+	}
+	depth := defaultThreadDepth
+	if v := query.Get("depth"); v != "" {
+		depth, err = strconv.Atoi(v)
+		if err != nil || depth <= 0 {
+			http.Error(w, "Invalid depth", http.StatusBadRequest)
+			return
+		}
+		if depth > maxThreadDepth {
+			depth = maxThreadDepth
+		}
+	}
+
+	comments, err := h.store.Comments.Thread(r.Context(), postID, parentID, depth)
+	if err == nil {
+		err = attachCommentReactions(r.Context(), h.store, viewerID(r), comments)
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"postID":   postID,
+			"parentID": parentID,
+		}).Error("Failed to fetch comment thread")
+		http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"post_id":   postID,
+		"parent_id": parentID,
+		"depth":     depth,
+		"comments":  buildThread(comments, parentID),
+	})
+}
+
+// buildThread nests a flat, oldest-first list of comments under their
+// parents, starting from the replies to rootID.
+func buildThread(comments []models.Comment, rootID int) []models.Comment {
+	children := make(map[int][]models.Comment)
+	for _, c := range comments {
+		children[c.ParentID] = append(children[c.ParentID], c)
+	}
+	var attach func(id int) []models.Comment
+	attach = func(id int) []models.Comment {
+		replies := children[id]
+		for i := range replies {
+			replies[i].Replies = attach(replies[i].ID)
+		}
+		return replies
+	}
+	if tree := attach(rootID); tree != nil {
+		return tree
+	}
+	return []models.Comment{}
 }
 
 func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
@@ -131,31 +348,22 @@ func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := middleware.GetUserIDFromToken(r)
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Error("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	result, err := h.db.Exec(
-		"UPDATE comments SET content = $1 WHERE id = $2 AND user_id = $3",
-		comment.Content, comment.ID, userID,
-	)
-	if err != nil {
+	existing, err := h.store.Comments.GetByID(r.Context(), comment.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
 		logger.Log.WithFields(logrus.Fields{
 			"error":     err.Error(),
 			"commentID": comment.ID,
 			"userID":    userID,
-		}).Error("Failed to update comment")
+		}).Error("Failed to fetch comment")
 		http.Error(w, "Error updating comment", http.StatusInternalServerError)
 		return
 	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	if existing == nil || existing.UserID != userID {
 		logger.Log.WithFields(logrus.Fields{
 			"commentID": comment.ID,
 			"userID":    userID,
@@ -164,6 +372,16 @@ func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.store.Comments.Update(r.Context(), comment.ID, comment.Content); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":     err.Error(),
+			"commentID": comment.ID,
+			"userID":    userID,
+		}).Error("Failed to update comment")
+		http.Error(w, "Error updating comment", http.StatusInternalServerError)
+		return
+	}
+
 	logger.Log.WithFields(logrus.Fields{
 		"commentID": comment.ID,
 		"userID":    userID,
@@ -191,62 +409,81 @@ func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := middleware.GetUserIDFromToken(r)
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Error("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Check if the user is the author of the comment or the author of the post
-	var postUserID int
-	err = h.db.QueryRow(
-		"SELECT user_id FROM posts WHERE id = (SELECT post_id FROM comments WHERE id = $1)",
-		comment.ID,
-	).Scan(&postUserID)
+	existing, err := h.store.Comments.GetByID(r.Context(), comment.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"commentID": comment.ID,
+			"userID":    userID,
+		}).Warn("Comment not found or unauthorized deletion attempt")
+		http.Error(w, "Comment not found or you don't have permission to delete it", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error":     err.Error(),
 			"commentID": comment.ID,
-		}).Error("Failed to fetch post information")
+		}).Error("Failed to fetch comment")
 		http.Error(w, "Error fetching post information", http.StatusInternalServerError)
 		return
 	}
 
-	var result sql.Result
-	if userID == postUserID {
-		// If the user is the post author, they can delete any comment
-		result, err = h.db.Exec("DELETE FROM comments WHERE id = $1", comment.ID)
-	} else {
-		// Otherwise, users can only delete their own comments
-		result, err = h.db.Exec("DELETE FROM comments WHERE id = $1 AND user_id = $2", comment.ID, userID)
+	// The comment author and the author of the post may delete a comment,
+	// moderators may delete any comment
+	allowed := existing.UserID == userID
+	if !allowed {
+		post, err := h.store.Posts.GetByID(r.Context(), existing.PostID)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":     err.Error(),
+				"commentID": comment.ID,
+			}).Error("Failed to fetch post information")
+			http.Error(w, "Error fetching post information", http.StatusInternalServerError)
+			return
+		}
+		allowed = post.UserID == userID
 	}
-
-	if err != nil {
+	moderated := false
+	if !allowed {
+		allowed, err = userCan(r.Context(), h.store, h.permissions, userID, models.PermCommentsDeleteAny)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  err.Error(),
+				"userID": userID,
+			}).Error("Failed to check permission")
+			http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+			return
+		}
+		moderated = allowed
+	}
+	if !allowed {
 		logger.Log.WithFields(logrus.Fields{
-			"error":     err.Error(),
 			"commentID": comment.ID,
 			"userID":    userID,
-		}).Error("Failed to delete comment")
-		http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+		}).Warn("Comment not found or unauthorized deletion attempt")
+		http.Error(w, "Comment not found or you don't have permission to delete it", http.StatusForbidden)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	if err := h.store.Comments.Delete(r.Context(), comment.ID); err != nil {
 		logger.Log.WithFields(logrus.Fields{
+			"error":     err.Error(),
 			"commentID": comment.ID,
 			"userID":    userID,
-		}).Warn("Comment not found or unauthorized deletion attempt")
-		http.Error(w, "Comment not found or you don't have permission to delete it", http.StatusForbidden)
+		}).Error("Failed to delete comment")
+		http.Error(w, "Error deleting comment", http.StatusInternalServerError)
 		return
 	}
 
 	logger.Log.WithFields(logrus.Fields{
 		"commentID": comment.ID,
 		"userID":    userID,
+		"authorID":  existing.UserID,
+		"moderated": moderated,
 	}).Info("Comment deleted successfully")
 
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestGetCommentsPagination(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	alice := models.NewUser("alice", "alice@example.com", "hash")
+	bob := models.NewUser("bob", "bob@example.com", "hash")
+	st.Users.Create(ctx, alice)
+	st.Users.Create(ctx, bob)
+	post := &models.Post{UserID: alice.ID, Content: "hello"}
+	st.Posts.Create(ctx, post)
+	other := &models.Post{UserID: bob.ID, Content: "other"}
+	st.Posts.Create(ctx, other)
+
+	var ids []int
+	for i := 1; i <= 5; i++ {
+		c := &models.Comment{PostID: post.ID, UserID: bob.ID, Content: fmt.Sprintf("comment %d", i)}
+		st.Comments.Create(ctx, c)
+		ids = append(ids, c.ID)
+	}
+	reply := &models.Comment{PostID: post.ID, ParentID: ids[0], UserID: alice.ID, Content: "reply"}
+	st.Comments.Create(ctx, reply)
+	st.Comments.Create(ctx, &models.Comment{PostID: other.ID, UserID: alice.ID, Content: "elsewhere"})
+	for _, r := range []models.Reaction{
+		{TargetType: models.ReactionTargetComment, TargetID: ids[2], UserID: alice.ID, Reaction: models.ReactionLike},
+		{TargetType: models.ReactionTargetComment, TargetID: ids[2], UserID: bob.ID, Reaction: models.ReactionLike},
+		{TargetType: models.ReactionTargetComment, TargetID: ids[4], UserID: alice.ID, Reaction: models.ReactionLike},
+	} {
+		r := r
+		st.Reactions.Add(ctx, &r)
+	}
+
+	sessions := auth.NewSessionManager(st)
+	pair, _ := sessions.Start(ctx, alice)
+	comments := NewCommentHandler(st, auth.NewPermissions(st))
+
+	get := func(query string) commentPage {
+		t.Helper()
+		rec := authorizedGet(comments.GetComments, "/api/index/comments?"+query, pair.AccessToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+		}
+		var page commentPage
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Не удалось разобрать ответ %q: %s", rec.Body.String(), err)
+		}
+		return page
+	}
+	// walk собирает ID всех страниц, переходя по next_cursor
+	walk := func(query string) []int {
+		t.Helper()
+		var got []int
+		cursor := ""
+		for pages := 0; pages < 10; pages++ {
+			page := get(query + "&cursor=" + cursor)
+			for _, c := range page.Comments {
+				got = append(got, c.ID)
+			}
+			if page.NextCursor == "" {
+				return got
+			}
+			cursor = page.NextCursor
+		}
+		t.Fatalf("Пагинация не завершилась: %v", got)
+		return nil
+	}
+
+	if rec := authorizedGet(comments.GetComments, "/api/index/comments", pair.AccessToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("Без post_id: ожидался статус 400, получен: %d", rec.Code)
+	}
+	if rec := authorizedGet(comments.GetComments, fmt.Sprintf("/api/index/comments?post_id=%d&sort=random", post.ID), pair.AccessToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("Неизвестная сортировка: ожидался статус 400, получен: %d", rec.Code)
+	}
+
+	// Ответы не попадают в список верхнего уровня, но учитываются в total
+	first := get(fmt.Sprintf("post_id=%d&limit=2", post.ID))
+	if first.Total != 6 || len(first.Comments) != 2 || first.NextCursor == "" {
+		t.Errorf("Неверная первая страница: %+v", first)
+	}
+	if first.Comments[0].ReplyCount != 1 {
+		t.Errorf("Ожидался reply_count 1, получен: %d", first.Comments[0].ReplyCount)
+	}
+
+	cases := map[string][]int{
+		"oldest": ids,
+		"newest": {ids[4], ids[3], ids[2], ids[1], ids[0]},
+		"top":    {ids[2], ids[4], ids[0], ids[1], ids[3]},
+	}
+	for sort, want := range cases {
+		got := walk(fmt.Sprintf("post_id=%d&limit=2&sort=%s", post.ID, sort))
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("sort=%s: ожидалось %v, получено %v", sort, want, got)
+		}
+	}
+
+	replies := get(fmt.Sprintf("post_id=%d&parent_id=%d", post.ID, ids[0]))
+	if len(replies.Comments) != 1 || replies.Comments[0].ID != reply.ID {
+		t.Errorf("Ожидался ответ %d, получено: %+v", reply.ID, replies.Comments)
+	}
+
+	// Лента запрашивает первые страницы нескольких постов сразу
+	rec := authorizedGet(comments.GetComments, fmt.Sprintf("/api/index/comments?post_ids=%d,%d&limit=1", post.ID, other.ID), pair.AccessToken)
+	var feed struct {
+		Posts []commentPage `json:"posts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("Не удалось разобрать ответ %q: %s", rec.Body.String(), err)
+	}
+	if len(feed.Posts) != 2 || feed.Posts[0].Total != 6 || feed.Posts[1].Total != 1 || len(feed.Posts[1].Comments) != 1 {
+		t.Errorf("Неверный ответ для нескольких постов: %s", rec.Body.String())
+	}
+	if rec := authorizedGet(comments.GetComments, fmt.Sprintf("/api/index/comments?post_ids=%d,%d&cursor=%s", post.ID, other.ID, first.NextCursor), pair.AccessToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("Курсор с post_ids: ожидался статус 400, получен: %d", rec.Code)
+	}
+}
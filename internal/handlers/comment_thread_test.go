@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestCommentThreads(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	alice := models.NewUser("alice", "alice@example.com", "hash")
+	bob := models.NewUser("bob", "bob@example.com", "hash")
+	st.Users.Create(ctx, alice)
+	st.Users.Create(ctx, bob)
+	post := &models.Post{UserID: alice.ID, Content: "hello"}
+	st.Posts.Create(ctx, post)
+	other := &models.Post{UserID: alice.ID, Content: "other"}
+	st.Posts.Create(ctx, other)
+
+	sessions := auth.NewSessionManager(st)
+	alicePair, _ := sessions.Start(ctx, alice)
+	bobPair, _ := sessions.Start(ctx, bob)
+	comments := NewCommentHandler(st, auth.NewPermissions(st))
+
+	create := func(token string, postID, parentID int, content string) *models.Comment {
+		t.Helper()
+		rec := authorizedJSON(comments.CreateComment, "/api/index/comments/create", token,
+			map[string]interface{}{"post_id": postID, "parent_id": parentID, "content": content})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+		}
+		var comment models.Comment
+		if err := json.Unmarshal(rec.Body.Bytes(), &comment); err != nil {
+			t.Fatalf("Не удалось разобрать ответ %q: %s", rec.Body.String(), err)
+		}
+		return &comment
+	}
+	thread := func(query string) []models.Comment {
+		t.Helper()
+		rec := authorizedGet(comments.GetThread, "/api/index/comments/thread?"+query, alicePair.AccessToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+		}
+		var body struct {
+			Comments []models.Comment `json:"comments"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Не удалось разобрать ответ %q: %s", rec.Body.String(), err)
+		}
+		return body.Comments
+	}
+
+	root := create(alicePair.AccessToken, post.ID, 0, "root")
+	reply := create(bobPair.AccessToken, post.ID, root.ID, "reply")
+	nested := create(alicePair.AccessToken, post.ID, reply.ID, "nested")
+	if reply.ParentID != root.ID {
+		t.Errorf("Ожидался parent_id %d, получен: %d", root.ID, reply.ParentID)
+	}
+
+	// Ответ можно оставить только на комментарий того же поста
+	rec := authorizedJSON(comments.CreateComment, "/api/index/comments/create", bobPair.AccessToken,
+		map[string]interface{}{"post_id": other.ID, "parent_id": root.ID, "content": "wrong post"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Ответ на комментарий другого поста: ожидался статус 404, получен: %d", rec.Code)
+	}
+
+	// На глубине 2 вложенный ответ обрезается, но reply_count остаётся
+	tree := thread(fmt.Sprintf("post_id=%d&depth=2", post.ID))
+	if len(tree) != 1 || tree[0].ID != root.ID || tree[0].ReplyCount != 1 || len(tree[0].Replies) != 1 {
+		t.Fatalf("Неверное дерево комментариев: %+v", tree)
+	}
+	branch := tree[0].Replies[0]
+	if branch.ID != reply.ID || branch.ReplyCount != 1 || len(branch.Replies) != 0 {
+		t.Errorf("Ветка должна быть обрезана на глубине 2: %+v", branch)
+	}
+	if branch.Reactions == nil {
+		t.Errorf("Ожидалась сводка реакций у ответа")
+	}
+
+	// Обрезанную ветку подгружают по parent_id
+	more := thread(fmt.Sprintf("post_id=%d&parent_id=%d", post.ID, reply.ID))
+	if len(more) != 1 || more[0].ID != nested.ID {
+		t.Errorf("Ожидался вложенный ответ %d, получено: %+v", nested.ID, more)
+	}
+
+	if rec := authorizedGet(comments.GetThread, "/api/index/comments/thread", alicePair.AccessToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("Без post_id: ожидался статус 400, получен: %d", rec.Code)
+	}
+
+	// Удалённый комментарий с ответами становится "надгробием", ветка остаётся
+	if err := st.Comments.Delete(ctx, root.ID); err != nil {
+		t.Fatalf("Не удалось удалить комментарий: %s", err)
+	}
+	tree = thread(fmt.Sprintf("post_id=%d", post.ID))
+	if len(tree) != 1 || !tree[0].Deleted || tree[0].Content != "" || tree[0].Username != "" || len(tree[0].Replies) != 1 {
+		t.Fatalf("Ожидалось надгробие с сохранёнными ответами: %+v", tree)
+	}
+	if _, err := st.Comments.GetByID(ctx, root.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Надгробие не должно находиться по ID, получено: %v", err)
+	}
+	rec = authorizedJSON(comments.CreateComment, "/api/index/comments/create", bobPair.AccessToken,
+		map[string]interface{}{"post_id": post.ID, "parent_id": root.ID, "content": "late"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Ответ на удалённый комментарий: ожидался статус 404, получен: %d", rec.Code)
+	}
+
+	// Когда у надгробия не остаётся ответов, оно удаляется вместе с последним
+	st.Comments.Delete(ctx, nested.ID)
+	st.Comments.Delete(ctx, reply.ID)
+	if tree := thread(fmt.Sprintf("post_id=%d", post.ID)); len(tree) != 0 {
+		t.Errorf("Ожидалась пустая ветка, получено: %+v", tree)
+	}
+	if n, _ := st.Comments.Count(ctx); n != 0 {
+		t.Errorf("Ожидалось 0 комментариев, получено: %d", n)
+	}
+}
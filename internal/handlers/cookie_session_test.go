@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestCookieSessionLoginRefreshLogout(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	hash, _ := auth.HashPassword("secret-password")
+	user := models.NewUser("alice", "alice@example.com", hash)
+	st.Users.Create(ctx, user)
+	st.Users.Activate(ctx, user.Email)
+
+	sessions := auth.NewSessionManager(st)
+	users := NewUserHandler(st, sessions, auth.NewLoginGuard(st), nil)
+	handler := NewSessionHandler(sessions)
+
+	body, _ := json.Marshal(map[string]string{"email": user.Email, "password": "secret-password"})
+	req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader(body))
+	req.Header.Set(middleware.SessionModeHeader, "cookie")
+	rec := httptest.NewRecorder()
+	users.Login(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	data := decodeBody(t, rec)
+	if data["session_mode"] != "cookie" || data["token"] != nil || data["refresh_token"] != nil {
+		t.Fatalf("В режиме cookie токены не должны попадать в тело ответа: %v", data)
+	}
+	jar := map[string]*http.Cookie{}
+	for _, c := range rec.Result().Cookies() {
+		jar[c.Name] = c
+	}
+	if jar[middleware.AccessTokenCookie] == nil || jar[middleware.RefreshTokenCookie] == nil || jar[middleware.CSRFCookie] == nil {
+		t.Fatalf("Ожидались cookie сессии, получены: %v", rec.Result().Cookies())
+	}
+
+	withCookies := func(path, csrf string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		for _, c := range jar {
+			req.AddCookie(c)
+		}
+		if csrf != "" {
+			req.Header.Set(middleware.CSRFHeader, csrf)
+		}
+		return req
+	}
+
+	// Обновление без CSRF-токена отклоняется
+	rec = httptest.NewRecorder()
+	handler.Refresh(rec, withCookies("/api/token/refresh", ""))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Ожидался статус 403 без CSRF-токена, получен: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Refresh(rec, withCookies("/api/token/refresh", jar[middleware.CSRFCookie].Value))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 при обновлении, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	for _, c := range rec.Result().Cookies() {
+		jar[c.Name] = c
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Logout(rec, withCookies("/api/logout", jar[middleware.CSRFCookie].Value))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 при выходе, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			t.Errorf("Cookie %s должна быть удалена при выходе", c.Name)
+		}
+	}
+	claims, _ := auth.VerifyToken(jar[middleware.AccessTokenCookie].Value)
+	if err := sessions.Validate(ctx, claims); err != auth.ErrTokenRevoked {
+		t.Errorf("Сессия должна быть отозвана, получено: %v", err)
+	}
+}
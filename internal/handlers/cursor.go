@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor turns a position into the opaque next_cursor string handed
+// to clients.
+func encodeCursor(c store.Cursor) string {
+	raw := strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + strconv.Itoa(c.ID)
+	if c.Score != 0 {
+		raw += ":" + strconv.Itoa(c.Score)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor. The empty string is
+// the zero Cursor, the start of the list.
+func decodeCursor(s string) (store.Cursor, error) {
+	if s == "" {
+		return store.Cursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return store.Cursor{}, errInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return store.Cursor{}, errInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return store.Cursor{}, errInvalidCursor
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil || id <= 0 {
+		return store.Cursor{}, errInvalidCursor
+	}
+	// Timestamp columns have no time zone and lib/pq sends the wall clock, so
+	// the cursor must be in UTC like the stored values, not in time.Local.
+	cursor := store.Cursor{Time: time.Unix(0, nanos).UTC(), ID: id}
+	if len(parts) == 3 {
+		if cursor.Score, err = strconv.Atoi(parts[2]); err != nil || cursor.Score < 0 {
+			return store.Cursor{}, errInvalidCursor
+		}
+	}
+	return cursor, nil
+}
+
+// pageParams reads ?cursor= and ?limit= from a cursor-paginated request.
+// The limit defaults to defaultPageSize and is capped at maxPageSize.
+func pageParams(r *http.Request) (store.Cursor, int, error) {
+	query := r.URL.Query()
+	cursor, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		return store.Cursor{}, 0, err
+	}
+	limit := defaultPageSize
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return store.Cursor{}, 0, errors.New("invalid limit")
+		}
+		limit = n
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return cursor, limit, nil
+}
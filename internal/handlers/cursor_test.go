@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+func TestDecodeCursorUsesUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	defer func() { time.Local = local }()
+
+	at := time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC)
+	cursor, err := decodeCursor(encodeCursor(store.Cursor{Time: at, ID: 7, Score: 3}))
+	if err != nil {
+		t.Fatalf("Не удалось разобрать курсор: %s", err)
+	}
+	if cursor.Time.Location() != time.UTC || cursor.Time.Hour() != 12 || !cursor.Time.Equal(at) {
+		t.Errorf("Ожидалось время %v в UTC, получено: %v", at, cursor.Time)
+	}
+	if cursor.ID != 7 || cursor.Score != 3 {
+		t.Errorf("Неверный курсор: %+v", cursor)
+	}
+}
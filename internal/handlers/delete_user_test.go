@@ -1,36 +1,45 @@
 package handlers_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pinokiochan/social-network-render/internal/auth"
 	"github.com/pinokiochan/social-network-render/internal/handlers"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 )
 
 func TestDeleteUser(t *testing.T) {
-	// Создание mock-базы данных
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Не удалось создать mock-базу данных: %s", err)
+	// Создание in-memory хранилища с одним пользователем
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	if err := st.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("Не удалось создать пользователя: %s", err)
 	}
-	defer db.Close()
 
-	// Моделируем выполнение SQL запроса на удаление пользователя
-	mock.ExpectExec("DELETE FROM users WHERE id = \\$1").
-		WithArgs(123).
-		WillReturnResult(sqlmock.NewResult(1, 1)) // Моделируем успешное удаление (1 строка затронута)
+	// Удаление выполняет администратор
+	admin := models.NewUser("root", "root@example.com", "hash")
+	admin.Role = models.RoleAdmin
+	if err := st.Users.Create(context.Background(), admin); err != nil {
+		t.Fatalf("Не удалось создать администратора: %s", err)
+	}
 
 	// Создание обработчика
-	handler := handlers.NewAdminHandler(db, nil)
+	handler := handlers.NewAdminHandler(st, auth.NewSessionManager(st), auth.NewPermissions(st), nil)
 
 	// Создание запроса DELETE
-	req, err := http.NewRequest("DELETE", "/api/admin/users/delete?id=123", nil)
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/api/admin/users/delete?id=%d", user.ID), nil)
 	if err != nil {
 		t.Fatalf("Не удалось создать запрос: %s", err)
 	}
+	principal := &middleware.Principal{UserID: admin.ID, Role: admin.Role}
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), principal))
 
 	// Регистрируем ответ
 	rec := httptest.NewRecorder()
@@ -53,8 +62,78 @@ func TestDeleteUser(t *testing.T) {
 		t.Errorf("Ожидался ответ %v, получен %v", expected, actual)
 	}
 
-	// Проверка всех ожиданий mock-базы данных
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Fatalf("Не все ожидания были выполнены: %s", err)
+	// Пользователь должен быть удалён из хранилища
+	if _, err := st.Users.GetByID(context.Background(), user.ID); err != store.ErrNotFound {
+		t.Fatalf("Ожидалась ошибка ErrNotFound, получено: %v", err)
+	}
+}
+
+func TestDeleteUserNotFound(t *testing.T) {
+	st := memory.New()
+	handler := handlers.NewAdminHandler(st, auth.NewSessionManager(st), auth.NewPermissions(st), nil)
+
+	req := httptest.NewRequest("DELETE", "/api/admin/users/delete?id=123", nil)
+	rec := httptest.NewRecorder()
+	handler.DeleteUser(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Ожидался статус 404, получен: %d", rec.Code)
+	}
+}
+
+func TestDeleteUserKeepsRepliesToTheirComments(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	admin := models.NewUser("root", "root@example.com", "hash")
+	admin.Role = models.RoleAdmin
+	alice := models.NewUser("alice", "alice@example.com", "hash")
+	bob := models.NewUser("bob", "bob@example.com", "hash")
+	for _, u := range []*models.User{admin, alice, bob} {
+		if err := st.Users.Create(ctx, u); err != nil {
+			t.Fatalf("Не удалось создать пользователя: %s", err)
+		}
+	}
+	post := &models.Post{UserID: admin.ID, Content: "hello"}
+	st.Posts.Create(ctx, post)
+
+	// У комментария bob есть ответ alice, у второго комментария ответов нет
+	answered := &models.Comment{PostID: post.ID, UserID: bob.ID, Content: "question"}
+	st.Comments.Create(ctx, answered)
+	reply := &models.Comment{PostID: post.ID, ParentID: answered.ID, UserID: alice.ID, Content: "answer"}
+	st.Comments.Create(ctx, reply)
+	lonely := &models.Comment{PostID: post.ID, UserID: bob.ID, Content: "nobody answered"}
+	st.Comments.Create(ctx, lonely)
+
+	handler := handlers.NewAdminHandler(st, auth.NewSessionManager(st), auth.NewPermissions(st), nil)
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/admin/users/delete?id=%d", bob.ID), nil)
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), &middleware.Principal{UserID: admin.ID, Role: admin.Role}))
+	rec := httptest.NewRecorder()
+	handler.DeleteUser(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 OK, получен: %d", rec.Code)
+	}
+
+	// Комментарий bob остаётся надгробием без автора, ответ alice на месте
+	thread, err := st.Comments.Thread(ctx, post.ID, 0, 2)
+	if err != nil {
+		t.Fatalf("Не удалось получить ветку: %s", err)
+	}
+	if len(thread) != 2 {
+		t.Fatalf("Ожидались надгробие и ответ, получено: %+v", thread)
+	}
+	tombstone, kept := thread[0], thread[1]
+	if tombstone.ID != answered.ID || !tombstone.Deleted || tombstone.UserID != 0 || tombstone.Content != "" || tombstone.ReplyCount != 1 {
+		t.Errorf("Ожидалось надгробие без автора с одним ответом: %+v", tombstone)
+	}
+	if kept.ID != reply.ID || kept.Deleted || kept.Username != "alice" {
+		t.Errorf("Ответ alice должен сохраниться: %+v", kept)
+	}
+
+	// Удаление последнего ответа убирает и надгробие
+	if err := st.Comments.Delete(ctx, reply.ID); err != nil {
+		t.Fatalf("Не удалось удалить ответ: %s", err)
+	}
+	if thread, _ := st.Comments.Thread(ctx, post.ID, 0, 2); len(thread) != 0 {
+		t.Errorf("Ожидалась пустая ветка, получено: %+v", thread)
 	}
 }
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/config"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// emailLink describes a single-use link mailed to an account, such as a
+// password reset or a passwordless login.
+type emailLink struct {
+	// name appears in logs and errors, e.g. "Password reset".
+	name    string
+	purpose string
+	ttl     time.Duration
+	// param is the query parameter that carries the token in the link.
+	param   string
+	subject string
+	// body is a format string taking the TTL in minutes and the link.
+	body string
+	// message is returned for every well-formed request, so the endpoint
+	// cannot be used to find out which addresses are registered.
+	message string
+	// activeOnly skips accounts whose email is not verified yet.
+	activeOnly bool
+}
+
+// emailLinkIssuer handles requests for one kind of email link: it validates
+// the address, rate-limits it and mails a hashed single-use token.
+type emailLinkIssuer struct {
+	link    emailLink
+	store   *store.Store
+	limiter *auth.RateLimiter
+	wg      *sync.WaitGroup
+}
+
+func newEmailLinkIssuer(s *store.Store, wg *sync.WaitGroup, link emailLink) *emailLinkIssuer {
+	return &emailLinkIssuer{
+		link:    link,
+		store:   s,
+		limiter: auth.NewRateLimiter(3, time.Hour),
+		wg:      wg,
+	}
+}
+
+// Request mails a link if the address belongs to an account. The response
+// is the same whether or not it does.
+func (l *emailLinkIssuer) Request(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.ToLower(l.link.name)
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || !utils.IsValidEmail(strings.TrimSpace(payload.Email)) {
+		logger.Log.WithFields(logrus.Fields{
+			"path": r.URL.Path,
+		}).Warn("Invalid " + name + " request")
+		http.Error(w, "Invalid email", http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(payload.Email)
+
+	if !l.limiter.Allow(strings.ToLower(email)) {
+		logger.Log.WithFields(logrus.Fields{
+			"email": email,
+			"ip":    r.RemoteAddr,
+		}).Warn(l.link.name + " rate limit exceeded")
+		http.Error(w, "Too many "+name+" requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	// The account lookup, the token and the email all happen after the
+	// response, so its timing does not depend on whether the account exists.
+	if l.wg != nil {
+		l.wg.Add(1)
+	}
+	go func() {
+		if l.wg != nil {
+			defer l.wg.Done()
+		}
+		if err := l.issue(context.Background(), email); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": err.Error(),
+				"email": email,
+			}).Error("Failed to issue " + name)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": l.link.message,
+	})
+}
+
+func (l *emailLinkIssuer) issue(ctx context.Context, email string) error {
+	user, err := l.store.Users.GetByEmail(ctx, email)
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"email": email,
+		}).Info(l.link.name + " requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if l.link.activeOnly && !user.IsActive {
+		logger.Log.WithFields(logrus.Fields{
+			"userID": user.ID,
+		}).Info(l.link.name + " requested for unverified account")
+		return nil
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(l.link.ttl)
+	if err := l.store.AuthTokens.Create(ctx, l.link.purpose, user.ID, auth.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/?%s=%s", config.BaseURL(), l.link.param, url.QueryEscape(token))
+	body := fmt.Sprintf(l.link.body, int(l.link.ttl.Minutes()), link)
+	if err := sendEmail(user.Email, l.link.subject, body, ""); err != nil {
+		return err
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID": user.ID,
+	}).Info(l.link.name + " issued")
+	return nil
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/timeline"
+	"github.com/sirupsen/logrus"
+)
+
+// FollowHandler serves the follow graph: following and unfollowing
+// accounts, follower counts and the followers/following lists.
+type FollowHandler struct {
+	store     *store.Store
+	timelines *timeline.Service
+}
+
+func NewFollowHandler(s *store.Store, timelines *timeline.Service) *FollowHandler {
+	return &FollowHandler{store: s, timelines: timelines}
+}
+
+// Follow makes the current user follow the account given by ?id=.
+func (h *FollowHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	targetID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if targetID == userID {
+		http.Error(w, "You cannot follow yourself", http.StatusBadRequest)
+		return
+	}
+
+	err = h.store.Follows.Follow(r.Context(), userID, targetID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"userID":   userID,
+			"targetID": targetID,
+		}).Error("Failed to follow user")
+		http.Error(w, "Error following user", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":   userID,
+		"targetID": targetID,
+	}).Info("User followed")
+
+	h.timelines.Followed(userID, targetID)
+
+	h.writeFollowState(w, r, userID, targetID)
+}
+
+// Unfollow stops the current user from following the account given by ?id=.
+func (h *FollowHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	targetID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.store.Follows.Unfollow(r.Context(), userID, targetID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Not following this user", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"userID":   userID,
+			"targetID": targetID,
+		}).Error("Failed to unfollow user")
+		http.Error(w, "Error unfollowing user", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":   userID,
+		"targetID": targetID,
+	}).Info("User unfollowed")
+
+	if err := h.timelines.Unfollowed(r.Context(), userID, targetID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"userID":   userID,
+			"targetID": targetID,
+		}).Error("Failed to remove unfollowed posts from timeline")
+	}
+
+	h.writeFollowState(w, r, userID, targetID)
+}
+
+// writeFollowState answers a follow or unfollow with the new relationship
+// and the target's follower count.
+func (h *FollowHandler) writeFollowState(w http.ResponseWriter, r *http.Request, userID, targetID int) {
+	following, err := h.store.Follows.IsFollowing(r.Context(), userID, targetID)
+	var counts models.FollowCounts
+	if err == nil {
+		counts, err = h.store.Follows.Counts(r.Context(), targetID)
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"targetID": targetID,
+		}).Error("Failed to fetch follow state")
+		http.Error(w, "Error fetching follow state", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "success",
+		"following": following,
+		"followers": counts.Followers,
+	})
+}
+
+// Profile returns the public profile of the account given by ?id=, or of
+// the current user without it: username, follower and following counts,
+// and whether the current user follows them.
+func (h *FollowHandler) Profile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, viewerID, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	counts, err := h.store.Follows.Counts(r.Context(), user.ID)
+	var following bool
+	if err == nil && viewerID != user.ID {
+		following, err = h.store.Follows.IsFollowing(r.Context(), viewerID, user.ID)
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": user.ID,
+		}).Error("Failed to fetch follow counts")
+		http.Error(w, "Error fetching profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":             user.ID,
+		"username":       user.Username,
+		"followers":      counts.Followers,
+		"following":      counts.Following,
+		"followed_by_me": following,
+	})
+}
+
+// Followers lists the accounts following the user given by ?id= (the
+// current user by default), most recent first. Pass the returned
+// next_cursor as ?cursor= to get the next page.
+func (h *FollowHandler) Followers(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, h.store.Follows.Followers)
+}
+
+// Following lists the accounts the user given by ?id= (the current user by
+// default) follows, most recent first, paginated like Followers.
+func (h *FollowHandler) Following(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, h.store.Follows.Following)
+}
+
+type followListFunc func(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.FollowUser, error)
+
+func (h *FollowHandler) list(w http.ResponseWriter, r *http.Request, fetch followListFunc) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cursor, limit, err := pageParams(r)
+	if err != nil {
+		http.Error(w, "Invalid cursor or limit", http.StatusBadRequest)
+		return
+	}
+	user, _, ok := h.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	users, err := fetch(r.Context(), user.ID, cursor, limit)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": user.ID,
+			"path":   r.URL.Path,
+		}).Error("Failed to list follows")
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+
+	nextCursor := ""
+	if len(users) == limit {
+		last := users[len(users)-1]
+		nextCursor = encodeCursor(store.Cursor{Time: last.FollowedAt, ID: last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":       users,
+		"next_cursor": nextCursor,
+	})
+}
+
+// targetUser resolves ?id= to a user, defaulting to the current user, and
+// also returns the current user's ID. It writes the error response and
+// returns false when it fails.
+func (h *FollowHandler) targetUser(w http.ResponseWriter, r *http.Request) (*models.User, int, bool) {
+	viewerID, ok := currentUserID(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+	targetID := viewerID
+	if s := r.URL.Query().Get("id"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return nil, 0, false
+		}
+		targetID = id
+	}
+
+	user, err := h.store.Users.GetByID(r.Context(), targetID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, 0, false
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": targetID,
+		}).Error("Failed to fetch user")
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	return user, viewerID, true
+}
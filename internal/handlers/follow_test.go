@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+	"github.com/pinokiochan/social-network-render/internal/timeline"
+)
+
+func authorizedGet(handler http.HandlerFunc, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if claims, err := auth.VerifyToken(token); err == nil {
+		req = req.WithContext(middleware.WithPrincipal(req.Context(), middleware.NewPrincipal(claims)))
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestFollowAndHomeFeed(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	alice := models.NewUser("alice", "alice@example.com", "hash")
+	bob := models.NewUser("bob", "bob@example.com", "hash")
+	carol := models.NewUser("carol", "carol@example.com", "hash")
+	for _, u := range []*models.User{alice, bob, carol} {
+		st.Users.Create(ctx, u)
+	}
+
+	var wg sync.WaitGroup
+	timelines := timeline.NewService(st, timeline.Config{FanoutLimit: 100, MaxEntries: 100}, &wg)
+	sessions := auth.NewSessionManager(st)
+	follows := NewFollowHandler(st, timelines)
+	posts := NewPostHandler(st, auth.NewPermissions(st), timelines)
+	pair, _ := sessions.Start(ctx, alice)
+
+	if rec := authorizedJSON(follows.Follow, fmt.Sprintf("/api/users/follow?id=%d", alice.ID), pair.AccessToken, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Подписка на себя: ожидался статус 400, получен: %d", rec.Code)
+	}
+	if rec := authorizedJSON(follows.Follow, "/api/users/follow?id=999", pair.AccessToken, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Неизвестный пользователь: ожидался статус 404, получен: %d", rec.Code)
+	}
+	rec := authorizedJSON(follows.Follow, fmt.Sprintf("/api/users/follow?id=%d", bob.ID), pair.AccessToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	// Повторная подписка ничего не меняет
+	rec = authorizedJSON(follows.Follow, fmt.Sprintf("/api/users/follow?id=%d", bob.ID), pair.AccessToken, nil)
+	if body := decodeBody(t, rec); body["following"] != true || body["followers"] != float64(1) {
+		t.Errorf("Неверное состояние подписки: %v", body)
+	}
+
+	rec = authorizedGet(follows.Profile, fmt.Sprintf("/api/users/profile?id=%d", bob.ID), pair.AccessToken)
+	if body := decodeBody(t, rec); body["followers"] != float64(1) || body["following"] != float64(0) || body["followed_by_me"] != true {
+		t.Errorf("Неверный профиль: %v", body)
+	}
+	rec = authorizedGet(follows.Followers, fmt.Sprintf("/api/users/followers?id=%d", bob.ID), pair.AccessToken)
+	users := decodeBody(t, rec)["users"].([]interface{})
+	if len(users) != 1 || users[0].(map[string]interface{})["username"] != "alice" {
+		t.Errorf("Ожидалось, что на bob подписана alice, получено: %v", users)
+	}
+
+	for i := 0; i < 3; i++ {
+		st.Posts.Create(ctx, &models.Post{UserID: bob.ID, Content: fmt.Sprintf("bob %d", i)})
+		st.Posts.Create(ctx, &models.Post{UserID: carol.ID, Content: fmt.Sprintf("carol %d", i)})
+	}
+	st.Posts.Create(ctx, &models.Post{UserID: alice.ID, Content: "alice"})
+
+	// Лента по две записи: свои посты и посты bob, без carol
+	var contents []string
+	path := "/api/feed/home?limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatalf("Пагинация не заканчивается")
+		}
+		rec := authorizedGet(posts.HomeFeed, path, pair.AccessToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+		}
+		body := decodeBody(t, rec)
+		for _, p := range body["posts"].([]interface{}) {
+			contents = append(contents, p.(map[string]interface{})["content"].(string))
+		}
+		path = ""
+		// Первый запрос строит ленту в фоне, следующие читают её
+		wg.Wait()
+		if next := body["next_cursor"].(string); next != "" {
+			path = "/api/feed/home?limit=2&cursor=" + url.QueryEscape(next)
+		}
+	}
+	want := []string{"alice", "bob 2", "bob 1", "bob 0"}
+	if fmt.Sprint(contents) != fmt.Sprint(want) {
+		t.Errorf("Ожидалась лента %v, получена: %v", want, contents)
+	}
+
+	if rec := authorizedGet(posts.HomeFeed, "/api/feed/home?cursor=garbage", pair.AccessToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("Неверный курсор: ожидался статус 400, получен: %d", rec.Code)
+	}
+
+	rec = authorizedJSON(follows.Unfollow, fmt.Sprintf("/api/users/unfollow?id=%d", bob.ID), pair.AccessToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	if rec := authorizedJSON(follows.Unfollow, fmt.Sprintf("/api/users/unfollow?id=%d", bob.ID), pair.AccessToken, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Повторная отписка: ожидался статус 404, получен: %d", rec.Code)
+	}
+	rec = authorizedGet(posts.HomeFeed, "/api/feed/home", pair.AccessToken)
+	if feed := decodeBody(t, rec)["posts"].([]interface{}); len(feed) != 1 {
+		t.Errorf("После отписки в ленте должны остаться только свои посты, получено: %v", feed)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestAdminImpersonation(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	admin := models.NewUser("admin", "admin@example.com", "hash")
+	admin.Role = models.RoleAdmin
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	superadmin := models.NewUser("root", "root@example.com", "hash")
+	superadmin.Role = models.RoleSuperadmin
+	for _, u := range []*models.User{admin, user, superadmin} {
+		st.Users.Create(ctx, u)
+	}
+
+	sessions := auth.NewSessionManager(st)
+	admins := NewAdminHandler(st, sessions, auth.NewPermissions(st), nil)
+	adminPair, _ := sessions.Start(ctx, admin)
+	impersonate := func(id int, payload interface{}) *httptest.ResponseRecorder {
+		return authorizedJSON(admins.Impersonate, fmt.Sprintf("/api/admin/users/impersonate?id=%d", id), adminPair.AccessToken, payload)
+	}
+
+	if rec := impersonate(admin.ID, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался статус 400 для самого себя, получен: %d", rec.Code)
+	}
+	if rec := impersonate(superadmin.ID, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Ожидался статус 403 для старшей роли, получен: %d", rec.Code)
+	}
+
+	// Без тела запроса токен только для чтения
+	rec := impersonate(user.ID, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	data := decodeBody(t, rec)
+	if data["read_only"] != true {
+		t.Errorf("Ожидался токен только для чтения, получено: %v", data["read_only"])
+	}
+	claims, err := auth.VerifyToken(data["token"].(string))
+	if err != nil {
+		t.Fatalf("Выдан неверный токен: %s", err)
+	}
+	if claims.UserID != user.ID || claims.Impersonator != admin.ID || !claims.ReadOnly {
+		t.Errorf("Неверные claims токена: %+v", claims)
+	}
+
+	rec = impersonate(user.ID, map[string]bool{"read_only": false})
+	if data := decodeBody(t, rec); rec.Code != http.StatusOK || data["read_only"] != false {
+		t.Errorf("Ожидался токен с правом записи, получено: %d %v", rec.Code, data)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/impersonation-log", nil)
+	adminClaims, _ := auth.VerifyToken(adminPair.AccessToken)
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), middleware.NewPrincipal(adminClaims)))
+	logRec := httptest.NewRecorder()
+	admins.ImpersonationLog(logRec, req)
+	events, _ := decodeBody(t, logRec)["events"].([]interface{})
+	if len(events) != 2 {
+		t.Fatalf("Ожидалось 2 записи в журнале, получено: %s", logRec.Body.String())
+	}
+
+	// Выход из токена имперсонации не завершает сессию администратора
+	sessionsHandler := NewSessionHandler(sessions)
+	if rec := authorizedJSON(sessionsHandler.Logout, "/api/logout", data["token"].(string), nil); rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 при выходе, получен: %d", rec.Code)
+	}
+	if err := sessions.Validate(ctx, adminClaims); err != nil {
+		t.Errorf("Сессия администратора не должна быть отозвана: %s", err)
+	}
+	if err := sessions.Validate(ctx, claims); err != auth.ErrTokenRevoked {
+		t.Errorf("Токен имперсонации должен быть отозван, получено: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/config"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxInviteDays caps the optional expiry of invite codes.
+	maxInviteDays = 365
+	// maxInviteUses caps multi-use codes; 0 still means unlimited.
+	maxInviteUses = 10000
+	// invitePrefixLength characters of the code are kept to tell codes apart.
+	invitePrefixLength = 6
+)
+
+// InviteHandler lets admins manage registration invite codes.
+type InviteHandler struct {
+	store *store.Store
+}
+
+func NewInviteHandler(s *store.Store) *InviteHandler {
+	return &InviteHandler{store: s}
+}
+
+// List returns every invite code without the codes themselves.
+func (h *InviteHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	invites, err := h.store.Invites.List(r.Context())
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to list invites")
+		http.Error(w, "Error fetching invites", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"invites": invites,
+	})
+}
+
+// Create generates an invite code. max_uses defaults to 1 and 0 means
+// unlimited; expires_in_days 0 means the code does not expire. The code and
+// a registration link are returned only in this response.
+func (h *InviteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	adminID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Note          string `json:"note"`
+		MaxUses       *int   `json:"max_uses"`
+		ExpiresInDays int    `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Invalid JSON format")
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	input.Note = strings.TrimSpace(input.Note)
+	if len(input.Note) > 255 {
+		http.Error(w, "Note must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+	maxUses := 1
+	if input.MaxUses != nil {
+		maxUses = *input.MaxUses
+	}
+	if maxUses < 0 || maxUses > maxInviteUses {
+		http.Error(w, "max_uses must be between 0 (unlimited) and 10000", http.StatusBadRequest)
+		return
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxInviteDays {
+		http.Error(w, "expires_in_days must be between 0 (no expiry) and 365", http.StatusBadRequest)
+		return
+	}
+
+	code, err := auth.RandomToken(12)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to generate invite code")
+		http.Error(w, "Error creating invite", http.StatusInternalServerError)
+		return
+	}
+	invite := &models.Invite{
+		CodeHash:  auth.HashToken(code),
+		Prefix:    code[:invitePrefixLength],
+		Note:      input.Note,
+		CreatedBy: adminID,
+		MaxUses:   maxUses,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(input.ExpiresInDays) * 24 * time.Hour)
+		invite.ExpiresAt = &expiresAt
+	}
+	if err := h.store.Invites.Create(r.Context(), invite); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":   err.Error(),
+			"adminID": adminID,
+		}).Error("Failed to create invite")
+		http.Error(w, "Error creating invite", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"adminID":  adminID,
+		"inviteID": invite.ID,
+		"maxUses":  maxUses,
+	}).Info("Invite created")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"code":   code,
+		"link":   config.BaseURL() + "/?invite=" + url.QueryEscape(code),
+		"invite": invite,
+	})
+}
+
+// Revoke stops the invite ?id= from registering more accounts. Accounts
+// already registered with it are not affected.
+func (h *InviteHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.store.Invites.Revoke(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"inviteID": id,
+		}).Error("Failed to revoke invite")
+		http.Error(w, "Error revoking invite", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"inviteID": id,
+	}).Info("Invite revoked")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+	})
+}
+
+// Redemptions lists the accounts registered with the invite ?id=, that is
+// who its creator invited.
+func (h *InviteHandler) Redemptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
+
+	redemptions, err := h.store.Invites.Redemptions(r.Context(), id)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"inviteID": id,
+		}).Error("Failed to list invite redemptions")
+		http.Error(w, "Error fetching invite redemptions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"redemptions": redemptions,
+	})
+}
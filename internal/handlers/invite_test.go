@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	captureEmails(t)
+	ctx := context.Background()
+	st := memory.New()
+	admin := models.NewUser("admin", "admin@example.com", "hash")
+	admin.Role = models.RoleAdmin
+	st.Users.Create(ctx, admin)
+
+	sessions := auth.NewSessionManager(st)
+	users := NewUserHandler(st, sessions, auth.NewLoginGuard(st), nil)
+	users.registration = auth.RegistrationPolicy{Mode: auth.RegistrationInvite}
+	invites := NewInviteHandler(st)
+	adminPair, _ := sessions.Start(ctx, admin)
+
+	register := func(username, code string) *httptest.ResponseRecorder {
+		return postJSON(users.Register, "/api/register", map[string]string{
+			"username":    username,
+			"email":       username + "@example.com",
+			"password":    "correct horse battery staple",
+			"invite_code": code,
+		})
+	}
+
+	if rec := register("alice", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("Без приглашения ожидался статус 403, получен: %d", rec.Code)
+	}
+	if rec := register("alice", "not-a-code"); rec.Code != http.StatusForbidden {
+		t.Fatalf("С неверным кодом ожидался статус 403, получен: %d", rec.Code)
+	}
+
+	rec := authorizedJSON(invites.Create, "/api/admin/invites/create", adminPair.AccessToken, map[string]interface{}{
+		"note": "first-year students",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Ожидался статус 201, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	code := decodeBody(t, rec)["code"].(string)
+
+	// По умолчанию код одноразовый
+	if rec := register("alice", code); rec.Code != http.StatusCreated {
+		t.Fatalf("С приглашением ожидался статус 201, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	if rec := register("bob", code); rec.Code != http.StatusForbidden {
+		t.Fatalf("Повторное использование кода: ожидался статус 403, получен: %d", rec.Code)
+	}
+	if _, err := st.Users.GetByEmail(ctx, "bob@example.com"); err == nil {
+		t.Errorf("Аккаунт без действующего приглашения не должен создаваться")
+	}
+
+	list, _ := st.Invites.List(ctx)
+	if len(list) != 1 || list[0].Uses != 1 || list[0].CreatedBy != admin.ID {
+		t.Fatalf("Неверное состояние приглашения: %+v", list)
+	}
+	redemptions, _ := st.Invites.Redemptions(ctx, list[0].ID)
+	if len(redemptions) != 1 || redemptions[0].Username != "alice" {
+		t.Errorf("Ожидалось, что приглашением воспользовалась alice, получено: %+v", redemptions)
+	}
+
+	// Отозванный многоразовый код больше не принимается
+	rec = authorizedJSON(invites.Create, "/api/admin/invites/create", adminPair.AccessToken, map[string]interface{}{
+		"max_uses": 0, "expires_in_days": 7,
+	})
+	unlimited := decodeBody(t, rec)
+	if rec := register("carol", unlimited["code"].(string)); rec.Code != http.StatusCreated {
+		t.Fatalf("Ожидался статус 201, получен: %d", rec.Code)
+	}
+	id := int(unlimited["invite"].(map[string]interface{})["id"].(float64))
+	if rec := authorizedJSON(invites.Revoke, fmt.Sprintf("/api/admin/invites/revoke?id=%d", id), adminPair.AccessToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 при отзыве, получен: %d", rec.Code)
+	}
+	if rec := register("dave", unlimited["code"].(string)); rec.Code != http.StatusForbidden {
+		t.Errorf("Отозванный код: ожидался статус 403, получен: %d", rec.Code)
+	}
+}
+
+func TestDomainRestrictedRegistration(t *testing.T) {
+	captureEmails(t)
+	st := memory.New()
+	users := NewUserHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st), nil)
+	users.registration = auth.RegistrationPolicy{Mode: auth.RegistrationDomains, AllowedDomains: []string{"astanait.edu.kz"}}
+
+	register := func(email string) int {
+		return postJSON(users.Register, "/api/register", map[string]string{
+			"username": "student",
+			"email":    email,
+			"password": "correct horse battery staple",
+		}).Code
+	}
+	if code := register("student@gmail.com"); code != http.StatusForbidden {
+		t.Errorf("Чужой домен: ожидался статус 403, получен: %d", code)
+	}
+	if code := register("student@astanait.edu.kz"); code != http.StatusCreated {
+		t.Errorf("Разрешенный домен: ожидался статус 201, получен: %d", code)
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+)
+
+type JWKSHandler struct {
+	keys *auth.KeyManager
+}
+
+func NewJWKSHandler(keys *auth.KeyManager) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// ServeJWKS publishes the public keys that verify access tokens, current and
+// retired, so other services can check tokens without sharing a secret.
+func (h *JWKSHandler) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": h.keys.JWKS(),
+	})
+}
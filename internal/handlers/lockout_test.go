@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestLoginLockoutAndAdminUnlock(t *testing.T) {
+	sent := captureEmails(t)
+	ctx := context.Background()
+	st := memory.New()
+	hash, _ := auth.HashPassword("secret-password")
+	user := models.NewUser("alice", "alice@example.com", hash)
+	st.Users.Create(ctx, user)
+	st.Users.Activate(ctx, user.Email)
+	admin := models.NewUser("admin", "admin@example.com", "hash")
+	admin.Role = models.RoleAdmin
+	st.Users.Create(ctx, admin)
+
+	var wg sync.WaitGroup
+	sessions := auth.NewSessionManager(st)
+	users := NewUserHandler(st, sessions, auth.NewLoginGuard(st), &wg)
+	// Без задержек, блокировка после трёх ошибок
+	policy := auth.LockoutPolicy{LockAfter: 3, LockDuration: time.Hour, ResetAfter: time.Hour}
+	users.loginGuard = auth.NewLoginGuardWithPolicy(st, policy, auth.LockoutPolicy{ResetAfter: time.Hour})
+
+	login := func(password string) int {
+		return postJSON(users.Login, "/api/login", map[string]string{"email": user.Email, "password": password}).Code
+	}
+	for i := 0; i < 3; i++ {
+		if code := login("wrong-password"); code != http.StatusUnauthorized {
+			t.Fatalf("Попытка %d: ожидался статус 401, получен: %d", i+1, code)
+		}
+	}
+	wg.Wait()
+	if len(*sent) != 1 || !strings.Contains((*sent)[0], "locked") {
+		t.Fatalf("Ожидалось письмо о блокировке, отправлено: %q", *sent)
+	}
+
+	// Даже верный пароль не принимается, пока аккаунт заблокирован
+	rec := postJSON(users.Login, "/api/login", map[string]string{"email": user.Email, "password": "secret-password"})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("Ожидался статус 429 с Retry-After, получен: %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	adminPair, _ := sessions.Start(ctx, admin)
+	admins := NewAdminHandler(st, sessions, auth.NewPermissions(st), nil)
+	unlock := authorizedJSON(admins.UnlockUser, fmt.Sprintf("/api/admin/users/unlock?id=%d", user.ID), adminPair.AccessToken, nil)
+	if unlock.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 при разблокировке, получен: %d (%s)", unlock.Code, unlock.Body.String())
+	}
+	if code := login("secret-password"); code != http.StatusOK {
+		t.Errorf("После разблокировки ожидался статус 200, получен: %d", code)
+	}
+}
+
+func TestLoginUnknownEmailLooksLikeWrongPassword(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	hash, _ := auth.HashPassword("secret-password")
+	user := models.NewUser("alice", "alice@example.com", hash)
+	st.Users.Create(ctx, user)
+	st.Users.Activate(ctx, user.Email)
+	users := NewUserHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st), nil)
+
+	known := postJSON(users.Login, "/api/login", map[string]string{"email": user.Email, "password": "wrong-password"})
+	unknown := postJSON(users.Login, "/api/login", map[string]string{"email": "nobody@example.com", "password": "wrong-password"})
+	if known.Code != unknown.Code || known.Body.String() != unknown.Body.String() {
+		t.Errorf("Ответы различаются: %d %q, %d %q", known.Code, known.Body.String(), unknown.Code, unknown.Body.String())
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const loginLinkTTL = 15 * time.Minute
+
+// LoginLinkHandler implements passwordless login: a single-use link sent by
+// email stands in for the password.
+type LoginLinkHandler struct {
+	store    *store.Store
+	sessions *auth.SessionManager
+	links    *emailLinkIssuer
+}
+
+func NewLoginLinkHandler(s *store.Store, sessions *auth.SessionManager, wg *sync.WaitGroup) *LoginLinkHandler {
+	return &LoginLinkHandler{
+		store:    s,
+		sessions: sessions,
+		links: newEmailLinkIssuer(s, wg, emailLink{
+			name:    "Login link",
+			purpose: models.TokenPurposeLoginLink,
+			ttl:     loginLinkTTL,
+			param:   "login_token",
+			subject: "Your login link",
+			body: "A login link was requested for your account.\n\n" +
+				"Open this link within %d minutes to log in. It works only once:\n%s\n\n" +
+				"If you did not request this, you can ignore this email.",
+			message:    "If an active account with that email exists, a login link has been sent",
+			activeOnly: true,
+		}),
+	}
+}
+
+// Request emails a login link if the address belongs to an active account.
+// The response is the same whether or not it does.
+func (h *LoginLinkHandler) Request(w http.ResponseWriter, r *http.Request) {
+	h.links.Request(w, r)
+}
+
+// Login exchanges the token from a login link for a session, or for a
+// second-factor challenge when the account has two-factor authentication.
+func (h *LoginLinkHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Token == "" {
+		http.Error(w, "Missing login token", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.store.AuthTokens.Consume(r.Context(), models.TokenPurposeLoginLink, auth.HashToken(payload.Token), time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"ip": r.RemoteAddr,
+		}).Warn("Invalid or expired login link")
+		http.Error(w, "Invalid or expired login link", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to consume login link")
+		http.Error(w, "Error logging in", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to load user of login link")
+		http.Error(w, "Error logging in", http.StatusInternalServerError)
+		return
+	}
+	if !user.IsActive {
+		http.Error(w, "Email not verified", http.StatusBadRequest)
+		return
+	}
+
+	// Any other link that is still in the inbox stops working.
+	if err := h.store.AuthTokens.InvalidateForUser(r.Context(), models.TokenPurposeLoginLink, userID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to invalidate outstanding login links")
+	}
+
+	completeLogin(w, r, h.store, h.sessions, user, "login_link")
+}
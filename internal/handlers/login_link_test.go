@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func loginTokenFromEmail(t *testing.T, body string) string {
+	i := strings.Index(body, "login_token=")
+	if i < 0 {
+		t.Fatalf("В письме нет ссылки для входа: %q", body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(body[i+len("login_token="):])[0])
+	if err != nil {
+		t.Fatalf("Не удалось разобрать токен: %s", err)
+	}
+	return token
+}
+
+func TestLoginLinkFlow(t *testing.T) {
+	sent := captureEmails(t)
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	st.Users.Create(ctx, user)
+	st.Users.Activate(ctx, user.Email)
+	inactive := models.NewUser("bob", "bob@example.com", "hash")
+	st.Users.Create(ctx, inactive)
+
+	var wg sync.WaitGroup
+	handler := NewLoginLinkHandler(st, auth.NewSessionManager(st), &wg)
+
+	known := postJSON(handler.Request, "/api/login/link/request", map[string]string{"email": user.Email})
+	unknown := postJSON(handler.Request, "/api/login/link/request", map[string]string{"email": "nobody@example.com"})
+	unverified := postJSON(handler.Request, "/api/login/link/request", map[string]string{"email": inactive.Email})
+	wg.Wait()
+
+	// Ответ не раскрывает, есть ли аккаунт и подтверждён ли он
+	if known.Code != http.StatusOK || known.Body.String() != unknown.Body.String() || known.Body.String() != unverified.Body.String() {
+		t.Fatalf("Ответы различаются: %d %q, %q, %q", known.Code, known.Body.String(), unknown.Body.String(), unverified.Body.String())
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("Ожидалось одно письмо, отправлено: %d", len(*sent))
+	}
+	token := loginTokenFromEmail(t, (*sent)[0])
+
+	rec := postJSON(handler.Login, "/api/login/link", map[string]string{"token": token})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	claims, err := auth.VerifyToken(decodeBody(t, rec)["token"].(string))
+	if err != nil || claims.UserID != user.ID {
+		t.Fatalf("Выдан неверный токен: %+v, %v", claims, err)
+	}
+
+	// Ссылка одноразовая
+	if rec := postJSON(handler.Login, "/api/login/link", map[string]string{"token": token}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Повторный вход по ссылке: ожидался статус 401, получен: %d", rec.Code)
+	}
+}
+
+func TestLoginLinkIsNotAPasswordResetToken(t *testing.T) {
+	captureEmails(t)
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	st.Users.Create(ctx, user)
+	st.Users.Activate(ctx, user.Email)
+	sessions := auth.NewSessionManager(st)
+
+	if err := st.AuthTokens.Create(ctx, models.TokenPurposePasswordReset, user.ID, auth.HashToken("reset-token"), time.Now().Add(loginLinkTTL)); err != nil {
+		t.Fatalf("Не удалось создать токен: %s", err)
+	}
+	links := NewLoginLinkHandler(st, sessions, nil)
+	if rec := postJSON(links.Login, "/api/login/link", map[string]string{"token": "reset-token"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Токен сброса пароля принят как ссылка для входа: %d", rec.Code)
+	}
+
+	// Второй фактор по-прежнему нужен
+	st.TOTP.SavePending(ctx, user.ID, "JBSWY3DPEHPK3PXP")
+	st.TOTP.Enable(ctx, user.ID, 0)
+	st.AuthTokens.Create(ctx, models.TokenPurposeLoginLink, user.ID, auth.HashToken("link-token"), time.Now().Add(loginLinkTTL))
+	rec := postJSON(links.Login, "/api/login/link", map[string]string{"token": "link-token"})
+	if data := decodeBody(t, rec); data["mfa_required"] != true || data["token"] != nil {
+		t.Errorf("Ожидался запрос второго фактора, получено: %v", data)
+	}
+}
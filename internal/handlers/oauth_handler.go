@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/config"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/oidc"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// oauthStateTTL is how long the user has to log in at the provider.
+	oauthStateTTL = 10 * time.Minute
+	// maxUsernameLength keeps generated usernames well inside the column.
+	maxUsernameLength = 40
+	// oauthModeCookie remembers across the provider round trip that the
+	// login should end in a cookie session.
+	oauthModeCookie = "oauth_session_mode"
+	// oauthStateCookie binds the state to the browser that started the
+	// login, so a callback URL cannot be replayed in someone else's browser.
+	// It holds the state's hash, like the server-side record.
+	oauthStateCookie = "oauth_state"
+)
+
+var (
+	errEmailNotVerified = errors.New("provider did not verify the email address")
+	errEmailNotAllowed  = errors.New("email domain is not allowed for this provider")
+	errInviteRequired   = errors.New("registration requires an invite code")
+)
+
+// OAuthHandler logs users in through external OpenID Connect providers.
+type OAuthHandler struct {
+	store     *store.Store
+	sessions  *auth.SessionManager
+	providers map[string]*oidc.Provider
+	// order keeps the configured order for the login page.
+	order []string
+	// registration limits which new accounts an external login may create.
+	// There is no way to enter an invite code, so invite holders register
+	// with a password first and link the provider on a later login.
+	registration auth.RegistrationPolicy
+}
+
+func NewOAuthHandler(s *store.Store, sessions *auth.SessionManager, providers []*oidc.Provider) *OAuthHandler {
+	h := &OAuthHandler{
+		store:        s,
+		sessions:     sessions,
+		providers:    make(map[string]*oidc.Provider),
+		registration: registrationPolicy(),
+	}
+	for _, p := range providers {
+		h.providers[p.Name()] = p
+		h.order = append(h.order, p.Name())
+	}
+	return h
+}
+
+// Providers lists the configured providers for the login page.
+func (h *OAuthHandler) Providers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	providers := make([]map[string]string, 0, len(h.order))
+	for _, name := range h.order {
+		providers = append(providers, map[string]string{
+			"name":         name,
+			"display_name": h.providers[name].DisplayName(),
+			"login_url":    "/api/oauth/start?provider=" + url.QueryEscape(name),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "success",
+		"providers": providers,
+	})
+}
+
+// Start redirects the browser to the provider. state, nonce and the PKCE
+// code verifier are kept server-side until the provider redirects back, and
+// the browser gets a cookie naming the state it started.
+// ?session=cookie makes the callback log in with session cookies.
+func (h *OAuthHandler) Start(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, ok := h.providers[r.URL.Query().Get("provider")]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	state, err := auth.RandomToken(32)
+	if err != nil {
+		h.startFailed(w, provider, err)
+		return
+	}
+	nonce, err := auth.RandomToken(32)
+	if err != nil {
+		h.startFailed(w, provider, err)
+		return
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		h.startFailed(w, provider, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		h.startFailed(w, provider, err)
+		return
+	}
+	err = h.store.OAuth.CreateState(r.Context(), &models.OAuthState{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+	})
+	if err != nil {
+		h.startFailed(w, provider, err)
+		return
+	}
+
+	// Lax, because the provider's redirect back is a cross-site navigation
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    auth.HashToken(state),
+		Path:     "/api/oauth/callback",
+		MaxAge:   int(oauthStateTTL / time.Second),
+		HttpOnly: true,
+		Secure:   config.SecureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	if r.URL.Query().Get("session") == "cookie" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthModeCookie,
+			Value:    "cookie",
+			Path:     "/api/oauth/callback",
+			MaxAge:   int(oauthStateTTL / time.Second),
+			HttpOnly: true,
+			Secure:   config.SecureCookies(),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (h *OAuthHandler) startFailed(w http.ResponseWriter, provider *oidc.Provider, err error) {
+	logger.Log.WithFields(logrus.Fields{
+		"error":    err.Error(),
+		"provider": provider.Name(),
+	}).Error("Failed to start OAuth login")
+	http.Error(w, "Login provider is unavailable", http.StatusBadGateway)
+}
+
+// Callback completes the login when the provider redirects back. The result
+// is handed to the login page in the URL fragment, which never reaches
+// server logs or the Referer header.
+func (h *OAuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		logger.Log.WithFields(logrus.Fields{
+			"error":       providerError,
+			"description": query.Get("error_description"),
+		}).Warn("Identity provider returned an error")
+		h.redirectError(w, r, "provider_error")
+		return
+	}
+
+	// A state started in another browser is left alone: this callback URL
+	// was handed to the victim of a login CSRF.
+	stateHash := auth.HashToken(query.Get("state"))
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/api/oauth/callback", MaxAge: -1})
+	if c, err := r.Cookie(oauthStateCookie); err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(stateHash)) != 1 {
+		logger.Log.WithFields(logrus.Fields{
+			"path": r.URL.Path,
+		}).Warn("OAuth callback without the state cookie of its login")
+		h.redirectError(w, r, "invalid_state")
+		return
+	}
+
+	// The state is single-use: it is deleted whether or not the rest of
+	// the login succeeds.
+	state, err := h.store.OAuth.ConsumeState(r.Context(), stateHash, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"path": r.URL.Path,
+		}).Warn("OAuth callback with unknown or expired state")
+		h.redirectError(w, r, "invalid_state")
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to load OAuth state")
+		h.redirectError(w, r, "server_error")
+		return
+	}
+	provider, ok := h.providers[state.Provider]
+	if !ok {
+		h.redirectError(w, r, "invalid_state")
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"provider": provider.Name(),
+		}).Error("Failed to exchange authorization code")
+		h.redirectError(w, r, "exchange_failed")
+		return
+	}
+	idToken, err := provider.Verify(r.Context(), rawIDToken, state.Nonce)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"provider": provider.Name(),
+		}).Warn("Rejected ID token")
+		h.redirectError(w, r, "invalid_token")
+		return
+	}
+
+	user, err := h.resolveUser(r.Context(), provider, idToken)
+	if errors.Is(err, errEmailNotVerified) || errors.Is(err, errEmailNotAllowed) {
+		logger.Log.WithFields(logrus.Fields{
+			"provider": provider.Name(),
+			"subject":  idToken.Subject,
+			"email":    idToken.Email,
+		}).Warn(err.Error())
+		h.redirectError(w, r, "email_not_allowed")
+		return
+	}
+	if errors.Is(err, errInviteRequired) {
+		logger.Log.WithFields(logrus.Fields{
+			"provider": provider.Name(),
+			"email":    idToken.Email,
+		}).Warn("External login cannot register without an invite")
+		h.redirectError(w, r, "registration_closed")
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"provider": provider.Name(),
+			"subject":  idToken.Subject,
+		}).Error("Failed to link external identity")
+		h.redirectError(w, r, "server_error")
+		return
+	}
+
+	// The provider replaces the password, not the second factor.
+	mfaEnabled, err := twoFactorEnabled(r.Context(), h.store, user.ID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  "Error fetching two-factor status",
+			"userID": user.ID,
+		}).Error(err)
+		h.redirectError(w, r, "server_error")
+		return
+	}
+	if mfaEnabled {
+		challenge, err := startMFAChallenge(r.Context(), h.store, user.ID)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  "Error creating login challenge",
+				"userID": user.ID,
+			}).Error(err)
+			h.redirectError(w, r, "server_error")
+			return
+		}
+		logger.Log.WithFields(logrus.Fields{
+			"userID":   user.ID,
+			"provider": provider.Name(),
+		}).Info("External login accepted, second factor required")
+		h.redirect(w, r, url.Values{
+			"oauth":           {"mfa_required"},
+			"challenge_token": {challenge},
+			"email":           {user.Email},
+		})
+		return
+	}
+
+	tokens, err := h.sessions.Start(r.Context(), user)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  "Error generating token",
+			"userID": user.ID,
+		}).Error(err)
+		h.redirectError(w, r, "server_error")
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":    user.ID,
+		"provider":  provider.Name(),
+		"sessionID": tokens.SessionID,
+	}).Info("User logged in with external provider")
+
+	result := url.Values{
+		"oauth":      {"success"},
+		"expires_in": {strconv.Itoa(tokens.ExpiresIn)},
+		"user_id":    {strconv.Itoa(user.ID)},
+		"is_admin":   {strconv.FormatBool(user.IsAdmin)},
+		"role":       {user.Role},
+		"email":      {user.Email},
+	}
+	if c, err := r.Cookie(oauthModeCookie); err == nil && c.Value == "cookie" {
+		http.SetCookie(w, &http.Cookie{Name: oauthModeCookie, Path: "/api/oauth/callback", MaxAge: -1})
+		if err := middleware.SetSessionCookies(w, tokens); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  err.Error(),
+				"userID": user.ID,
+			}).Error("Failed to set session cookies")
+			h.redirectError(w, r, "server_error")
+			return
+		}
+		result.Set("session_mode", "cookie")
+	} else {
+		result.Set("token", tokens.AccessToken)
+		result.Set("refresh_token", tokens.RefreshToken)
+	}
+	h.redirect(w, r, result)
+}
+
+// resolveUser returns the local user for an external identity. A known
+// identity maps to its user; otherwise the identity is linked to the account
+// with the same verified email, or a new account is created.
+func (h *OAuthHandler) resolveUser(ctx context.Context, provider *oidc.Provider, token *oidc.IDToken) (*models.User, error) {
+	if !provider.EmailAllowed(token.Email) {
+		return nil, errEmailNotAllowed
+	}
+
+	identity, err := h.store.OAuth.GetIdentity(ctx, provider.Name(), token.Subject)
+	if err == nil {
+		return h.store.Users.GetByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	// Linking by email is only safe when the provider vouches for it.
+	if token.Email == "" || !token.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+	email := token.Email
+
+	user, err := h.store.Users.GetByEmail(ctx, email)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		if h.registration.NeedsInvite(email) {
+			return nil, errInviteRequired
+		}
+		if user, err = h.createUser(ctx, token, email); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !user.IsActive:
+		// The provider has verified the address, which is what the
+		// emailed code would have proven.
+		if err := h.store.Users.Activate(ctx, user.Email); err != nil {
+			return nil, err
+		}
+		user.IsActive = true
+	}
+
+	err = h.store.OAuth.CreateIdentity(ctx, &models.Identity{
+		UserID:   user.ID,
+		Provider: provider.Name(),
+		Subject:  token.Subject,
+		Email:    email,
+	})
+	if errors.Is(err, store.ErrConflict) {
+		// A concurrent callback linked the same identity first.
+		identity, err := h.store.OAuth.GetIdentity(ctx, provider.Name(), token.Subject)
+		if err != nil {
+			return nil, err
+		}
+		return h.store.Users.GetByID(ctx, identity.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":   user.ID,
+		"provider": provider.Name(),
+		"subject":  token.Subject,
+	}).Info("External identity linked")
+	return user, nil
+}
+
+// createUser registers an active account for an external identity. The
+// password is random; the user can set one through password reset.
+func (h *OAuthHandler) createUser(ctx context.Context, token *oidc.IDToken, email string) (*models.User, error) {
+	password, err := auth.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	base := usernameFrom(token.PreferredUsername, token.Name, email)
+	username := base
+	for attempt := 0; ; attempt++ {
+		user := models.NewUser(username, email, hashedPassword)
+		user.IsActive = true
+		err := h.store.Users.Create(ctx, user)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, store.ErrConflict) || attempt == 5 {
+			return nil, err
+		}
+		// Usernames are letters only, so collisions get a letter suffix.
+		suffix, err := randomLetters(4)
+		if err != nil {
+			return nil, err
+		}
+		username = base + suffix
+	}
+}
+
+// usernameFrom derives a username from the first candidate that has
+// letters in it, keeping only letters as registration does.
+func usernameFrom(candidates ...string) string {
+	for _, candidate := range candidates {
+		if at := strings.Index(candidate, "@"); at >= 0 {
+			candidate = candidate[:at]
+		}
+		var b strings.Builder
+		for _, r := range candidate {
+			if unicode.IsLetter(r) {
+				b.WriteRune(r)
+			}
+		}
+		if name := []rune(b.String()); len(name) > 0 {
+			if len(name) > maxUsernameLength {
+				name = name[:maxUsernameLength]
+			}
+			return string(name)
+		}
+	}
+	return "user"
+}
+
+func randomLetters(n int) (string, error) {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, n)
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = letters[idx.Int64()]
+	}
+	return string(b), nil
+}
+
+func (h *OAuthHandler) redirect(w http.ResponseWriter, r *http.Request, fragment url.Values) {
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, config.BaseURL()+"/#"+fragment.Encode(), http.StatusFound)
+}
+
+func (h *OAuthHandler) redirectError(w http.ResponseWriter, r *http.Request, code string) {
+	h.redirect(w, r, url.Values{"oauth_error": {code}})
+}
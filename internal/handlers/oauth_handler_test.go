@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/oidc"
+	"github.com/pinokiochan/social-network-render/internal/oidc/oidctest"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+// oauthLogin проходит вход через провайдера целиком и возвращает параметры
+// из фрагмента URL, на который сервер перенаправил браузер
+func oauthLogin(t *testing.T, h *OAuthHandler, idp *oidctest.Server) url.Values {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.Start(rec, httptest.NewRequest(http.MethodGet, "/api/oauth/start?provider=astanait", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Start: ожидался статус 302, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	callback, err := idp.Login(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Провайдер не выполнил вход: %s", err)
+	}
+	return oauthCallback(t, h, callback.RequestURI(), rec.Result().Cookies())
+}
+
+// oauthCallback возвращает браузер с провайдера с cookie, выданными Start
+func oauthCallback(t *testing.T, h *OAuthHandler, requestURI string, cookies []*http.Cookie) url.Values {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, requestURI, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.Callback(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Callback: ожидался статус 302, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+	fragment, err := url.ParseQuery(location[strings.Index(location, "#")+1:])
+	if err != nil {
+		t.Fatalf("Не удалось разобрать фрагмент %q: %s", location, err)
+	}
+	return fragment
+}
+
+func newOAuthTestHandler(t *testing.T, st *store.Store) (*OAuthHandler, *oidctest.Server) {
+	idp := oidctest.NewServer("sonet", "client-secret")
+	t.Cleanup(idp.Close)
+	config := idp.Config("astanait", "http://127.0.0.1:8080/api/oauth/callback")
+	config.AllowedDomains = []string{"astanait.edu.kz"}
+	return NewOAuthHandler(st, auth.NewSessionManager(st), []*oidc.Provider{oidc.NewProvider(config, nil)}), idp
+}
+
+func TestOAuthLoginCreatesAndLinksUser(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	h, idp := newOAuthTestHandler(t, st)
+	idp.SetIdentity(oidctest.Identity{Subject: "s-1", Email: "aigerim@astanait.edu.kz", EmailVerified: true, Name: "Aigerim N."})
+
+	// Первый вход создаёт активного пользователя и привязывает identity
+	result := oauthLogin(t, h, idp)
+	if result.Get("oauth") != "success" || result.Get("token") == "" || result.Get("refresh_token") == "" {
+		t.Fatalf("Ожидался успешный вход, получено: %v", result)
+	}
+	claims, err := auth.VerifyToken(result.Get("token"))
+	if err != nil {
+		t.Fatalf("Выданный токен не проходит проверку: %s", err)
+	}
+	user, err := st.Users.GetByEmail(ctx, "aigerim@astanait.edu.kz")
+	if err != nil {
+		t.Fatalf("Пользователь не создан: %s", err)
+	}
+	if claims.UserID != user.ID || !user.IsActive || user.Username != "AigerimN" || user.Role != models.RoleUser {
+		t.Errorf("Неожиданный пользователь: %+v", user)
+	}
+
+	// Повторный вход находит того же пользователя по subject, даже если
+	// провайдер сменил email
+	idp.SetIdentity(oidctest.Identity{Subject: "s-1", Email: "a.n@astanait.edu.kz", EmailVerified: true})
+	result = oauthLogin(t, h, idp)
+	if claims, _ := auth.VerifyToken(result.Get("token")); claims == nil || claims.UserID != user.ID {
+		t.Errorf("Ожидался вход пользователем %d, получено: %v", user.ID, result)
+	}
+
+	// Существующий неподтверждённый аккаунт с тем же email привязывается
+	// и активируется
+	hash, _ := auth.HashPassword("secret-password")
+	existing := models.NewUser("timur", "timur@astanait.edu.kz", hash)
+	if err := st.Users.Create(ctx, existing); err != nil {
+		t.Fatalf("Не удалось создать пользователя: %s", err)
+	}
+	idp.SetIdentity(oidctest.Identity{Subject: "s-2", Email: "timur@astanait.edu.kz", EmailVerified: true, Name: "Timur"})
+	result = oauthLogin(t, h, idp)
+	if claims, _ := auth.VerifyToken(result.Get("token")); claims == nil || claims.UserID != existing.ID {
+		t.Fatalf("Ожидался вход пользователем %d, получено: %v", existing.ID, result)
+	}
+	if linked, _ := st.Users.GetByID(ctx, existing.ID); !linked.IsActive {
+		t.Error("Привязанный аккаунт не активирован")
+	}
+	if _, err := st.OAuth.GetIdentity(ctx, "astanait", "s-2"); err != nil {
+		t.Errorf("Identity не привязана: %s", err)
+	}
+}
+
+func TestOAuthLoginRejections(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	h, idp := newOAuthTestHandler(t, st)
+
+	// Неподтверждённый email не привязывается к чужому аккаунту
+	hash, _ := auth.HashPassword("secret-password")
+	victim := models.NewUser("victim", "victim@astanait.edu.kz", hash)
+	st.Users.Create(ctx, victim)
+	idp.SetIdentity(oidctest.Identity{Subject: "attacker", Email: "victim@astanait.edu.kz", EmailVerified: false})
+	if result := oauthLogin(t, h, idp); result.Get("oauth_error") != "email_not_allowed" {
+		t.Errorf("Ожидался отказ для неподтверждённого email, получено: %v", result)
+	}
+
+	// Адреса вне разрешённых доменов не принимаются
+	idp.SetIdentity(oidctest.Identity{Subject: "outsider", Email: "someone@gmail.com", EmailVerified: true})
+	if result := oauthLogin(t, h, idp); result.Get("oauth_error") != "email_not_allowed" {
+		t.Errorf("Ожидался отказ для чужого домена, получено: %v", result)
+	}
+
+	// Подделанный nonce в ID token
+	idp.SetIdentity(oidctest.Identity{Subject: "s-3", Email: "dana@astanait.edu.kz", EmailVerified: true})
+	idp.OverrideClaims(map[string]interface{}{"nonce": "replayed"})
+	if result := oauthLogin(t, h, idp); result.Get("oauth_error") != "invalid_token" {
+		t.Errorf("Ожидался отказ для неверного nonce, получено: %v", result)
+	}
+
+	// Неизвестный state и повторное использование state
+	forged := []*http.Cookie{{Name: oauthStateCookie, Value: auth.HashToken("forged")}}
+	if result := oauthCallback(t, h, "/api/oauth/callback?code=x&state=forged", forged); result.Get("oauth_error") != "invalid_state" {
+		t.Errorf("Ожидался отказ для неизвестного state, получено: %v", result)
+	}
+	rec := httptest.NewRecorder()
+	h.Start(rec, httptest.NewRequest(http.MethodGet, "/api/oauth/start?provider=astanait", nil))
+	callback, _ := idp.Login(rec.Header().Get("Location"))
+	cookies := rec.Result().Cookies()
+
+	// Login CSRF: callback злоумышленника открывается в браузере жертвы,
+	// где нет cookie со state, или есть cookie другого входа
+	if result := oauthCallback(t, h, callback.RequestURI(), nil); result.Get("oauth_error") != "invalid_state" {
+		t.Errorf("Callback без cookie должен отклоняться, получено: %v", result)
+	}
+	other := httptest.NewRecorder()
+	h.Start(other, httptest.NewRequest(http.MethodGet, "/api/oauth/start?provider=astanait", nil))
+	if result := oauthCallback(t, h, callback.RequestURI(), other.Result().Cookies()); result.Get("oauth_error") != "invalid_state" {
+		t.Errorf("Callback с cookie другого входа должен отклоняться, получено: %v", result)
+	}
+
+	if result := oauthCallback(t, h, callback.RequestURI(), cookies); result.Get("oauth") != "success" {
+		t.Fatalf("Ожидался успешный вход, получено: %v", result)
+	}
+	if result := oauthCallback(t, h, callback.RequestURI(), cookies); result.Get("oauth_error") != "invalid_state" {
+		t.Errorf("Повторный callback должен отклоняться, получено: %v", result)
+	}
+
+	if _, err := st.Users.GetByEmail(ctx, "someone@gmail.com"); err == nil {
+		t.Error("Создан пользователь из неразрешённого домена")
+	}
+}
+
+func TestOAuthLoginRequiresSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	h, idp := newOAuthTestHandler(t, st)
+
+	hash, _ := auth.HashPassword("secret-password")
+	user := models.NewUser("alice", "alice@astanait.edu.kz", hash)
+	st.Users.Create(ctx, user)
+	st.Users.Activate(ctx, user.Email)
+	st.TOTP.SavePending(ctx, user.ID, "JBSWY3DPEHPK3PXP")
+	st.TOTP.Enable(ctx, user.ID, 0)
+
+	idp.SetIdentity(oidctest.Identity{Subject: "alice", Email: user.Email, EmailVerified: true})
+	result := oauthLogin(t, h, idp)
+	if result.Get("oauth") != "mfa_required" || result.Get("challenge_token") == "" || result.Get("token") != "" {
+		t.Fatalf("Ожидался запрос второго фактора, получено: %v", result)
+	}
+}
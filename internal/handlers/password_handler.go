@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+// sendEmail is a variable so tests can capture outgoing mail.
+var sendEmail = utils.SendEmail
+
+type PasswordHandler struct {
+	store      *store.Store
+	sessions   *auth.SessionManager
+	resetLinks *emailLinkIssuer
+	policy     auth.PasswordPolicy
+}
+
+func NewPasswordHandler(s *store.Store, sessions *auth.SessionManager, wg *sync.WaitGroup) *PasswordHandler {
+	return &PasswordHandler{
+		store:    s,
+		sessions: sessions,
+		resetLinks: newEmailLinkIssuer(s, wg, emailLink{
+			name:    "Password reset",
+			purpose: models.TokenPurposePasswordReset,
+			ttl:     passwordResetTTL,
+			param:   "reset_token",
+			subject: "Password reset",
+			body: "A password reset was requested for your account.\n\n" +
+				"Open this link within %d minutes to choose a new password:\n%s\n\n" +
+				"If you did not request this, you can ignore this email.",
+			message: "If an account with that email exists, a password reset link has been sent",
+		}),
+		policy: auth.PasswordPolicyFromEnv(),
+	}
+}
+
+// Forgot emails a single-use password reset link if the address belongs to
+// an account. The response is the same whether or not it does.
+func (h *PasswordHandler) Forgot(w http.ResponseWriter, r *http.Request) {
+	h.resetLinks.Request(w, r)
+}
+
+// checkPasswordPolicy validates a new password of the account with username
+// and email. If it fails, it responds with 400 and the failed rules:
+//
+//	{"status": "error", "message": "...", "violations": [{"rule": "min_length", "message": "..."}]}
+func checkPasswordPolicy(w http.ResponseWriter, policy auth.PasswordPolicy, password, username, email string) bool {
+	violations := policy.Validate(password, username, email)
+	if len(violations) == 0 {
+		return true
+	}
+
+	rules := make([]string, len(violations))
+	for i, v := range violations {
+		rules[i] = v.Rule
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"username": username,
+		"rules":    strings.Join(rules, ","),
+	}).Warn("Password rejected by policy")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "error",
+		"message":    "Password does not meet the requirements",
+		"violations": violations,
+	})
+	return false
+}
+
+// sendEmailAsync sends in the background; wg, if not nil, lets shutdown and
+// tests wait for the delivery.
+func sendEmailAsync(wg *sync.WaitGroup, to, subject, body string) {
+	if wg != nil {
+		wg.Add(1)
+	}
+	go func() {
+		if wg != nil {
+			defer wg.Done()
+		}
+		if err := sendEmail(to, subject, body, ""); err != nil {
+			logger.Log.WithError(err).WithField("email", to).Error("Failed to send email")
+		}
+	}()
+}
+
+// Reset sets a new password using a token from the reset email. The token
+// is consumed, and every session and personal access token of the user is
+// revoked.
+func (h *PasswordHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to decode payload")
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if payload.Token == "" || payload.Password == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+
+	// The token is only used up once the new password is accepted, so a
+	// rejected password can be corrected with the same link.
+	tokenHash := auth.HashToken(payload.Token)
+	userID, err := h.store.AuthTokens.Lookup(r.Context(), models.TokenPurposePasswordReset, tokenHash, time.Now())
+	var user *models.User
+	if err == nil {
+		user, err = h.store.Users.GetByID(r.Context(), userID)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"ip": r.RemoteAddr,
+		}).Warn("Invalid or expired password reset token")
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to look up password reset token")
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkPasswordPolicy(w, h.policy, payload.Password, user.Username, user.Email) {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Error hashing password")
+		http.Error(w, "Error processing password", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err = h.store.AuthTokens.Consume(r.Context(), models.TokenPurposePasswordReset, tokenHash, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"ip": r.RemoteAddr,
+		}).Warn("Invalid or expired password reset token")
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to consume password reset token")
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.Users.UpdatePassword(r.Context(), userID, hashedPassword); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to update password")
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.AuthTokens.InvalidateForUser(r.Context(), models.TokenPurposePasswordReset, userID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to invalidate outstanding reset tokens")
+	}
+	if err := h.sessions.RevokeAllCredentials(r.Context(), userID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to revoke sessions after password reset")
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID": userID,
+	}).Info("Password reset successfully")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Password has been reset",
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+// captureEmails подменяет отправку писем и возвращает отправленные тела.
+func captureEmails(t *testing.T) *[]string {
+	var mu sync.Mutex
+	sent := []string{}
+	original := sendEmail
+	sendEmail = func(to, subject, body, attachmentPath string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, body)
+		return nil
+	}
+	t.Cleanup(func() { sendEmail = original })
+	return &sent
+}
+
+func postJSON(handler http.HandlerFunc, path string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func resetTokenFromEmail(t *testing.T, body string) string {
+	i := strings.Index(body, "reset_token=")
+	if i < 0 {
+		t.Fatalf("В письме нет ссылки для сброса: %q", body)
+	}
+	raw := strings.Fields(body[i+len("reset_token="):])[0]
+	token, err := url.QueryUnescape(raw)
+	if err != nil {
+		t.Fatalf("Не удалось разобрать токен: %s", err)
+	}
+	return token
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	sent := captureEmails(t)
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "old-hash")
+	if err := st.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("Не удалось создать пользователя: %s", err)
+	}
+	var wg sync.WaitGroup
+	sessions := auth.NewSessionManager(st)
+	handler := NewPasswordHandler(st, sessions, &wg)
+
+	pair, err := sessions.Start(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Не удалось создать сессию: %s", err)
+	}
+	pat, err := sessions.CreateAccessToken(context.Background(), &models.PersonalAccessToken{UserID: user.ID, Name: "script", Scopes: []string{auth.ScopePostsRead}})
+	if err != nil {
+		t.Fatalf("Не удалось создать токен: %s", err)
+	}
+
+	known := postJSON(handler.Forgot, "/api/password/forgot", map[string]string{"email": "alice@example.com"})
+	unknown := postJSON(handler.Forgot, "/api/password/forgot", map[string]string{"email": "nobody@example.com"})
+	wg.Wait()
+
+	// Ответы для существующего и несуществующего адреса должны совпадать
+	if known.Code != http.StatusOK || unknown.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получено: %d и %d", known.Code, unknown.Code)
+	}
+	if known.Body.String() != unknown.Body.String() {
+		t.Errorf("Ответы различаются: %q и %q", known.Body.String(), unknown.Body.String())
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("Ожидалось одно письмо, отправлено: %d", len(*sent))
+	}
+	token := resetTokenFromEmail(t, (*sent)[0])
+
+	rec := postJSON(handler.Reset, "/api/password/reset", map[string]string{"token": token, "password": "new-password"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	updated, err := st.Users.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Не удалось загрузить пользователя: %s", err)
+	}
+	if err := auth.CheckPasswordHash("new-password", updated.Password); err != nil {
+		t.Error("Пароль не был изменён")
+	}
+
+	// Старые сессии должны быть отозваны
+	if _, err := sessions.Refresh(context.Background(), pair.RefreshToken); err == nil {
+		t.Error("Refresh-токен продолжает работать после сброса пароля")
+	}
+	if _, err := sessions.ValidateAccessToken(context.Background(), pat); err != auth.ErrInvalidAccessToken {
+		t.Errorf("Personal access token работает после сброса пароля: %v", err)
+	}
+
+	// Токен одноразовый
+	rec = postJSON(handler.Reset, "/api/password/reset", map[string]string{"token": token, "password": "another-password"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Повторное использование токена: ожидался статус 400, получен: %d", rec.Code)
+	}
+}
+
+func TestForgotPasswordRateLimit(t *testing.T) {
+	captureEmails(t)
+	st := memory.New()
+	handler := NewPasswordHandler(st, auth.NewSessionManager(st), nil)
+
+	var rec *httptest.ResponseRecorder
+	for i := 0; i < 4; i++ {
+		rec = postJSON(handler.Forgot, "/api/password/forgot", map[string]string{"email": "nobody@example.com"})
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Ожидался статус 429, получен: %d", rec.Code)
+	}
+}
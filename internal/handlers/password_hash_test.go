@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginUpgradesWeakPasswordHash(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	weak, _ := bcrypt.GenerateFromPassword([]byte("secret-password"), bcrypt.MinCost)
+	user := models.NewUser("alice", "alice@example.com", string(weak))
+	st.Users.Create(ctx, user)
+	st.Users.Activate(ctx, user.Email)
+	handler := NewUserHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st), nil)
+
+	rec := postJSON(handler.Login, "/api/login", map[string]string{"email": user.Email, "password": "secret-password"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	stored, _ := st.Users.GetByID(ctx, user.ID)
+	if info := auth.DescribeHash(stored.Password); info.Algorithm != auth.AlgorithmArgon2id || auth.NeedsRehash(stored.Password) {
+		t.Fatalf("Хэш не обновлён при входе: %+v", info)
+	}
+
+	// Со старым паролем по-прежнему можно войти
+	rec = postJSON(handler.Login, "/api/login", map[string]string{"email": user.Email, "password": "secret-password"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Повторный вход: ожидался статус 200, получен: %d", rec.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestRegisterRejectsWeakPassword(t *testing.T) {
+	captureEmails(t)
+	st := memory.New()
+	handler := NewUserHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st), nil)
+
+	rec := postJSON(handler.Register, "/api/register", map[string]string{
+		"username": "alice",
+		"email":    "alice@example.com",
+		"password": "alice1",
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Ожидался статус 400, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	violations, _ := decodeBody(t, rec)["violations"].([]interface{})
+	rules := map[string]bool{}
+	for _, v := range violations {
+		rules[v.(map[string]interface{})["rule"].(string)] = true
+	}
+	if len(rules) != 2 || !rules[auth.RuleMinLength] || !rules[auth.RuleSimilarity] {
+		t.Errorf("Неожиданный список нарушенных правил: %v", violations)
+	}
+	if _, err := st.Users.GetByEmail(context.Background(), "alice@example.com"); err == nil {
+		t.Error("Пользователь создан со слабым паролем")
+	}
+}
+
+func TestPasswordResetRejectsWeakPasswordWithoutUsingToken(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "old-hash")
+	st.Users.Create(ctx, user)
+	st.AuthTokens.Create(ctx, models.TokenPurposePasswordReset, user.ID, auth.HashToken("reset-token"), time.Now().Add(passwordResetTTL))
+	handler := NewPasswordHandler(st, auth.NewSessionManager(st), nil)
+
+	rec := postJSON(handler.Reset, "/api/password/reset", map[string]string{"token": "reset-token", "password": "password1"})
+	if rec.Code != http.StatusBadRequest || decodeBody(t, rec)["violations"] == nil {
+		t.Fatalf("Ожидался отказ с нарушенными правилами, получено: %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	// Ссылка остаётся рабочей, чтобы можно было выбрать другой пароль
+	rec = postJSON(handler.Reset, "/api/password/reset", map[string]string{"token": "reset-token", "password": "correct horse battery staple"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+// userCan reports whether the user's current role holds permission. Handlers
+// use it for checks that depend on the resource, such as moderators deleting
+// other users' posts; route-level checks go through middleware.Require.
+func userCan(ctx context.Context, s *store.Store, permissions *auth.Permissions, userID int, permission string) (bool, error) {
+	user, err := s.Users.GetByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Can(ctx, user.Role, permission)
+}
@@ -1,24 +1,28 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 
+	"github.com/pinokiochan/social-network-render/internal/auth"
 	"github.com/pinokiochan/social-network-render/internal/logger"
-	"github.com/pinokiochan/social-network-render/internal/middleware"
 	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/timeline"
 	"github.com/sirupsen/logrus"
 )
 
 type PostHandler struct {
-	db *sql.DB
+	store       *store.Store
+	permissions *auth.Permissions
+	timelines   *timeline.Service
 }
 
-func NewPostHandler(db *sql.DB) *PostHandler {
-	return &PostHandler{db: db}
+func NewPostHandler(s *store.Store, permissions *auth.Permissions, timelines *timeline.Service) *PostHandler {
+	return &PostHandler{store: s, permissions: permissions, timelines: timelines}
 }
 
 func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
@@ -40,19 +44,13 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := middleware.GetUserIDFromToken(r)
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Error("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	err = h.db.QueryRow(
-		"INSERT INTO posts (user_id, content) VALUES ($1, $2) RETURNING id, created_at",
-		userID, post.Content,
-	).Scan(&post.ID, &post.CreatedAt)
+	post.UserID = userID
+	err := h.store.Posts.Create(r.Context(), &post)
 
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
@@ -63,13 +61,14 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post.UserID = userID
-
 	logger.Log.WithFields(logrus.Fields{
 		"postID": post.ID,
 		"userID": userID,
 	}).Info("Post created successfully")
 
+	// Пост попадает в ленты подписчиков в фоне
+	h.timelines.PostCreated(post)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(post)
 }
@@ -91,48 +90,47 @@ func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Преобразуем page и pageSize в целые числа
-	offset, _ := strconv.Atoi(page)
+	pageNum, _ := strconv.Atoi(page)
 	limit, _ := strconv.Atoi(pageSize)
-	offset = (offset - 1) * limit
-
-	baseQuery := `
-        SELECT posts.id, posts.user_id, posts.content, posts.created_at, users.username
-        FROM posts
-        JOIN users ON posts.user_id = users.id
-    `
-	whereClause := []string{}
-	args := []interface{}{}
+	if pageNum < 1 {
+		pageNum = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
 
-	// Фильтрация по ключевым словам
-	if keyword != "" {
-		whereClause = append(whereClause, "posts.content ILIKE $"+strconv.Itoa(len(args)+1))
-		args = append(args, "%"+keyword+"%")
+	filter := store.PostFilter{
+		Keyword:  keyword,
+		Username: username,
+		Limit:    limit,
+		Offset:   (pageNum - 1) * limit,
 	}
+
 	// Фильтрация по user_id
 	if userID != "" {
-		whereClause = append(whereClause, "posts.user_id = $"+strconv.Itoa(len(args)+1))
-		args = append(args, userID)
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"user_id": userID,
+			}).Warn("Invalid user_id filter")
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		filter.UserID = id
 	}
 	// Фильтрация по дате
 	if date != "" {
-		whereClause = append(whereClause, "DATE(posts.created_at) = $"+strconv.Itoa(len(args)+1))
-		args = append(args, date)
-	}
-	// Фильтрация по username
-	if username != "" {
-		whereClause = append(whereClause, "users.username ILIKE $"+strconv.Itoa(len(args)+1))
-		args = append(args, "%"+username+"%")
-	}
-
-	// Если есть фильтры, добавляем их в запрос
-	if len(whereClause) > 0 {
-		baseQuery += " WHERE " + strings.Join(whereClause, " AND ")
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"date": date,
+			}).Warn("Invalid date filter")
+			http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filter.Date = day
 	}
 
-	// Добавляем сортировку и пагинацию
-	baseQuery += " ORDER BY posts.created_at DESC LIMIT $" + strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2)
-	args = append(args, limit, offset)
-
 	logger.Log.WithFields(logrus.Fields{
 		"keyword":   keyword,
 		"user_id":   userID,
@@ -143,7 +141,7 @@ func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
 	}).Debug("Fetching posts with filters")
 
 	// Выполняем запрос
-	rows, err := h.db.Query(baseQuery, args...)
+	posts, err := h.store.Posts.List(r.Context(), filter)
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
@@ -151,20 +149,12 @@ func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.CreatedAt, &post.Username)
-		if err != nil {
-			logger.Log.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Error("Error scanning post")
-			http.Error(w, "Error scanning post", http.StatusInternalServerError)
-			return
-		}
-		posts = append(posts, post)
+	if err := attachPostReactions(r.Context(), h.store, viewerID(r), posts); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to fetch reactions")
+		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
+		return
 	}
 
 	logger.Log.WithFields(logrus.Fields{
@@ -194,31 +184,22 @@ func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := middleware.GetUserIDFromToken(r)
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Error("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	result, err := h.db.Exec(
-		"UPDATE posts SET content = $1 WHERE id = $2 AND user_id = $3",
-		post.Content, post.ID, userID,
-	)
-	if err != nil {
+	existing, err := h.store.Posts.GetByID(r.Context(), post.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
 		logger.Log.WithFields(logrus.Fields{
 			"error":  err.Error(),
 			"postID": post.ID,
 			"userID": userID,
-		}).Error("Failed to update post")
+		}).Error("Failed to fetch post")
 		http.Error(w, "Error updating post", http.StatusInternalServerError)
 		return
 	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	if existing == nil || existing.UserID != userID {
 		logger.Log.WithFields(logrus.Fields{
 			"postID": post.ID,
 			"userID": userID,
@@ -227,6 +208,16 @@ func (h *PostHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.store.Posts.Update(r.Context(), post.ID, post.Content); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"postID": post.ID,
+			"userID": userID,
+		}).Error("Failed to update post")
+		http.Error(w, "Error updating post", http.StatusInternalServerError)
+		return
+	}
+
 	logger.Log.WithFields(logrus.Fields{
 		"postID": post.ID,
 		"userID": userID,
@@ -254,28 +245,37 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := middleware.GetUserIDFromToken(r)
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Error("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	result, err := h.db.Exec("DELETE FROM posts WHERE id = $1 AND user_id = $2", post.ID, userID)
-	if err != nil {
+	existing, err := h.store.Posts.GetByID(r.Context(), post.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
 		logger.Log.WithFields(logrus.Fields{
 			"error":  err.Error(),
 			"postID": post.ID,
 			"userID": userID,
-		}).Error("Failed to delete post")
+		}).Error("Failed to fetch post")
 		http.Error(w, "Error deleting post", http.StatusInternalServerError)
 		return
 	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	// The author may delete a post, moderators may delete any post
+	allowed := existing != nil && existing.UserID == userID
+	moderated := false
+	if existing != nil && !allowed {
+		allowed, err = userCan(r.Context(), h.store, h.permissions, userID, models.PermPostsDeleteAny)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  err.Error(),
+				"userID": userID,
+			}).Error("Failed to check permission")
+			http.Error(w, "Error deleting post", http.StatusInternalServerError)
+			return
+		}
+		moderated = allowed
+	}
+	if !allowed {
 		logger.Log.WithFields(logrus.Fields{
 			"postID": post.ID,
 			"userID": userID,
@@ -284,10 +284,77 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Удаление каскадом убирает пост и из лент подписчиков
+	if err := h.store.Posts.Delete(r.Context(), post.ID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"postID": post.ID,
+			"userID": userID,
+		}).Error("Failed to delete post")
+		http.Error(w, "Error deleting post", http.StatusInternalServerError)
+		return
+	}
+
 	logger.Log.WithFields(logrus.Fields{
-		"postID": post.ID,
-		"userID": userID,
+		"postID":    post.ID,
+		"userID":    userID,
+		"authorID":  existing.UserID,
+		"moderated": moderated,
 	}).Info("Post deleted successfully")
 
 	w.WriteHeader(http.StatusOK)
-}
\ No newline at end of file
+}
+
+// HomeFeed returns the current user's home timeline: their own posts and
+// those of the accounts they follow, newest first. Pass the returned
+// next_cursor as ?cursor= to get the next page; ?limit= sets the page size.
+func (h *PostHandler) HomeFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	cursor, limit, err := pageParams(r)
+	if err != nil {
+		http.Error(w, "Invalid cursor or limit", http.StatusBadRequest)
+		return
+	}
+
+	posts, err := h.timelines.Home(r.Context(), userID, cursor, limit)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to fetch home feed")
+		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
+		return
+	}
+	if err := attachPostReactions(r.Context(), h.store, userID, posts); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to fetch reactions")
+		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
+		return
+	}
+
+	nextCursor := ""
+	if len(posts) == limit {
+		last := posts[len(posts)-1]
+		nextCursor = encodeCursor(store.Cursor{Time: last.CreatedAt, ID: last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":       posts,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// currentUserID returns the authenticated user placed in the request context
+// by the auth middleware, or writes 401 if there is none.
+func currentUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, ok := middleware.UserIDFrom(r.Context())
+	if !ok {
+		logger.Log.WithFields(logrus.Fields{
+			"path": r.URL.Path,
+		}).Warn("Unauthorized access attempt")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestUserUpdateChangesOnlyCurrentUser(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	hash, _ := auth.HashPassword("alice-password")
+	alice := models.NewUser("alice", "alice@example.com", hash)
+	bob := models.NewUser("bob", "bob@example.com", hash)
+	for _, u := range []*models.User{alice, bob} {
+		if err := st.Users.Create(ctx, u); err != nil {
+			t.Fatalf("Не удалось создать пользователя: %s", err)
+		}
+	}
+
+	sessions := auth.NewSessionManager(st)
+	handler := NewUserHandler(st, sessions, auth.NewLoginGuard(st), nil)
+	pair, err := sessions.Start(ctx, alice)
+	if err != nil {
+		t.Fatalf("Не удалось создать сессию: %s", err)
+	}
+
+	// Без аутентификации профиль недоступен
+	rec := postJSON(handler.UserUpdate, "/api/user-profile/edit", map[string]interface{}{
+		"id": bob.ID, "username": "mallory", "password": "new-password",
+	})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Ожидался статус 401, получен: %d", rec.Code)
+	}
+
+	// id из тела запроса игнорируется: меняется только профиль владельца токена
+	rec = authorizedJSON(handler.UserUpdate, "/api/user-profile/edit", pair.AccessToken, map[string]interface{}{
+		"id": bob.ID, "username": "alice2", "password": "new-password",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	storedBob, _ := st.Users.GetByID(ctx, bob.ID)
+	if storedBob.Username != "bob" || auth.CheckPasswordHash("alice-password", storedBob.Password) != nil {
+		t.Errorf("Профиль другого пользователя был изменён: %+v", storedBob)
+	}
+	storedAlice, _ := st.Users.GetByID(ctx, alice.ID)
+	if storedAlice.Username != "alice2" || auth.CheckPasswordHash("new-password", storedAlice.Password) != nil {
+		t.Errorf("Профиль текущего пользователя не изменён: %+v", storedAlice)
+	}
+}
+
+func TestUserUpdateKeepsSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	hash, _ := auth.HashPassword("alice-password")
+	alice := models.NewUser("alice", "alice@example.com", hash)
+	st.Users.Create(ctx, alice)
+
+	sessions := auth.NewSessionManager(st)
+	handler := NewUserHandler(st, sessions, auth.NewLoginGuard(st), nil)
+	pair, err := sessions.StartMFA(ctx, alice)
+	if err != nil {
+		t.Fatalf("Не удалось создать сессию: %s", err)
+	}
+
+	rec := authorizedJSON(handler.UserUpdate, "/api/user-profile/edit", pair.AccessToken, map[string]interface{}{
+		"username": "alice2", "password": "new-password",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	claims, err := auth.VerifyToken(decodeBody(t, rec)["token"].(string))
+	if err != nil || !claims.MFA {
+		t.Fatalf("Новая сессия должна сохранить признак mfa: %v %+v", err, claims)
+	}
+}
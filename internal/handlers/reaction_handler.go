@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+// ReactionHandler serves likes and emoji reactions to one kind of item,
+// posts or comments.
+type ReactionHandler struct {
+	store  *store.Store
+	target string
+	// reactions are the allowed reactions, "like" first.
+	reactions []string
+}
+
+func NewReactionHandler(s *store.Store, target string, reactions []string) *ReactionHandler {
+	return &ReactionHandler{store: s, target: target, reactions: reactions}
+}
+
+// Available lists the reactions users can add.
+func (h *ReactionHandler) Available(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reactions": h.reactions,
+	})
+}
+
+// Add adds the current user's ?reaction= to the item given by ?id=. Each
+// reaction can be added once per user and item.
+func (h *ReactionHandler) Add(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	targetID, reaction, ok := h.params(w, r, "")
+	if !ok {
+		return
+	}
+
+	err := h.store.Reactions.Add(r.Context(), &models.Reaction{
+		TargetType: h.target,
+		TargetID:   targetID,
+		UserID:     userID,
+		Reaction:   reaction,
+	})
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Reaction already added", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"userID":   userID,
+			"target":   h.target,
+			"targetID": targetID,
+		}).Error("Failed to add reaction")
+		http.Error(w, "Error adding reaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":   userID,
+		"target":   h.target,
+		"targetID": targetID,
+		"reaction": reaction,
+	}).Info("Reaction added")
+
+	h.writeSummary(w, r, http.StatusCreated, userID, targetID)
+}
+
+// Remove takes back the current user's ?reaction= to the item given by ?id=.
+func (h *ReactionHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	targetID, reaction, ok := h.params(w, r, "")
+	if !ok {
+		return
+	}
+
+	err := h.store.Reactions.Remove(r.Context(), h.target, targetID, userID, reaction)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Reaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"userID":   userID,
+			"target":   h.target,
+			"targetID": targetID,
+		}).Error("Failed to remove reaction")
+		http.Error(w, "Error removing reaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":   userID,
+		"target":   h.target,
+		"targetID": targetID,
+		"reaction": reaction,
+	}).Info("Reaction removed")
+
+	h.writeSummary(w, r, http.StatusOK, userID, targetID)
+}
+
+// writeSummary answers an add or remove with the item's new counts.
+func (h *ReactionHandler) writeSummary(w http.ResponseWriter, r *http.Request, status, userID, targetID int) {
+	summaries, err := h.store.Reactions.Summaries(r.Context(), h.target, []int{targetID}, userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"target":   h.target,
+			"targetID": targetID,
+		}).Error("Failed to fetch reactions")
+		http.Error(w, "Error fetching reactions", http.StatusInternalServerError)
+		return
+	}
+	summary, ok := summaries[targetID]
+	if !ok {
+		summary = models.NewReactionSummary()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "success",
+		"reactions": summary,
+	})
+}
+
+// List returns who added ?reaction= (like by default) to the item given by
+// ?id=, most recent first, paginated with ?cursor= and ?limit=.
+func (h *ReactionHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	targetID, reaction, ok := h.params(w, r, models.ReactionLike)
+	if !ok {
+		return
+	}
+	cursor, limit, err := pageParams(r)
+	if err != nil {
+		http.Error(w, "Invalid cursor or limit", http.StatusBadRequest)
+		return
+	}
+
+	reactions, err := h.store.Reactions.List(r.Context(), h.target, targetID, reaction, cursor, limit)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":    err.Error(),
+			"target":   h.target,
+			"targetID": targetID,
+		}).Error("Failed to list reactions")
+		http.Error(w, "Error fetching reactions", http.StatusInternalServerError)
+		return
+	}
+
+	nextCursor := ""
+	if len(reactions) == limit {
+		last := reactions[len(reactions)-1]
+		nextCursor = encodeCursor(store.Cursor{Time: last.CreatedAt, ID: last.UserID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":       reactions,
+		"next_cursor": nextCursor,
+	})
+}
+
+// params reads ?id= and ?reaction=, which falls back to defaultReaction,
+// and checks the reaction is allowed. It writes the error response and
+// returns false when they are invalid.
+func (h *ReactionHandler) params(w http.ResponseWriter, r *http.Request, defaultReaction string) (int, string, bool) {
+	targetID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, "", false
+	}
+	reaction := r.URL.Query().Get("reaction")
+	if reaction == "" {
+		reaction = defaultReaction
+	}
+	for _, allowed := range h.reactions {
+		if reaction == allowed {
+			return targetID, reaction, true
+		}
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"reaction": reaction,
+		"path":     r.URL.Path,
+	}).Warn("Unknown reaction")
+	http.Error(w, "Unknown reaction", http.StatusBadRequest)
+	return 0, "", false
+}
+
+// viewerID returns the authenticated user, or 0 if there is none.
+func viewerID(r *http.Request) int {
+	if p, ok := middleware.PrincipalFrom(r.Context()); ok {
+		return p.UserID
+	}
+	return 0
+}
+
+// attachPostReactions fills in the reaction summaries of posts as seen by
+// viewerID. Posts without reactions get an empty summary.
+func attachPostReactions(ctx context.Context, s *store.Store, viewerID int, posts []models.Post) error {
+	ids := make([]int, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	summaries, err := s.Reactions.Summaries(ctx, models.ReactionTargetPost, ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Reactions = summaryOrEmpty(summaries, posts[i].ID)
+	}
+	return nil
+}
+
+// attachCommentReactions is attachPostReactions for comments.
+func attachCommentReactions(ctx context.Context, s *store.Store, viewerID int, comments []models.Comment) error {
+	ids := make([]int, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	summaries, err := s.Reactions.Summaries(ctx, models.ReactionTargetComment, ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Reactions = summaryOrEmpty(summaries, comments[i].ID)
+	}
+	return nil
+}
+
+func summaryOrEmpty(summaries map[int]*models.ReactionSummary, id int) *models.ReactionSummary {
+	if summary, ok := summaries[id]; ok {
+		return summary
+	}
+	return models.NewReactionSummary()
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestPostAndCommentReactions(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	alice := models.NewUser("alice", "alice@example.com", "hash")
+	bob := models.NewUser("bob", "bob@example.com", "hash")
+	st.Users.Create(ctx, alice)
+	st.Users.Create(ctx, bob)
+	post := &models.Post{UserID: alice.ID, Content: "hello"}
+	st.Posts.Create(ctx, post)
+	comment := &models.Comment{PostID: post.ID, UserID: bob.ID, Content: "hi"}
+	st.Comments.Create(ctx, comment)
+
+	sessions := auth.NewSessionManager(st)
+	alicePair, _ := sessions.Start(ctx, alice)
+	bobPair, _ := sessions.Start(ctx, bob)
+	reactions := []string{models.ReactionLike, "🔥"}
+	postReactions := NewReactionHandler(st, models.ReactionTargetPost, reactions)
+	commentReactions := NewReactionHandler(st, models.ReactionTargetComment, reactions)
+	posts := NewPostHandler(st, auth.NewPermissions(st), nil)
+	comments := NewCommentHandler(st, auth.NewPermissions(st))
+
+	react := func(h *ReactionHandler, action string, id int, reaction, token string) int {
+		path := fmt.Sprintf("/api/index/posts/reactions/%s?id=%d&reaction=%s", action, id, url.QueryEscape(reaction))
+		handler := h.Add
+		if action == "remove" {
+			handler = h.Remove
+		}
+		return authorizedJSON(handler, path, token, nil).Code
+	}
+
+	if code := react(postReactions, "add", post.ID, models.ReactionLike, alicePair.AccessToken); code != http.StatusCreated {
+		t.Fatalf("Ожидался статус 201, получен: %d", code)
+	}
+	if code := react(postReactions, "add", post.ID, models.ReactionLike, alicePair.AccessToken); code != http.StatusConflict {
+		t.Errorf("Повторный лайк: ожидался статус 409, получен: %d", code)
+	}
+	if code := react(postReactions, "add", post.ID, "😈", alicePair.AccessToken); code != http.StatusBadRequest {
+		t.Errorf("Реакция не из набора: ожидался статус 400, получен: %d", code)
+	}
+	if code := react(postReactions, "add", 999, models.ReactionLike, alicePair.AccessToken); code != http.StatusNotFound {
+		t.Errorf("Несуществующий пост: ожидался статус 404, получен: %d", code)
+	}
+	react(postReactions, "add", post.ID, "🔥", alicePair.AccessToken)
+	react(postReactions, "add", post.ID, models.ReactionLike, bobPair.AccessToken)
+	react(commentReactions, "add", comment.ID, "🔥", alicePair.AccessToken)
+
+	// Счётчики общие, а "мои" реакции у каждого свои
+	rec := authorizedGet(posts.GetPosts, "/api/index/posts", bobPair.AccessToken)
+	var listed []models.Post
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("Не удалось разобрать ответ %q: %s", rec.Body.String(), err)
+	}
+	if len(listed) != 1 || listed[0].Reactions == nil {
+		t.Fatalf("Ожидался пост с реакциями, получено: %s", rec.Body.String())
+	}
+	summary := listed[0].Reactions
+	if summary.Counts[models.ReactionLike] != 2 || summary.Counts["🔥"] != 1 || fmt.Sprint(summary.Mine) != "[like]" {
+		t.Errorf("Неверная сводка реакций для bob: %+v", summary)
+	}
+
+	rec = authorizedGet(comments.GetComments, fmt.Sprintf("/api/index/comments?post_id=%d", post.ID), alicePair.AccessToken)
+	var page struct {
+		Comments []models.Comment `json:"comments"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Не удалось разобрать ответ %q: %s", rec.Body.String(), err)
+	}
+	listedComments := page.Comments
+	if len(listedComments) != 1 || listedComments[0].Reactions.Counts["🔥"] != 1 || len(listedComments[0].Reactions.Mine) != 1 {
+		t.Errorf("Неверные реакции комментария: %s", rec.Body.String())
+	}
+
+	rec = authorizedGet(postReactions.List, fmt.Sprintf("/api/index/posts/reactions?id=%d", post.ID), alicePair.AccessToken)
+	users := decodeBody(t, rec)["users"].([]interface{})
+	if len(users) != 2 || users[0].(map[string]interface{})["username"] != "bob" {
+		t.Errorf("Ожидалось, что последним лайкнул bob, получено: %v", users)
+	}
+
+	if code := react(postReactions, "remove", post.ID, models.ReactionLike, bobPair.AccessToken); code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d", code)
+	}
+	if code := react(postReactions, "remove", post.ID, models.ReactionLike, bobPair.AccessToken); code != http.StatusNotFound {
+		t.Errorf("Повторное удаление: ожидался статус 404, получен: %d", code)
+	}
+
+	// Реакции удаляются вместе с постом и его комментариями
+	st.Posts.Delete(ctx, post.ID)
+	left, _ := st.Reactions.List(ctx, models.ReactionTargetComment, comment.ID, "🔥", store.Cursor{}, 10)
+	if len(left) != 0 {
+		t.Errorf("Реакции удалённого комментария остались: %v", left)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestRoleAssignment(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	create := func(name, role string) *models.User {
+		user := models.NewUser(name, name+"@example.com", "hash")
+		user.Role = role
+		if err := st.Users.Create(ctx, user); err != nil {
+			t.Fatalf("Не удалось создать пользователя: %s", err)
+		}
+		return user
+	}
+	root := create("root", models.RoleSuperadmin)
+	admin := create("admin", models.RoleAdmin)
+	member := create("bob", models.RoleUser)
+
+	sessions := auth.NewSessionManager(st)
+	handler := NewAdminHandler(st, sessions, auth.NewPermissions(st), nil)
+	tokenFor := func(user *models.User) string {
+		pair, err := sessions.Start(ctx, user)
+		if err != nil {
+			t.Fatalf("Не удалось создать сессию: %s", err)
+		}
+		return pair.AccessToken
+	}
+	adminToken := tokenFor(admin)
+	setRole := func(token string, user *models.User, role string) int {
+		rec := authorizedJSON(handler.SetUserRole, "/api/admin/users/role", token, map[string]interface{}{"id": user.ID, "role": role})
+		return rec.Code
+	}
+
+	// Администратор назначает модераторов, но не других администраторов
+	if code := setRole(adminToken, member, models.RoleModerator); code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 при назначении модератора, получен: %d", code)
+	}
+	if code := setRole(adminToken, member, models.RoleAdmin); code != http.StatusForbidden {
+		t.Fatalf("Ожидался статус 403 при назначении администратора, получен: %d", code)
+	}
+	if code := setRole(adminToken, root, models.RoleUser); code != http.StatusForbidden {
+		t.Fatalf("Ожидался статус 403 при понижении суперадминистратора, получен: %d", code)
+	}
+	if code := setRole(adminToken, admin, models.RoleSuperadmin); code != http.StatusForbidden {
+		t.Fatalf("Ожидался статус 403 при изменении собственной роли, получен: %d", code)
+	}
+
+	// Суперадминистратор назначает любую роль; понижение завершает сессии
+	memberToken := tokenFor(member)
+	if code := setRole(tokenFor(root), member, models.RoleAdmin); code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 при назначении администратора, получен: %d", code)
+	}
+	if code := setRole(tokenFor(root), member, models.RoleUser); code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200 при понижении, получен: %d", code)
+	}
+	claims, _ := auth.VerifyToken(memberToken)
+	if err := sessions.Validate(ctx, claims); err != auth.ErrTokenRevoked {
+		t.Fatalf("Ожидалась ошибка ErrTokenRevoked после понижения, получено: %v", err)
+	}
+
+	stored, _ := st.Users.GetByID(ctx, member.ID)
+	if stored.Role != models.RoleUser || stored.IsAdmin {
+		t.Errorf("Ожидалась роль user без is_admin, получено: %s, %v", stored.Role, stored.IsAdmin)
+	}
+
+	// superadmin не может потерять roles.manage
+	rec := authorizedJSON(handler.SetRolePermission, "/api/admin/roles/permissions", tokenFor(root), map[string]interface{}{
+		"role": models.RoleSuperadmin, "permission": models.PermRolesManage, "granted": false,
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Ожидался статус 400, получен: %d", rec.Code)
+	}
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+type SessionHandler struct {
+	sessions *auth.SessionManager
+}
+
+func NewSessionHandler(sessions *auth.SessionManager) *SessionHandler {
+	return &SessionHandler{sessions: sessions}
+}
+
+// Refresh exchanges a refresh token for a new access/refresh token pair. In
+// cookie mode the refresh token comes from its cookie and the new pair is
+// set as cookies again.
+func (h *SessionHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&payload)
+	refreshToken, cookies := payload.RefreshToken, false
+	if refreshToken == "" {
+		refreshToken = middleware.RefreshTokenFromCookie(r)
+		cookies = true
+	}
+	if refreshToken == "" {
+		logger.Log.WithFields(logrus.Fields{
+			"path": r.URL.Path,
+		}).Warn("Missing refresh token")
+		http.Error(w, "Missing refresh token", http.StatusBadRequest)
+		return
+	}
+	if cookies && !middleware.ValidCSRF(r) {
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+		return
+	}
+
+	tokens, err := h.sessions.Refresh(r.Context(), refreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"ip":    r.RemoteAddr,
+		}).Warn("Refresh token rejected")
+		if cookies {
+			middleware.ClearSessionCookies(w)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to refresh session")
+		http.Error(w, "Error refreshing token", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"sessionID": tokens.SessionID,
+	}).Info("Session refreshed")
+
+	writeTokens(w, cookies, tokens, map[string]interface{}{
+		"status": "success",
+	})
+}
+
+// Logout revokes the session identified by the access token in the
+// Authorization header or, if that has already expired, by the refresh token
+// in the request body. In cookie mode both come from the session cookies,
+// which are cleared.
+func (h *SessionHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cookies := middleware.CookieMode(r)
+	if cookies && !middleware.ValidCSRF(r) {
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	if cookies {
+		middleware.ClearSessionCookies(w)
+	}
+
+	var sessionID string
+	if claims, err := auth.VerifyToken(middleware.TokenFromRequest(r)); err == nil {
+		sessionID = claims.SessionID
+
+		// Kill the presented access token right away instead of letting it
+		// live until it expires.
+		if err := h.sessions.RevokeToken(r.Context(), claims); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  err.Error(),
+				"userID": claims.UserID,
+			}).Error("Failed to revoke access token")
+		}
+
+		// An impersonation token shares the admin's session: logging out
+		// of it only ends the impersonation.
+		if claims.IsImpersonation() {
+			logger.Log.WithFields(logrus.Fields{
+				"impersonatorID": claims.Impersonator,
+				"userID":         claims.UserID,
+			}).Info("Impersonation ended")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": "success",
+			})
+			return
+		}
+	}
+	if sessionID == "" {
+		var payload struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload.RefreshToken == "" {
+			payload.RefreshToken = middleware.RefreshTokenFromCookie(r)
+		}
+		sessionID, _ = auth.SessionIDFromRefreshToken(payload.RefreshToken)
+	}
+
+	if sessionID == "" {
+		logger.Log.WithFields(logrus.Fields{
+			"path": r.URL.Path,
+		}).Warn("Logout without a session")
+		http.Error(w, "No session provided", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.sessions.Revoke(r.Context(), sessionID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"error":     err.Error(),
+			"sessionID": sessionID,
+		}).Error("Failed to revoke session")
+		http.Error(w, "Error logging out", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"sessionID": sessionID,
+	}).Info("User logged out")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+	})
+}
+
+// RevokeAll logs the current user out of every session and invalidates all
+// of their outstanding access tokens, including the one used for this call,
+// and their personal access tokens.
+func (h *SessionHandler) RevokeAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.sessions.RevokeAllCredentials(r.Context(), userID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to revoke sessions")
+		http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID": userID,
+	}).Info("All sessions revoked")
+
+	if middleware.CookieMode(r) {
+		middleware.ClearSessionCookies(w)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+	})
+}
+
+// sessionView is a session as listed to its owner.
+type sessionView struct {
+	models.Session
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// List returns the active sessions of the current user: the device, the
+// address it was last seen from, and when it logged in and was last used.
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessions.List(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to list sessions")
+		http.Error(w, "Error fetching sessions", http.StatusInternalServerError)
+		return
+	}
+
+	var currentID string
+	if p, ok := middleware.PrincipalFrom(r.Context()); ok {
+		currentID = p.SessionID
+	}
+	views := make([]sessionView, len(sessions))
+	for i, s := range sessions {
+		views[i] = sessionView{Session: s, Current: s.ID == currentID}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": views,
+	})
+}
+
+// Revoke logs the current user out of one session, given by ?id=. Access
+// tokens of that session stop working immediately.
+func (h *SessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID := r.URL.Query().Get("id")
+	if sessionID == "" {
+		http.Error(w, "Missing session ID", http.StatusBadRequest)
+		return
+	}
+
+	err := h.sessions.RevokeForUser(r.Context(), userID, sessionID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":     err.Error(),
+			"sessionID": sessionID,
+		}).Error("Failed to revoke session")
+		http.Error(w, "Error revoking session", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":    userID,
+		"sessionID": sessionID,
+	}).Info("Session revoked")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestListAndRevokeSessions(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	st.Users.Create(ctx, user)
+
+	sessions := auth.NewSessionManager(st)
+	handler := NewSessionHandler(sessions)
+	current, _ := sessions.Start(auth.WithClient(ctx, auth.Client{UserAgent: "Firefox", IP: "10.0.0.1"}), user)
+	other, _ := sessions.Start(auth.WithClient(ctx, auth.Client{UserAgent: "Safari", IP: "10.0.0.2"}), user)
+
+	claims, _ := auth.VerifyToken(current.AccessToken)
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), middleware.NewPrincipal(claims)))
+	rec := httptest.NewRecorder()
+	handler.List(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	list := decodeBody(t, rec)["sessions"].([]interface{})
+	if len(list) != 2 {
+		t.Fatalf("Ожидалось две сессии, получено: %v", list)
+	}
+	for _, item := range list {
+		s := item.(map[string]interface{})
+		if (s["id"] == current.SessionID) != (s["current"] == true) {
+			t.Errorf("Неверно отмечена текущая сессия: %v", s)
+		}
+		if s["user_agent"] == "" || s["ip"] == "" || s["last_used_at"] == nil {
+			t.Errorf("Нет данных об устройстве: %v", s)
+		}
+	}
+
+	if rec := authorizedJSON(handler.Revoke, "/api/sessions/revoke?id=unknown", current.AccessToken, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Неизвестная сессия: ожидался статус 404, получен: %d", rec.Code)
+	}
+	if rec := authorizedJSON(handler.Revoke, "/api/sessions/revoke?id="+other.SessionID, current.AccessToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	// Токен отозванной сессии сразу перестаёт проходить проверку
+	otherClaims, _ := auth.VerifyToken(other.AccessToken)
+	if err := sessions.Validate(ctx, otherClaims); err != auth.ErrTokenRevoked {
+		t.Errorf("Токен отозванной сессии принят: %v", err)
+	}
+}
+
+func TestRevokeAllRevokesAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	st.Users.Create(ctx, user)
+
+	sessions := auth.NewSessionManager(st)
+	handler := NewSessionHandler(sessions)
+	pair, _ := sessions.Start(ctx, user)
+	pat, err := sessions.CreateAccessToken(ctx, &models.PersonalAccessToken{UserID: user.ID, Name: "script", Scopes: []string{auth.ScopePostsRead}})
+	if err != nil {
+		t.Fatalf("Не удалось создать токен: %s", err)
+	}
+
+	// После "выйти везде" утёкший personal access token тоже не работает
+	if rec := authorizedJSON(handler.RevokeAll, "/api/sessions/revoke-all", pair.AccessToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	if _, err := sessions.ValidateAccessToken(ctx, pat); err != auth.ErrInvalidAccessToken {
+		t.Errorf("Personal access token принят после выхода со всех устройств: %v", err)
+	}
+}
@@ -0,0 +1,699 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// totpIssuer is shown next to the account in authenticator apps.
+	totpIssuer = "Sonet"
+
+	recoveryCodeCount = 10
+
+	mfaChallengeTTL = 5 * time.Minute
+	// maxMFAChallengeAttempts wrong codes invalidate the challenge; the user
+	// has to enter the password again. Wrong codes also count as failed
+	// logins of the account, so new challenges do not reset the limit.
+	maxMFAChallengeAttempts = 5
+)
+
+type TwoFactorHandler struct {
+	store    *store.Store
+	sessions *auth.SessionManager
+	// loginGuard counts wrong codes and passwords as failed logins of the
+	// account, in the same store as the password login.
+	loginGuard *auth.LoginGuard
+}
+
+// NewTwoFactorHandler builds the handler. loginGuard should be the one the
+// UserHandler uses, so that passwords and codes share one failure budget.
+func NewTwoFactorHandler(s *store.Store, sessions *auth.SessionManager, loginGuard *auth.LoginGuard) *TwoFactorHandler {
+	return &TwoFactorHandler{store: s, sessions: sessions, loginGuard: loginGuard}
+}
+
+// secondFactor is the part of a request body carrying either a TOTP code or
+// a recovery code.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// Status reports whether two-factor authentication is enabled for the
+// current user and how many recovery codes are left.
+func (h *TwoFactorHandler) Status(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	enabled := false
+	totp, err := h.store.TOTP.Get(r.Context(), userID)
+	if err == nil {
+		enabled = totp.Enabled()
+	} else if !errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to fetch two-factor status")
+		http.Error(w, "Error fetching two-factor status", http.StatusInternalServerError)
+		return
+	}
+
+	remaining := 0
+	if enabled {
+		if remaining, err = h.store.TOTP.CountRecoveryCodes(r.Context(), userID); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  err.Error(),
+				"userID": userID,
+			}).Error("Failed to count recovery codes")
+			http.Error(w, "Error fetching two-factor status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// Enroll creates a new TOTP secret for the current user. It stays pending
+// until confirmed with a code from the authenticator app.
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to fetch user")
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to generate TOTP secret")
+		http.Error(w, "Error enrolling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.store.TOTP.SavePending(r.Context(), userID, secret)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to save TOTP secret")
+		http.Error(w, "Error enrolling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	uri := auth.TOTPURI(totpIssuer, user.Email, secret)
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID": userID,
+	}).Info("Two-factor enrollment started")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"secret":      secret,
+		"otpauth_uri": uri,
+		// The string to encode into a QR code for authenticator apps.
+		"qr_payload": uri,
+		"digits":     auth.TOTPDigits,
+		"period":     int(auth.TOTPPeriod.Seconds()),
+	})
+}
+
+// Confirm enables two-factor authentication once the user proves the app
+// was set up by sending a valid code. It returns the recovery codes, which
+// are shown only this once, and replaces all sessions with a new one opened
+// with the second factor.
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input secondFactor
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	totp, err := h.store.TOTP.Get(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && totp.Enabled()) {
+		http.Error(w, "No pending two-factor enrollment", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to fetch TOTP secret")
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(totp.Secret, input.Code, time.Now())
+	if !valid {
+		logger.Log.WithFields(logrus.Fields{
+			"userID": userID,
+		}).Warn("Invalid code during two-factor enrollment")
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.TOTP.Enable(r.Context(), userID, step); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to enable two-factor authentication")
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := h.replaceRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to generate recovery codes")
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	// Sessions opened with the password alone are ended.
+	tokens, err := h.restartSessions(r.Context(), userID, true)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to restart sessions")
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID": userID,
+	}).Info("Two-factor authentication enabled")
+
+	writeTokens(w, middleware.CookieMode(r), tokens, map[string]interface{}{
+		"status":         "success",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable turns two-factor authentication off. It requires the password and
+// a current TOTP or recovery code.
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+		secondFactor
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to fetch user")
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	if h.throttled(w, r, user) {
+		return
+	}
+	if err := auth.CheckPasswordHash(input.Password, user.Password); err != nil {
+		h.recordFailure(r, user)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	totp, ok := h.enabledTOTP(w, r, userID)
+	if !ok {
+		return
+	}
+	valid, err := h.verifySecondFactor(r.Context(), totp, input.secondFactor)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to verify second factor")
+		http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		h.recordFailure(r, user)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	h.recordSuccess(r, user)
+
+	if err := h.store.TOTP.Delete(r.Context(), userID); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to disable two-factor authentication")
+		http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.restartSessions(r.Context(), userID, false)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to restart sessions")
+		http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID": userID,
+	}).Info("Two-factor authentication disabled")
+
+	writeTokens(w, middleware.CookieMode(r), tokens, map[string]interface{}{
+		"status": "success",
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current TOTP code.
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to fetch user")
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	if h.throttled(w, r, user) {
+		return
+	}
+
+	totp, ok := h.enabledTOTP(w, r, userID)
+	if !ok {
+		return
+	}
+	valid, err := h.verifySecondFactor(r.Context(), totp, secondFactor{Code: input.Code})
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to verify second factor")
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		h.recordFailure(r, user)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	h.recordSuccess(r, user)
+
+	codes, err := h.replaceRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to generate recovery codes")
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID": userID,
+	}).Info("Recovery codes regenerated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "success",
+		"recovery_codes": codes,
+	})
+}
+
+// LoginChallenge completes a login started with /api/login for an account
+// with two-factor authentication: the challenge token from that response
+// plus a TOTP or recovery code are exchanged for a session.
+func (h *TwoFactorHandler) LoginChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		secondFactor
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ChallengeToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tokenHash := auth.HashToken(input.ChallengeToken)
+	challenge, err := h.store.MFAChallenges.Get(r.Context(), tokenHash)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && challenge.Expired(time.Now())) {
+		http.Error(w, "Invalid or expired challenge, log in again", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to fetch login challenge")
+		http.Error(w, "Error verifying code", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.store.Users.GetByID(r.Context(), challenge.UserID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": challenge.UserID,
+		}).Error("Failed to fetch user")
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	if h.throttled(w, r, user) {
+		return
+	}
+
+	totp, err := h.store.TOTP.Get(r.Context(), challenge.UserID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": challenge.UserID,
+		}).Error("Failed to fetch TOTP secret")
+		http.Error(w, "Error verifying code", http.StatusInternalServerError)
+		return
+	}
+
+	valid, err := h.verifySecondFactor(r.Context(), totp, input.secondFactor)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": challenge.UserID,
+		}).Error("Failed to verify second factor")
+		http.Error(w, "Error verifying code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		attempts, err := h.store.MFAChallenges.IncrementAttempts(r.Context(), tokenHash)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Failed to record challenge attempt")
+		}
+		logger.Log.WithFields(logrus.Fields{
+			"userID":   challenge.UserID,
+			"attempts": attempts,
+		}).Warn("Invalid second factor during login")
+		locked := h.recordFailure(r, user)
+		if locked || attempts >= maxMFAChallengeAttempts {
+			h.store.MFAChallenges.Delete(r.Context(), tokenHash)
+			http.Error(w, "Too many failed attempts, log in again", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.store.MFAChallenges.Delete(r.Context(), tokenHash); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to delete login challenge")
+	}
+	h.recordSuccess(r, user)
+
+	tokens, err := h.sessions.StartMFA(r.Context(), user)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  "Error generating token",
+			"userID": user.ID,
+		}).Error(err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":    user.ID,
+		"isAdmin":   user.IsAdmin,
+		"sessionID": tokens.SessionID,
+	}).Info("User logged in with two-factor authentication")
+
+	writeLoginResponse(w, r, user, tokens)
+}
+
+// throttled answers 429 and returns true while the account, or the client
+// IP, has to wait after failed logins.
+func (h *TwoFactorHandler) throttled(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	ip := middleware.ClientIP(r)
+	wait, err := h.loginGuard.Check(r.Context(), user, user.Email, ip)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": user.ID,
+		}).Error("Failed to check login attempts")
+		http.Error(w, "Error verifying code", http.StatusInternalServerError)
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"userID": user.ID,
+		"ip":     ip,
+		"wait":   wait.String(),
+	}).Warn("Second factor attempt throttled")
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds()+0.999)))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// recordFailure counts a wrong password or code as a failed login of the
+// account and reports whether it locked the account.
+func (h *TwoFactorHandler) recordFailure(r *http.Request, user *models.User) bool {
+	lockedUntil, err := h.loginGuard.Fail(r.Context(), user, user.Email, middleware.ClientIP(r))
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": user.ID,
+		}).Error("Failed to record failed login attempt")
+		return false
+	}
+	if lockedUntil == nil {
+		return false
+	}
+	logger.Log.WithFields(logrus.Fields{
+		"userID":      user.ID,
+		"lockedUntil": lockedUntil.Format(time.RFC3339),
+	}).Warn("Account locked after failed second factor attempts")
+	return true
+}
+
+// recordSuccess forgets the failed logins of the account once both factors
+// were accepted.
+func (h *TwoFactorHandler) recordSuccess(r *http.Request, user *models.User) {
+	if err := h.loginGuard.Succeed(r.Context(), user); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": user.ID,
+		}).Error("Failed to reset failed login attempts")
+	}
+}
+
+// startMFAChallenge is called by Login after the password was accepted for
+// an account with two-factor authentication. The returned token is sent to
+// the client in place of a session.
+func startMFAChallenge(ctx context.Context, s *store.Store, userID int) (string, error) {
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = s.MFAChallenges.Create(ctx, &models.MFAChallenge{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// twoFactorEnabled reports whether the user has confirmed TOTP enrollment.
+func twoFactorEnabled(ctx context.Context, s *store.Store, userID int) (bool, error) {
+	totp, err := s.TOTP.Get(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.Enabled(), nil
+}
+
+// verifySecondFactor checks a TOTP code, rejecting codes whose time step was
+// already used, or consumes a recovery code.
+func (h *TwoFactorHandler) verifySecondFactor(ctx context.Context, totp *models.TOTP, factor secondFactor) (bool, error) {
+	if factor.Code != "" {
+		step, valid := auth.ValidateTOTP(totp.Secret, factor.Code, time.Now())
+		if !valid {
+			return false, nil
+		}
+		err := h.store.TOTP.UseStep(ctx, totp.UserID, step)
+		if errors.Is(err, store.ErrConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if factor.RecoveryCode != "" {
+		err := h.store.TOTP.UseRecoveryCode(ctx, totp.UserID, auth.HashRecoveryCode(factor.RecoveryCode))
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		if err == nil {
+			logger.Log.WithFields(logrus.Fields{
+				"userID": totp.UserID,
+			}).Info("Recovery code used")
+		}
+		return err == nil, err
+	}
+	return false, nil
+}
+
+func (h *TwoFactorHandler) enabledTOTP(w http.ResponseWriter, r *http.Request, userID int) (*models.TOTP, bool) {
+	totp, err := h.store.TOTP.Get(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !totp.Enabled()) {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return nil, false
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": userID,
+		}).Error("Failed to fetch TOTP secret")
+		http.Error(w, "Error fetching two-factor status", http.StatusInternalServerError)
+		return nil, false
+	}
+	return totp, true
+}
+
+func (h *TwoFactorHandler) replaceRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	if err := h.store.TOTP.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// restartSessions revokes every session of the user and opens a new one for
+// the current client.
+func (h *TwoFactorHandler) restartSessions(ctx context.Context, userID int, mfa bool) (*auth.TokenPair, error) {
+	if err := h.sessions.RevokeAll(ctx, userID); err != nil {
+		return nil, err
+	}
+	user, err := h.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa {
+		return h.sessions.StartMFA(ctx, user)
+	}
+	return h.sessions.Start(ctx, user)
+}
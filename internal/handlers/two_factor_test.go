@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+// authorizedJSON calls handler as the auth middleware would, with the
+// principal of token in the request context.
+func authorizedJSON(handler http.HandlerFunc, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if claims, err := auth.VerifyToken(token); err == nil {
+		req = req.WithContext(middleware.WithPrincipal(req.Context(), middleware.NewPrincipal(claims)))
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	var data map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatalf("Не удалось разобрать ответ %q: %s", rec.Body.String(), err)
+	}
+	return data
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	hash, _ := auth.HashPassword("secret-password")
+	user := models.NewUser("alice", "alice@example.com", hash)
+	if err := st.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Не удалось создать пользователя: %s", err)
+	}
+	st.Users.Activate(ctx, user.Email)
+
+	sessions := auth.NewSessionManager(st)
+	loginGuard := auth.NewLoginGuard(st)
+	users := NewUserHandler(st, sessions, loginGuard, nil)
+	twoFactor := NewTwoFactorHandler(st, sessions, loginGuard)
+
+	pair, err := sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatalf("Не удалось создать сессию: %s", err)
+	}
+
+	// Подключение: секрет, затем подтверждение кодом
+	rec := authorizedJSON(twoFactor.Enroll, "/api/2fa/enroll", pair.AccessToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Enroll: ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	secret := decodeBody(t, rec)["secret"].(string)
+	code, _ := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+
+	rec = authorizedJSON(twoFactor.Confirm, "/api/2fa/confirm", pair.AccessToken, map[string]string{"code": code})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Confirm: ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	recoveryCodes := decodeBody(t, rec)["recovery_codes"].([]interface{})
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Ожидалось %d кодов восстановления, получено: %d", recoveryCodeCount, len(recoveryCodes))
+	}
+
+	// Пароль больше не выдаёт сессию, только challenge
+	login := func() string {
+		rec := postJSON(users.Login, "/api/login", map[string]string{"email": user.Email, "password": "secret-password"})
+		data := decodeBody(t, rec)
+		if data["mfa_required"] != true || data["token"] != nil {
+			t.Fatalf("Ожидался challenge вместо токена, получено: %v", data)
+		}
+		return data["challenge_token"].(string)
+	}
+
+	// Код, уже использованный при подтверждении, повторно не принимается
+	challenge := login()
+	rec = postJSON(twoFactor.LoginChallenge, "/api/login/2fa", map[string]string{"challenge_token": challenge, "code": code})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Повторный код: ожидался статус 401, получен: %d", rec.Code)
+	}
+
+	recovery := recoveryCodes[0].(string)
+	rec = postJSON(twoFactor.LoginChallenge, "/api/login/2fa", map[string]string{"challenge_token": challenge, "recovery_code": recovery})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Код восстановления: ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	claims, err := auth.VerifyToken(decodeBody(t, rec)["token"].(string))
+	if err != nil || !claims.MFA {
+		t.Fatalf("Токен должен содержать признак mfa: %v %+v", err, claims)
+	}
+
+	// Challenge и код восстановления одноразовые
+	rec = postJSON(twoFactor.LoginChallenge, "/api/login/2fa", map[string]string{"challenge_token": challenge, "recovery_code": recovery})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Повторный challenge: ожидался статус 401, получен: %d", rec.Code)
+	}
+	rec = postJSON(twoFactor.LoginChallenge, "/api/login/2fa", map[string]string{"challenge_token": login(), "recovery_code": recovery})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Повторный код восстановления: ожидался статус 401, получен: %d", rec.Code)
+	}
+}
+
+func TestLoginChallengeLocksAfterTooManyAttempts(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	st.Users.Create(ctx, user)
+	st.TOTP.SavePending(ctx, user.ID, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	st.TOTP.Enable(ctx, user.ID, 0)
+
+	twoFactor := NewTwoFactorHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st))
+	// Без задержек аккаунта, чтобы проверить лимит самого challenge
+	noDelay := auth.LockoutPolicy{ResetAfter: time.Hour}
+	twoFactor.loginGuard = auth.NewLoginGuardWithPolicy(st, noDelay, noDelay)
+	challenge, err := startMFAChallenge(ctx, st, user.ID)
+	if err != nil {
+		t.Fatalf("Не удалось создать challenge: %s", err)
+	}
+
+	for i := 0; i < maxMFAChallengeAttempts; i++ {
+		postJSON(twoFactor.LoginChallenge, "/api/login/2fa", map[string]string{"challenge_token": challenge, "code": "000000"})
+	}
+
+	// После блокировки верный код уже не помогает
+	code, _ := auth.TOTPCode("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", auth.TOTPStep(time.Now()))
+	rec := postJSON(twoFactor.LoginChallenge, "/api/login/2fa", map[string]string{"challenge_token": challenge, "code": code})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Ожидался статус 401, получен: %d", rec.Code)
+	}
+}
+
+func TestWrongCodesLockTheAccountAcrossChallenges(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	st.Users.Create(ctx, user)
+	st.TOTP.SavePending(ctx, user.ID, secret)
+	st.TOTP.Enable(ctx, user.ID, 0)
+
+	twoFactor := NewTwoFactorHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st))
+	policy := auth.LockoutPolicy{FreeAttempts: 100, LockAfter: 3, LockDuration: time.Hour, ResetAfter: time.Hour}
+	twoFactor.loginGuard = auth.NewLoginGuardWithPolicy(st, policy, auth.LockoutPolicy{ResetAfter: time.Hour})
+
+	// Каждая ошибка приходится на новый challenge, как после повторного ввода пароля
+	for i := 0; i < 3; i++ {
+		challenge, _ := startMFAChallenge(ctx, st, user.ID)
+		rec := postJSON(twoFactor.LoginChallenge, "/api/login/2fa", map[string]string{"challenge_token": challenge, "code": "000000"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Ожидался статус 401, получен: %d", rec.Code)
+		}
+	}
+
+	// Аккаунт заблокирован: верный код на новом challenge не принимается
+	challenge, _ := startMFAChallenge(ctx, st, user.ID)
+	code, _ := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	rec := postJSON(twoFactor.LoginChallenge, "/api/login/2fa", map[string]string{"challenge_token": challenge, "code": code})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Ожидался статус 429, получен: %d", rec.Code)
+	}
+
+	// Отключение 2FA тоже проходит через блокировку
+	pair, _ := auth.NewSessionManager(st).StartMFA(ctx, user)
+	rec = authorizedJSON(twoFactor.Disable, "/api/2fa/disable", pair.AccessToken, map[string]string{"password": "password", "code": code})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Отключение 2FA: ожидался статус 429, получен: %d", rec.Code)
+	}
+}
+
+func TestRegenerateRecoveryCodesIsThrottled(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	st.Users.Create(ctx, user)
+	st.TOTP.SavePending(ctx, user.ID, secret)
+	st.TOTP.Enable(ctx, user.ID, 0)
+
+	twoFactor := NewTwoFactorHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st))
+	policy := auth.LockoutPolicy{FreeAttempts: 100, LockAfter: 3, LockDuration: time.Hour, ResetAfter: time.Hour}
+	twoFactor.loginGuard = auth.NewLoginGuardWithPolicy(st, policy, auth.LockoutPolicy{ResetAfter: time.Hour})
+	pair, _ := auth.NewSessionManager(st).StartMFA(ctx, user)
+
+	// Украденный токен не позволяет перебирать коды без ограничений
+	for i := 0; i < 3; i++ {
+		rec := authorizedJSON(twoFactor.RegenerateRecoveryCodes, "/api/2fa/recovery-codes", pair.AccessToken, map[string]string{"code": "000000"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Ожидался статус 401, получен: %d", rec.Code)
+		}
+	}
+	code, _ := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	rec := authorizedJSON(twoFactor.RegenerateRecoveryCodes, "/api/2fa/recovery-codes", pair.AccessToken, map[string]string{"code": code})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Ожидался статус 429, получен: %d", rec.Code)
+	}
+}
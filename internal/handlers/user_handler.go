@@ -1,24 +1,64 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/pinokiochan/social-network-render/internal/auth"
 	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
 	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
 	"github.com/pinokiochan/social-network-render/internal/utils"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	verificationCodeTTL = 15 * time.Minute
+	// maxVerificationAttempts wrong guesses lock the code until a new one is
+	// requested.
+	maxVerificationAttempts = 5
+	// verificationResendCooldown is the minimum time between two codes sent
+	// to the same address.
+	verificationResendCooldown = time.Minute
 )
 
 type UserHandler struct {
-	db *sql.DB
+	store    *store.Store
+	sessions *auth.SessionManager
+	// resendLimiter caps verification emails per address on top of the
+	// per-code cooldown.
+	resendLimiter *auth.RateLimiter
+	// loginGuard slows down and locks out repeated failed logins.
+	loginGuard *auth.LoginGuard
+	wg         *sync.WaitGroup
+	policy     auth.PasswordPolicy
+	// registration decides who may register and whether an invite code is
+	// required.
+	registration auth.RegistrationPolicy
+}
+
+func NewUserHandler(s *store.Store, sessions *auth.SessionManager, loginGuard *auth.LoginGuard, wg *sync.WaitGroup) *UserHandler {
+	return &UserHandler{
+		store:         s,
+		sessions:      sessions,
+		resendLimiter: auth.NewRateLimiter(5, time.Hour),
+		loginGuard:    loginGuard,
+		wg:            wg,
+		policy:        auth.PasswordPolicyFromEnv(),
+		// main refuses to start with an invalid setting
+		registration: registrationPolicy(),
+	}
 }
 
-func NewUserHandler(db *sql.DB) *UserHandler {
-	return &UserHandler{db: db}
+func registrationPolicy() auth.RegistrationPolicy {
+	policy, _ := auth.RegistrationPolicyFromEnv()
+	return policy
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -32,9 +72,10 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Username   string `json:"username"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -55,8 +96,14 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// generate 6 digit code
-	//send email
+	if !checkPasswordPolicy(w, h.policy, input.Password, input.Username, input.Email) {
+		return
+	}
+
+	inviteHash, ok := h.checkInvite(w, r, input.Email, input.InviteCode)
+	if !ok {
+		return
+	}
 
 	hashedPassword, err := auth.HashPassword(input.Password)
 	if err != nil {
@@ -67,9 +114,16 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userID int
-	query := "INSERT INTO users (username, email, password, is_admin, is_active) VALUES ($1, $2, $3, $4, $5) RETURNING id"
-	_, err = h.db.Exec(query, input.Username, input.Email, hashedPassword, false, false)
+	user := models.NewUser(input.Username, input.Email, hashedPassword)
+	err = h.store.Users.Create(r.Context(), user)
+	if errors.Is(err, store.ErrConflict) {
+		logger.Log.WithFields(logrus.Fields{
+			"email":    input.Email,
+			"username": input.Username,
+		}).Warn("User already exists")
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": "Error inserting user",
@@ -77,11 +131,34 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
+	userID := user.ID
 
-	code := utils.GenerateCode()
-	query = "INSERT INTO inactive_users (email, code) VALUES ($1, $2)"
-	_, err = h.db.Exec(query, input.Email, code)
+	// The code was checked above, but its last use may have been taken
+	// meanwhile; the account is only kept if the redemption succeeds.
+	if inviteHash != "" {
+		_, err := h.store.Invites.Redeem(r.Context(), inviteHash, userID, time.Now())
+		if err != nil {
+			if deleteErr := h.store.Users.Delete(r.Context(), userID); deleteErr != nil {
+				logger.Log.WithFields(logrus.Fields{
+					"error":  deleteErr.Error(),
+					"userID": userID,
+				}).Error("Failed to remove account after rejected invite")
+			}
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Invalid or expired invite code", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": "Error redeeming invite",
+			}).Error(err)
+			http.Error(w, "Error creating user", http.StatusInternalServerError)
+			return
+		}
+	}
 
+	code, err := h.issueVerificationCode(r, input.Email)
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": "Error creating user",
@@ -106,9 +183,12 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		"email":    input.Email,
 	}).Info("User registered successfully")
 
-	err = utils.SendEmail(input.Email, "Verification Code", fmt.Sprintf("Verify your email via this 4-digit code: %v", code), "")
-	if err != nil {
-		return
+	// Если письмо не ушло, пользователь может запросить код повторно
+	if err := sendVerificationEmail(input.Email, code); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": "Error sending verification email",
+			"email": input.Email,
+		}).Error(err)
 	}
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -122,6 +202,68 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// checkInvite enforces the registration mode for email. It returns the hash
+// of the invite code to redeem once the account exists, empty if none was
+// given, or writes an error response and returns false.
+func (h *UserHandler) checkInvite(w http.ResponseWriter, r *http.Request, email, code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		if !h.registration.NeedsInvite(email) {
+			return "", true
+		}
+		logger.Log.WithFields(logrus.Fields{
+			"email": email,
+			"mode":  h.registration.Mode,
+		}).Warn("Registration without a required invite code")
+		if h.registration.Mode == auth.RegistrationDomains {
+			http.Error(w, "Registration is limited to addresses at "+strings.Join(h.registration.AllowedDomains, ", ")+
+				"; other addresses need an invite code", http.StatusForbidden)
+		} else {
+			http.Error(w, "An invite code is required to register", http.StatusForbidden)
+		}
+		return "", false
+	}
+
+	hash := auth.HashToken(code)
+	invite, err := h.store.Invites.GetByHash(r.Context(), hash)
+	if err == nil && !invite.Usable(time.Now()) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"email": email,
+		}).Warn("Registration with an invalid invite code")
+		http.Error(w, "Invalid or expired invite code", http.StatusForbidden)
+		return "", false
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": "Error fetching invite",
+		}).Error(err)
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return "", false
+	}
+	return hash, true
+}
+
+// Registration tells the registration form which mode is in effect.
+func (h *UserHandler) Registration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	domains := h.registration.AllowedDomains
+	if domains == nil {
+		domains = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":            h.registration.Mode,
+		"allowed_domains": domains,
+	})
+}
+
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		logger.Log.WithFields(logrus.Fields{
@@ -146,48 +288,189 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user models.User
-	err := h.db.QueryRow("SELECT id, password, is_admin FROM users WHERE email = $1", credentials.Email).Scan(&user.ID, &user.Password, &user.IsAdmin)
+	// An unknown email goes through the same checks as a known one, with a
+	// nil user, so neither the response nor its timing reveals which
+	// accounts exist.
+	user, err := h.store.Users.GetByEmail(r.Context(), credentials.Email)
+	if errors.Is(err, store.ErrNotFound) {
+		user, err = nil, nil
+	}
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
-			"error": "Invalid credentials",
+			"error": "Error fetching user",
 			"email": credentials.Email,
 		}).Error(err)
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
 		return
 	}
 
-	if err := auth.CheckPasswordHash(credentials.Password, user.Password); err != nil {
+	ip := middleware.ClientIP(r)
+	wait, err := h.loginGuard.Check(r.Context(), user, credentials.Email, ip)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"email": credentials.Email,
+		}).Error("Failed to check login attempts")
+		http.Error(w, "Error logging in", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		logger.Log.WithFields(logrus.Fields{
+			"email": credentials.Email,
+			"ip":    ip,
+			"wait":  wait.String(),
+		}).Warn("Login attempt throttled")
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds()+0.999)))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if user == nil {
+		err = auth.CheckPasswordDummy(credentials.Password)
+	} else {
+		err = auth.CheckPasswordHash(credentials.Password, user.Password)
+	}
+	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": "Invalid credentials",
 			"email": credentials.Email,
+			"ip":    ip,
 		}).Error(err)
+		h.recordLoginFailure(r, user, credentials.Email, ip)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	getStatus := "SELECT is_active FROM users WHERE email = $1"
-
-	// Variable to hold the is_active value
-	var isActive bool
-
-	// Use QueryRow to get the result
-	err = h.db.QueryRow(getStatus, credentials.Email).Scan(&isActive)
+	// With two-factor authentication the failures are only forgotten once
+	// the code was accepted too; otherwise every correct password would
+	// reset the count of wrong codes.
+	mfaEnabled, err := twoFactorEnabled(r.Context(), h.store, user.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return
-		} else {
-			return
+		logger.Log.WithFields(logrus.Fields{
+			"error":  "Error fetching two-factor status",
+			"userID": user.ID,
+		}).Error(err)
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	if !mfaEnabled {
+		if err := h.loginGuard.Succeed(r.Context(), user); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  err.Error(),
+				"userID": user.ID,
+			}).Error("Failed to reset failed login attempts")
 		}
 	}
+	h.upgradePasswordHash(r, user, credentials.Password)
 
 	// Check the is_active value
-	if !isActive {
+	if !user.IsActive {
 		http.Error(w, "Email not verified", 400)
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID, user.IsAdmin)
+	completeLogin(w, r, h.store, h.sessions, user, "password")
+}
+
+// recordLoginFailure counts a wrong password and tells the owner when it
+// locked their account.
+func (h *UserHandler) recordLoginFailure(r *http.Request, user *models.User, email, ip string) {
+	lockedUntil, err := h.loginGuard.Fail(r.Context(), user, email, ip)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"email": email,
+		}).Error("Failed to record failed login attempt")
+		return
+	}
+	if lockedUntil == nil {
+		return
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"userID":      user.ID,
+		"ip":          ip,
+		"lockedUntil": lockedUntil.Format(time.RFC3339),
+	}).Warn("Account locked after failed login attempts")
+
+	body := fmt.Sprintf("There have been too many failed attempts to log in to your account, "+
+		"the last one from %s.\n\n"+
+		"Password login is locked until %s. If this was not you, consider changing your password "+
+		"once the lock expires, or reset it now with \"Forgot password\".",
+		ip, lockedUntil.UTC().Format("2006-01-02 15:04 MST"))
+	sendEmailAsync(h.wg, user.Email, "Your account has been temporarily locked", body)
+}
+
+// upgradePasswordHash rehashes the password with the current parameters
+// when the stored hash is weaker. The plaintext is only available at login,
+// so this is how existing accounts move to new parameters. Failures are
+// logged only: the old hash keeps working.
+func (h *UserHandler) upgradePasswordHash(r *http.Request, user *models.User, password string) {
+	if !auth.NeedsRehash(user.Password) {
+		return
+	}
+	from := auth.DescribeHash(user.Password)
+	hash, err := auth.HashPassword(password)
+	if err == nil {
+		err = h.store.Users.UpdatePassword(r.Context(), user.ID, hash)
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": user.ID,
+		}).Error("Failed to upgrade password hash")
+		return
+	}
+	user.Password = hash
+
+	to := auth.DescribeHash(hash)
+	logger.Log.WithFields(logrus.Fields{
+		"userID": user.ID,
+		"from":   from.Algorithm + " " + from.Params,
+		"to":     to.Algorithm + " " + to.Params,
+	}).Info("Password hash upgraded")
+}
+
+// completeLogin is called once the first factor (password, login link) of
+// user was accepted. With two-factor authentication the session is only
+// issued by /api/login/2fa in exchange for the challenge token and a code.
+func completeLogin(w http.ResponseWriter, r *http.Request, s *store.Store, sessions *auth.SessionManager, user *models.User, method string) {
+	mfaEnabled, err := twoFactorEnabled(r.Context(), s, user.ID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error":  "Error fetching two-factor status",
+			"userID": user.ID,
+		}).Error(err)
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	if mfaEnabled {
+		challenge, err := startMFAChallenge(r.Context(), s, user.ID)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error":  "Error creating login challenge",
+				"userID": user.ID,
+			}).Error(err)
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Log.WithFields(logrus.Fields{
+			"userID": user.ID,
+			"method": method,
+		}).Info("First factor accepted, second factor required")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":          "mfa_required",
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_in":      int(mfaChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	tokens, err := sessions.Start(r.Context(), user)
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error":  "Error generating token",
@@ -198,22 +481,50 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logger.Log.WithFields(logrus.Fields{
-		"userID":  user.ID,
-		"email":   credentials.Email,
-		"isAdmin": user.IsAdmin,
+		"userID":    user.ID,
+		"email":     user.Email,
+		"isAdmin":   user.IsAdmin,
+		"method":    method,
+		"sessionID": tokens.SessionID,
 	}).Info("User logged in successfully")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeLoginResponse(w, r, user, tokens)
+}
+
+// writeLoginResponse sends the tokens of a freshly started session.
+func writeLoginResponse(w http.ResponseWriter, r *http.Request, user *models.User, tokens *auth.TokenPair) {
+	writeTokens(w, middleware.CookieMode(r), tokens, map[string]interface{}{
 		"status":   "success",
-		"token":    token,
 		"user_id":  user.ID,
 		"is_admin": user.IsAdmin,
+		"role":     user.Role,
 	})
 }
 
+// writeTokens sends body with a new token pair. In cookie mode the tokens
+// are set as HttpOnly cookies and left out of the body.
+func writeTokens(w http.ResponseWriter, cookies bool, tokens *auth.TokenPair, body map[string]interface{}) {
+	if cookies {
+		if err := middleware.SetSessionCookies(w, tokens); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Failed to set session cookies")
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+		body["session_mode"] = "cookie"
+	} else {
+		body["token"] = tokens.AccessToken
+		body["refresh_token"] = tokens.RefreshToken
+	}
+	body["expires_in"] = tokens.ExpiresIn
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
 func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.db.Query("SELECT id, username, email, is_admin FROM users")
+	users, err := h.store.Users.List(r.Context())
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": "Error fetching users",
@@ -221,20 +532,6 @@ func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error fetching users", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var users []models.User
-	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.IsAdmin); err != nil {
-			logger.Log.WithFields(logrus.Fields{
-				"error": "Error scanning user",
-			}).Error(err)
-			http.Error(w, "Error scanning user", http.StatusInternalServerError)
-			return
-		}
-		users = append(users, user)
-	}
 
 	logger.Log.WithFields(logrus.Fields{
 		"count": len(users),
@@ -245,49 +542,100 @@ func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *UserHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	var credentials struct {
 		Email string `json:"email"`
-		Code  int    `json:"code"`
+		// Accepts both "123456" and 123456.
+		Code json.Number `json:"code"`
 	}
 
-	json.NewDecoder(r.Body).Decode(&credentials)
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": "Invalid JSON format",
+			"path":  r.URL.Path,
+		}).Error(err)
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
 
-	row := h.db.QueryRow("SELECT inactive_users_id FROM inactive_users WHERE email = $1 AND code = $2", credentials.Email, credentials.Code)
-	var userID int
-	err := row.Scan(&userID)
-	if err == sql.ErrNoRows {
+	verification, err := h.store.Verifications.Get(r.Context(), credentials.Email)
+	if errors.Is(err, store.ErrNotFound) {
 		logger.Log.WithFields(logrus.Fields{
-			"error": "Invalid verification code",
 			"email": credentials.Email,
-			"code":  credentials.Code,
-		}).Error(fmt.Errorf("invalid verification code"))
-		http.Error(w, "Invalid verification code", http.StatusNotFound)
+		}).Warn("No pending verification")
+		http.Error(w, "Invalid verification code", http.StatusBadRequest)
 		return
 	} else if err != nil {
 		logger.Log.WithFields(logrus.Fields{
-			"error": "Error fetching user ID",
+			"error": "Error fetching verification",
 			"email": credentials.Email,
-			"code":  credentials.Code,
 		}).Error(err)
-		http.Error(w, "Error fetching user ID", http.StatusInternalServerError)
+		http.Error(w, "Error fetching verification", http.StatusInternalServerError)
+		return
+	}
+
+	if verification.Attempts >= maxVerificationAttempts {
+		logger.Log.WithFields(logrus.Fields{
+			"email": credentials.Email,
+		}).Warn("Verification locked after too many attempts")
+		http.Error(w, "Too many failed attempts, request a new code", http.StatusTooManyRequests)
+		return
+	}
+	if verification.Expired(time.Now()) {
+		logger.Log.WithFields(logrus.Fields{
+			"email": credentials.Email,
+		}).Warn("Verification code expired")
+		http.Error(w, "Verification code has expired, request a new code", http.StatusBadRequest)
+		return
+	}
+
+	if !auth.TokenHashEqual(hashVerificationCode(credentials.Email, credentials.Code.String()), verification.CodeHash) {
+		attempts, err := h.store.Verifications.IncrementAttempts(r.Context(), credentials.Email)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": "Error recording verification attempt",
+				"email": credentials.Email,
+			}).Error(err)
+		}
+		logger.Log.WithFields(logrus.Fields{
+			"email":    credentials.Email,
+			"attempts": attempts,
+		}).Warn("Invalid verification code")
+		if attempts >= maxVerificationAttempts {
+			http.Error(w, "Too many failed attempts, request a new code", http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "Invalid verification code", http.StatusBadRequest)
 		return
 	}
 
-	query := "UPDATE users set is_active=true where email=$1"
-	_, err = h.db.Exec(query, credentials.Email)
+	err = h.store.Users.Activate(r.Context(), credentials.Email)
 
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
-			"error":  "Error activating user",
-			"userID": userID,
+			"error": "Error activating user",
+			"email": credentials.Email,
 		}).Error(err)
 		http.Error(w, "Error activating user", http.StatusInternalServerError)
 		return
 	}
 
+	if err := h.store.Verifications.Delete(r.Context(), credentials.Email); err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": "Error deleting verification",
+			"email": credentials.Email,
+		}).Error(err)
+	}
+
 	logger.Log.WithFields(logrus.Fields{
-		"userID": userID,
-		"email":  credentials.Email,
+		"email": credentials.Email,
 	}).Info("User verified successfully")
 
 	w.WriteHeader(http.StatusOK)
@@ -296,6 +644,117 @@ func (h *UserHandler) Verify(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ResendVerification sends a fresh code to an account that is still pending
+// verification. The previous code stops working and the attempt counter is
+// reset. The response does not reveal whether the address is pending.
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+		}).Warn("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || !utils.IsValidEmail(input.Email) {
+		logger.Log.WithFields(logrus.Fields{
+			"path": r.URL.Path,
+		}).Warn("Invalid resend request")
+		http.Error(w, "Invalid email", http.StatusBadRequest)
+		return
+	}
+
+	verification, err := h.store.Verifications.Get(r.Context(), input.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"error": "Error fetching verification",
+			"email": input.Email,
+		}).Error(err)
+		http.Error(w, "Error sending verification code", http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil {
+		if wait := verificationResendCooldown - time.Since(verification.LastSentAt); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "Please wait before requesting a new code", http.StatusTooManyRequests)
+			return
+		}
+	}
+	if !h.resendLimiter.Allow(strings.ToLower(input.Email)) {
+		logger.Log.WithFields(logrus.Fields{
+			"email": input.Email,
+			"ip":    r.RemoteAddr,
+		}).Warn("Verification resend rate limit exceeded")
+		http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if err == nil {
+		code, err := h.issueVerificationCode(r, input.Email)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": "Error issuing verification code",
+				"email": input.Email,
+			}).Error(err)
+			http.Error(w, "Error sending verification code", http.StatusInternalServerError)
+			return
+		}
+		if err := sendVerificationEmail(input.Email, code); err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": "Error sending verification email",
+				"email": input.Email,
+			}).Error(err)
+			http.Error(w, "Error sending verification code", http.StatusInternalServerError)
+			return
+		}
+		logger.Log.WithFields(logrus.Fields{
+			"email": input.Email,
+		}).Info("Verification code resent")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "If the account is awaiting verification, a new code has been sent",
+	})
+}
+
+// issueVerificationCode stores a fresh code for email, replacing any pending
+// one, and returns the plain code to be emailed.
+func (h *UserHandler) issueVerificationCode(r *http.Request, email string) (string, error) {
+	code, err := utils.GenerateCode()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = h.store.Verifications.Save(r.Context(), &models.Verification{
+		Email:      email,
+		CodeHash:   hashVerificationCode(email, code),
+		ExpiresAt:  now.Add(verificationCodeTTL),
+		LastSentAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func sendVerificationEmail(email, code string) error {
+	body := fmt.Sprintf("Verify your email via this 6-digit code: %s\n\nThe code expires in %d minutes.",
+		code, int(verificationCodeTTL.Minutes()))
+	return sendEmail(email, "Verification Code", body, "")
+}
+
+// hashVerificationCode binds the code to the address so equal codes issued
+// to different users do not share a hash.
+func hashVerificationCode(email, code string) string {
+	return auth.HashToken(email + ":" + code)
+}
+
 // user-profile
 // logic for update current user data: password, username
 // user activity
@@ -310,8 +769,13 @@ func (h *UserHandler) UserUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Профиль всегда принадлежит текущему пользователю, id из запроса не используется
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var payload struct {
-		ID       int    `json:"id"`
 		Username string `json:"username"`
 		Password string `json:"password"`
 	}
@@ -324,16 +788,32 @@ func (h *UserHandler) UserUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if payload.ID == 0 || payload.Username == "" || payload.Password == "" {
+	if payload.Username == "" || payload.Password == "" {
 		logger.Log.WithFields(logrus.Fields{
-			"id":       payload.ID,
+			"id":       userID,
 			"username": payload.Username,
-			"password": payload.Password,
 		}).Warn("Missing required fields")
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
+	user, err := h.store.Users.GetByID(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    userID,
+		}).Error("Failed to fetch user")
+		http.Error(w, "Error updating user", http.StatusInternalServerError)
+		return
+	}
+	if !checkPasswordPolicy(w, h.policy, payload.Password, payload.Username, user.Email) {
+		return
+	}
+
 	// Hash the password before saving it
 	hashedPassword, err := auth.HashPassword(payload.Password)
 	if err != nil {
@@ -345,45 +825,81 @@ func (h *UserHandler) UserUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update user data in database
-	result, err := h.db.Exec(`
-		UPDATE users 
-		SET username = $1, password = $2, updated_at = NOW()
-		WHERE id = $3
-	`, payload.Username, hashedPassword, payload.ID)
-
+	err = h.store.Users.UpdateProfile(r.Context(), userID, payload.Username, hashedPassword)
+	if errors.Is(err, store.ErrNotFound) {
+		logger.Log.WithFields(logrus.Fields{
+			"id": userID,
+		}).Warn("User not found for update")
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		logger.Log.WithFields(logrus.Fields{
+			"id":       userID,
+			"username": payload.Username,
+		}).Warn("Username already taken")
+		http.Error(w, "Username already taken", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error": err.Error(),
-			"id":    payload.ID,
+			"id":    userID,
 		}).Error("Failed to update user")
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	// A password change logs the user out everywhere; the caller gets a
+	// fresh session so the profile page keeps working.
+	if err := h.sessions.RevokeAll(r.Context(), userID); err != nil {
 		logger.Log.WithFields(logrus.Fields{
-			"id": payload.ID,
-		}).Warn("User not found for update")
-		http.Error(w, "User not found", http.StatusNotFound)
+			"error": err.Error(),
+			"id":    userID,
+		}).Error("Failed to revoke sessions after password change")
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	user, err = h.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    userID,
+		}).Error("Failed to reload user")
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	// The new session keeps the second factor of the one it replaces, or an
+	// admin would lose access to routes that require it.
+	start := h.sessions.Start
+	if principal, ok := middleware.PrincipalFrom(r.Context()); ok && principal.MFA {
+		start = h.sessions.StartMFA
+	}
+	tokens, err := start(r.Context(), user)
+	if err != nil {
+		logger.Log.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    userID,
+		}).Error("Error generating token")
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
 	logger.Log.WithFields(logrus.Fields{
-		"id":       payload.ID,
+		"id":       userID,
 		"username": payload.Username,
 	}).Info("User updated successfully")
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User updated successfully"})
+	writeTokens(w, middleware.CookieMode(r), tokens, map[string]interface{}{
+		"message": "User updated successfully",
+	})
 }
 func (h *UserHandler) UserData(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		// Обработка получения данных пользователя
-		userID := r.URL.Query().Get("id")
-		if userID == "" {
-			logger.Log.Warn("User ID is required")
-			http.Error(w, `{"error": "User ID is required"}`, http.StatusBadRequest)
+		// Обработка получения данных текущего пользователя
+		userID, ok := currentUserID(w, r)
+		if !ok {
 			return
 		}
 
@@ -391,15 +907,13 @@ func (h *UserHandler) UserData(w http.ResponseWriter, r *http.Request) {
 			Username string `json:"username"`
 			Email    string `json:"email"`
 			IsAdmin  bool   `json:"is_admin"`
+			Role     string `json:"role"`
+			models.FollowCounts
 		}
 
-		err := h.db.QueryRow(`
-			SELECT username, email, is_admin
-			FROM users 
-			WHERE id = $1
-		`, userID).Scan(&user.Username, &user.Email, &user.IsAdmin)
+		found, err := h.store.Users.GetByID(r.Context(), userID)
 		if err != nil {
-			if err == sql.ErrNoRows {
+			if errors.Is(err, store.ErrNotFound) {
 				// Пользователь не найден, возвращаем ошибку в JSON формате
 				logger.Log.WithFields(logrus.Fields{
 					"id": userID,
@@ -415,6 +929,19 @@ func (h *UserHandler) UserData(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
+		user.Username = found.Username
+		user.Email = found.Email
+		user.IsAdmin = found.IsAdmin
+		user.Role = found.Role
+		user.FollowCounts, err = h.store.Follows.Counts(r.Context(), userID)
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": err.Error(),
+				"id":    userID,
+			}).Error("Failed to fetch follow counts")
+			http.Error(w, `{"error": "Failed to fetch user data"}`, http.StatusInternalServerError)
+			return
+		}
 
 		// Логируем успешное получение данных пользователя
 		logger.Log.WithFields(logrus.Fields{
@@ -440,30 +967,14 @@ func (h *UserHandler) UserPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID from query parameters
-	userIDStr := r.URL.Query().Get("id")
-	if userIDStr == "" {
-		logger.Log.Warn("User ID is required")
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
-	}
-
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Warn("Invalid user ID")
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	// Posts of the current user
+	userID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Fetch posts from the database
-	rows, err := h.db.Query(`
-		SELECT content, created_at
-		FROM posts
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-	`, userID)
+	// Fetch posts from the store
+	userPosts, err := h.store.Posts.List(r.Context(), store.PostFilter{UserID: userID})
 	if err != nil {
 		logger.Log.WithFields(logrus.Fields{
 			"error":  err.Error(),
@@ -472,33 +983,15 @@ func (h *UserHandler) UserPosts(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to fetch user posts", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var posts []struct {
-		Content   string `json:"content"`
-		CreatedAt string `json:"created_at"`
+	type userPost struct {
+		Content   string    `json:"content"`
+		CreatedAt time.Time `json:"created_at"`
 	}
 
-	for rows.Next() {
-		var post struct {
-			Content   string `json:"content"`
-			CreatedAt string `json:"created_at"`
-		}
-		if err := rows.Scan(&post.Content, &post.CreatedAt); err != nil {
-			logger.Log.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Error("Error scanning post row")
-			continue
-		}
-		posts = append(posts, post)
-	}
-
-	if err = rows.Err(); err != nil {
-		logger.Log.WithFields(logrus.Fields{
-			"error": err.Error(),
-		}).Error("Error iterating over post rows")
-		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
-		return
+	var posts []userPost
+	for _, post := range userPosts {
+		posts = append(posts, userPost{Content: post.Content, CreatedAt: post.CreatedAt})
 	}
 
 	// Log successful retrieval of posts
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+var codePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+func registerForVerification(t *testing.T, handler *UserHandler, sent *[]string) string {
+	rec := postJSON(handler.Register, "/api/register", map[string]string{
+		"username": "alice",
+		"email":    "alice@example.com",
+		"password": "secret-password",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Ожидался статус 201, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	code := codePattern.FindString((*sent)[len(*sent)-1])
+	if code == "" {
+		t.Fatalf("В письме нет кода подтверждения: %q", (*sent)[len(*sent)-1])
+	}
+	return code
+}
+
+func TestVerifyActivatesUserAndDeletesCode(t *testing.T) {
+	sent := captureEmails(t)
+	st := memory.New()
+	handler := NewUserHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st), nil)
+	code := registerForVerification(t, handler, sent)
+
+	if v, _ := st.Verifications.Get(context.Background(), "alice@example.com"); v == nil || v.CodeHash == code {
+		t.Fatal("Код должен храниться только в виде хэша")
+	}
+
+	rec := postJSON(handler.Verify, "/api/verify", map[string]string{"email": "alice@example.com", "code": code})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	user, err := st.Users.GetByEmail(context.Background(), "alice@example.com")
+	if err != nil || !user.IsActive {
+		t.Errorf("Пользователь должен быть активирован: %v", err)
+	}
+	if _, err := st.Verifications.Get(context.Background(), "alice@example.com"); err != store.ErrNotFound {
+		t.Errorf("Запись подтверждения должна быть удалена, получено: %v", err)
+	}
+}
+
+func TestVerifyLocksOutAfterTooManyAttempts(t *testing.T) {
+	sent := captureEmails(t)
+	st := memory.New()
+	handler := NewUserHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st), nil)
+	code := registerForVerification(t, handler, sent)
+
+	wrong := "100000"
+	if code == wrong {
+		wrong = "100001"
+	}
+	for i := 0; i < maxVerificationAttempts; i++ {
+		postJSON(handler.Verify, "/api/verify", map[string]string{"email": "alice@example.com", "code": wrong})
+	}
+
+	// После блокировки даже верный код не принимается
+	rec := postJSON(handler.Verify, "/api/verify", map[string]string{"email": "alice@example.com", "code": code})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Ожидался статус 429, получен: %d", rec.Code)
+	}
+
+	// Повторная отправка сразу после регистрации ограничена
+	rec = postJSON(handler.ResendVerification, "/api/verify/resend", map[string]string{"email": "alice@example.com"})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Ожидался статус 429 до истечения паузы, получен: %d", rec.Code)
+	}
+
+	// Сдвигаем время последней отправки, чтобы пауза истекла
+	v, _ := st.Verifications.Get(context.Background(), "alice@example.com")
+	v.LastSentAt = time.Now().Add(-2 * verificationResendCooldown)
+	st.Verifications.Save(context.Background(), v)
+
+	rec = postJSON(handler.ResendVerification, "/api/verify/resend", map[string]string{"email": "alice@example.com"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d (%s)", rec.Code, rec.Body.String())
+	}
+	newCode := codePattern.FindString((*sent)[len(*sent)-1])
+
+	rec = postJSON(handler.Verify, "/api/verify", map[string]string{"email": "alice@example.com", "code": newCode})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Новый код должен сработать, получен статус: %d (%s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestResendUnknownEmailLooksLikeSuccess(t *testing.T) {
+	sent := captureEmails(t)
+	st := memory.New()
+	handler := NewUserHandler(st, auth.NewSessionManager(st), auth.NewLoginGuard(st), nil)
+
+	rec := postJSON(handler.ResendVerification, "/api/verify/resend", map[string]string{"email": "nobody@example.com"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получен: %d", rec.Code)
+	}
+	if len(*sent) != 0 {
+		t.Errorf("Письмо не должно отправляться, отправлено: %d", len(*sent))
+	}
+}
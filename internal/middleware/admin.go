@@ -1,34 +1,75 @@
 package middleware
 
 import (
-	"github.com/pinokiochan/social-network-render/internal/auth"
 	"net/http"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/sirupsen/logrus"
 )
 
-// AdminOnly проверяет, является ли пользователь администратором
-func AdminOnly(next http.HandlerFunc) http.HandlerFunc {
+// Require пропускает запрос, только если роль пользователя имеет право
+// permission согласно матрице ролей в базе данных
+func (a *Auth) Require(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		// Проверяем токен, включая отзыв и версию токена
+		claims, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		// Токен имперсонации не дает доступа к админке, даже если
+		// пользователь, от имени которого он выдан, администратор
+		if claims.IsImpersonation() {
+			a.serveImpersonated(w, r, claims, true, denyImpersonation)
 			return
 		}
 
-		// Проверяем и декодируем токен
-		claims, err := auth.VerifyToken(token)
+		// Проверяем право роли пользователя
+		role := auth.RoleOf(claims)
+		allowed, err := a.permissions.Can(r.Context(), role, permission)
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			logger.Log.WithFields(logrus.Fields{
+				"error":      err.Error(),
+				"permission": permission,
+			}).Error("Failed to check permission")
+			http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			logger.Log.WithFields(logrus.Fields{
+				"userID":     claims.UserID,
+				"role":       role,
+				"permission": permission,
+				"path":       r.URL.Path,
+			}).Warn("Permission denied")
+			http.Error(w, "Insufficient permissions", http.StatusForbidden)
+			return
+		}
+
+		// Personal access token должен иметь admin:read для чтения и admin:write для изменений
+		scope := auth.ScopeAdminWrite
+		if r.Method == http.MethodGet {
+			scope = auth.ScopeAdminRead
+		}
+		if !authorizeScope(w, r, claims, scope) {
 			return
 		}
 
-		// Проверяем, является ли пользователь администратором
-		if !claims.IsAdmin {
-			http.Error(w, "Admin access required", http.StatusForbidden)
+		// Администраторы должны входить с двухфакторной аутентификацией.
+		// Токены с admin-доступом выпускаются только из такой сессии.
+		if a.requireAdminMFA && models.IsAdminRole(role) && !claims.MFA && !claims.IsAccessToken() {
+			logger.Log.WithFields(logrus.Fields{
+				"userID": claims.UserID,
+				"path":   r.URL.Path,
+			}).Warn("Admin request without two-factor authentication")
+			http.Error(w, "Two-factor authentication required for admin access", http.StatusForbidden)
 			return
 		}
 
 		// Если все проверки пройдены, продолжаем выполнение запроса
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withPrincipal(r, claims))
 
 	}
 
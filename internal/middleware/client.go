@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+)
+
+// ClientMiddleware stores the user agent and IP of the request in its
+// context, so sessions opened or used by the request record the device.
+func ClientMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := auth.WithClient(r.Context(), auth.Client{
+			UserAgent: r.UserAgent(),
+			IP:        ClientIP(r),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClientIP returns the address of the client without the port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
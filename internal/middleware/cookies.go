@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/config"
+)
+
+// Cookie session mode keeps the tokens out of reach of scripts: the access
+// and refresh tokens are HttpOnly cookies, and requests that change state
+// must echo the readable CSRF cookie in the X-CSRF-Token header
+// (double-submit), which a cross-site page cannot read.
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+
+	// SessionModeHeader set to "cookie" on a login request selects cookie
+	// mode for the new session.
+	SessionModeHeader = "X-Session-Mode"
+	CSRFHeader        = "X-CSRF-Token"
+
+	// The refresh token is only needed by /api/token/refresh and /api/logout.
+	refreshCookiePath = "/api/"
+)
+
+// CookieMode reports whether tokens issued in response to r belong in
+// cookies: the client asked for cookie mode, or sent session cookies and no
+// Authorization header.
+func CookieMode(r *http.Request) bool {
+	if r.Header.Get(SessionModeHeader) == "cookie" {
+		return true
+	}
+	if r.Header.Get("Authorization") != "" {
+		return false
+	}
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie} {
+		if c, err := r.Cookie(name); err == nil && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSessionCookies stores a freshly issued token pair in cookies together
+// with a new CSRF token.
+func SetSessionCookies(w http.ResponseWriter, tokens *auth.TokenPair) error {
+	csrf, err := auth.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	refreshAge := int(auth.RefreshTokenTTL / time.Second)
+	http.SetCookie(w, sessionCookie(AccessTokenCookie, tokens.AccessToken, "/", tokens.ExpiresIn, true))
+	http.SetCookie(w, sessionCookie(RefreshTokenCookie, tokens.RefreshToken, refreshCookiePath, refreshAge, true))
+	http.SetCookie(w, sessionCookie(CSRFCookie, csrf, "/", refreshAge, false))
+	return nil
+}
+
+// ClearSessionCookies removes the session cookies from the browser.
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, sessionCookie(AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, sessionCookie(RefreshTokenCookie, "", refreshCookiePath, -1, true))
+	http.SetCookie(w, sessionCookie(CSRFCookie, "", "/", -1, false))
+}
+
+func sessionCookie(name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   config.SecureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// RefreshTokenFromCookie returns the refresh token stored in cookie mode.
+func RefreshTokenFromCookie(r *http.Request) string {
+	c, err := r.Cookie(RefreshTokenCookie)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// ValidCSRF reports whether r carries the CSRF token of its session cookie
+// in the X-CSRF-Token header. Safe methods never need one.
+func ValidCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	c, err := r.Cookie(CSRFCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(c.Value)) == 1
+}
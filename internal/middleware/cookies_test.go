@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestCookieSessionRequiresCSRF(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	if err := st.Users.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	sessions := auth.NewSessionManager(st)
+	tokens, err := sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+
+	set := httptest.NewRecorder()
+	if err := middleware.SetSessionCookies(set, tokens); err != nil {
+		t.Fatalf("SetSessionCookies returned error: %v", err)
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, c := range set.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	for _, name := range []string{middleware.AccessTokenCookie, middleware.RefreshTokenCookie} {
+		c := cookies[name]
+		if c == nil || !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteStrictMode {
+			t.Fatalf("cookie %s: got %+v, want HttpOnly, Secure and SameSite=Strict", name, c)
+		}
+	}
+	csrf := cookies[middleware.CSRFCookie]
+	if csrf == nil || csrf.HttpOnly || csrf.Value == "" {
+		t.Fatalf("CSRF cookie must be readable by scripts, got %+v", csrf)
+	}
+
+	handler := middleware.NewAuth(sessions, auth.NewPermissions(st)).JWT(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(method, csrfHeader string) int {
+		req := httptest.NewRequest(method, "/api/user-profile/edit", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		if csrfHeader != "" {
+			req.Header.Set(middleware.CSRFHeader, csrfHeader)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	if code := call(http.MethodGet, ""); code != http.StatusOK {
+		t.Errorf("GET with cookie: got %d, want 200", code)
+	}
+	if code := call(http.MethodPost, ""); code != http.StatusForbidden {
+		t.Errorf("POST without CSRF header: got %d, want 403", code)
+	}
+	if code := call(http.MethodPost, "forged"); code != http.StatusForbidden {
+		t.Errorf("POST with wrong CSRF header: got %d, want 403", code)
+	}
+	if code := call(http.MethodPost, csrf.Value); code != http.StatusOK {
+		t.Errorf("POST with CSRF header: got %d, want 200", code)
+	}
+
+	// A token in the Authorization header is not subject to CSRF checks,
+	// since browsers never attach it on their own.
+	req := httptest.NewRequest(http.MethodPost, "/api/user-profile/edit", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("POST with header token: got %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestImpersonationTokens(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	admin := models.NewUser("admin", "admin@example.com", "hash")
+	admin.Role = models.RoleAdmin
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	for _, u := range []*models.User{admin, user} {
+		if err := st.Users.Create(ctx, u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	sessions := auth.NewSessionManager(st)
+	a := middleware.NewAuth(sessions, auth.NewPermissions(st))
+	var seen *middleware.Principal
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = middleware.PrincipalFrom(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}
+	content := a.JWTScope(auth.ScopePostsWrite, ok)
+	account := a.JWT(ok)
+	adminRoute := a.Require(models.PermUsersRead, ok)
+
+	call := func(handler http.HandlerFunc, method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	adminPair, err := sessions.Start(ctx, admin)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	adminClaims, _ := auth.VerifyToken(adminPair.AccessToken)
+	readOnly, _, err := sessions.Impersonate(ctx, admin.ID, adminClaims.SessionID, user, true)
+	if err != nil {
+		t.Fatalf("Impersonate returned error: %v", err)
+	}
+
+	rec := call(content, http.MethodGet, readOnly)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("read-only GET: got %d, want 200", rec.Code)
+	}
+	if seen.UserID != user.ID || seen.Impersonator != admin.ID || !seen.ReadOnly {
+		t.Errorf("unexpected principal %+v", seen)
+	}
+	if rec.Header().Get(middleware.HeaderImpersonatedBy) != strconv.Itoa(admin.ID) ||
+		rec.Header().Get(middleware.HeaderImpersonationReadOnly) != "true" {
+		t.Errorf("missing impersonation headers: %v", rec.Header())
+	}
+	if code := call(content, http.MethodPost, readOnly).Code; code != http.StatusForbidden {
+		t.Errorf("read-only POST: got %d, want 403", code)
+	}
+
+	writable, _, err := sessions.Impersonate(ctx, admin.ID, adminClaims.SessionID, user, false)
+	if err != nil {
+		t.Fatalf("Impersonate returned error: %v", err)
+	}
+	if code := call(content, http.MethodPost, writable).Code; code != http.StatusOK {
+		t.Errorf("writable POST: got %d, want 200", code)
+	}
+	// Account settings stay read-only even for a writable token.
+	if code := call(account, http.MethodPost, writable).Code; code != http.StatusForbidden {
+		t.Errorf("writable POST to account route: got %d, want 403", code)
+	}
+	if code := call(account, http.MethodGet, writable).Code; code != http.StatusOK {
+		t.Errorf("writable GET of account route: got %d, want 200", code)
+	}
+
+	// Impersonating an admin does not grant admin access.
+	otherAdmin := models.NewUser("admin2", "admin2@example.com", "hash")
+	otherAdmin.Role = models.RoleAdmin
+	st.Users.Create(ctx, otherAdmin)
+	asAdmin, _, _ := sessions.Impersonate(ctx, admin.ID, adminClaims.SessionID, otherAdmin, true)
+	if code := call(adminRoute, http.MethodGet, asAdmin).Code; code != http.StatusForbidden {
+		t.Errorf("admin route with impersonation token: got %d, want 403", code)
+	}
+
+	events, err := st.Impersonation.List(ctx, 100)
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("got %d audit events, want 6", len(events))
+	}
+	if e := events[0]; e.UserID != otherAdmin.ID || e.Status != http.StatusForbidden || e.Method != http.MethodGet {
+		t.Errorf("unexpected latest event %+v", e)
+	}
+
+	// Logging the admin out ends the impersonation.
+	if err := sessions.Revoke(ctx, adminClaims.SessionID); err != nil {
+		t.Fatalf("Revoke returned error: %v", err)
+	}
+	if code := call(content, http.MethodGet, readOnly).Code; code != http.StatusUnauthorized {
+		t.Errorf("token after admin logout: got %d, want 401", code)
+	}
+}
@@ -1,49 +1,162 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
-	"github.com/pinokiochan/social-network-render/internal/auth"
+	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/config"
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/sirupsen/logrus"
 )
 
-func JWT(next http.HandlerFunc) http.HandlerFunc {
+// Auth verifies access tokens and checks them against the server-side
+// revocation state kept by the session manager.
+type Auth struct {
+	sessions    *auth.SessionManager
+	permissions *auth.Permissions
+	// requireAdminMFA makes Require reject admin sessions opened without a
+	// second factor.
+	requireAdminMFA bool
+}
+
+func NewAuth(sessions *auth.SessionManager, permissions *auth.Permissions) *Auth {
+	return &Auth{sessions: sessions, permissions: permissions, requireAdminMFA: config.RequireAdminMFA()}
+}
+
+// JWT requires a session token. Personal access tokens are rejected; routes
+// that accept them declare a scope with JWTScope.
+func (a *Auth) JWT(next http.HandlerFunc) http.HandlerFunc {
+	return a.JWTScope("", next)
+}
+
+// JWTScope requires a session token or a personal access token granted the
+// given scope.
+func (a *Auth) JWTScope(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			http.Error(w, "No token provided", http.StatusUnauthorized)
+		claims, ok := a.authenticate(w, r)
+		if !ok {
 			return
 		}
-
-		claims := &auth.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return auth.JwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		if !authorizeScope(w, r, claims, scope) {
+			return
+		}
+		if claims.IsImpersonation() {
+			// Routes without a scope manage the account itself
+			a.serveImpersonated(w, r, claims, scope == "", next)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withPrincipal(r, claims))
+	}
+}
+
+// authorizeScope writes an error response and returns false if claims come
+// from a personal access token that lacks scope. An empty scope means the
+// route is not available to personal access tokens at all.
+func authorizeScope(w http.ResponseWriter, r *http.Request, claims *auth.Claims, scope string) bool {
+	if !claims.IsAccessToken() {
+		return true
+	}
+	if scope == "" {
+		http.Error(w, "Personal access tokens are not accepted for this endpoint", http.StatusForbidden)
+		return false
+	}
+	if !claims.HasScope(scope) {
+		logger.Log.WithFields(logrus.Fields{
+			"userID":  claims.UserID,
+			"tokenID": claims.AccessTokenID,
+			"scope":   scope,
+			"path":    r.URL.Path,
+		}).Warn("Personal access token lacks required scope")
+		http.Error(w, "Token is missing the required scope: "+scope, http.StatusForbidden)
+		return false
 	}
+	return true
 }
 
-func GetUserIDFromToken(r *http.Request) (int, error) {
-	tokenString := r.Header.Get("Authorization")
+// authenticate writes an error response and returns false if the request
+// does not carry a valid, unrevoked session token or personal access token.
+func (a *Auth) authenticate(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	tokenString, fromCookie := tokenFromRequest(r)
 	if tokenString == "" {
-		return 0, fmt.Errorf("no token provided")
+		http.Error(w, "No token provided", http.StatusUnauthorized)
+		return nil, false
+	}
+	// Browsers attach the cookie to cross-site requests too
+	if fromCookie && !ValidCSRF(r) {
+		logger.Log.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		}).Warn("Missing or invalid CSRF token")
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+		return nil, false
+	}
+
+	if auth.IsAccessToken(tokenString) {
+		claims, err := a.sessions.ValidateAccessToken(r.Context(), tokenString)
+		if err == auth.ErrInvalidAccessToken {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return nil, false
+		}
+		if err != nil {
+			logger.Log.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Failed to validate personal access token")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return nil, false
+		}
+		return claims, true
+	}
+
+	claims, err := auth.VerifyToken(tokenString)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if err := a.sessions.Validate(r.Context(), claims); err != nil {
+		if err == auth.ErrTokenRevoked {
+			logger.Log.WithFields(logrus.Fields{
+				"userID": claims.UserID,
+				"path":   r.URL.Path,
+			}).Warn("Revoked token rejected")
+			http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+			return nil, false
+		}
+		logger.Log.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"userID": claims.UserID,
+		}).Error("Failed to check token revocation")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
 	}
 
-	claims := &auth.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return auth.JwtKey, nil
-	})
+	return claims, true
+}
+
+// TokenFromRequest returns the access token from the Authorization header,
+// accepting both a bare token and the "Bearer <token>" form, or else from
+// the session cookie.
+func TokenFromRequest(r *http.Request) string {
+	token, _ := tokenFromRequest(r)
+	return token
+}
 
-	if err != nil || !token.Valid {
-		return 0, fmt.Errorf("invalid token")
+func tokenFromRequest(r *http.Request) (token string, fromCookie bool) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:]), false
 	}
+	if header != "" {
+		return header, false
+	}
+	if c, err := r.Cookie(AccessTokenCookie); err == nil && c.Value != "" {
+		return c.Value, true
+	}
+	return "", false
+}
 
-	return claims.UserID, nil
-}
\ No newline at end of file
+func withPrincipal(r *http.Request, claims *auth.Claims) *http.Request {
+	return r.WithContext(WithPrincipal(r.Context(), NewPrincipal(claims)))
+}
@@ -0,0 +1,277 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+	"github.com/pinokiochan/social-network-render/internal/middleware"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+)
+
+func TestJWTRejectsRevokedTokens(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("alice", "alice@example.com", "hash")
+	if err := st.Users.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	sessions := auth.NewSessionManager(st)
+	handler := middleware.NewAuth(sessions, auth.NewPermissions(st)).JWT(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/index/posts", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	first, err := sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	if code := call(first.AccessToken); code != http.StatusOK {
+		t.Fatalf("fresh token: got %d, want 200", code)
+	}
+
+	// A single revoked token is rejected.
+	claims, err := auth.VerifyToken(first.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyToken returned error: %v", err)
+	}
+	if err := sessions.RevokeToken(ctx, claims); err != nil {
+		t.Fatalf("RevokeToken returned error: %v", err)
+	}
+	if code := call(first.AccessToken); code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: got %d, want 401", code)
+	}
+
+	// "Log out everywhere" invalidates every token issued before it.
+	second, err := sessions.Start(ctx, user)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	if err := sessions.RevokeAll(ctx, user.ID); err != nil {
+		t.Fatalf("RevokeAll returned error: %v", err)
+	}
+	if code := call(second.AccessToken); code != http.StatusUnauthorized {
+		t.Fatalf("token after revoke-all: got %d, want 401", code)
+	}
+
+	// Tokens of a deleted user stop working as soon as the cache is dropped.
+	reloaded, _ := st.Users.GetByID(ctx, user.ID)
+	third, err := sessions.Start(ctx, reloaded)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	if code := call(third.AccessToken); code != http.StatusOK {
+		t.Fatalf("token after re-login: got %d, want 200", code)
+	}
+	if err := st.Users.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	sessions.Forget(user.ID)
+	if code := call(third.AccessToken); code != http.StatusUnauthorized {
+		t.Fatalf("token of deleted user: got %d, want 401", code)
+	}
+}
+
+func TestJWTStoresPrincipal(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("mod", "mod@example.com", "hash")
+	user.Role = models.RoleModerator
+	if err := st.Users.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	sessions := auth.NewSessionManager(st)
+	tokens, err := sessions.StartMFA(ctx, user)
+	if err != nil {
+		t.Fatalf("StartMFA returned error: %v", err)
+	}
+
+	var principal *middleware.Principal
+	handler := middleware.NewAuth(sessions, auth.NewPermissions(st)).JWT(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = middleware.PrincipalFrom(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	handler(httptest.NewRecorder(), req)
+
+	if principal == nil {
+		t.Fatal("handler did not receive a principal")
+	}
+	if principal.UserID != user.ID || principal.Role != models.RoleModerator ||
+		principal.SessionID != tokens.SessionID || !principal.MFA || principal.IsAccessToken() {
+		t.Errorf("unexpected principal: %+v", principal)
+	}
+
+	if _, ok := middleware.PrincipalFrom(context.Background()); ok {
+		t.Error("PrincipalFrom found a principal in an empty context")
+	}
+}
+
+func TestRequireAdminSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	admin := models.NewUser("root", "root@example.com", "hash")
+	admin.IsAdmin = true
+	if err := st.Users.Create(ctx, admin); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	sessions := auth.NewSessionManager(st)
+	handler := middleware.NewAuth(sessions, auth.NewPermissions(st)).Require(models.PermStatsRead, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/stats", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	passwordOnly, err := sessions.Start(ctx, admin)
+	if err != nil {
+		t.Fatalf("Start returned error: %v", err)
+	}
+	if code := call(passwordOnly.AccessToken); code != http.StatusForbidden {
+		t.Fatalf("admin without 2FA: got %d, want 403", code)
+	}
+
+	withMFA, err := sessions.StartMFA(ctx, admin)
+	if err != nil {
+		t.Fatalf("StartMFA returned error: %v", err)
+	}
+	if code := call(withMFA.AccessToken); code != http.StatusOK {
+		t.Fatalf("admin with 2FA: got %d, want 200", code)
+	}
+
+	// The mfa claim survives refresh.
+	refreshed, err := sessions.Refresh(ctx, withMFA.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh returned error: %v", err)
+	}
+	if code := call(refreshed.AccessToken); code != http.StatusOK {
+		t.Fatalf("refreshed admin token: got %d, want 200", code)
+	}
+}
+
+func TestRequirePermissions(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	moderator := models.NewUser("mod", "mod@example.com", "hash")
+	moderator.Role = models.RoleModerator
+	member := models.NewUser("bob", "bob@example.com", "hash")
+	for _, u := range []*models.User{moderator, member} {
+		if err := st.Users.Create(ctx, u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	sessions := auth.NewSessionManager(st)
+	permissions := auth.NewPermissions(st)
+	authMiddleware := middleware.NewAuth(sessions, permissions)
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	call := func(permission string, user *models.User) int {
+		tokens, err := sessions.Start(ctx, user)
+		if err != nil {
+			t.Fatalf("Start returned error: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		rec := httptest.NewRecorder()
+		authMiddleware.Require(permission, ok)(rec, req)
+		return rec.Code
+	}
+
+	if code := call(models.PermPostsDeleteAny, moderator); code != http.StatusOK {
+		t.Fatalf("moderator deleting posts: got %d, want 200", code)
+	}
+	if code := call(models.PermUsersDelete, moderator); code != http.StatusForbidden {
+		t.Fatalf("moderator deleting users: got %d, want 403", code)
+	}
+	if code := call(models.PermEmailBroadcast, moderator); code != http.StatusForbidden {
+		t.Fatalf("moderator broadcasting email: got %d, want 403", code)
+	}
+	if code := call(models.PermStatsRead, member); code != http.StatusForbidden {
+		t.Fatalf("regular user reading stats: got %d, want 403", code)
+	}
+
+	// Changes to the matrix apply immediately.
+	if err := permissions.Revoke(ctx, models.RoleModerator, models.PermPostsDeleteAny); err != nil {
+		t.Fatalf("Revoke returned error: %v", err)
+	}
+	if code := call(models.PermPostsDeleteAny, moderator); code != http.StatusForbidden {
+		t.Fatalf("after revoking permission: got %d, want 403", code)
+	}
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	user := models.NewUser("bot", "bot@example.com", "hash")
+	if err := st.Users.Create(ctx, user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	sessions := auth.NewSessionManager(st)
+	authMiddleware := middleware.NewAuth(sessions, auth.NewPermissions(st))
+	var gotUserID int
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		gotUserID, _ = middleware.UserIDFrom(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}
+
+	call := func(handler http.HandlerFunc, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	pat := &models.PersonalAccessToken{UserID: user.ID, Name: "poster", Scopes: []string{auth.ScopePostsWrite}}
+	token, err := sessions.CreateAccessToken(ctx, pat)
+	if err != nil {
+		t.Fatalf("CreateAccessToken returned error: %v", err)
+	}
+
+	if code := call(authMiddleware.JWTScope(auth.ScopePostsWrite, ok), token); code != http.StatusOK {
+		t.Fatalf("granted scope: got %d, want 200", code)
+	}
+	if gotUserID != user.ID {
+		t.Errorf("handler saw user %d, want %d", gotUserID, user.ID)
+	}
+	if code := call(authMiddleware.JWTScope(auth.ScopeCommentsWrite, ok), token); code != http.StatusForbidden {
+		t.Fatalf("missing scope: got %d, want 403", code)
+	}
+	if code := call(authMiddleware.JWT(ok), token); code != http.StatusForbidden {
+		t.Fatalf("route without scope: got %d, want 403", code)
+	}
+
+	stored, _ := st.AccessTokens.GetByHash(ctx, auth.HashToken(token))
+	if stored.LastUsedAt == nil {
+		t.Error("last_used_at was not recorded")
+	}
+
+	if err := st.AccessTokens.Revoke(ctx, pat.ID, user.ID); err != nil {
+		t.Fatalf("Revoke returned error: %v", err)
+	}
+	if code := call(authMiddleware.JWTScope(auth.ScopePostsWrite, ok), token); code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: got %d, want 401", code)
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/pinokiochan/social-network-render/internal/auth"
+)
+
+// Principal is the authenticated caller of a request. The auth middleware
+// stores it in the request context; handlers read it with PrincipalFrom or
+// UserIDFrom instead of parsing the token again.
+type Principal struct {
+	UserID int
+	Role   string
+	// SessionID is empty for personal access tokens.
+	SessionID string
+	// MFA is set when the session was opened with a second factor.
+	MFA bool
+	// AccessTokenID and Scopes are set for personal access tokens.
+	AccessTokenID int
+	Scopes        []string
+	// Impersonator is the ID of the admin acting as UserID, zero otherwise.
+	Impersonator int
+	ReadOnly     bool
+}
+
+// NewPrincipal builds the principal for verified claims.
+func NewPrincipal(claims *auth.Claims) *Principal {
+	return &Principal{
+		UserID:        claims.UserID,
+		Role:          auth.RoleOf(claims),
+		SessionID:     claims.SessionID,
+		MFA:           claims.MFA,
+		AccessTokenID: claims.AccessTokenID,
+		Scopes:        claims.Scopes,
+		Impersonator:  claims.Impersonator,
+		ReadOnly:      claims.ReadOnly,
+	}
+}
+
+// IsAccessToken reports whether the request was authenticated with a
+// personal access token.
+func (p *Principal) IsAccessToken() bool {
+	return p.AccessTokenID != 0
+}
+
+// IsImpersonation reports whether an admin is acting as the user.
+func (p *Principal) IsImpersonation() bool {
+	return p.Impersonator != 0
+}
+
+// HasRole reports whether the principal has one of the given roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal stored by the auth middleware.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// UserIDFrom returns the ID of the authenticated user.
+func UserIDFrom(ctx context.Context) (int, bool) {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return 0, false
+	}
+	return p.UserID, true
+}
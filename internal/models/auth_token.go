@@ -0,0 +1,8 @@
+package models
+
+// Purposes of the single-use tokens sent by email. A token is only accepted
+// by the endpoint of its purpose.
+const (
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeLoginLink     = "login_link"
+)
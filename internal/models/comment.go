@@ -9,4 +9,14 @@ type Comment struct {
 	Username  string    `json:"username"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+	// ParentID is the comment this one replies to, 0 for top-level comments.
+	ParentID int `json:"parent_id,omitempty"`
+	// Deleted marks a tombstone: a removed comment kept in place because it
+	// still has replies. Its author and content are blanked.
+	Deleted    bool `json:"deleted,omitempty"`
+	ReplyCount int  `json:"reply_count"`
+	// Replies is filled in by the thread endpoint.
+	Replies []Comment `json:"replies,omitempty"`
+	// Reactions is filled in by the handlers that list comments.
+	Reactions *ReactionSummary `json:"reactions,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// FollowUser is an account in a followers or following list.
+type FollowUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	// FollowedAt is when the follow relationship started.
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowCounts are the sizes of a user's followers and following lists.
+type FollowCounts struct {
+	Followers int `json:"followers"`
+	Following int `json:"following"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// OAuthState is a login started at an external identity provider that has
+// not come back yet. It is looked up by the hash of the state parameter and
+// used once.
+type OAuthState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// Expired reports whether the login can no longer be completed at the given
+// time.
+func (s *OAuthState) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// Identity links an account at an external identity provider, identified by
+// its subject, to a local user.
+type Identity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ImpersonationEvent is an entry of the impersonation audit log: the start
+// of an impersonation, or a request made with an impersonation token.
+type ImpersonationEvent struct {
+	ID             int       `json:"id"`
+	ImpersonatorID int       `json:"impersonator_id"`
+	UserID         int       `json:"user_id"`
+	Method         string    `json:"method"`
+	Path           string    `json:"path"`
+	Status         int       `json:"status"`
+	ReadOnly       bool      `json:"read_only"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Invite is an admin-generated registration code. The code itself is shown
+// once on creation; only its hash is kept.
+type Invite struct {
+	ID        int    `json:"id"`
+	CodeHash  string `json:"-"`
+	Prefix    string `json:"prefix"`
+	Note      string `json:"note"`
+	CreatedBy int    `json:"created_by"`
+	// MaxUses is the number of accounts the code can register, 0 for
+	// unlimited.
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Usable reports whether the code can register another account at the
+// given time.
+func (i *Invite) Usable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !now.Before(*i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
+
+// InviteRedemption records which account was registered with an invite, and
+// so who invited whom.
+type InviteRedemption struct {
+	InviteID   int       `json:"invite_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	RedeemedAt time.Time `json:"redeemed_at"`
+}
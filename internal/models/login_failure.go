@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LoginFailures counts consecutive failed password logins of an account.
+type LoginFailures struct {
+	UserID       int
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+// Locked reports whether the account is locked at the given time.
+func (f *LoginFailures) Locked(now time.Time) bool {
+	return f.LockedUntil != nil && now.Before(*f.LockedUntil)
+}
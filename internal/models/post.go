@@ -8,4 +8,6 @@ type Post struct {
 	Username  string    `json:"username"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+	// Reactions is filled in by the handlers that list posts.
+	Reactions *ReactionSummary `json:"reactions,omitempty"`
 }
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Kinds of items that can be reacted to.
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+// ReactionLike is always available; the emoji reactions come from the
+// REACTIONS setting.
+const ReactionLike = "like"
+
+// Reaction is one user's reaction to a post or comment. A user can add each
+// reaction to an item once.
+type Reaction struct {
+	TargetType string    `json:"-"`
+	TargetID   int       `json:"-"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	Reaction   string    `json:"reaction"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReactionSummary aggregates the reactions to one item.
+type ReactionSummary struct {
+	// Counts maps each reaction to the number of users who added it.
+	Counts map[string]int `json:"counts"`
+	// Mine lists the reactions the current user added.
+	Mine []string `json:"mine"`
+}
+
+// NewReactionSummary returns an empty summary.
+func NewReactionSummary() *ReactionSummary {
+	return &ReactionSummary{Counts: map[string]int{}, Mine: []string{}}
+}
@@ -0,0 +1,94 @@
+package models
+
+// Roles, from least to most privileged.
+const (
+	RoleUser       = "user"
+	RoleModerator  = "moderator"
+	RoleAdmin      = "admin"
+	RoleSuperadmin = "superadmin"
+)
+
+// Roles lists every role in order of increasing privilege.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin, RoleSuperadmin}
+
+// Permissions checked by middleware.Require and by handlers. Which role has
+// which permission is stored in the role_permissions table.
+const (
+	PermStatsRead           = "stats.read"
+	PermUsersRead           = "users.read"
+	PermUsersEdit           = "users.edit"
+	PermUsersDelete         = "users.delete"
+	PermUsersRevokeSessions = "users.revoke_sessions"
+	PermEmailBroadcast      = "email.broadcast"
+	PermPostsDeleteAny      = "posts.delete_any"
+	PermCommentsDeleteAny   = "comments.delete_any"
+	PermRolesManage         = "roles.manage"
+	PermUsersImpersonate    = "users.impersonate"
+	PermInvitesManage       = "invites.manage"
+)
+
+// Permissions lists every known permission.
+var Permissions = []string{
+	PermStatsRead,
+	PermUsersRead,
+	PermUsersEdit,
+	PermUsersDelete,
+	PermUsersRevokeSessions,
+	PermEmailBroadcast,
+	PermPostsDeleteAny,
+	PermCommentsDeleteAny,
+	PermRolesManage,
+	PermUsersImpersonate,
+	PermInvitesManage,
+}
+
+// DefaultRolePermissions is the permission matrix seeded by the roles
+// migration. The in-memory store starts from it as well.
+var DefaultRolePermissions = map[string][]string{
+	RoleUser: {},
+	RoleModerator: {
+		PermStatsRead, PermUsersRead,
+		PermPostsDeleteAny, PermCommentsDeleteAny,
+	},
+	RoleAdmin: {
+		PermStatsRead, PermUsersRead, PermUsersEdit, PermUsersDelete, PermUsersRevokeSessions,
+		PermEmailBroadcast, PermPostsDeleteAny, PermCommentsDeleteAny, PermUsersImpersonate,
+		PermInvitesManage,
+	},
+	RoleSuperadmin: {
+		PermStatsRead, PermUsersRead, PermUsersEdit, PermUsersDelete, PermUsersRevokeSessions,
+		PermEmailBroadcast, PermPostsDeleteAny, PermCommentsDeleteAny, PermRolesManage,
+		PermUsersImpersonate, PermInvitesManage,
+	},
+}
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	return RoleRank(role) >= 0
+}
+
+// ValidPermission reports whether permission is one of Permissions.
+func ValidPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleRank orders roles by privilege; it returns -1 for unknown roles.
+func RoleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsAdminRole reports whether the role counts as an administrator. The
+// is_admin flag of a user is derived from it.
+func IsAdminRole(role string) bool {
+	return role == RoleAdmin || role == RoleSuperadmin
+}
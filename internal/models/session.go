@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Session is a logged-in device. Access tokens carry the session ID so the
+// session can be refreshed or revoked server-side.
+type Session struct {
+	ID               string     `json:"id"`
+	UserID           int        `json:"user_id"`
+	RefreshTokenHash string     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	// MFA is set when the session was opened with a second factor.
+	MFA bool `json:"mfa"`
+	// UserAgent is the client that logged in; IP is the address the
+	// session was last seen from.
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+}
+
+// Active reports whether the session can still be used at the given time.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,7 @@
+package models
+
+// TimelineEntry puts a post on a user's materialized home timeline.
+type TimelineEntry struct {
+	UserID int
+	PostID int
+}
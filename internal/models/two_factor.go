@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// TOTP is a user's time-based one-time password secret. It is pending until
+// the user confirms enrollment with a valid code.
+type TOTP struct {
+	UserID       int
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// Enabled reports whether enrollment was confirmed.
+func (t *TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// MFAChallenge is issued after a correct password for an account with
+// two-factor authentication, and exchanged for a session together with a
+// TOTP or recovery code.
+type MFAChallenge struct {
+	TokenHash string
+	UserID    int
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the challenge can no longer be used at the given
+// time.
+func (c *MFAChallenge) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
@@ -10,10 +10,13 @@ type User struct {
 	Username  string    `json:"username"`   // The user's username
 	Email     string    `json:"email"`      // The user's email address
 	Password  string    `json:"-"`          // The user's password (not exposed in JSON response)
-	IsAdmin   bool      `json:"is_admin"`   // Flag to determine if the user is an admin
+	IsAdmin   bool      `json:"is_admin"`   // Flag to determine if the user is an admin, derived from Role
+	Role      string    `json:"role"`       // One of the roles in role.go
 	CreatedAt time.Time `json:"created_at"` // The timestamp when the user was created
 	UpdatedAt time.Time `json:"updated_at"` // The timestamp when the user was last updated
 	IsActive  bool      `json:"is_active"`
+	// TokenVersion is embedded in access tokens; bumping it revokes them all
+	TokenVersion int `json:"-"`
 }
 
 // NewUser creates and returns a new user instance with the provided username, email, and password
@@ -24,6 +27,7 @@ func NewUser(username, email, password string) *User {
 		Email:     email,
 		Password:  password,
 		IsAdmin:   false, // Default: new users are not admins
+		Role:      RoleUser,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -37,6 +41,30 @@ func (u *User) SetPassword(password string) {
 
 // SetAdmin updates the user's admin status and sets the updated timestamp
 func (u *User) SetAdmin(isAdmin bool) {
-	u.IsAdmin = isAdmin
+	if isAdmin {
+		u.SetRole(RoleAdmin)
+	} else {
+		u.SetRole(RoleUser)
+	}
+}
+
+// SetRole updates the user's role, keeps IsAdmin in sync and sets the
+// updated timestamp
+func (u *User) SetRole(role string) {
+	u.Role = role
+	u.IsAdmin = IsAdminRole(role)
 	u.UpdatedAt = time.Now()
 }
+
+// NormalizeRole reconciles Role and IsAdmin for users built by code that
+// only sets the admin flag: such users become admins, users without a role
+// become regular users, and IsAdmin is then derived from Role.
+func (u *User) NormalizeRole() {
+	if u.IsAdmin && !IsAdminRole(u.Role) {
+		u.Role = RoleAdmin
+	}
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+	u.IsAdmin = IsAdminRole(u.Role)
+}
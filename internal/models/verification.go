@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Verification is a pending email verification code for an account that
+// has not been activated yet.
+type Verification struct {
+	Email      string
+	CodeHash   string
+	Attempts   int
+	ExpiresAt  time.Time
+	LastSentAt time.Time
+}
+
+// Expired reports whether the code can no longer be used at the given time.
+func (v *Verification) Expired(now time.Time) bool {
+	return !now.Before(v.ExpiresAt)
+}
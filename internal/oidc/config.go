@@ -0,0 +1,54 @@
+package oidc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var providerName = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+// LoadProvidersFromEnv builds the providers listed in OIDC_PROVIDERS, a
+// comma-separated list of names. Each provider NAME is configured with
+//
+//	OIDC_<NAME>_ISSUER           issuer URL (required)
+//	OIDC_<NAME>_CLIENT_ID        client ID (required)
+//	OIDC_<NAME>_CLIENT_SECRET    client secret, empty for public clients
+//	OIDC_<NAME>_DISPLAY_NAME     button label
+//	OIDC_<NAME>_SCOPES           space-separated, default "openid email profile"
+//	OIDC_<NAME>_ALLOWED_DOMAINS  comma-separated email domains
+//
+// redirectURL is the callback URL registered with every provider.
+func LoadProvidersFromEnv(redirectURL string) ([]*Provider, error) {
+	var providers []*Provider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !providerName.MatchString(name) {
+			return nil, fmt.Errorf("invalid OIDC provider name %q", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.Replace(name, "-", "_", -1)) + "_"
+		config := Config{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		for _, domain := range strings.Split(os.Getenv(prefix+"ALLOWED_DOMAINS"), ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				config.AllowedDomains = append(config.AllowedDomains, domain)
+			}
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+		}
+		providers = append(providers, NewProvider(config, nil))
+	}
+	return providers, nil
+}
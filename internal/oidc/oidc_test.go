@@ -0,0 +1,149 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/oidc"
+	"github.com/pinokiochan/social-network-render/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://app.test/api/oauth/callback"
+
+// login runs the authorization code flow against the mock provider and
+// returns the raw ID token.
+func login(t *testing.T, idp *oidctest.Server, p *oidc.Provider, nonce string) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("NewCodeVerifier returned error: %v", err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL returned error: %v", err)
+	}
+	callback, err := idp.Login(authURL)
+	if err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	if callback.Query().Get("state") != "state-1" {
+		t.Fatalf("state was not echoed back: %s", callback)
+	}
+	return p.Exchange(ctx, callback.Query().Get("code"), verifier)
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.NewServer("client", "secret")
+	defer idp.Close()
+	idp.SetIdentity(oidctest.Identity{Subject: "42", Email: "student@astanait.edu.kz", EmailVerified: true, Name: "Student"})
+	p := oidc.NewProvider(idp.Config("mock", redirectURL), nil)
+
+	raw, err := login(t, idp, p, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange returned error: %v", err)
+	}
+	token, err := p.Verify(context.Background(), raw, "nonce-1")
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if token.Subject != "42" || token.Email != "student@astanait.edu.kz" || !token.EmailVerified {
+		t.Errorf("unexpected token: %+v", token)
+	}
+	if token.ExpiresAt.Before(time.Now()) {
+		t.Errorf("token already expired: %v", token.ExpiresAt)
+	}
+
+	// The provider rotates its key; the new kid triggers a JWKS refresh.
+	idp.RotateKey()
+	raw, err = login(t, idp, p, "nonce-2")
+	if err != nil {
+		t.Fatalf("Exchange returned error: %v", err)
+	}
+	if _, err := p.Verify(context.Background(), raw, "nonce-2"); err != nil {
+		t.Errorf("token signed with rotated key was rejected: %v", err)
+	}
+}
+
+func TestExchangeRequiresCodeVerifier(t *testing.T) {
+	idp := oidctest.NewServer("client", "secret")
+	defer idp.Close()
+	p := oidc.NewProvider(idp.Config("mock", redirectURL), nil)
+
+	verifier, _ := oidc.NewCodeVerifier()
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL returned error: %v", err)
+	}
+	callback, err := idp.Login(authURL)
+	if err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	other, _ := oidc.NewCodeVerifier()
+	if _, err := p.Exchange(context.Background(), callback.Query().Get("code"), other); err == nil {
+		t.Fatal("Exchange succeeded with the wrong code verifier")
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	idp := oidctest.NewServer("client", "secret")
+	defer idp.Close()
+	p := oidc.NewProvider(idp.Config("mock", redirectURL), nil)
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		nonce  string
+	}{
+		{"wrong nonce", nil, "another-nonce"},
+		{"wrong audience", map[string]interface{}{"aud": "someone-else"}, "nonce"},
+		{"wrong authorized party", map[string]interface{}{"aud": []string{"client", "other"}, "azp": "other"}, "nonce"},
+		{"wrong issuer", map[string]interface{}{"iss": "https://evil.example"}, "nonce"},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, "nonce"},
+		{"no subject", map[string]interface{}{"sub": ""}, "nonce"},
+	}
+	for _, tt := range tests {
+		idp.OverrideClaims(tt.claims)
+		raw, err := login(t, idp, p, "nonce")
+		if err != nil {
+			t.Fatalf("%s: Exchange returned error: %v", tt.name, err)
+		}
+		if _, err := p.Verify(context.Background(), raw, tt.nonce); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Errorf("%s: Verify = %v, want ErrInvalidIDToken", tt.name, err)
+		}
+	}
+
+	// An unsigned token is never accepted.
+	unsigned := "eyJhbGciOiJub25lIn0." + "eyJzdWIiOiIxIn0."
+	if _, err := p.Verify(context.Background(), unsigned, "nonce"); err == nil {
+		t.Error("Verify accepted an unsigned token")
+	}
+}
+
+func TestAuthCodeURLUsesPKCE(t *testing.T) {
+	idp := oidctest.NewServer("client", "")
+	defer idp.Close()
+	cfg := idp.Config("mock", redirectURL)
+	cfg.AllowedDomains = []string{"astanait.edu.kz"}
+	p := oidc.NewProvider(cfg, nil)
+
+	raw, err := p.AuthCodeURL(context.Background(), "s", "n", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL returned error: %v", err)
+	}
+	u, _ := url.Parse(raw)
+	q := u.Query()
+	if q.Get("code_challenge") != oidc.CodeChallenge("verifier") || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("missing PKCE parameters: %s", raw)
+	}
+	if q.Get("scope") != "openid email profile" || q.Get("redirect_uri") != redirectURL || q.Get("nonce") != "n" {
+		t.Errorf("unexpected parameters: %s", raw)
+	}
+
+	if !p.EmailAllowed("Student@AstanaIT.edu.kz") || p.EmailAllowed("student@gmail.com") {
+		t.Error("EmailAllowed does not follow AllowedDomains")
+	}
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type accessTokenStore struct {
+	*db
+}
+
+func copyAccessToken(t *models.PersonalAccessToken) models.PersonalAccessToken {
+	copied := *t
+	copied.Scopes = append([]string(nil), t.Scopes...)
+	return copied
+}
+
+func (s *accessTokenStore) Create(ctx context.Context, t *models.PersonalAccessToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[t.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	for _, existing := range s.accessTokens {
+		if existing.TokenHash == t.TokenHash {
+			return store.ErrConflict
+		}
+	}
+
+	s.nextAccessTokenID++
+	t.ID = s.nextAccessTokenID
+	t.CreatedAt = time.Now()
+
+	stored := copyAccessToken(t)
+	s.accessTokens[t.ID] = &stored
+	return nil
+}
+
+func (s *accessTokenStore) GetByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.accessTokens {
+		if t.TokenHash == hash {
+			copied := copyAccessToken(t)
+			return &copied, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *accessTokenStore) ListForUser(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []models.PersonalAccessToken{}
+	for _, t := range s.accessTokens {
+		if t.UserID == userID {
+			tokens = append(tokens, copyAccessToken(t))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+func (s *accessTokenStore) Revoke(ctx context.Context, id, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.accessTokens[id]
+	if !ok || t.UserID != userID {
+		return store.ErrNotFound
+	}
+	if t.RevokedAt == nil {
+		now := time.Now()
+		t.RevokedAt = &now
+	}
+	return nil
+}
+
+func (s *accessTokenStore) RevokeAllForUser(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range s.accessTokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			revokedAt := now
+			t.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func (s *accessTokenStore) Touch(ctx context.Context, id int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.accessTokens[id]; ok {
+		t.LastUsedAt = &at
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type authToken struct {
+	purpose   string
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+type authTokenStore struct {
+	*db
+}
+
+func (s *authTokenStore) Create(ctx context.Context, purpose string, userID int, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+	if _, ok := s.authTokens[tokenHash]; ok {
+		return store.ErrConflict
+	}
+	s.authTokens[tokenHash] = &authToken{purpose: purpose, userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *authTokenStore) Lookup(ctx context.Context, purpose, tokenHash string, now time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.authTokens[tokenHash]
+	if !ok || token.purpose != purpose || token.used || !now.Before(token.expiresAt) {
+		return 0, store.ErrNotFound
+	}
+	return token.userID, nil
+}
+
+func (s *authTokenStore) Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.authTokens[tokenHash]
+	if !ok || token.purpose != purpose || token.used || !now.Before(token.expiresAt) {
+		return 0, store.ErrNotFound
+	}
+	token.used = true
+	return token.userID, nil
+}
+
+func (s *authTokenStore) InvalidateForUser(ctx context.Context, purpose string, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.authTokens {
+		if token.userID == userID && token.purpose == purpose {
+			token.used = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type commentStore struct {
+	*db
+}
+
+func (s *commentStore) Create(ctx context.Context, comment *models.Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[comment.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	if _, ok := s.posts[comment.PostID]; !ok {
+		return store.ErrNotFound
+	}
+	if comment.ParentID != 0 {
+		parent, ok := s.comments[comment.ParentID]
+		if !ok || parent.Deleted || parent.PostID != comment.PostID {
+			return store.ErrNotFound
+		}
+	}
+
+	s.nextCommentID++
+	comment.ID = s.nextCommentID
+	comment.CreatedAt = time.Now()
+	comment.Deleted = false
+	comment.ReplyCount = 0
+	comment.Replies = nil
+
+	stored := *comment
+	stored.Username = ""
+	stored.Reactions = nil
+	s.comments[comment.ID] = &stored
+	return nil
+}
+
+func (s *commentStore) GetByID(ctx context.Context, id int) (*models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.comments[id]
+	if !ok || c.Deleted {
+		return nil, store.ErrNotFound
+	}
+	comment := s.commentLocked(c, s.replyCountsLocked())
+	return &comment, nil
+}
+
+func (s *commentStore) ListByPost(ctx context.Context, postID, parentID int, order string, after store.Cursor, limit int) ([]models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scores := make(map[int]int)
+	if order == store.CommentsTop {
+		for key := range s.reactions {
+			if key.targetType == models.ReactionTargetComment {
+				scores[key.targetID]++
+			}
+		}
+	}
+
+	replies := s.replyCountsLocked()
+	var comments []models.Comment
+	for _, c := range s.comments {
+		if c.PostID != postID || c.ParentID != parentID {
+			continue
+		}
+		if !commentAfter(order, after, c, scores[c.ID]) {
+			continue
+		}
+		comments = append(comments, s.commentLocked(c, replies))
+	}
+
+	switch order {
+	case store.CommentsNewest:
+		sort.Slice(comments, func(i, j int) bool {
+			if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+				return comments[i].CreatedAt.After(comments[j].CreatedAt)
+			}
+			return comments[i].ID > comments[j].ID
+		})
+	case store.CommentsTop:
+		sort.Slice(comments, func(i, j int) bool {
+			if scores[comments[i].ID] != scores[comments[j].ID] {
+				return scores[comments[i].ID] > scores[comments[j].ID]
+			}
+			return comments[i].ID < comments[j].ID
+		})
+	default:
+		sortOldestFirst(comments)
+	}
+	if len(comments) > limit {
+		comments = comments[:limit]
+	}
+	return comments, nil
+}
+
+// commentAfter reports whether c, with the given reaction score, belongs to
+// the page starting after the cursor in the given order.
+func commentAfter(order string, after store.Cursor, c *models.Comment, score int) bool {
+	if after.IsZero() {
+		return true
+	}
+	switch order {
+	case store.CommentsNewest:
+		return after.Before(c.CreatedAt, c.ID)
+	case store.CommentsTop:
+		return score < after.Score || (score == after.Score && c.ID > after.ID)
+	}
+	if !c.CreatedAt.Equal(after.Time) {
+		return c.CreatedAt.After(after.Time)
+	}
+	return c.ID > after.ID
+}
+
+func (s *commentStore) CountByPost(ctx context.Context, postIDs []int) (map[int]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[int]bool, len(postIDs))
+	for _, id := range postIDs {
+		wanted[id] = true
+	}
+	counts := make(map[int]int)
+	for _, c := range s.comments {
+		if wanted[c.PostID] && !c.Deleted {
+			counts[c.PostID]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *commentStore) Thread(ctx context.Context, postID, parentID, depth int) ([]models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	replies := s.replyCountsLocked()
+	var comments []models.Comment
+	level := map[int]bool{parentID: true}
+	for d := 0; d < depth && len(level) > 0; d++ {
+		next := make(map[int]bool)
+		for _, c := range s.comments {
+			if c.PostID == postID && level[c.ParentID] {
+				comments = append(comments, s.commentLocked(c, replies))
+				next[c.ID] = true
+			}
+		}
+		level = next
+	}
+	sortOldestFirst(comments)
+	return comments, nil
+}
+
+func (s *commentStore) Update(ctx context.Context, id int, content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[id]
+	if !ok || c.Deleted {
+		return store.ErrNotFound
+	}
+	c.Content = content
+	return nil
+}
+
+func (s *commentStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[id]
+	if !ok || c.Deleted {
+		return store.ErrNotFound
+	}
+	replies := s.replyCountsLocked()
+	if replies[id] > 0 {
+		c.Deleted = true
+		c.Content = ""
+		s.deleteReactionsLocked(models.ReactionTargetComment, id)
+		return nil
+	}
+
+	parentID := c.ParentID
+	s.deleteCommentLocked(id)
+	replies[parentID]--
+	for parentID != 0 {
+		parent, ok := s.comments[parentID]
+		if !ok || !parent.Deleted || replies[parentID] > 0 {
+			break
+		}
+		next := parent.ParentID
+		s.deleteCommentLocked(parentID)
+		replies[next]--
+		parentID = next
+	}
+	return nil
+}
+
+func (s *commentStore) Count(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, c := range s.comments {
+		if !c.Deleted {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// replyCountsLocked counts the direct replies of every comment, tombstones
+// included. Callers must hold mu.
+func (d *db) replyCountsLocked() map[int]int {
+	counts := make(map[int]int)
+	for _, c := range d.comments {
+		if c.ParentID != 0 {
+			counts[c.ParentID]++
+		}
+	}
+	return counts
+}
+
+// pruneTombstonesLocked removes tombstones left without replies, repeating
+// until none are left. Callers must hold mu.
+func (d *db) pruneTombstonesLocked() {
+	for {
+		replies := d.replyCountsLocked()
+		removed := false
+		for id, c := range d.comments {
+			if c.Deleted && replies[id] == 0 {
+				d.deleteCommentLocked(id)
+				removed = true
+			}
+		}
+		if !removed {
+			return
+		}
+	}
+}
+
+// commentLocked copies a stored comment for a caller, filling in the author
+// and reply count and blanking tombstones. Callers must hold mu.
+func (s *commentStore) commentLocked(c *models.Comment, replies map[int]int) models.Comment {
+	comment := *c
+	comment.ReplyCount = replies[c.ID]
+	if comment.Deleted {
+		comment.UserID = 0
+		comment.Content = ""
+		return comment
+	}
+	comment.Username = s.usernameLocked(comment.UserID)
+	return comment
+}
+
+func sortOldestFirst(comments []models.Comment) {
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+		}
+		return comments[i].ID < comments[j].ID
+	})
+}
@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type followStore struct {
+	*db
+}
+
+func (s *followStore) Follow(ctx context.Context, followerID, followeeID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[followerID]; !ok {
+		return store.ErrNotFound
+	}
+	if _, ok := s.users[followeeID]; !ok {
+		return store.ErrNotFound
+	}
+	followees, ok := s.follows[followerID]
+	if !ok {
+		followees = make(map[int]time.Time)
+		s.follows[followerID] = followees
+	}
+	if _, ok := followees[followeeID]; !ok {
+		followees[followeeID] = time.Now()
+	}
+	return nil
+}
+
+func (s *followStore) Unfollow(ctx context.Context, followerID, followeeID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.follows[followerID][followeeID]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.follows[followerID], followeeID)
+	return nil
+}
+
+func (s *followStore) IsFollowing(ctx context.Context, followerID, followeeID int) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.follows[followerID][followeeID]
+	return ok, nil
+}
+
+func (s *followStore) Counts(ctx context.Context, userID int) (models.FollowCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := models.FollowCounts{Following: len(s.follows[userID])}
+	for _, followees := range s.follows {
+		if _, ok := followees[userID]; ok {
+			counts.Followers++
+		}
+	}
+	return counts, nil
+}
+
+func (s *followStore) Followers(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.FollowUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []models.FollowUser{}
+	for followerID, followees := range s.follows {
+		if since, ok := followees[userID]; ok {
+			users = append(users, models.FollowUser{ID: followerID, Username: s.usernameLocked(followerID), FollowedAt: since})
+		}
+	}
+	return pageFollowUsers(users, after, limit), nil
+}
+
+func (s *followStore) Following(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.FollowUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []models.FollowUser{}
+	for followeeID, since := range s.follows[userID] {
+		users = append(users, models.FollowUser{ID: followeeID, Username: s.usernameLocked(followeeID), FollowedAt: since})
+	}
+	return pageFollowUsers(users, after, limit), nil
+}
+
+// pageFollowUsers sorts users most recent follow first and returns the page
+// starting after the cursor.
+func pageFollowUsers(users []models.FollowUser, after store.Cursor, limit int) []models.FollowUser {
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].FollowedAt.Equal(users[j].FollowedAt) {
+			return users[i].FollowedAt.After(users[j].FollowedAt)
+		}
+		return users[i].ID > users[j].ID
+	})
+	page := []models.FollowUser{}
+	for _, u := range users {
+		if len(page) == limit {
+			break
+		}
+		if after.Before(u.FollowedAt, u.ID) {
+			page = append(page, u)
+		}
+	}
+	return page
+}
+
+func (s *followStore) FollowerIDs(ctx context.Context, userID int) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []int{}
+	for followerID, followees := range s.follows {
+		if _, ok := followees[userID]; ok {
+			ids = append(ids, followerID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *followStore) PopularFollowing(ctx context.Context, userID, minFollowers int) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	followers := make(map[int]int)
+	for _, followees := range s.follows {
+		for followeeID := range followees {
+			followers[followeeID]++
+		}
+	}
+	ids := []int{}
+	for followeeID := range s.follows[userID] {
+		if followers[followeeID] >= minFollowers {
+			ids = append(ids, followeeID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type impersonationAuditStore struct {
+	*db
+}
+
+func (s *impersonationAuditStore) Record(ctx context.Context, event *models.ImpersonationEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.ID = len(s.impersonationAudit) + 1
+	event.CreatedAt = time.Now()
+	s.impersonationAudit = append(s.impersonationAudit, *event)
+	return nil
+}
+
+func (s *impersonationAuditStore) List(ctx context.Context, limit int) ([]models.ImpersonationEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []models.ImpersonationEvent{}
+	for i := len(s.impersonationAudit) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, s.impersonationAudit[i])
+	}
+	return events, nil
+}
@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type inviteStore struct {
+	*db
+}
+
+func (s *inviteStore) Create(ctx context.Context, invite *models.Invite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.invites {
+		if existing.CodeHash == invite.CodeHash {
+			return store.ErrConflict
+		}
+	}
+
+	s.nextInviteID++
+	invite.ID = s.nextInviteID
+	invite.CreatedAt = time.Now()
+
+	stored := *invite
+	s.invites[invite.ID] = &stored
+	return nil
+}
+
+func (s *inviteStore) List(ctx context.Context) ([]models.Invite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invites := []models.Invite{}
+	for _, invite := range s.invites {
+		invites = append(invites, *invite)
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].ID > invites[j].ID
+	})
+	return invites, nil
+}
+
+func (s *inviteStore) GetByHash(ctx context.Context, hash string) (*models.Invite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, invite := range s.invites {
+		if invite.CodeHash == hash {
+			copied := *invite
+			return &copied, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *inviteStore) Redeem(ctx context.Context, hash string, userID int, now time.Time) (*models.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	for _, invite := range s.invites {
+		if invite.CodeHash != hash {
+			continue
+		}
+		if !invite.Usable(now) {
+			return nil, store.ErrNotFound
+		}
+		invite.Uses++
+		s.inviteRedemptions = append(s.inviteRedemptions, models.InviteRedemption{
+			InviteID:   invite.ID,
+			UserID:     userID,
+			RedeemedAt: now,
+		})
+		copied := *invite
+		return &copied, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *inviteStore) Revoke(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if invite.RevokedAt == nil {
+		now := time.Now()
+		invite.RevokedAt = &now
+	}
+	return nil
+}
+
+func (s *inviteStore) Redemptions(ctx context.Context, inviteID int) ([]models.InviteRedemption, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	redemptions := []models.InviteRedemption{}
+	for _, r := range s.inviteRedemptions {
+		if r.InviteID == inviteID {
+			r.Username = s.usernameLocked(r.UserID)
+			redemptions = append(redemptions, r)
+		}
+	}
+	return redemptions, nil
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type loginFailureStore struct {
+	*db
+}
+
+func (s *loginFailureStore) Get(ctx context.Context, userID int) (*models.LoginFailures, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.loginFailures[userID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *f
+	return &copied, nil
+}
+
+func (s *loginFailureStore) RecordFailure(ctx context.Context, userID int, at, forgetBefore time.Time) (*models.LoginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return nil, store.ErrNotFound
+	}
+	f, ok := s.loginFailures[userID]
+	if !ok {
+		f = &models.LoginFailures{UserID: userID}
+		s.loginFailures[userID] = f
+	}
+	if f.LastFailedAt.Before(forgetBefore) {
+		f.Failures = 0
+	}
+	f.Failures++
+	f.LastFailedAt = at
+	copied := *f
+	return &copied, nil
+}
+
+func (s *loginFailureStore) Lock(ctx context.Context, userID int, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.loginFailures[userID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	f.LockedUntil = &until
+	return nil
+}
+
+func (s *loginFailureStore) Reset(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginFailures, userID)
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package memory implements the store interfaces in process memory. It is
+// intended for handler tests and for running the server without PostgreSQL.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+// db holds every table behind a single lock so that cross-table operations,
+// such as cascading deletes, stay consistent.
+type db struct {
+	mu sync.RWMutex
+
+	users         map[int]*models.User
+	posts         map[int]*models.Post
+	comments      map[int]*models.Comment
+	verifications map[string]*models.Verification // keyed by email
+	sessions      map[string]*models.Session
+	revokedTokens map[string]time.Time
+	// single-use emailed tokens keyed by hash
+	authTokens    map[string]*authToken
+	totp          map[int]*models.TOTP
+	recoveryCodes map[int][]*recoveryCode
+	mfaChallenges map[string]*models.MFAChallenge // keyed by token hash
+	accessTokens  map[int]*models.PersonalAccessToken
+	roles         map[string]map[string]bool // role -> granted permissions
+	// pending OpenID Connect logins keyed by state hash
+	oauthStates map[string]*models.OAuthState
+	identities  map[int]*models.Identity
+	// failed password logins keyed by user ID
+	loginFailures map[int]*models.LoginFailures
+	// append-only, oldest first
+	impersonationAudit []models.ImpersonationEvent
+	invites            map[int]*models.Invite
+	inviteRedemptions  []models.InviteRedemption // oldest first
+	// follower ID -> followee ID -> when the follow started
+	follows map[int]map[int]time.Time
+	// user ID -> set of post IDs on their materialized home timeline
+	timelines      map[int]map[int]bool
+	builtTimelines map[int]bool
+	reactions      map[reactionKey]time.Time // -> when it was added
+
+	nextUserID        int
+	nextPostID        int
+	nextCommentID     int
+	nextAccessTokenID int
+	nextIdentityID    int
+	nextInviteID      int
+}
+
+// New returns an empty, thread-safe in-memory Store.
+func New() *store.Store {
+	d := &db{
+		users:          make(map[int]*models.User),
+		posts:          make(map[int]*models.Post),
+		comments:       make(map[int]*models.Comment),
+		verifications:  make(map[string]*models.Verification),
+		sessions:       make(map[string]*models.Session),
+		revokedTokens:  make(map[string]time.Time),
+		authTokens:     make(map[string]*authToken),
+		totp:           make(map[int]*models.TOTP),
+		recoveryCodes:  make(map[int][]*recoveryCode),
+		mfaChallenges:  make(map[string]*models.MFAChallenge),
+		accessTokens:   make(map[int]*models.PersonalAccessToken),
+		roles:          make(map[string]map[string]bool),
+		oauthStates:    make(map[string]*models.OAuthState),
+		identities:     make(map[int]*models.Identity),
+		loginFailures:  make(map[int]*models.LoginFailures),
+		invites:        make(map[int]*models.Invite),
+		follows:        make(map[int]map[int]time.Time),
+		timelines:      make(map[int]map[int]bool),
+		builtTimelines: make(map[int]bool),
+		reactions:      make(map[reactionKey]time.Time),
+	}
+	for role, permissions := range models.DefaultRolePermissions {
+		d.roles[role] = make(map[string]bool)
+		for _, p := range permissions {
+			d.roles[role][p] = true
+		}
+	}
+	return &store.Store{
+		Users:         &userStore{d},
+		Posts:         &postStore{d},
+		Comments:      &commentStore{d},
+		Verifications: &verificationStore{d},
+		Sessions:      &sessionStore{d},
+		RevokedTokens: &revokedTokenStore{d},
+		AuthTokens:    &authTokenStore{d},
+		TOTP:          &totpStore{d},
+		MFAChallenges: &mfaChallengeStore{d},
+		AccessTokens:  &accessTokenStore{d},
+		Roles:         &roleStore{d},
+		OAuth:         &oauthStore{d},
+		LoginFailures: &loginFailureStore{d},
+		Impersonation: &impersonationAuditStore{d},
+		Invites:       &inviteStore{d},
+		Follows:       &followStore{d},
+		Timelines:     &timelineStore{d},
+		Reactions:     &reactionStore{d},
+	}
+}
+
+// deletePostLocked removes a post together with its comments, mirroring the
+// ON DELETE CASCADE constraints of the SQL schema. Callers must hold mu.
+func (d *db) deletePostLocked(id int) {
+	delete(d.posts, id)
+	for _, timeline := range d.timelines {
+		delete(timeline, id)
+	}
+	for commentID, c := range d.comments {
+		if c.PostID == id {
+			d.deleteCommentLocked(commentID)
+		}
+	}
+	d.deleteReactionsLocked(models.ReactionTargetPost, id)
+}
+
+// deleteCommentLocked removes a comment together with its replies and
+// reactions. Callers must hold mu.
+func (d *db) deleteCommentLocked(id int) {
+	delete(d.comments, id)
+	d.deleteReactionsLocked(models.ReactionTargetComment, id)
+	for replyID, c := range d.comments {
+		if c.ParentID == id {
+			d.deleteCommentLocked(replyID)
+		}
+	}
+}
+
+func (d *db) usernameLocked(userID int) string {
+	if u, ok := d.users[userID]; ok {
+		return u.Username
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type mfaChallengeStore struct {
+	*db
+}
+
+func (s *mfaChallengeStore) Create(ctx context.Context, c *models.MFAChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.mfaChallenges[c.TokenHash]; ok {
+		return store.ErrConflict
+	}
+	stored := *c
+	s.mfaChallenges[c.TokenHash] = &stored
+	return nil
+}
+
+func (s *mfaChallengeStore) Get(ctx context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.mfaChallenges[tokenHash]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *c
+	return &copied, nil
+}
+
+func (s *mfaChallengeStore) IncrementAttempts(ctx context.Context, tokenHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.mfaChallenges[tokenHash]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	c.Attempts++
+	return c.Attempts, nil
+}
+
+func (s *mfaChallengeStore) Delete(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.mfaChallenges, tokenHash)
+	now := time.Now()
+	for hash, c := range s.mfaChallenges {
+		if c.Expired(now) {
+			delete(s.mfaChallenges, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type oauthStore struct {
+	*db
+}
+
+func (s *oauthStore) CreateState(ctx context.Context, state *models.OAuthState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, st := range s.oauthStates {
+		if st.Expired(now) {
+			delete(s.oauthStates, hash)
+		}
+	}
+	if _, ok := s.oauthStates[state.StateHash]; ok {
+		return store.ErrConflict
+	}
+	state.CreatedAt = now
+	stored := *state
+	s.oauthStates[state.StateHash] = &stored
+	return nil
+}
+
+func (s *oauthStore) ConsumeState(ctx context.Context, stateHash string, now time.Time) (*models.OAuthState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.oauthStates[stateHash]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	delete(s.oauthStates, stateHash)
+	if state.Expired(now) {
+		return nil, store.ErrNotFound
+	}
+	return state, nil
+}
+
+func (s *oauthStore) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, identity := range s.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			copied := *identity
+			return &copied, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *oauthStore) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[identity.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	for _, existing := range s.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return store.ErrConflict
+		}
+	}
+	s.nextIdentityID++
+	identity.ID = s.nextIdentityID
+	identity.CreatedAt = time.Now()
+	stored := *identity
+	s.identities[identity.ID] = &stored
+	return nil
+}
@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type postStore struct {
+	*db
+}
+
+func (s *postStore) Create(ctx context.Context, post *models.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[post.UserID]; !ok {
+		return store.ErrNotFound
+	}
+
+	s.nextPostID++
+	post.ID = s.nextPostID
+	post.CreatedAt = time.Now()
+
+	stored := *post
+	stored.Username = ""
+	s.posts[post.ID] = &stored
+	return nil
+}
+
+func (s *postStore) GetByID(ctx context.Context, id int) (*models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.posts[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	post := *p
+	post.Username = s.usernameLocked(post.UserID)
+	return &post, nil
+}
+
+func (s *postStore) List(ctx context.Context, filter store.PostFilter) ([]models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keyword := strings.ToLower(filter.Keyword)
+	username := strings.ToLower(filter.Username)
+
+	var posts []models.Post
+	for _, p := range s.posts {
+		post := *p
+		post.Username = s.usernameLocked(post.UserID)
+
+		if keyword != "" && !strings.Contains(strings.ToLower(post.Content), keyword) {
+			continue
+		}
+		if filter.UserID != 0 && post.UserID != filter.UserID {
+			continue
+		}
+		if !filter.Date.IsZero() && post.CreatedAt.Format("2006-01-02") != filter.Date.Format("2006-01-02") {
+			continue
+		}
+		if username != "" && !strings.Contains(strings.ToLower(post.Username), username) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+
+	if filter.Limit > 0 {
+		if filter.Offset >= len(posts) {
+			return nil, nil
+		}
+		end := filter.Offset + filter.Limit
+		if end > len(posts) {
+			end = len(posts)
+		}
+		posts = posts[filter.Offset:end]
+	}
+	return posts, nil
+}
+
+func (s *postStore) Update(ctx context.Context, id int, content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	p.Content = content
+	return nil
+}
+
+func (s *postStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[id]; !ok {
+		return store.ErrNotFound
+	}
+	s.deletePostLocked(id)
+	return nil
+}
+
+func (s *postStore) Count(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.posts), nil
+}
+
+func (s *postStore) Home(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	followees := s.follows[userID]
+	return s.newestLocked(func(authorID int) bool {
+		_, ok := followees[authorID]
+		return ok || authorID == userID
+	}, after, limit), nil
+}
+
+func (s *postStore) ByAuthors(ctx context.Context, authorIDs []int, after store.Cursor, limit int) ([]models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	authors := make(map[int]bool, len(authorIDs))
+	for _, id := range authorIDs {
+		authors[id] = true
+	}
+	return s.newestLocked(func(authorID int) bool { return authors[authorID] }, after, limit), nil
+}
+
+// newestLocked returns up to limit posts whose author matches, newest first,
+// starting after the cursor. Callers must hold mu.
+func (d *db) newestLocked(match func(authorID int) bool, after store.Cursor, limit int) []models.Post {
+	posts := []models.Post{}
+	for _, p := range d.posts {
+		if !match(p.UserID) || !after.Before(p.CreatedAt, p.ID) {
+			continue
+		}
+		post := *p
+		post.Username = d.usernameLocked(post.UserID)
+		posts = append(posts, post)
+	}
+	sortNewestFirst(posts)
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts
+}
+
+func sortNewestFirst(posts []models.Post) {
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+}
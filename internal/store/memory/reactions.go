@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type reactionKey struct {
+	targetType string
+	targetID   int
+	userID     int
+	reaction   string
+}
+
+type reactionStore struct {
+	*db
+}
+
+func (s *reactionStore) Add(ctx context.Context, reaction *models.Reaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.targetExistsLocked(reaction.TargetType, reaction.TargetID) {
+		return store.ErrNotFound
+	}
+	if _, ok := s.users[reaction.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	key := reactionKey{reaction.TargetType, reaction.TargetID, reaction.UserID, reaction.Reaction}
+	if _, ok := s.reactions[key]; ok {
+		return store.ErrConflict
+	}
+	reaction.CreatedAt = time.Now()
+	s.reactions[key] = reaction.CreatedAt
+	return nil
+}
+
+func (s *reactionStore) Remove(ctx context.Context, targetType string, targetID, userID int, reaction string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reactionKey{targetType, targetID, userID, reaction}
+	if _, ok := s.reactions[key]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.reactions, key)
+	return nil
+}
+
+func (s *reactionStore) Summaries(ctx context.Context, targetType string, targetIDs []int, viewerID int) (map[int]*models.ReactionSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[int]bool, len(targetIDs))
+	for _, id := range targetIDs {
+		wanted[id] = true
+	}
+	summaries := make(map[int]*models.ReactionSummary)
+	for key := range s.reactions {
+		if key.targetType != targetType || !wanted[key.targetID] {
+			continue
+		}
+		summary, ok := summaries[key.targetID]
+		if !ok {
+			summary = models.NewReactionSummary()
+			summaries[key.targetID] = summary
+		}
+		summary.Counts[key.reaction]++
+		if key.userID == viewerID {
+			summary.Mine = append(summary.Mine, key.reaction)
+		}
+	}
+	for _, summary := range summaries {
+		sort.Strings(summary.Mine)
+	}
+	return summaries, nil
+}
+
+func (s *reactionStore) List(ctx context.Context, targetType string, targetID int, reaction string, after store.Cursor, limit int) ([]models.Reaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reactions := []models.Reaction{}
+	for key, createdAt := range s.reactions {
+		if key.targetType != targetType || key.targetID != targetID || key.reaction != reaction {
+			continue
+		}
+		if !after.Before(createdAt, key.userID) {
+			continue
+		}
+		reactions = append(reactions, models.Reaction{
+			TargetType: targetType,
+			TargetID:   targetID,
+			UserID:     key.userID,
+			Username:   s.usernameLocked(key.userID),
+			Reaction:   reaction,
+			CreatedAt:  createdAt,
+		})
+	}
+	sort.Slice(reactions, func(i, j int) bool {
+		if !reactions[i].CreatedAt.Equal(reactions[j].CreatedAt) {
+			return reactions[i].CreatedAt.After(reactions[j].CreatedAt)
+		}
+		return reactions[i].UserID > reactions[j].UserID
+	})
+	if len(reactions) > limit {
+		reactions = reactions[:limit]
+	}
+	return reactions, nil
+}
+
+func (d *db) targetExistsLocked(targetType string, id int) bool {
+	switch targetType {
+	case models.ReactionTargetPost:
+		_, ok := d.posts[id]
+		return ok
+	case models.ReactionTargetComment:
+		c, ok := d.comments[id]
+		return ok && !c.Deleted
+	}
+	return false
+}
+
+// deleteReactionsLocked removes every reaction to the item. Callers must
+// hold mu.
+func (d *db) deleteReactionsLocked(targetType string, id int) {
+	for key := range d.reactions {
+		if key.targetType == targetType && key.targetID == id {
+			delete(d.reactions, key)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+type revokedTokenStore struct {
+	*db
+}
+
+func (s *revokedTokenStore) Add(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedTokens[jti]; !ok {
+		s.revokedTokens[jti] = expiresAt
+	}
+	return nil
+}
+
+func (s *revokedTokenStore) Contains(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.revokedTokens[jti]
+	return ok, nil
+}
+
+func (s *revokedTokenStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for jti, expiresAt := range s.revokedTokens {
+		if expiresAt.Before(now) {
+			delete(s.revokedTokens, jti)
+		}
+	}
+	return nil
+}
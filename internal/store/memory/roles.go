@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type roleStore struct {
+	*db
+}
+
+func (s *roleStore) Permissions(ctx context.Context) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matrix := make(map[string][]string, len(s.roles))
+	for role, set := range s.roles {
+		permissions := []string{}
+		for p := range set {
+			permissions = append(permissions, p)
+		}
+		sort.Strings(permissions)
+		matrix[role] = permissions
+	}
+	return matrix, nil
+}
+
+func (s *roleStore) Grant(ctx context.Context, role, permission string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, ok := s.roles[role]
+	if !ok {
+		return store.ErrNotFound
+	}
+	set[permission] = true
+	return nil
+}
+
+func (s *roleStore) Revoke(ctx context.Context, role, permission string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.roles[role], permission)
+	return nil
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type sessionStore struct {
+	*db
+}
+
+func (s *sessionStore) Create(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[session.UserID]; !ok {
+		return store.ErrNotFound
+	}
+	if _, ok := s.sessions[session.ID]; ok {
+		return store.ErrConflict
+	}
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastUsedAt = now
+
+	stored := *session
+	s.sessions[session.ID] = &stored
+	return nil
+}
+
+func (s *sessionStore) GetByID(ctx context.Context, id string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.sessions[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	session := *stored
+	return &session, nil
+}
+
+func (s *sessionStore) ListForUser(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.Active(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (s *sessionStore) Touch(ctx context.Context, id, ip string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	session.LastUsedAt = at
+	if ip != "" {
+		session.IP = ip
+	}
+	return nil
+}
+
+func (s *sessionStore) Rotate(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.RevokedAt != nil || session.RefreshTokenHash != oldHash {
+		return store.ErrConflict
+	}
+	session.RefreshTokenHash = newHash
+	session.ExpiresAt = expiresAt
+	session.LastUsedAt = time.Now()
+	return nil
+}
+
+func (s *sessionStore) Revoke(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (s *sessionStore) RevokeAllForUser(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			revokedAt := now
+			session.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type timelineStore struct {
+	*db
+}
+
+func (s *timelineStore) Push(ctx context.Context, entries []models.TimelineEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range entries {
+		if _, ok := s.users[e.UserID]; !ok {
+			continue
+		}
+		if _, ok := s.posts[e.PostID]; !ok {
+			continue
+		}
+		timeline, ok := s.timelines[e.UserID]
+		if !ok {
+			timeline = make(map[int]bool)
+			s.timelines[e.UserID] = timeline
+		}
+		timeline[e.PostID] = true
+	}
+	return nil
+}
+
+func (s *timelineStore) Page(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	timeline := s.timelines[userID]
+	posts := []models.Post{}
+	for postID := range timeline {
+		p := s.posts[postID]
+		if !after.Before(p.CreatedAt, p.ID) {
+			continue
+		}
+		post := *p
+		post.Username = s.usernameLocked(post.UserID)
+		posts = append(posts, post)
+	}
+	sortNewestFirst(posts)
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+func (s *timelineStore) RemoveAuthor(ctx context.Context, userID, authorID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for postID := range s.timelines[userID] {
+		if s.posts[postID].UserID == authorID {
+			delete(s.timelines[userID], postID)
+		}
+	}
+	return nil
+}
+
+func (s *timelineStore) Trim(ctx context.Context, userID, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timeline := s.timelines[userID]
+	if len(timeline) <= keep {
+		return nil
+	}
+	posts := make([]models.Post, 0, len(timeline))
+	for postID := range timeline {
+		posts = append(posts, *s.posts[postID])
+	}
+	sortNewestFirst(posts)
+	for _, p := range posts[keep:] {
+		delete(timeline, p.ID)
+	}
+	return nil
+}
+
+func (s *timelineStore) Replace(ctx context.Context, userID int, postIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+	// newest is the newest given post; entries newer than it were pushed
+	// after the caller read its posts and are kept
+	var newest store.Cursor
+	timeline := make(map[int]bool, len(postIDs))
+	for _, id := range postIDs {
+		if p, ok := s.posts[id]; ok {
+			timeline[id] = true
+			if newest.IsZero() || !newest.Before(p.CreatedAt, p.ID) {
+				newest = store.Cursor{Time: p.CreatedAt, ID: p.ID}
+			}
+		}
+	}
+	for id := range s.timelines[userID] {
+		if p, ok := s.posts[id]; ok && (newest.IsZero() || !newest.Before(p.CreatedAt, p.ID)) {
+			timeline[id] = true
+		}
+	}
+	s.timelines[userID] = timeline
+	s.builtTimelines[userID] = true
+	return nil
+}
+
+func (s *timelineStore) Built(ctx context.Context, userID int) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.builtTimelines[userID], nil
+}
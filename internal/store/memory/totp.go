@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type recoveryCode struct {
+	hash string
+	used bool
+}
+
+type totpStore struct {
+	*db
+}
+
+func (s *totpStore) SavePending(ctx context.Context, userID int, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.totp[userID]; ok && existing.Enabled() {
+		return store.ErrConflict
+	}
+	s.totp[userID] = &models.TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (s *totpStore) Get(ctx context.Context, userID int) (*models.TOTP, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.totp[userID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *t
+	return &copied, nil
+}
+
+func (s *totpStore) Enable(ctx context.Context, userID int, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[userID]
+	if !ok || t.Enabled() {
+		return store.ErrNotFound
+	}
+	now := time.Now()
+	t.EnabledAt = &now
+	t.LastUsedStep = step
+	return nil
+}
+
+func (s *totpStore) UseStep(ctx context.Context, userID int, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return store.ErrConflict
+	}
+	t.LastUsedStep = step
+	return nil
+}
+
+func (s *totpStore) Delete(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totp, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
+
+func (s *totpStore) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := make([]*recoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, &recoveryCode{hash: hash})
+	}
+	s.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (s *totpStore) UseRecoveryCode(ctx context.Context, userID int, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, code := range s.recoveryCodes[userID] {
+		if !code.used && code.hash == hash {
+			code.used = true
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *totpStore) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, code := range s.recoveryCodes[userID] {
+		if !code.used {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,274 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type userStore struct {
+	*db
+}
+
+// conflictLocked reports whether another user already has username or email.
+func (s *userStore) conflictLocked(id int, username, email string) bool {
+	for _, u := range s.users {
+		if u.ID == id {
+			continue
+		}
+		if u.Username == username || strings.EqualFold(u.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *userStore) Create(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conflictLocked(0, user.Username, user.Email) {
+		return store.ErrConflict
+	}
+
+	user.NormalizeRole()
+	s.nextUserID++
+	now := time.Now()
+	user.ID = s.nextUserID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *userStore) GetByID(ctx context.Context, id int) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (s *userStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *userStore) List(ctx context.Context) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, *u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (s *userStore) UpdateProfile(ctx context.Context, id int, username, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if s.conflictLocked(id, username, "") {
+		return store.ErrConflict
+	}
+	u.Username = username
+	u.Password = passwordHash
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *userStore) UpdateAccount(ctx context.Context, id int, username, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if s.conflictLocked(id, username, email) {
+		return store.ErrConflict
+	}
+	u.Username = username
+	u.Email = email
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *userStore) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.Password = passwordHash
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *userStore) SetRole(ctx context.Context, id int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.SetRole(role)
+	return nil
+}
+
+func (s *userStore) BumpTokenVersion(ctx context.Context, id int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	u.TokenVersion++
+	return u.TokenVersion, nil
+}
+
+func (s *userStore) Activate(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			u.IsActive = true
+			u.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (s *userStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.users, id)
+	for postID, p := range s.posts {
+		if p.UserID == id {
+			s.deletePostLocked(postID)
+		}
+	}
+	// Comments become authorless tombstones, mirroring the ON DELETE SET
+	// NULL on comments.user_id, so replies by others stay in place
+	for commentID, c := range s.comments {
+		if c.UserID == id {
+			c.UserID = 0
+			c.Content = ""
+			if !c.Deleted {
+				c.Deleted = true
+				s.deleteReactionsLocked(models.ReactionTargetComment, commentID)
+			}
+		}
+	}
+	s.pruneTombstonesLocked()
+	for sessionID, session := range s.sessions {
+		if session.UserID == id {
+			delete(s.sessions, sessionID)
+		}
+	}
+	for tokenHash, token := range s.authTokens {
+		if token.userID == id {
+			delete(s.authTokens, tokenHash)
+		}
+	}
+	delete(s.totp, id)
+	delete(s.recoveryCodes, id)
+	for tokenHash, challenge := range s.mfaChallenges {
+		if challenge.UserID == id {
+			delete(s.mfaChallenges, tokenHash)
+		}
+	}
+	for tokenID, token := range s.accessTokens {
+		if token.UserID == id {
+			delete(s.accessTokens, tokenID)
+		}
+	}
+	for identityID, identity := range s.identities {
+		if identity.UserID == id {
+			delete(s.identities, identityID)
+		}
+	}
+	delete(s.loginFailures, id)
+	for _, invite := range s.invites {
+		if invite.CreatedBy == id {
+			invite.CreatedBy = 0
+		}
+	}
+	redemptions := s.inviteRedemptions[:0]
+	for _, r := range s.inviteRedemptions {
+		if r.UserID != id {
+			redemptions = append(redemptions, r)
+		}
+	}
+	s.inviteRedemptions = redemptions
+	delete(s.follows, id)
+	for _, followees := range s.follows {
+		delete(followees, id)
+	}
+	delete(s.timelines, id)
+	delete(s.builtTimelines, id)
+	for key := range s.reactions {
+		if key.userID == id {
+			delete(s.reactions, key)
+		}
+	}
+	return nil
+}
+
+func (s *userStore) Count(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users), nil
+}
+
+func (s *userStore) CountActiveSince(ctx context.Context, since time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	active := make(map[int]bool)
+	for _, p := range s.posts {
+		if p.CreatedAt.After(since) {
+			active[p.UserID] = true
+		}
+	}
+	for _, c := range s.comments {
+		if c.UserID != 0 && c.CreatedAt.After(since) {
+			active[c.UserID] = true
+		}
+	}
+	return len(active), nil
+}
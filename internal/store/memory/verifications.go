@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type verificationStore struct {
+	*db
+}
+
+func (s *verificationStore) Save(ctx context.Context, v *models.Verification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *v
+	stored.Attempts = 0
+	s.verifications[v.Email] = &stored
+	return nil
+}
+
+func (s *verificationStore) Get(ctx context.Context, email string) (*models.Verification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.verifications[email]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	copied := *v
+	return &copied, nil
+}
+
+func (s *verificationStore) IncrementAttempts(ctx context.Context, email string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.verifications[email]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	v.Attempts++
+	return v.Attempts, nil
+}
+
+func (s *verificationStore) Delete(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.verifications, email)
+	return nil
+}
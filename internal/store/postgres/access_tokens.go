@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type accessTokenStore struct {
+	db *sql.DB
+}
+
+const accessTokenColumns = "id, user_id, name, token_hash, token_prefix, scopes, created_at, last_used_at, expires_at, revoked_at"
+
+func scanAccessToken(row rowScanner) (*models.PersonalAccessToken, error) {
+	var t models.PersonalAccessToken
+	var scopes string
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.TokenHash, &t.Prefix, &scopes,
+		&t.CreatedAt, &lastUsedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return &t, nil
+}
+
+func (s *accessTokenStore) Create(ctx context.Context, t *models.PersonalAccessToken) error {
+	var expiresAt interface{}
+	if t.ExpiresAt != nil {
+		expiresAt = *t.ExpiresAt
+	}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, t.UserID, t.Name, t.TokenHash, t.Prefix, strings.Join(t.Scopes, " "), expiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+	return translateError(err)
+}
+
+func (s *accessTokenStore) GetByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	t, err := scanAccessToken(s.db.QueryRowContext(ctx,
+		"SELECT "+accessTokenColumns+" FROM personal_access_tokens WHERE token_hash = $1", hash,
+	))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return t, nil
+}
+
+func (s *accessTokenStore) ListForUser(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+accessTokenColumns+" FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC, id DESC", userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.PersonalAccessToken{}
+	for rows.Next() {
+		t, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *accessTokenStore) Revoke(ctx context.Context, id, userID int) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE personal_access_tokens SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1 AND user_id = $2",
+		id, userID,
+	))
+}
+
+func (s *accessTokenStore) RevokeAllForUser(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE personal_access_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID,
+	)
+	return err
+}
+
+func (s *accessTokenStore) Touch(ctx context.Context, id int, at time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE personal_access_tokens SET last_used_at = $2 WHERE id = $1", id, at,
+	)
+	return err
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type authTokenStore struct {
+	db *sql.DB
+}
+
+func (s *authTokenStore) Create(ctx context.Context, purpose string, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO auth_tokens (purpose, user_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		purpose, userID, tokenHash, expiresAt,
+	)
+	return translateError(err)
+}
+
+func (s *authTokenStore) Lookup(ctx context.Context, purpose, tokenHash string, now time.Time) (int, error) {
+	var userID int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id FROM auth_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+	`, tokenHash, purpose, now).Scan(&userID)
+	return userID, translateError(err)
+}
+
+func (s *authTokenStore) Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (int, error) {
+	var userID int
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE auth_tokens SET used_at = $3
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+		RETURNING user_id
+	`, tokenHash, purpose, now).Scan(&userID)
+	return userID, translateError(err)
+}
+
+func (s *authTokenStore) InvalidateForUser(ctx context.Context, purpose string, userID int) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE auth_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userID, purpose,
+	)
+	return err
+}
@@ -0,0 +1,257 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type commentStore struct {
+	db *sql.DB
+}
+
+// commentColumns selects a comment aliased as c left joined with its author
+// as users, plus its direct reply count. Tombstones of deleted users have no
+// author.
+const commentColumns = `c.id, c.post_id, COALESCE(c.parent_id, 0), COALESCE(c.user_id, 0), c.content,
+	c.created_at, c.deleted_at IS NOT NULL, COALESCE(users.username, ''),
+	(SELECT COUNT(*) FROM comments replies WHERE replies.parent_id = c.id)`
+
+func scanComment(row rowScanner) (*models.Comment, error) {
+	var comment models.Comment
+	err := row.Scan(&comment.ID, &comment.PostID, &comment.ParentID, &comment.UserID,
+		&comment.Content, &comment.CreatedAt, &comment.Deleted, &comment.Username, &comment.ReplyCount)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if comment.Deleted {
+		comment.UserID = 0
+		comment.Username = ""
+		comment.Content = ""
+	}
+	return &comment, nil
+}
+
+func scanComments(rows *sql.Rows) ([]models.Comment, error) {
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, *comment)
+	}
+	return comments, rows.Err()
+}
+
+func (s *commentStore) Create(ctx context.Context, comment *models.Comment) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO comments (post_id, parent_id, user_id, content)
+		SELECT $1::int, NULLIF($2::int, 0), $3::int, $4::text
+		WHERE $2 = 0 OR EXISTS (
+			SELECT 1 FROM comments
+			WHERE id = $2 AND post_id = $1 AND deleted_at IS NULL
+		)
+		RETURNING id, created_at
+	`, comment.PostID, comment.ParentID, comment.UserID, comment.Content,
+	).Scan(&comment.ID, &comment.CreatedAt)
+	return translateError(err)
+}
+
+func (s *commentStore) GetByID(ctx context.Context, id int) (*models.Comment, error) {
+	return scanComment(s.db.QueryRowContext(ctx, `
+		SELECT `+commentColumns+`
+		FROM comments c
+		LEFT JOIN users ON c.user_id = users.id
+		WHERE c.id = $1 AND c.deleted_at IS NULL
+	`, id))
+}
+
+func (s *commentStore) ListByPost(ctx context.Context, postID, parentID int, order string, after store.Cursor, limit int) ([]models.Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments c
+		LEFT JOIN users ON c.user_id = users.id`
+	if order == store.CommentsTop {
+		query += `
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS score FROM comment_reactions r WHERE r.comment_id = c.id
+		) reactions`
+	}
+	query += " WHERE c.post_id = $1"
+	args := []interface{}{postID, limit}
+	if parentID == 0 {
+		query += " AND c.parent_id IS NULL"
+	} else {
+		args = append(args, parentID)
+		query += " AND c.parent_id = $" + strconv.Itoa(len(args))
+	}
+
+	switch order {
+	case store.CommentsNewest:
+		if !after.IsZero() {
+			args = append(args, after.Time, after.ID)
+			query += " AND (c.created_at, c.id) < ($" + strconv.Itoa(len(args)-1) + ", $" + strconv.Itoa(len(args)) + ")"
+		}
+		query += " ORDER BY c.created_at DESC, c.id DESC"
+	case store.CommentsTop:
+		if !after.IsZero() {
+			args = append(args, after.Score, after.ID)
+			score, id := "$"+strconv.Itoa(len(args)-1), "$"+strconv.Itoa(len(args))
+			query += " AND (reactions.score < " + score + " OR (reactions.score = " + score + " AND c.id > " + id + "))"
+		}
+		query += " ORDER BY reactions.score DESC, c.id"
+	default:
+		if !after.IsZero() {
+			args = append(args, after.Time, after.ID)
+			query += " AND (c.created_at, c.id) > ($" + strconv.Itoa(len(args)-1) + ", $" + strconv.Itoa(len(args)) + ")"
+		}
+		query += " ORDER BY c.created_at, c.id"
+	}
+	query += " LIMIT $2"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows)
+}
+
+func (s *commentStore) CountByPost(ctx context.Context, postIDs []int) (map[int]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT post_id, COUNT(*)
+		FROM comments
+		WHERE post_id = ANY($1) AND deleted_at IS NULL
+		GROUP BY post_id
+	`, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int, len(postIDs))
+	for rows.Next() {
+		var postID, n int
+		if err := rows.Scan(&postID, &n); err != nil {
+			return nil, err
+		}
+		counts[postID] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *commentStore) Thread(ctx context.Context, postID, parentID, depth int) ([]models.Comment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE thread (id, level) AS (
+			SELECT id, 1 FROM comments
+			WHERE post_id = $1
+			  AND (parent_id = $2 OR ($2 = 0 AND parent_id IS NULL))
+			UNION ALL
+			SELECT comments.id, thread.level + 1
+			FROM comments
+			JOIN thread ON comments.parent_id = thread.id
+			WHERE thread.level < $3
+		)
+		SELECT `+commentColumns+`
+		FROM thread
+		JOIN comments c ON c.id = thread.id
+		LEFT JOIN users ON c.user_id = users.id
+		ORDER BY c.created_at, c.id
+	`, postID, parentID, depth)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows)
+}
+
+func (s *commentStore) Update(ctx context.Context, id int, content string) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE comments SET content = $1 WHERE id = $2 AND deleted_at IS NULL", content, id,
+	))
+}
+
+func (s *commentStore) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	var hasReplies bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT parent_id, EXISTS (SELECT 1 FROM comments replies WHERE replies.parent_id = comments.id)
+		FROM comments
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id).Scan(&parentID, &hasReplies)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if hasReplies {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE comments SET deleted_at = CURRENT_TIMESTAMP, content = '' WHERE id = $1", id,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comment_reactions WHERE comment_id = $1", id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE id = $1", id); err != nil {
+		return err
+	}
+	// Walk up removing tombstones that no longer have any replies.
+	for parentID.Valid {
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM comments
+			WHERE id = $1 AND deleted_at IS NOT NULL
+			  AND NOT EXISTS (SELECT 1 FROM comments replies WHERE replies.parent_id = $1)
+			RETURNING parent_id
+		`, parentID.Int64).Scan(&parentID)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// pruneTombstones removes tombstones left without replies, repeating until
+// none are left so that chains of tombstones go in one call.
+func pruneTombstones(ctx context.Context, tx *sql.Tx) error {
+	for {
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM comments c
+			WHERE c.deleted_at IS NOT NULL
+			  AND NOT EXISTS (SELECT 1 FROM comments replies WHERE replies.parent_id = c.id)
+		`)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *commentStore) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE deleted_at IS NULL").Scan(&n)
+	return n, err
+}
@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type followStore struct {
+	db *sql.DB
+}
+
+// Follow and Unfollow leave users.follower_count to the trigger on follows,
+// which also sees the rows removed when an account is deleted.
+func (s *followStore) Follow(ctx context.Context, followerID, followeeID int) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, followerID, followeeID)
+	return translateError(err)
+}
+
+func (s *followStore) Unfollow(ctx context.Context, followerID, followeeID int) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2", followerID, followeeID,
+	))
+}
+
+func (s *followStore) IsFollowing(ctx context.Context, followerID, followeeID int) (bool, error) {
+	var following bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2)", followerID, followeeID,
+	).Scan(&following)
+	return following, err
+}
+
+func (s *followStore) Counts(ctx context.Context, userID int) (models.FollowCounts, error) {
+	var counts models.FollowCounts
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT follower_count FROM users WHERE id = $1),
+			(SELECT COUNT(*) FROM follows WHERE follower_id = $1)
+	`, userID).Scan(&counts.Followers, &counts.Following)
+	return counts, err
+}
+
+func (s *followStore) Followers(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.FollowUser, error) {
+	return s.list(ctx, "followee_id", "follower_id", userID, after, limit)
+}
+
+func (s *followStore) Following(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.FollowUser, error) {
+	return s.list(ctx, "follower_id", "followee_id", userID, after, limit)
+}
+
+// list pages through the follows of userID on the given side of the
+// relationship, returning the accounts on the other side.
+func (s *followStore) list(ctx context.Context, side, other string, userID int, after store.Cursor, limit int) ([]models.FollowUser, error) {
+	query := `
+		SELECT users.id, users.username, follows.created_at
+		FROM follows
+		JOIN users ON users.id = follows.` + other + `
+		WHERE follows.` + side + ` = $1`
+	args := []interface{}{userID, limit}
+	if !after.IsZero() {
+		query += " AND (follows.created_at, follows." + other + ") < ($3, $4)"
+		args = append(args, after.Time, after.ID)
+	}
+	query += " ORDER BY follows.created_at DESC, follows." + other + " DESC LIMIT $2"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.FollowUser{}
+	for rows.Next() {
+		var u models.FollowUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.FollowedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *followStore) FollowerIDs(ctx context.Context, userID int) ([]int, error) {
+	return s.ids(ctx, "SELECT follower_id FROM follows WHERE followee_id = $1", userID)
+}
+
+func (s *followStore) PopularFollowing(ctx context.Context, userID, minFollowers int) ([]int, error) {
+	return s.ids(ctx, `
+		SELECT follows.followee_id
+		FROM follows
+		JOIN users ON users.id = follows.followee_id
+		WHERE follows.follower_id = $1 AND users.follower_count >= $2
+	`, userID, minFollowers)
+}
+
+func (s *followStore) ids(ctx context.Context, query string, args ...interface{}) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
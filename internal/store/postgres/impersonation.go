@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type impersonationAuditStore struct {
+	db *sql.DB
+}
+
+func (s *impersonationAuditStore) Record(ctx context.Context, event *models.ImpersonationEvent) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO impersonation_audit (impersonator_id, user_id, method, path, status, read_only)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, event.ImpersonatorID, event.UserID, event.Method, event.Path, event.Status, event.ReadOnly,
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+func (s *impersonationAuditStore) List(ctx context.Context, limit int) ([]models.ImpersonationEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, impersonator_id, user_id, method, path, status, read_only, created_at
+		FROM impersonation_audit
+		ORDER BY id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.ImpersonationEvent{}
+	for rows.Next() {
+		var e models.ImpersonationEvent
+		if err := rows.Scan(&e.ID, &e.ImpersonatorID, &e.UserID, &e.Method, &e.Path, &e.Status, &e.ReadOnly, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
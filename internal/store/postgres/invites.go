@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type inviteStore struct {
+	db *sql.DB
+}
+
+const inviteColumns = "id, code_hash, code_prefix, note, created_by, max_uses, uses, created_at, expires_at, revoked_at"
+
+func scanInvite(row rowScanner) (*models.Invite, error) {
+	var invite models.Invite
+	var createdBy sql.NullInt64
+	var expiresAt, revokedAt sql.NullTime
+	err := row.Scan(&invite.ID, &invite.CodeHash, &invite.Prefix, &invite.Note, &createdBy,
+		&invite.MaxUses, &invite.Uses, &invite.CreatedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	invite.CreatedBy = int(createdBy.Int64)
+	if expiresAt.Valid {
+		invite.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		invite.RevokedAt = &revokedAt.Time
+	}
+	return &invite, nil
+}
+
+func (s *inviteStore) Create(ctx context.Context, invite *models.Invite) error {
+	var expiresAt interface{}
+	if invite.ExpiresAt != nil {
+		expiresAt = *invite.ExpiresAt
+	}
+	var createdBy interface{}
+	if invite.CreatedBy != 0 {
+		createdBy = invite.CreatedBy
+	}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO invites (code_hash, code_prefix, note, created_by, max_uses, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, invite.CodeHash, invite.Prefix, invite.Note, createdBy, invite.MaxUses, expiresAt,
+	).Scan(&invite.ID, &invite.CreatedAt)
+	return translateError(err)
+}
+
+func (s *inviteStore) List(ctx context.Context) ([]models.Invite, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+inviteColumns+" FROM invites ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []models.Invite{}
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *invite)
+	}
+	return invites, rows.Err()
+}
+
+func (s *inviteStore) GetByHash(ctx context.Context, hash string) (*models.Invite, error) {
+	invite, err := scanInvite(s.db.QueryRowContext(ctx,
+		"SELECT "+inviteColumns+" FROM invites WHERE code_hash = $1", hash,
+	))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return invite, nil
+}
+
+func (s *inviteStore) Redeem(ctx context.Context, hash string, userID int, now time.Time) (*models.Invite, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The conditional increment is the check: concurrent redemptions of the
+	// last use serialize on the row and only one of them matches.
+	invite, err := scanInvite(tx.QueryRowContext(ctx, `
+		UPDATE invites SET uses = uses + 1
+		WHERE code_hash = $1 AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > $2)
+			AND (max_uses = 0 OR uses < max_uses)
+		RETURNING `+inviteColumns,
+		hash, now,
+	))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO invite_redemptions (invite_id, user_id, redeemed_at) VALUES ($1, $2, $3)",
+		invite.ID, userID, now,
+	); err != nil {
+		return nil, translateError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+func (s *inviteStore) Revoke(ctx context.Context, id int) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE invites SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1", id,
+	))
+}
+
+func (s *inviteStore) Redemptions(ctx context.Context, inviteID int) ([]models.InviteRedemption, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.invite_id, r.user_id, u.username, r.redeemed_at
+		FROM invite_redemptions r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.invite_id = $1
+		ORDER BY r.redeemed_at, r.user_id
+	`, inviteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	redemptions := []models.InviteRedemption{}
+	for rows.Next() {
+		var r models.InviteRedemption
+		if err := rows.Scan(&r.InviteID, &r.UserID, &r.Username, &r.RedeemedAt); err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, r)
+	}
+	return redemptions, rows.Err()
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type loginFailureStore struct {
+	db *sql.DB
+}
+
+func scanLoginFailures(row rowScanner) (*models.LoginFailures, error) {
+	var f models.LoginFailures
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&f.UserID, &f.Failures, &f.LastFailedAt, &lockedUntil); err != nil {
+		return nil, translateError(err)
+	}
+	if lockedUntil.Valid {
+		f.LockedUntil = &lockedUntil.Time
+	}
+	return &f, nil
+}
+
+func (s *loginFailureStore) Get(ctx context.Context, userID int) (*models.LoginFailures, error) {
+	return scanLoginFailures(s.db.QueryRowContext(ctx,
+		"SELECT user_id, failures, last_failed_at, locked_until FROM login_failures WHERE user_id = $1", userID,
+	))
+}
+
+func (s *loginFailureStore) RecordFailure(ctx context.Context, userID int, at, forgetBefore time.Time) (*models.LoginFailures, error) {
+	return scanLoginFailures(s.db.QueryRowContext(ctx, `
+		INSERT INTO login_failures (user_id, failures, last_failed_at) VALUES ($1, 1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET failures = CASE WHEN login_failures.last_failed_at < $3 THEN 1 ELSE login_failures.failures + 1 END,
+		    last_failed_at = $2
+		RETURNING user_id, failures, last_failed_at, locked_until
+	`, userID, at, forgetBefore))
+}
+
+func (s *loginFailureStore) Lock(ctx context.Context, userID int, until time.Time) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE login_failures SET locked_until = $2 WHERE user_id = $1", userID, until,
+	))
+}
+
+func (s *loginFailureStore) Reset(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE user_id = $1", userID)
+	return err
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type mfaChallengeStore struct {
+	db *sql.DB
+}
+
+func (s *mfaChallengeStore) Create(ctx context.Context, c *models.MFAChallenge) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		c.TokenHash, c.UserID, c.ExpiresAt,
+	)
+	return translateError(err)
+}
+
+func (s *mfaChallengeStore) Get(ctx context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	var c models.MFAChallenge
+	err := s.db.QueryRowContext(ctx,
+		"SELECT token_hash, user_id, attempts, expires_at FROM mfa_challenges WHERE token_hash = $1", tokenHash,
+	).Scan(&c.TokenHash, &c.UserID, &c.Attempts, &c.ExpiresAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &c, nil
+}
+
+func (s *mfaChallengeStore) IncrementAttempts(ctx context.Context, tokenHash string) (int, error) {
+	var attempts int
+	err := s.db.QueryRowContext(ctx,
+		"UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = $1 RETURNING attempts", tokenHash,
+	).Scan(&attempts)
+	return attempts, translateError(err)
+}
+
+func (s *mfaChallengeStore) Delete(ctx context.Context, tokenHash string) error {
+	// Expired challenges are removed along the way.
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM mfa_challenges WHERE token_hash = $1 OR expires_at < NOW()", tokenHash,
+	)
+	return err
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type oauthStore struct {
+	db *sql.DB
+}
+
+func (s *oauthStore) CreateState(ctx context.Context, state *models.OAuthState) error {
+	// Abandoned logins are removed along the way.
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM oauth_states WHERE expires_at < NOW()"); err != nil {
+		return err
+	}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO oauth_states (state_hash, provider, nonce, code_verifier, expires_at)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING created_at`,
+		state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt,
+	).Scan(&state.CreatedAt)
+	return translateError(err)
+}
+
+func (s *oauthStore) ConsumeState(ctx context.Context, stateHash string, now time.Time) (*models.OAuthState, error) {
+	var state models.OAuthState
+	err := s.db.QueryRowContext(ctx,
+		`DELETE FROM oauth_states WHERE state_hash = $1 AND expires_at > $2
+		 RETURNING state_hash, provider, nonce, code_verifier, created_at, expires_at`,
+		stateHash, now,
+	).Scan(&state.StateHash, &state.Provider, &state.Nonce, &state.CodeVerifier, &state.CreatedAt, &state.ExpiresAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &state, nil
+}
+
+func (s *oauthStore) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, provider, subject, email, created_at
+		 FROM user_identities WHERE provider = $1 AND subject = $2`,
+		provider, subject,
+	).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &identity, nil
+}
+
+func (s *oauthStore) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email)
+		 VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt)
+	return translateError(err)
+}
@@ -0,0 +1,70 @@
+// Package postgres implements the store interfaces on top of PostgreSQL.
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+// New returns a Store backed by the given database connection.
+func New(db *sql.DB) *store.Store {
+	return &store.Store{
+		Users:         &userStore{db: db},
+		Posts:         &postStore{db: db},
+		Comments:      &commentStore{db: db},
+		Verifications: &verificationStore{db: db},
+		Sessions:      &sessionStore{db: db},
+		RevokedTokens: &revokedTokenStore{db: db},
+		AuthTokens:    &authTokenStore{db: db},
+		TOTP:          &totpStore{db: db},
+		MFAChallenges: &mfaChallengeStore{db: db},
+		AccessTokens:  &accessTokenStore{db: db},
+		Roles:         &roleStore{db: db},
+		OAuth:         &oauthStore{db: db},
+		LoginFailures: &loginFailureStore{db: db},
+		Impersonation: &impersonationAuditStore{db: db},
+		Invites:       &inviteStore{db: db},
+		Follows:       &followStore{db: db},
+		Timelines:     &timelineStore{db: db},
+		Reactions:     &reactionStore{db: db},
+	}
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// translateError maps driver errors onto the store sentinel errors.
+func translateError(err error) error {
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code {
+		case "23505": // unique_violation
+			return store.ErrConflict
+		case "23503": // foreign_key_violation
+			return store.ErrNotFound
+		}
+	}
+	return err
+}
+
+// expectAffected turns an UPDATE/DELETE that touched no rows into
+// store.ErrNotFound.
+func expectAffected(result sql.Result, err error) error {
+	if err != nil {
+		return translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type postStore struct {
+	db *sql.DB
+}
+
+func (s *postStore) Create(ctx context.Context, post *models.Post) error {
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO posts (user_id, content) VALUES ($1, $2) RETURNING id, created_at",
+		post.UserID, post.Content,
+	).Scan(&post.ID, &post.CreatedAt)
+	return translateError(err)
+}
+
+func (s *postStore) GetByID(ctx context.Context, id int) (*models.Post, error) {
+	var post models.Post
+	err := s.db.QueryRowContext(ctx, `
+		SELECT posts.id, posts.user_id, posts.content, posts.created_at, users.username
+		FROM posts
+		JOIN users ON posts.user_id = users.id
+		WHERE posts.id = $1
+	`, id).Scan(&post.ID, &post.UserID, &post.Content, &post.CreatedAt, &post.Username)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &post, nil
+}
+
+func (s *postStore) List(ctx context.Context, filter store.PostFilter) ([]models.Post, error) {
+	query := `
+		SELECT posts.id, posts.user_id, posts.content, posts.created_at, users.username
+		FROM posts
+		JOIN users ON posts.user_id = users.id
+	`
+	whereClause := []string{}
+	args := []interface{}{}
+
+	if filter.Keyword != "" {
+		args = append(args, "%"+filter.Keyword+"%")
+		whereClause = append(whereClause, "posts.content ILIKE $"+strconv.Itoa(len(args)))
+	}
+	if filter.UserID != 0 {
+		args = append(args, filter.UserID)
+		whereClause = append(whereClause, "posts.user_id = $"+strconv.Itoa(len(args)))
+	}
+	if !filter.Date.IsZero() {
+		args = append(args, filter.Date.Format("2006-01-02"))
+		whereClause = append(whereClause, "DATE(posts.created_at) = $"+strconv.Itoa(len(args)))
+	}
+	if filter.Username != "" {
+		args = append(args, "%"+filter.Username+"%")
+		whereClause = append(whereClause, "users.username ILIKE $"+strconv.Itoa(len(args)))
+	}
+
+	if len(whereClause) > 0 {
+		query += " WHERE " + strings.Join(whereClause, " AND ")
+	}
+	query += " ORDER BY posts.created_at DESC, posts.id DESC"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += " LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.CreatedAt, &post.Username); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (s *postStore) Update(ctx context.Context, id int, content string) error {
+	return expectAffected(s.db.ExecContext(ctx, "UPDATE posts SET content = $1 WHERE id = $2", content, id))
+}
+
+func (s *postStore) Delete(ctx context.Context, id int) error {
+	return expectAffected(s.db.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", id))
+}
+
+func (s *postStore) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts").Scan(&n)
+	return n, err
+}
+
+func (s *postStore) Home(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.Post, error) {
+	return s.newestOf(ctx, `
+		SELECT $1::int
+		UNION
+		SELECT followee_id FROM follows WHERE follower_id = $1
+	`, userID, after, limit)
+}
+
+func (s *postStore) ByAuthors(ctx context.Context, authorIDs []int, after store.Cursor, limit int) ([]models.Post, error) {
+	return s.newestOf(ctx, "SELECT unnest($1::int[])", pq.Array(authorIDs), after, limit)
+}
+
+// newestOf returns the newest posts of the authors selected by authorsQuery,
+// which reads its parameter from $1. It reads the newest posts of each
+// author separately through the (user_id, created_at, id) index and merges
+// them, so the cost grows with the number of authors times the page size
+// rather than with the size of the posts table.
+func (s *postStore) newestOf(ctx context.Context, authorsQuery string, authorsArg interface{}, after store.Cursor, limit int) ([]models.Post, error) {
+	args := []interface{}{authorsArg, limit}
+	page := ""
+	if !after.IsZero() {
+		page = "AND (posts.created_at, posts.id) < ($3, $4)"
+		args = append(args, after.Time, after.ID)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, p.user_id, p.content, p.created_at, users.username
+		FROM (`+authorsQuery+`) AS authors(user_id)
+		CROSS JOIN LATERAL (
+			SELECT posts.id, posts.user_id, posts.content, posts.created_at
+			FROM posts
+			WHERE posts.user_id = authors.user_id `+page+`
+			ORDER BY posts.created_at DESC, posts.id DESC
+			LIMIT $2
+		) p
+		JOIN users ON users.id = p.user_id
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $2
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.CreatedAt, &post.Username); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
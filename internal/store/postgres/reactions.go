@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type reactionStore struct {
+	db *sql.DB
+}
+
+// reactionTable returns the table and item column holding reactions to
+// targetType.
+func reactionTable(targetType string) (table, column string, err error) {
+	switch targetType {
+	case models.ReactionTargetPost:
+		return "post_reactions", "post_id", nil
+	case models.ReactionTargetComment:
+		return "comment_reactions", "comment_id", nil
+	}
+	return "", "", fmt.Errorf("unknown reaction target %q", targetType)
+}
+
+func (s *reactionStore) Add(ctx context.Context, reaction *models.Reaction) error {
+	table, column, err := reactionTable(reaction.TargetType)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO " + table + " (" + column + ", user_id, reaction) VALUES ($1, $2, $3) RETURNING created_at"
+	if reaction.TargetType == models.ReactionTargetComment {
+		// Tombstoned comments take no new reactions.
+		query = `
+			INSERT INTO comment_reactions (comment_id, user_id, reaction)
+			SELECT $1::int, $2::int, $3::varchar
+			WHERE NOT EXISTS (SELECT 1 FROM comments WHERE id = $1 AND deleted_at IS NOT NULL)
+			RETURNING created_at
+		`
+	}
+	err = s.db.QueryRowContext(ctx, query,
+		reaction.TargetID, reaction.UserID, reaction.Reaction,
+	).Scan(&reaction.CreatedAt)
+	return translateError(err)
+}
+
+func (s *reactionStore) Remove(ctx context.Context, targetType string, targetID, userID int, reaction string) error {
+	table, column, err := reactionTable(targetType)
+	if err != nil {
+		return err
+	}
+	return expectAffected(s.db.ExecContext(ctx,
+		"DELETE FROM "+table+" WHERE "+column+" = $1 AND user_id = $2 AND reaction = $3",
+		targetID, userID, reaction,
+	))
+}
+
+func (s *reactionStore) Summaries(ctx context.Context, targetType string, targetIDs []int, viewerID int) (map[int]*models.ReactionSummary, error) {
+	table, column, err := reactionTable(targetType)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make(map[int]*models.ReactionSummary)
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+column+`, reaction, COUNT(*), BOOL_OR(user_id = $2)
+		FROM `+table+`
+		WHERE `+column+` = ANY($1)
+		GROUP BY `+column+`, reaction
+		ORDER BY `+column+`, reaction
+	`, pq.Array(targetIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		var reaction string
+		var mine bool
+		if err := rows.Scan(&id, &reaction, &count, &mine); err != nil {
+			return nil, err
+		}
+		summary, ok := summaries[id]
+		if !ok {
+			summary = models.NewReactionSummary()
+			summaries[id] = summary
+		}
+		summary.Counts[reaction] = count
+		if mine {
+			summary.Mine = append(summary.Mine, reaction)
+		}
+	}
+	return summaries, rows.Err()
+}
+
+func (s *reactionStore) List(ctx context.Context, targetType string, targetID int, reaction string, after store.Cursor, limit int) ([]models.Reaction, error) {
+	table, column, err := reactionTable(targetType)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT r.user_id, users.username, r.created_at
+		FROM ` + table + ` r
+		JOIN users ON users.id = r.user_id
+		WHERE r.` + column + ` = $1 AND r.reaction = $2`
+	args := []interface{}{targetID, reaction, limit}
+	if !after.IsZero() {
+		query += " AND (r.created_at, r.user_id) < ($4, $5)"
+		args = append(args, after.Time, after.ID)
+	}
+	query += " ORDER BY r.created_at DESC, r.user_id DESC LIMIT $3"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := []models.Reaction{}
+	for rows.Next() {
+		r := models.Reaction{TargetType: targetType, TargetID: targetID, Reaction: reaction}
+		if err := rows.Scan(&r.UserID, &r.Username, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type revokedTokenStore struct {
+	db *sql.DB
+}
+
+func (s *revokedTokenStore) Add(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, userID, expiresAt)
+	return err
+}
+
+func (s *revokedTokenStore) Contains(ctx context.Context, jti string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (s *revokedTokenStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < $1", now)
+	return err
+}
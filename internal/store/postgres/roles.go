@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+)
+
+type roleStore struct {
+	db *sql.DB
+}
+
+func (s *roleStore) Permissions(ctx context.Context) (map[string][]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.name, rp.permission
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+		ORDER BY r.name, rp.permission
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matrix := make(map[string][]string)
+	for rows.Next() {
+		var role string
+		var permission sql.NullString
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, err
+		}
+		if _, ok := matrix[role]; !ok {
+			matrix[role] = []string{}
+		}
+		if permission.Valid {
+			matrix[role] = append(matrix[role], permission.String)
+		}
+	}
+	return matrix, rows.Err()
+}
+
+func (s *roleStore) Grant(ctx context.Context, role, permission string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		role, permission,
+	)
+	return translateError(err)
+}
+
+func (s *roleStore) Revoke(ctx context.Context, role, permission string) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM role_permissions WHERE role = $1 AND permission = $2", role, permission,
+	)
+	return err
+}
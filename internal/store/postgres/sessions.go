@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type sessionStore struct {
+	db *sql.DB
+}
+
+func (s *sessionStore) Create(ctx context.Context, session *models.Session) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO sessions (id, user_id, refresh_token_hash, expires_at, mfa, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at, last_used_at
+	`, session.ID, session.UserID, session.RefreshTokenHash, session.ExpiresAt, session.MFA,
+		session.UserAgent, session.IP,
+	).Scan(&session.CreatedAt, &session.LastUsedAt)
+	return translateError(err)
+}
+
+const sessionColumns = "id, user_id, refresh_token_hash, created_at, last_used_at, expires_at, revoked_at, mfa, user_agent, ip"
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	var revokedAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.RefreshTokenHash,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &revokedAt, &session.MFA,
+		&session.UserAgent, &session.IP)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return &session, nil
+}
+
+func (s *sessionStore) GetByID(ctx context.Context, id string) (*models.Session, error) {
+	session, err := scanSession(s.db.QueryRowContext(ctx,
+		"SELECT "+sessionColumns+" FROM sessions WHERE id = $1", id,
+	))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return session, nil
+}
+
+func (s *sessionStore) ListForUser(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC
+	`, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sessionStore) Touch(ctx context.Context, id, ip string, at time.Time) error {
+	return expectAffected(s.db.ExecContext(ctx, `
+		UPDATE sessions SET last_used_at = $2, ip = COALESCE(NULLIF($3, ''), ip)
+		WHERE id = $1
+	`, id, at, ip))
+}
+
+func (s *sessionStore) Rotate(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	err := expectAffected(s.db.ExecContext(ctx, `
+		UPDATE sessions
+		SET refresh_token_hash = $1, expires_at = $2, last_used_at = NOW()
+		WHERE id = $3 AND refresh_token_hash = $4 AND revoked_at IS NULL
+	`, newHash, expiresAt, id, oldHash))
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (s *sessionStore) Revoke(ctx context.Context, id string) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1", id,
+	))
+}
+
+func (s *sessionStore) RevokeAllForUser(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID,
+	)
+	return err
+}
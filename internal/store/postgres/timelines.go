@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type timelineStore struct {
+	db *sql.DB
+}
+
+// pushQuery inserts (user_id, post_id) pairs given as two arrays, copying
+// the author and time from the post. Posts deleted in the meantime drop out
+// of the join.
+const pushQuery = `
+	INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+	SELECT entries.user_id, posts.id, posts.user_id, posts.created_at
+	FROM unnest($1::int[], $2::int[]) AS entries(user_id, post_id)
+	JOIN posts ON posts.id = entries.post_id
+	ON CONFLICT DO NOTHING
+`
+
+func (s *timelineStore) Push(ctx context.Context, entries []models.TimelineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	userIDs := make([]int64, len(entries))
+	postIDs := make([]int64, len(entries))
+	for i, e := range entries {
+		userIDs[i] = int64(e.UserID)
+		postIDs[i] = int64(e.PostID)
+	}
+	_, err := s.db.ExecContext(ctx, pushQuery, pq.Array(userIDs), pq.Array(postIDs))
+	return translateError(err)
+}
+
+func (s *timelineStore) Page(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.Post, error) {
+	query := `
+		SELECT posts.id, posts.user_id, posts.content, posts.created_at, users.username
+		FROM timeline_entries
+		JOIN posts ON posts.id = timeline_entries.post_id
+		JOIN users ON users.id = posts.user_id
+		WHERE timeline_entries.user_id = $1`
+	args := []interface{}{userID, limit}
+	if !after.IsZero() {
+		query += " AND (timeline_entries.created_at, timeline_entries.post_id) < ($3, $4)"
+		args = append(args, after.Time, after.ID)
+	}
+	query += " ORDER BY timeline_entries.created_at DESC, timeline_entries.post_id DESC LIMIT $2"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.CreatedAt, &post.Username); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (s *timelineStore) RemoveAuthor(ctx context.Context, userID, authorID int) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM timeline_entries WHERE user_id = $1 AND author_id = $2", userID, authorID,
+	)
+	return err
+}
+
+func (s *timelineStore) Trim(ctx context.Context, userID, keep int) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM timeline_entries
+		WHERE user_id = $1 AND (created_at, post_id) <= (
+			SELECT created_at, post_id FROM timeline_entries
+			WHERE user_id = $1
+			ORDER BY created_at DESC, post_id DESC
+			OFFSET $2 LIMIT 1
+		)
+	`, userID, keep)
+	return err
+}
+
+func (s *timelineStore) Replace(ctx context.Context, userID int, postIDs []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userIDs := make([]int64, len(postIDs))
+	ids := make([]int64, len(postIDs))
+	for i, id := range postIDs {
+		userIDs[i] = int64(userID)
+		ids[i] = int64(id)
+	}
+	// Only entries up to the newest given post go: anything newer was pushed
+	// by a fan-out after the caller read its posts. Without posts nothing is
+	// deleted, for the same reason.
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM timeline_entries
+		WHERE user_id = $1 AND (created_at, post_id) <= (
+			SELECT created_at, id FROM posts
+			WHERE id = ANY($2::int[])
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		)
+	`, userID, pq.Array(ids)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, pushQuery, pq.Array(userIDs), pq.Array(ids)); err != nil {
+		return translateError(err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO timelines (user_id) VALUES ($1)
+		ON CONFLICT (user_id) DO UPDATE SET built_at = CURRENT_TIMESTAMP
+	`, userID); err != nil {
+		return translateError(err)
+	}
+	return tx.Commit()
+}
+
+func (s *timelineStore) Built(ctx context.Context, userID int) (bool, error) {
+	var built bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM timelines WHERE user_id = $1)", userID,
+	).Scan(&built)
+	return built, err
+}
@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+type totpStore struct {
+	db *sql.DB
+}
+
+func (s *totpStore) SavePending(ctx context.Context, userID int, secret string) error {
+	err := expectAffected(s.db.ExecContext(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`, userID, secret))
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (s *totpStore) Get(ctx context.Context, userID int) (*models.TOTP, error) {
+	var t models.TOTP
+	var enabledAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id, secret, enabled_at, last_used_step, created_at
+		FROM user_totp
+		WHERE user_id = $1
+	`, userID).Scan(&t.UserID, &t.Secret, &enabledAt, &t.LastUsedStep, &t.CreatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if enabledAt.Valid {
+		t.EnabledAt = &enabledAt.Time
+	}
+	return &t, nil
+}
+
+func (s *totpStore) Enable(ctx context.Context, userID int, step int64) error {
+	return expectAffected(s.db.ExecContext(ctx, `
+		UPDATE user_totp SET enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`, userID, step))
+}
+
+func (s *totpStore) UseStep(ctx context.Context, userID int, step int64) error {
+	err := expectAffected(s.db.ExecContext(ctx,
+		"UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2",
+		userID, step,
+	))
+	if err == store.ErrNotFound {
+		return store.ErrConflict
+	}
+	return err
+}
+
+func (s *totpStore) Delete(ctx context.Context, userID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *totpStore) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash,
+		); err != nil {
+			return translateError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *totpStore) UseRecoveryCode(ctx context.Context, userID int, hash string) error {
+	return expectAffected(s.db.ExecContext(ctx, `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE id = (
+			SELECT id FROM recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)
+	`, userID, hash))
+}
+
+func (s *totpStore) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID,
+	).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type userStore struct {
+	db *sql.DB
+}
+
+const userColumns = "id, username, email, password, is_admin, is_active, created_at, updated_at, token_version, role"
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	var createdAt, updatedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password,
+		&user.IsAdmin, &user.IsActive, &createdAt, &updatedAt, &user.TokenVersion, &user.Role)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	user.CreatedAt = createdAt.Time
+	user.UpdatedAt = updatedAt.Time
+	return &user, nil
+}
+
+func (s *userStore) Create(ctx context.Context, user *models.User) error {
+	user.NormalizeRole()
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO users (username, email, password, is_admin, is_active, role) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at",
+		user.Username, user.Email, user.Password, user.IsAdmin, user.IsActive, user.Role,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	return translateError(err)
+}
+
+func (s *userStore) GetByID(ctx context.Context, id int) (*models.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+func (s *userStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email))
+}
+
+func (s *userStore) List(ctx context.Context) ([]models.User, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (s *userStore) UpdateProfile(ctx context.Context, id int, username, passwordHash string) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE users SET username = $1, password = $2, updated_at = NOW() WHERE id = $3",
+		username, passwordHash, id,
+	))
+}
+
+func (s *userStore) UpdateAccount(ctx context.Context, id int, username, email string) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE users SET username = $1, email = $2, updated_at = NOW() WHERE id = $3",
+		username, email, id,
+	))
+}
+
+func (s *userStore) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2", passwordHash, id,
+	))
+}
+
+func (s *userStore) SetRole(ctx context.Context, id int, role string) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE users SET role = $1, is_admin = $2, updated_at = NOW() WHERE id = $3",
+		role, models.IsAdminRole(role), id,
+	))
+}
+
+func (s *userStore) BumpTokenVersion(ctx context.Context, id int) (int, error) {
+	var version int
+	err := s.db.QueryRowContext(ctx,
+		"UPDATE users SET token_version = token_version + 1 WHERE id = $1 RETURNING token_version", id,
+	).Scan(&version)
+	return version, translateError(err)
+}
+
+func (s *userStore) Activate(ctx context.Context, email string) error {
+	return expectAffected(s.db.ExecContext(ctx,
+		"UPDATE users SET is_active = true, updated_at = NOW() WHERE email = $1", email,
+	))
+}
+
+// Delete removes the user. Their comments become tombstones first, so that
+// the ON DELETE SET NULL on comments.user_id keeps other users' replies in
+// place; tombstones left without replies are removed afterwards.
+func (s *userStore) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM comment_reactions
+		WHERE comment_id IN (SELECT id FROM comments WHERE user_id = $1 AND deleted_at IS NULL)
+	`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE comments SET deleted_at = CURRENT_TIMESTAMP, content = '' WHERE user_id = $1 AND deleted_at IS NULL", id,
+	); err != nil {
+		return err
+	}
+	if err := expectAffected(tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)); err != nil {
+		return err
+	}
+	if err := pruneTombstones(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *userStore) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+	return n, err
+}
+
+func (s *userStore) CountActiveSince(ctx context.Context, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT user_id)
+		FROM (
+			SELECT user_id FROM posts WHERE created_at > $1
+			UNION
+			SELECT user_id FROM comments WHERE created_at > $1
+		) AS active_users
+	`, since).Scan(&n)
+	return n, err
+}
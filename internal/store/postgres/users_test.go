@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pinokiochan/social-network-render/internal/store"
+)
+
+func TestUserStoreDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// The user's comments become tombstones before the user row goes, and
+	// tombstones left without replies are pruned in the same transaction
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM comment_reactions").
+		WithArgs(123).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE comments SET deleted_at").
+		WithArgs(123).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM users WHERE id = \\$1").
+		WithArgs(123).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM comments c").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM comments c").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM comment_reactions").
+		WithArgs(124).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE comments SET deleted_at").
+		WithArgs(124).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM users WHERE id = \\$1").
+		WithArgs(124).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	users := New(db).Users
+	if err := users.Delete(context.Background(), 123); err != nil {
+		t.Errorf("Delete(123) returned error: %v", err)
+	}
+	if err := users.Delete(context.Background(), 124); err != store.ErrNotFound {
+		t.Errorf("Delete(124) = %v, want ErrNotFound", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+type verificationStore struct {
+	db *sql.DB
+}
+
+func (s *verificationStore) Save(ctx context.Context, v *models.Verification) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO inactive_users (email, code_hash, expires_at, attempts, last_sent_at)
+		VALUES ($1, $2, $3, 0, $4)
+		ON CONFLICT (email) DO UPDATE SET
+			code_hash = EXCLUDED.code_hash,
+			expires_at = EXCLUDED.expires_at,
+			attempts = 0,
+			last_sent_at = EXCLUDED.last_sent_at
+	`, v.Email, v.CodeHash, v.ExpiresAt, v.LastSentAt)
+	return translateError(err)
+}
+
+func (s *verificationStore) Get(ctx context.Context, email string) (*models.Verification, error) {
+	v := &models.Verification{}
+	err := s.db.QueryRowContext(ctx,
+		"SELECT email, code_hash, attempts, expires_at, last_sent_at FROM inactive_users WHERE email = $1", email,
+	).Scan(&v.Email, &v.CodeHash, &v.Attempts, &v.ExpiresAt, &v.LastSentAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return v, nil
+}
+
+func (s *verificationStore) IncrementAttempts(ctx context.Context, email string) (int, error) {
+	var attempts int
+	err := s.db.QueryRowContext(ctx,
+		"UPDATE inactive_users SET attempts = attempts + 1 WHERE email = $1 RETURNING attempts", email,
+	).Scan(&attempts)
+	return attempts, translateError(err)
+}
+
+func (s *verificationStore) Delete(ctx context.Context, email string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM inactive_users WHERE email = $1", email)
+	return err
+}
@@ -0,0 +1,405 @@
+// Package store defines the persistence interfaces used by the HTTP handlers.
+// Implementations live in the postgres and memory subpackages.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("store: record not found")
+	// ErrConflict is returned when a write violates a uniqueness constraint.
+	ErrConflict = errors.New("store: record already exists")
+)
+
+// Store groups every repository the application needs.
+type Store struct {
+	Users         UserStore
+	Posts         PostStore
+	Comments      CommentStore
+	Verifications VerificationStore
+	Sessions      SessionStore
+	RevokedTokens RevokedTokenStore
+	AuthTokens    AuthTokenStore
+	TOTP          TOTPStore
+	MFAChallenges MFAChallengeStore
+	AccessTokens  AccessTokenStore
+	Roles         RoleStore
+	OAuth         OAuthStore
+	LoginFailures LoginFailureStore
+	Impersonation ImpersonationAuditStore
+	Invites       InviteStore
+	Follows       FollowStore
+	Timelines     TimelineStore
+	Reactions     ReactionStore
+}
+
+// UserStore persists user accounts.
+type UserStore interface {
+	// Create inserts the user and fills in its ID and timestamps.
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	List(ctx context.Context) ([]models.User, error)
+	// UpdateProfile changes the username and password hash of a user.
+	UpdateProfile(ctx context.Context, id int, username, passwordHash string) error
+	// UpdateAccount changes the username and email of a user.
+	UpdateAccount(ctx context.Context, id int, username, email string) error
+	// UpdatePassword replaces the password hash of a user.
+	UpdatePassword(ctx context.Context, id int, passwordHash string) error
+	// SetRole changes the role of a user; is_admin follows the role.
+	SetRole(ctx context.Context, id int, role string) error
+	// BumpTokenVersion increments the user's token version, invalidating
+	// every access token issued before, and returns the new version.
+	BumpTokenVersion(ctx context.Context, id int) (int, error)
+	// Activate marks the user with the given email as verified.
+	Activate(ctx context.Context, email string) error
+	Delete(ctx context.Context, id int) error
+	Count(ctx context.Context) (int, error)
+	// CountActiveSince counts users who posted or commented after since.
+	CountActiveSince(ctx context.Context, since time.Time) (int, error)
+}
+
+// PostFilter narrows the result of PostStore.List. Zero values disable a
+// filter; a zero Limit returns every matching post.
+type PostFilter struct {
+	Keyword  string
+	UserID   int
+	Date     time.Time
+	Username string
+	Limit    int
+	Offset   int
+}
+
+// PostStore persists posts.
+type PostStore interface {
+	// Create inserts the post and fills in its ID and CreatedAt.
+	Create(ctx context.Context, post *models.Post) error
+	GetByID(ctx context.Context, id int) (*models.Post, error)
+	// List returns posts newest first, joined with their author's username.
+	List(ctx context.Context, filter PostFilter) ([]models.Post, error)
+	Update(ctx context.Context, id int, content string) error
+	Delete(ctx context.Context, id int) error
+	Count(ctx context.Context) (int, error)
+	// Home returns up to limit posts by the user and the accounts they
+	// follow, newest first, starting after the given cursor.
+	Home(ctx context.Context, userID int, after Cursor, limit int) ([]models.Post, error)
+	// ByAuthors returns up to limit posts by the given authors, newest
+	// first, starting after the given cursor.
+	ByAuthors(ctx context.Context, authorIDs []int, after Cursor, limit int) ([]models.Post, error)
+}
+
+// Cursor is a position in a list ordered newest first by (Time, ID). A page
+// starting after a cursor holds the rows that sort strictly below it; the
+// zero Cursor starts at the newest row. Unlike an offset, it stays stable
+// while new rows are inserted at the top.
+type Cursor struct {
+	Time time.Time
+	ID   int
+	// Score is set instead of Time by lists ordered by a score, such as
+	// comments sorted by CommentsTop.
+	Score int
+}
+
+// IsZero reports whether the cursor points at the start of the list.
+func (c Cursor) IsZero() bool {
+	return c.Time.IsZero() && c.ID == 0
+}
+
+// Before reports whether a row at (t, id) comes after the cursor in newest
+// first order, i.e. belongs to the page starting at c.
+func (c Cursor) Before(t time.Time, id int) bool {
+	if c.IsZero() {
+		return true
+	}
+	if !t.Equal(c.Time) {
+		return t.Before(c.Time)
+	}
+	return id < c.ID
+}
+
+// Comment list orders accepted by CommentStore.ListByPost. CommentsTop puts
+// the comments with the most reactions first, ties oldest first.
+const (
+	CommentsOldest = "oldest"
+	CommentsNewest = "newest"
+	CommentsTop    = "top"
+)
+
+// CommentStore persists comments.
+type CommentStore interface {
+	// Create inserts the comment and fills in its ID and CreatedAt. A
+	// non-zero ParentID must name a live comment on the same post, otherwise
+	// Create returns ErrNotFound.
+	Create(ctx context.Context, comment *models.Comment) error
+	// GetByID returns ErrNotFound for tombstones.
+	GetByID(ctx context.Context, id int) (*models.Comment, error)
+	// ListByPost returns a page of the replies to parentID on the post (the
+	// top-level comments when parentID is 0), tombstones included, in the
+	// given order. The page starts after the cursor: (Time, ID) for
+	// CommentsOldest and CommentsNewest, (Score, ID) for CommentsTop.
+	ListByPost(ctx context.Context, postID, parentID int, order string, after Cursor, limit int) ([]models.Comment, error)
+	// CountByPost counts the live comments, replies included, on each post.
+	// Posts without comments are missing from the map.
+	CountByPost(ctx context.Context, postIDs []int) (map[int]int, error)
+	// Thread returns the replies to parentID on the post (the top-level
+	// comments when parentID is 0) and their descendants down to depth
+	// levels, as a flat list oldest first with ReplyCount set.
+	Thread(ctx context.Context, postID, parentID, depth int) ([]models.Comment, error)
+	// Update returns ErrNotFound for tombstones.
+	Update(ctx context.Context, id int, content string) error
+	// Delete removes the comment, or turns it into a tombstone if it still
+	// has replies. Tombstones left without replies are removed as well.
+	Delete(ctx context.Context, id int) error
+	// Count counts live comments.
+	Count(ctx context.Context) (int, error)
+}
+
+// VerificationStore persists pending email verification codes, at most one
+// per email address.
+type VerificationStore interface {
+	// Save stores the verification, replacing any pending one for the same
+	// email and resetting its attempt counter.
+	Save(ctx context.Context, v *models.Verification) error
+	// Get returns the pending verification for email, or ErrNotFound.
+	Get(ctx context.Context, email string) (*models.Verification, error)
+	// IncrementAttempts records a failed attempt and returns the new count.
+	IncrementAttempts(ctx context.Context, email string) (int, error)
+	Delete(ctx context.Context, email string) error
+}
+
+// SessionStore persists login sessions and their current refresh token hash.
+type SessionStore interface {
+	Create(ctx context.Context, session *models.Session) error
+	GetByID(ctx context.Context, id string) (*models.Session, error)
+	// Rotate swaps the refresh token hash of an active session, but only if
+	// the stored hash still equals oldHash. It returns ErrConflict when the
+	// hash has already been rotated or the session is revoked.
+	Rotate(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error
+	// ListForUser returns the sessions of the user that are active at now,
+	// most recently used first.
+	ListForUser(ctx context.Context, userID int, now time.Time) ([]models.Session, error)
+	// Touch records that the session was used at the given time from ip;
+	// an empty ip keeps the stored one.
+	Touch(ctx context.Context, id, ip string, at time.Time) error
+	Revoke(ctx context.Context, id string) error
+	// RevokeAllForUser revokes every active session of the user.
+	RevokeAllForUser(ctx context.Context, userID int) error
+}
+
+// RevokedTokenStore is a denylist of access token IDs (the jti claim).
+type RevokedTokenStore interface {
+	Add(ctx context.Context, jti string, userID int, expiresAt time.Time) error
+	Contains(ctx context.Context, jti string) (bool, error)
+	// DeleteExpired drops entries whose token would have expired anyway.
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// AuthTokenStore persists single-use tokens sent by email, such as password
+// reset and login links, by hash. A token is only accepted for the purpose
+// it was created with (models.TokenPurpose*).
+type AuthTokenStore interface {
+	Create(ctx context.Context, purpose string, userID int, tokenHash string, expiresAt time.Time) error
+	// Lookup returns the user an unused, unexpired token of the given
+	// purpose belongs to without using it up, or ErrNotFound.
+	Lookup(ctx context.Context, purpose, tokenHash string, now time.Time) (int, error)
+	// Consume marks an unused, unexpired token of the given purpose as used
+	// and returns the user it belongs to, or ErrNotFound.
+	Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (int, error)
+	// InvalidateForUser marks every outstanding token of the user with the
+	// given purpose as used.
+	InvalidateForUser(ctx context.Context, purpose string, userID int) error
+}
+
+// TOTPStore persists TOTP secrets and recovery codes.
+type TOTPStore interface {
+	// SavePending stores a new, not yet enabled secret, replacing a pending
+	// one. It returns ErrConflict if two-factor authentication is enabled.
+	SavePending(ctx context.Context, userID int, secret string) error
+	// Get returns the user's secret, pending or enabled, or ErrNotFound.
+	Get(ctx context.Context, userID int) (*models.TOTP, error)
+	// Enable confirms a pending secret.
+	Enable(ctx context.Context, userID int, step int64) error
+	// UseStep records that the code for step was accepted. It returns
+	// ErrConflict if that step or a later one was already used.
+	UseStep(ctx context.Context, userID int, step int64) error
+	// Delete removes the secret together with all recovery codes.
+	Delete(ctx context.Context, userID int) error
+
+	// ReplaceRecoveryCodes discards existing recovery codes and stores the
+	// given hashes.
+	ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error
+	// UseRecoveryCode marks an unused recovery code as used, or returns
+	// ErrNotFound.
+	UseRecoveryCode(ctx context.Context, userID int, hash string) error
+	// CountRecoveryCodes returns the number of unused recovery codes.
+	CountRecoveryCodes(ctx context.Context, userID int) (int, error)
+}
+
+// MFAChallengeStore persists pending second-factor login challenges.
+type MFAChallengeStore interface {
+	Create(ctx context.Context, c *models.MFAChallenge) error
+	// Get returns the challenge with the given token hash, or ErrNotFound.
+	Get(ctx context.Context, tokenHash string) (*models.MFAChallenge, error)
+	// IncrementAttempts records a failed code and returns the new count.
+	IncrementAttempts(ctx context.Context, tokenHash string) (int, error)
+	Delete(ctx context.Context, tokenHash string) error
+}
+
+// AccessTokenStore persists personal access tokens.
+type AccessTokenStore interface {
+	// Create inserts the token and fills in its ID and CreatedAt.
+	Create(ctx context.Context, t *models.PersonalAccessToken) error
+	// GetByHash returns the token with the given hash, or ErrNotFound.
+	GetByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error)
+	// ListForUser returns the user's tokens, newest first, including revoked
+	// and expired ones.
+	ListForUser(ctx context.Context, userID int) ([]models.PersonalAccessToken, error)
+	// Revoke revokes a token owned by userID, or returns ErrNotFound.
+	Revoke(ctx context.Context, id, userID int) error
+	// RevokeAllForUser revokes every token of the user.
+	RevokeAllForUser(ctx context.Context, userID int) error
+	// Touch records when the token was last used.
+	Touch(ctx context.Context, id int, at time.Time) error
+}
+
+// RoleStore persists the role permission matrix.
+type RoleStore interface {
+	// Permissions returns the permissions granted to each role. Every role
+	// is present, possibly with no permissions.
+	Permissions(ctx context.Context) (map[string][]string, error)
+	// Grant adds the permission to the role; granting twice is not an error.
+	Grant(ctx context.Context, role, permission string) error
+	// Revoke removes the permission from the role; revoking a permission
+	// the role does not have is not an error.
+	Revoke(ctx context.Context, role, permission string) error
+}
+
+// OAuthStore persists pending OpenID Connect logins and the external
+// identities linked to users.
+type OAuthStore interface {
+	CreateState(ctx context.Context, state *models.OAuthState) error
+	// ConsumeState deletes the state with the given hash and returns it. It
+	// returns ErrNotFound if the state does not exist or has expired.
+	ConsumeState(ctx context.Context, stateHash string, now time.Time) (*models.OAuthState, error)
+	// GetIdentity returns the identity of subject at provider, or ErrNotFound.
+	GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error)
+	// CreateIdentity inserts the identity and fills in its ID and CreatedAt.
+	// It returns ErrConflict if the subject is already linked.
+	CreateIdentity(ctx context.Context, identity *models.Identity) error
+}
+
+// LoginFailureStore tracks failed password logins per account.
+type LoginFailureStore interface {
+	// Get returns the failures of the user, or ErrNotFound if there are
+	// none since the last successful login.
+	Get(ctx context.Context, userID int) (*models.LoginFailures, error)
+	// RecordFailure counts a failed login at the given time and returns the
+	// updated record. Failures older than forgetBefore are not counted.
+	RecordFailure(ctx context.Context, userID int, at, forgetBefore time.Time) (*models.LoginFailures, error)
+	// Lock rejects logins of the user until the given time.
+	Lock(ctx context.Context, userID int, until time.Time) error
+	// Reset forgets the failures and lifts a lock.
+	Reset(ctx context.Context, userID int) error
+}
+
+// ImpersonationAuditStore is the append-only audit log of admin
+// impersonation.
+type ImpersonationAuditStore interface {
+	// Record appends the event and fills in its ID and CreatedAt.
+	Record(ctx context.Context, event *models.ImpersonationEvent) error
+	// List returns the latest events, newest first.
+	List(ctx context.Context, limit int) ([]models.ImpersonationEvent, error)
+}
+
+// InviteStore persists registration invite codes and the accounts created
+// with them.
+type InviteStore interface {
+	// Create inserts the invite and fills in its ID and CreatedAt.
+	Create(ctx context.Context, invite *models.Invite) error
+	// List returns every invite, newest first, including used up, expired
+	// and revoked ones.
+	List(ctx context.Context) ([]models.Invite, error)
+	// GetByHash returns the invite with the given code hash, or ErrNotFound.
+	GetByHash(ctx context.Context, hash string) (*models.Invite, error)
+	// Redeem uses the invite for userID if it is still usable at now, or
+	// returns ErrNotFound. Uses are counted atomically, so a single-use code
+	// registers one account even under concurrent requests.
+	Redeem(ctx context.Context, hash string, userID int, now time.Time) (*models.Invite, error)
+	// Revoke stops the invite from registering more accounts.
+	Revoke(ctx context.Context, id int) error
+	// Redemptions returns the accounts registered with the invite, oldest
+	// first.
+	Redemptions(ctx context.Context, inviteID int) ([]models.InviteRedemption, error)
+}
+
+// FollowStore persists the follow graph.
+type FollowStore interface {
+	// Follow makes followerID follow followeeID. Following an account
+	// twice is not an error; an unknown account is ErrNotFound.
+	Follow(ctx context.Context, followerID, followeeID int) error
+	// Unfollow removes the relationship, or returns ErrNotFound.
+	Unfollow(ctx context.Context, followerID, followeeID int) error
+	IsFollowing(ctx context.Context, followerID, followeeID int) (bool, error)
+	Counts(ctx context.Context, userID int) (models.FollowCounts, error)
+	// Followers returns up to limit accounts following userID, most recent
+	// follow first, starting after the cursor. The cursor ID is the
+	// follower's user ID.
+	Followers(ctx context.Context, userID int, after Cursor, limit int) ([]models.FollowUser, error)
+	// Following returns up to limit accounts userID follows, most recent
+	// follow first, starting after the cursor. The cursor ID is the
+	// followee's user ID.
+	Following(ctx context.Context, userID int, after Cursor, limit int) ([]models.FollowUser, error)
+	// FollowerIDs returns the IDs of every account following userID.
+	FollowerIDs(ctx context.Context, userID int) ([]int, error)
+	// PopularFollowing returns the IDs of the accounts userID follows that
+	// have at least minFollowers followers.
+	PopularFollowing(ctx context.Context, userID, minFollowers int) ([]int, error)
+}
+
+// TimelineStore persists materialized home timelines: for each user, the
+// posts pushed to them by fan-out on write.
+type TimelineStore interface {
+	// Push adds each entry's post to its user's timeline. Entries already
+	// there and posts deleted in the meantime are skipped.
+	Push(ctx context.Context, entries []models.TimelineEntry) error
+	// Page returns up to limit posts from the user's timeline, newest first,
+	// starting after the cursor, joined with their author's username.
+	Page(ctx context.Context, userID int, after Cursor, limit int) ([]models.Post, error)
+	// RemoveAuthor drops the posts of authorID from the user's timeline.
+	RemoveAuthor(ctx context.Context, userID, authorID int) error
+	// Trim keeps only the newest keep entries of the user's timeline.
+	Trim(ctx context.Context, userID, keep int) error
+	// Replace swaps the user's timeline for the given posts and marks it
+	// built. Entries newer than the newest of postIDs are kept: they were
+	// pushed after the caller read its posts, and Replace would otherwise
+	// lose them.
+	Replace(ctx context.Context, userID int, postIDs []int) error
+	// Built reports whether the user's timeline has been built by Replace.
+	Built(ctx context.Context, userID int) (bool, error)
+}
+
+// ReactionStore persists reactions to posts and comments. targetType is
+// models.ReactionTargetPost or models.ReactionTargetComment.
+type ReactionStore interface {
+	// Add stores the reaction and fills in its CreatedAt. It returns
+	// ErrConflict if the user already added this reaction to the item and
+	// ErrNotFound if the item or user does not exist.
+	Add(ctx context.Context, reaction *models.Reaction) error
+	// Remove deletes the user's reaction to the item, or returns
+	// ErrNotFound.
+	Remove(ctx context.Context, targetType string, targetID, userID int, reaction string) error
+	// Summaries aggregates the reactions to the given items; viewerID's own
+	// reactions are listed in Mine. Items without reactions are missing
+	// from the result.
+	Summaries(ctx context.Context, targetType string, targetIDs []int, viewerID int) (map[int]*models.ReactionSummary, error)
+	// List returns up to limit users who added the reaction to the item,
+	// most recent first, starting after the cursor. The cursor ID is the
+	// user ID.
+	List(ctx context.Context, targetType string, targetID int, reaction string, after Cursor, limit int) ([]models.Reaction, error)
+}
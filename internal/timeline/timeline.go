@@ -0,0 +1,337 @@
+// Package timeline materializes home timelines with fan-out on write.
+//
+// When a post is created, its ID is pushed in the background to the
+// timelines of the author and of every follower. Accounts with more
+// followers than Config.FanoutLimit are not pushed; their posts are pulled
+// at read time and merged in. Timelines that grew are trimmed to their newest
+// Config.MaxEntries posts every TrimInterval, and older pages, like
+// timelines that have not been built yet, are served by the pull query.
+package timeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pinokiochan/social-network-render/internal/logger"
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultFanoutLimit is the follower count above which posts are
+	// pulled instead of pushed.
+	DefaultFanoutLimit = 10000
+	// DefaultMaxEntries is how many posts a materialized timeline keeps.
+	DefaultMaxEntries = 800
+
+	// pushBatchSize bounds the number of rows one fan-out insert writes.
+	pushBatchSize = 1000
+	// backgroundTimeout bounds a single background fan-out or rebuild.
+	backgroundTimeout = 5 * time.Minute
+
+	// TrimInterval is how often RunTrimmer trims the timelines that grew.
+	TrimInterval = time.Minute
+)
+
+// Config tunes the hybrid push/pull timeline.
+type Config struct {
+	// FanoutLimit: authors with more followers are not fanned out to their
+	// followers, whose feeds pull their posts instead.
+	FanoutLimit int
+	// MaxEntries is the number of newest posts kept per timeline.
+	MaxEntries int
+}
+
+// ConfigFromEnv reads TIMELINE_FANOUT_LIMIT and TIMELINE_MAX_ENTRIES.
+func ConfigFromEnv() (Config, error) {
+	config := Config{FanoutLimit: DefaultFanoutLimit, MaxEntries: DefaultMaxEntries}
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"TIMELINE_FANOUT_LIMIT", &config.FanoutLimit},
+		{"TIMELINE_MAX_ENTRIES", &config.MaxEntries},
+	} {
+		s := os.Getenv(setting.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return config, fmt.Errorf("%s must be a positive integer, got %q", setting.name, s)
+		}
+		*setting.value = n
+	}
+	return config, nil
+}
+
+// Service keeps materialized timelines up to date and serves home feeds.
+type Service struct {
+	store  *store.Store
+	config Config
+	// wg, if not nil, lets shutdown and tests wait for background work.
+	wg *sync.WaitGroup
+
+	mu sync.Mutex
+	// building holds the users whose timeline this process is building.
+	building map[int]bool
+	// grown holds the users whose timeline got posts since the last trim.
+	grown map[int]bool
+}
+
+func NewService(s *store.Store, config Config, wg *sync.WaitGroup) *Service {
+	return &Service{
+		store:    s,
+		config:   config,
+		wg:       wg,
+		building: make(map[int]bool),
+		grown:    make(map[int]bool),
+	}
+}
+
+// background runs fn in a goroutine tracked by wg and logs its error.
+func (s *Service) background(action string, fields logrus.Fields, fn func(ctx context.Context) error) {
+	if s.wg != nil {
+		s.wg.Add(1)
+	}
+	go func() {
+		if s.wg != nil {
+			defer s.wg.Done()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTimeout)
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			fields["error"] = err.Error()
+			logger.Log.WithFields(fields).Error("Failed to " + action)
+		}
+	}()
+}
+
+// PostCreated pushes a new post to the timelines of its author and, unless
+// the author is over the fan-out limit, of their followers.
+func (s *Service) PostCreated(post models.Post) {
+	s.background("fan out post", logrus.Fields{"postID": post.ID, "userID": post.UserID}, func(ctx context.Context) error {
+		return s.fanOut(ctx, post)
+	})
+}
+
+func (s *Service) fanOut(ctx context.Context, post models.Post) error {
+	recipients := []int{post.UserID}
+	// The count comes first so that the IDs of a popular account's
+	// followers, who pull its posts anyway, are never loaded.
+	counts, err := s.store.Follows.Counts(ctx, post.UserID)
+	if err != nil {
+		return err
+	}
+	if counts.Followers <= s.config.FanoutLimit {
+		followers, err := s.store.Follows.FollowerIDs(ctx, post.UserID)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, followers...)
+	}
+
+	for start := 0; start < len(recipients); start += pushBatchSize {
+		end := start + pushBatchSize
+		if end > len(recipients) {
+			end = len(recipients)
+		}
+		entries := make([]models.TimelineEntry, 0, end-start)
+		for _, userID := range recipients[start:end] {
+			entries = append(entries, models.TimelineEntry{UserID: userID, PostID: post.ID})
+		}
+		if err := s.store.Timelines.Push(ctx, entries); err != nil {
+			return err
+		}
+	}
+	s.markGrown(recipients...)
+
+	logger.Log.WithFields(logrus.Fields{
+		"postID":     post.ID,
+		"recipients": len(recipients),
+		"followers":  counts.Followers,
+	}).Debug("Post fanned out")
+	return nil
+}
+
+// Followed backfills the newest posts of followeeID into the follower's
+// timeline in the background. Posts of accounts over the fan-out limit are
+// pulled at read time instead.
+func (s *Service) Followed(followerID, followeeID int) {
+	s.background("backfill timeline", logrus.Fields{"userID": followerID, "followeeID": followeeID}, func(ctx context.Context) error {
+		built, err := s.store.Timelines.Built(ctx, followerID)
+		if err != nil || !built {
+			// An unbuilt timeline gets everything when it is built.
+			return err
+		}
+		counts, err := s.store.Follows.Counts(ctx, followeeID)
+		if err != nil || counts.Followers > s.config.FanoutLimit {
+			return err
+		}
+		posts, err := s.store.Posts.ByAuthors(ctx, []int{followeeID}, store.Cursor{}, s.config.MaxEntries)
+		if err != nil {
+			return err
+		}
+		entries := make([]models.TimelineEntry, len(posts))
+		for i, p := range posts {
+			entries[i] = models.TimelineEntry{UserID: followerID, PostID: p.ID}
+		}
+		if err := s.store.Timelines.Push(ctx, entries); err != nil {
+			return err
+		}
+		s.markGrown(followerID)
+		return nil
+	})
+}
+
+func (s *Service) markGrown(userIDs ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range userIDs {
+		s.grown[id] = true
+	}
+}
+
+// Trim cuts the timelines that got posts since the last call down to their
+// newest MaxEntries posts.
+func (s *Service) Trim(ctx context.Context) error {
+	s.mu.Lock()
+	grown := s.grown
+	s.grown = make(map[int]bool)
+	s.mu.Unlock()
+
+	for userID := range grown {
+		if err := s.store.Timelines.Trim(ctx, userID, s.config.MaxEntries); err != nil {
+			// The ones not trimmed yet are left for the next call.
+			for id := range grown {
+				s.markGrown(id)
+			}
+			return err
+		}
+		delete(grown, userID)
+	}
+	return nil
+}
+
+// RunTrimmer calls Trim every TrimInterval until ctx is done.
+func (s *Service) RunTrimmer(ctx context.Context) {
+	ticker := time.NewTicker(TrimInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Trim(ctx); err != nil && ctx.Err() == nil {
+				logger.Log.WithFields(logrus.Fields{
+					"error": err.Error(),
+				}).Error("Failed to trim timelines")
+			}
+		}
+	}
+}
+
+// Unfollowed removes the posts of followeeID from the follower's timeline.
+// It runs synchronously so the next feed request no longer shows them.
+func (s *Service) Unfollowed(ctx context.Context, followerID, followeeID int) error {
+	return s.store.Timelines.RemoveAuthor(ctx, followerID, followeeID)
+}
+
+// Rebuild replaces the user's timeline with the newest MaxEntries posts of
+// the user and the accounts they follow, as computed by the pull query.
+func (s *Service) Rebuild(ctx context.Context, userID int) error {
+	posts, err := s.store.Posts.Home(ctx, userID, store.Cursor{}, s.config.MaxEntries)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	return s.store.Timelines.Replace(ctx, userID, ids)
+}
+
+// build rebuilds the user's timeline in the background unless this process
+// is already doing so, so concurrent first reads start a single rebuild.
+func (s *Service) build(userID int) {
+	s.mu.Lock()
+	if s.building[userID] {
+		s.mu.Unlock()
+		return
+	}
+	s.building[userID] = true
+	s.mu.Unlock()
+
+	s.background("build timeline", logrus.Fields{"userID": userID}, func(ctx context.Context) error {
+		defer func() {
+			s.mu.Lock()
+			delete(s.building, userID)
+			s.mu.Unlock()
+		}()
+		return s.Rebuild(ctx, userID)
+	})
+}
+
+// Home returns up to limit posts of the user's home feed, newest first,
+// starting after the cursor.
+func (s *Service) Home(ctx context.Context, userID int, after store.Cursor, limit int) ([]models.Post, error) {
+	built, err := s.store.Timelines.Built(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !built {
+		s.build(userID)
+		return s.store.Posts.Home(ctx, userID, after, limit)
+	}
+
+	posts, err := s.store.Timelines.Page(ctx, userID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) < limit {
+		// Past the oldest materialized entry: the rest of the feed, if any,
+		// has been trimmed away.
+		return s.store.Posts.Home(ctx, userID, after, limit)
+	}
+	popular, err := s.store.Follows.PopularFollowing(ctx, userID, s.config.FanoutLimit+1)
+	if err != nil || len(popular) == 0 {
+		return posts, err
+	}
+	pulled, err := s.store.Posts.ByAuthors(ctx, popular, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return merge(posts, pulled, limit), nil
+}
+
+// merge combines two newest-first lists into one of at most limit posts,
+// dropping duplicates.
+func merge(a, b []models.Post, limit int) []models.Post {
+	merged := make([]models.Post, 0, limit)
+	seen := make(map[int]bool, limit)
+	for len(merged) < limit && (len(a) > 0 || len(b) > 0) {
+		var next models.Post
+		if len(b) == 0 || (len(a) > 0 && newer(a[0], b[0])) {
+			next, a = a[0], a[1:]
+		} else {
+			next, b = b[0], b[1:]
+		}
+		if !seen[next.ID] {
+			seen[next.ID] = true
+			merged = append(merged, next)
+		}
+	}
+	return merged
+}
+
+func newer(a, b models.Post) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
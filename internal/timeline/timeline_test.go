@@ -0,0 +1,200 @@
+package timeline_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pinokiochan/social-network-render/internal/models"
+	"github.com/pinokiochan/social-network-render/internal/store"
+	"github.com/pinokiochan/social-network-render/internal/store/memory"
+	"github.com/pinokiochan/social-network-render/internal/timeline"
+)
+
+func contents(posts []models.Post) string {
+	var c []string
+	for _, p := range posts {
+		c = append(c, p.Content)
+	}
+	return fmt.Sprint(c)
+}
+
+func createPost(t *testing.T, st *store.Store, s *timeline.Service, userID int, content string) models.Post {
+	t.Helper()
+	post := models.Post{UserID: userID, Content: content}
+	if err := st.Posts.Create(context.Background(), &post); err != nil {
+		t.Fatalf("Create post: %v", err)
+	}
+	s.PostCreated(post)
+	return post
+}
+
+func TestFanOutAndPopularPull(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	var users []*models.User
+	for _, name := range []string{"reader", "friend", "celebrity", "fan"} {
+		u := models.NewUser(name, name+"@example.com", "hash")
+		st.Users.Create(ctx, u)
+		users = append(users, u)
+	}
+	reader, friend, celebrity, fan := users[0], users[1], users[2], users[3]
+	st.Follows.Follow(ctx, reader.ID, friend.ID)
+	st.Follows.Follow(ctx, reader.ID, celebrity.ID)
+	st.Follows.Follow(ctx, fan.ID, celebrity.ID)
+
+	var wg sync.WaitGroup
+	s := timeline.NewService(st, timeline.Config{FanoutLimit: 1, MaxEntries: 3}, &wg)
+	if err := s.Rebuild(ctx, reader.ID); err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+
+	createPost(t, st, s, friend.ID, "friend 1")
+	createPost(t, st, s, celebrity.ID, "celebrity 1")
+	deleted := createPost(t, st, s, friend.ID, "friend 2")
+	createPost(t, st, s, reader.ID, "own")
+	wg.Wait()
+
+	// The celebrity has two followers, over the limit, so only the author's
+	// own timeline got the post.
+	materialized, _ := st.Timelines.Page(ctx, reader.ID, store.Cursor{}, 10)
+	if got := contents(materialized); got != "[own friend 2 friend 1]" {
+		t.Errorf("materialized timeline = %s", got)
+	}
+
+	feed, err := s.Home(ctx, reader.ID, store.Cursor{}, 3)
+	if err != nil {
+		t.Fatalf("Home: %v", err)
+	}
+	if got := contents(feed); got != "[own friend 2 celebrity 1]" {
+		t.Errorf("first page = %s", got)
+	}
+	last := feed[len(feed)-1]
+	feed, _ = s.Home(ctx, reader.ID, store.Cursor{Time: last.CreatedAt, ID: last.ID}, 3)
+	if got := contents(feed); got != "[friend 1]" {
+		t.Errorf("second page = %s", got)
+	}
+
+	st.Posts.Delete(ctx, deleted.ID)
+	materialized, _ = st.Timelines.Page(ctx, reader.ID, store.Cursor{}, 10)
+	if got := contents(materialized); got != "[own friend 1]" {
+		t.Errorf("deleted post still on the timeline: %s", got)
+	}
+
+	if err := s.Unfollowed(ctx, reader.ID, friend.ID); err != nil {
+		t.Fatalf("Unfollowed: %v", err)
+	}
+	materialized, _ = st.Timelines.Page(ctx, reader.ID, store.Cursor{}, 10)
+	if got := contents(materialized); got != "[own]" {
+		t.Errorf("unfollowed posts still on the timeline: %s", got)
+	}
+}
+
+func TestTrimmedTimelineFallsBackToPull(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	reader := models.NewUser("reader", "reader@example.com", "hash")
+	friend := models.NewUser("friend", "friend@example.com", "hash")
+	st.Users.Create(ctx, reader)
+	st.Users.Create(ctx, friend)
+	st.Follows.Follow(ctx, reader.ID, friend.ID)
+
+	var wg sync.WaitGroup
+	s := timeline.NewService(st, timeline.Config{FanoutLimit: 10, MaxEntries: 2}, &wg)
+	for i := 0; i < 5; i++ {
+		createPost(t, st, s, friend.ID, fmt.Sprintf("post %d", i))
+	}
+	wg.Wait()
+
+	// Not built yet: served by the pull query while it is built.
+	feed, _ := s.Home(ctx, reader.ID, store.Cursor{}, 2)
+	wg.Wait()
+	if built, _ := st.Timelines.Built(ctx, reader.ID); !built {
+		t.Fatalf("timeline was not built on first read")
+	}
+
+	var all []models.Post
+	for len(feed) > 0 {
+		all = append(all, feed...)
+		last := feed[len(feed)-1]
+		feed, _ = s.Home(ctx, reader.ID, store.Cursor{Time: last.CreatedAt, ID: last.ID}, 2)
+	}
+	if got := contents(all); got != "[post 4 post 3 post 2 post 1 post 0]" {
+		t.Errorf("feed = %s", got)
+	}
+	wg.Wait()
+	if materialized, _ := st.Timelines.Page(ctx, reader.ID, store.Cursor{}, 10); len(materialized) != 2 {
+		t.Errorf("timeline kept %d entries, want 2", len(materialized))
+	}
+}
+
+func TestReplaceKeepsEntriesPushedAfterTheSnapshot(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	reader := models.NewUser("reader", "reader@example.com", "hash")
+	friend := models.NewUser("friend", "friend@example.com", "hash")
+	st.Users.Create(ctx, reader)
+	st.Users.Create(ctx, friend)
+	st.Follows.Follow(ctx, reader.ID, friend.ID)
+
+	old := models.Post{UserID: friend.ID, Content: "old"}
+	st.Posts.Create(ctx, &old)
+	// A rebuild reads its snapshot, then a fan-out lands before Replace.
+	snapshot, err := st.Posts.Home(ctx, reader.ID, store.Cursor{}, 10)
+	if err != nil {
+		t.Fatalf("Home: %v", err)
+	}
+	fresh := models.Post{UserID: friend.ID, Content: "fresh"}
+	st.Posts.Create(ctx, &fresh)
+	st.Timelines.Push(ctx, []models.TimelineEntry{{UserID: reader.ID, PostID: fresh.ID}})
+
+	ids := make([]int, len(snapshot))
+	for i, p := range snapshot {
+		ids[i] = p.ID
+	}
+	if err := st.Timelines.Replace(ctx, reader.ID, ids); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	page, err := st.Timelines.Page(ctx, reader.ID, store.Cursor{}, 10)
+	if err != nil {
+		t.Fatalf("Page: %v", err)
+	}
+	if got := contents(page); got != "[fresh old]" {
+		t.Errorf("timeline = %s, want [fresh old]", got)
+	}
+}
+
+func TestTrimCutsGrownTimelines(t *testing.T) {
+	ctx := context.Background()
+	st := memory.New()
+	reader := models.NewUser("reader", "reader@example.com", "hash")
+	friend := models.NewUser("friend", "friend@example.com", "hash")
+	st.Users.Create(ctx, reader)
+	st.Users.Create(ctx, friend)
+	st.Follows.Follow(ctx, reader.ID, friend.ID)
+
+	var wg sync.WaitGroup
+	s := timeline.NewService(st, timeline.Config{FanoutLimit: 10, MaxEntries: 2}, &wg)
+	if err := s.Rebuild(ctx, reader.ID); err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		createPost(t, st, s, friend.ID, fmt.Sprintf("post %d", i))
+	}
+	wg.Wait()
+
+	// Reads do not trim; the trimmer does.
+	s.Home(ctx, reader.ID, store.Cursor{}, 2)
+	wg.Wait()
+	if materialized, _ := st.Timelines.Page(ctx, reader.ID, store.Cursor{}, 10); len(materialized) != 4 {
+		t.Fatalf("timeline has %d entries before Trim, want 4", len(materialized))
+	}
+	if err := s.Trim(ctx); err != nil {
+		t.Fatalf("Trim: %v", err)
+	}
+	materialized, _ := st.Timelines.Page(ctx, reader.ID, store.Cursor{}, 10)
+	if got := contents(materialized); got != "[post 3 post 2]" {
+		t.Errorf("trimmed timeline = %s, want [post 3 post 2]", got)
+	}
+}
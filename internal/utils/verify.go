@@ -1,10 +1,17 @@
 package utils
 
 import (
-	"math/rand"
+	"crypto/rand"
+	"math/big"
+	"strconv"
 )
 
-// GenerateCode generates a random 4-digit code for user verification.
-func GenerateCode() int {
-	return rand.Intn(9000) + 1000
+// GenerateCode generates a random 6-digit code for user verification.
+// The first digit is never zero so clients may send the code as a number.
+func GenerateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(n.Int64()+100000, 10), nil
 }
@@ -77,6 +77,18 @@ class AdminAPI {
             body: JSON.stringify({ id: userId, username, email })
         });
     }
+    static async setUserRole(userId, role) {
+        return this.fetchWithAuth(`/api/admin/users/role`, {
+            method: 'POST',
+            body: JSON.stringify({ id: userId, role })
+        });
+    }
+    static async impersonate(userId, readOnly) {
+        return this.fetchWithAuth(`/api/admin/users/impersonate?id=${userId}`, {
+            method: 'POST',
+            body: JSON.stringify({ read_only: readOnly })
+        });
+    }
     static async sendBroadcastEmail(recipient, subject, body) {
         return this.fetchWithAuth('/api/admin/broadcast', {
             method: 'POST',
@@ -150,7 +162,7 @@ async function loadUsersList(filters = {}, sortBy = null) {
         const usersList = document.getElementById('users-list');
         usersList.innerHTML = filteredUsers.map(user => `
         <div class="user-item">
-        <span>${user.username} (${user.email})</span>
+        <span>${user.username} (${user.email}) — ${user.role || 'user'}</span>
         <div class="user-actions">
             <button onclick="editUser(${user.id})" class="edit-btn">
                <i class="fas fa-edit"></i> 
@@ -158,6 +170,9 @@ async function loadUsersList(filters = {}, sortBy = null) {
             <button onclick="deleteUser(${user.id})" class="delete-btn">
                <i class="fas fa-trash-alt"></i> 
             </button>
+            <button onclick="impersonateUser(${user.id})" class="edit-btn" title="View as this user">
+               <i class="fas fa-user-secret"></i>
+            </button>
         </div>
     </div>
     
@@ -223,6 +238,19 @@ async function editUser(userId) {
             showError('Failed to update user');
         }
     }
+
+    // Роль меняется отдельно; пустой ввод оставляет роль без изменений
+    const role = prompt('Enter new role (user, moderator, admin, superadmin) or leave empty:');
+    if (role) {
+        try {
+            await AdminAPI.setUserRole(userId, role.trim().toLowerCase());
+            alert('Role updated successfully');
+            loadUsersList();
+        } catch (error) {
+            console.error('Error changing role:', error);
+            showError('Failed to change role');
+        }
+    }
 }
 
 
@@ -250,8 +278,13 @@ async function handleAdminLogin(event) {
             throw new Error('Login failed');
         }
 
-        const { token } = await response.json();
-        AdminAuth.setToken(token);
+        let data = await response.json();
+        // Администраторы входят со вторым фактором
+        if (data.mfa_required) {
+            data = await completeAdminTwoFactorLogin(data.challenge_token);
+        }
+
+        AdminAuth.setToken(data.token);
         showAdminContent();
     } catch (error) {
         console.error('Login error:', error);
@@ -259,6 +292,28 @@ async function handleAdminLogin(event) {
     }
 }
 
+async function completeAdminTwoFactorLogin(challengeToken) {
+    const input = prompt('Enter the 6-digit code from your authenticator app or a recovery code:');
+    if (!input) {
+        throw new Error('Two-factor authentication cancelled');
+    }
+
+    const value = input.trim();
+    const body = /^\d{6}$/.test(value)
+        ? { challenge_token: challengeToken, code: value }
+        : { challenge_token: challengeToken, recovery_code: value };
+
+    const response = await fetch('/api/login/2fa', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(body)
+    });
+    if (!response.ok) {
+        throw new Error('Two-factor authentication failed');
+    }
+    return response.json();
+}
+
 // UI Management: Функция для обработки отправки рассылки
 async function handleBroadcastEmail(event) {
     event.preventDefault();
@@ -322,6 +377,22 @@ async function deleteUser(userId) {
     }
 }
 
+// Открывает сайт от имени пользователя. Токен имперсонации живет 10 минут
+// и не обновляется; по умолчанию он только для чтения.
+async function impersonateUser(userId) {
+    const readOnly = !confirm('Allow changes on behalf of this user? Cancel opens a read-only view.');
+    try {
+        const data = await AdminAPI.impersonate(userId, readOnly);
+        localStorage.removeItem('refreshToken');
+        localStorage.removeItem('currentUser');
+        localStorage.setItem('token', data.token);
+        window.open('/index', '_blank');
+    } catch (error) {
+        console.error('Error starting impersonation:', error);
+        showError('Failed to impersonate user');
+    }
+}
+
 function handleLogout() {
     AdminAuth.removeToken();
     showLoginForm();
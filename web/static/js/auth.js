@@ -5,12 +5,13 @@ async function register(event) {
     const username = document.getElementById('register-username').value;
     const email = document.getElementById('register-email').value;
     const password = document.getElementById('register-password').value;
+    const invite_code = document.getElementById('register-invite').value.trim();
 
     try {
         const response = await fetch('/api/register', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ username, email, password })
+            body: JSON.stringify({ username, email, password, invite_code })
         });
         
 
@@ -23,11 +24,16 @@ async function register(event) {
             verifyBlock.innerHTML = `
             <h2>Please, verify your email:
             <input id="code" type="text" name="code" placeholder="Enter your verifying code">
-            <button type="Submit" onClick="SendVerificationEmail()">Send verification code</button>`
+            <button type="Submit" onClick="SendVerificationEmail()">Send verification code</button>
+            <button type="button" onClick="ResendVerificationCode()">Resend code</button>`
             alert('Registration successful.');
             
+        } else if (response.status === 403) {
+            // Нужен код приглашения или адрес разрешенного домена
+            alert(await response.text());
         } else {
-            alert('Registration failed. Please try again.');
+            const policyError = await passwordPolicyError(response);
+            alert(policyError || 'Registration failed. Please try again.');
         }
 
     } catch (error) {
@@ -48,8 +54,7 @@ async function SendVerificationEmail(event) {
         return;
     }
 
-    code = Number(code);
-    console.log(email, code)
+    code = code.trim();
     try {
         const response = await fetch('/api/verify', {
             method: 'POST',
@@ -63,8 +68,8 @@ async function SendVerificationEmail(event) {
         
             // Handle additional steps if needed (e.g., update the UI)
         } else {
-            const error = await response.json();
-            alert('Failed to send verification code: ' + error.message);
+            const error = await response.text();
+            alert('Failed to verify code: ' + error);
         }
     } catch (error) {
         console.error('Error:', error);
@@ -72,6 +77,26 @@ async function SendVerificationEmail(event) {
     }
 }
 
+async function ResendVerificationCode() {
+    const email = document.getElementById('register-email').value;
+
+    try {
+        const response = await fetch('/api/verify/resend', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email })
+        });
+
+        if (response.ok) {
+            alert('A new verification code has been sent.');
+        } else {
+            alert(await response.text());
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
 // document.addEventListener('DOMContentLoaded', sendVerificationEmail);
 
 async function login(event) {
@@ -82,7 +107,7 @@ async function login(event) {
     try {
         const response = await fetch('/api/login', {
             method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
+            headers: { 'Content-Type': 'application/json', ...SESSION_MODE_HEADERS },
             body: JSON.stringify({ email, password })
         });
 
@@ -94,9 +119,16 @@ async function login(event) {
                 return;
             }
 
-            localStorage.setItem('token', data.token);
-            localStorage.setItem('currentUser', JSON.stringify({ id: data.user_id, email }));
-            window.location.href = '/index'; // Redirect to the main page
+            if (data.mfa_required) {
+                await completeTwoFactorLogin(data.challenge_token, email);
+                return;
+            }
+
+            finishLogin(data, email);
+        } else if (response.status === 429) {
+            // После нескольких неудачных попыток сервер просит подождать
+            const retryAfter = response.headers.get('Retry-After');
+            alert(`Too many failed login attempts. Please try again in ${retryAfter || 'a few'} seconds.`);
         } else {
             alert('Login failed. Please try again.');
         }
@@ -105,6 +137,230 @@ async function login(event) {
     }
 }
 
+async function forgotPassword(event) {
+    event.preventDefault();
+    const email = document.getElementById('forgot-email').value;
+
+    try {
+        const response = await fetch('/api/password/forgot', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email })
+        });
+
+        if (response.ok) {
+            const data = await response.json();
+            alert(data.message);
+        } else if (response.status === 429) {
+            alert('Too many requests. Please try again later.');
+        } else {
+            alert('Failed to request a password reset. Please check your email address.');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+async function resetPassword(event) {
+    event.preventDefault();
+    const token = new URLSearchParams(window.location.search).get('reset_token');
+    const password = document.getElementById('reset-password').value;
+
+    try {
+        const response = await fetch('/api/password/reset', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ token, password })
+        });
+
+        if (response.ok) {
+            clearTokens();
+            alert('Your password has been reset. Please log in.');
+            window.location.href = '/';
+        } else {
+            const policyError = await passwordPolicyError(response);
+            alert(policyError || 'The reset link is invalid or has expired.');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+async function requestLoginLink(event) {
+    event.preventDefault();
+    const email = document.getElementById('login-link-email').value;
+
+    try {
+        const response = await fetch('/api/login/link/request', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email })
+        });
+
+        if (response.ok) {
+            const data = await response.json();
+            alert(data.message);
+        } else if (response.status === 429) {
+            alert('Too many requests. Please try again later.');
+        } else {
+            alert('Failed to request a login link. Please check your email address.');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+// Вход по ссылке из письма: токен одноразовый, сразу убираем его из адреса
+async function loginWithLink(token) {
+    history.replaceState(null, '', window.location.pathname);
+
+    try {
+        const response = await fetch('/api/login/link', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', ...SESSION_MODE_HEADERS },
+            body: JSON.stringify({ token })
+        });
+
+        if (response.ok) {
+            const data = await response.json();
+            if (data.mfa_required) {
+                await completeTwoFactorLogin(data.challenge_token, null);
+                return;
+            }
+            finishLogin(data, null);
+        } else {
+            alert('The login link is invalid or has expired.');
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+// Ссылка из письма открывает форму сброса вместо входа
+if (new URLSearchParams(window.location.search).has('reset_token')) {
+    document.getElementById('auth-forms').style.display = 'none';
+    document.getElementById('reset-forms').style.display = 'block';
+}
+
+// Кнопки входа через OpenID Connect провайдеров
+async function loadOAuthProviders() {
+    try {
+        const response = await fetch('/api/oauth/providers');
+        if (!response.ok) {
+            return;
+        }
+        const data = await response.json();
+        const container = document.getElementById('oauth-providers');
+        data.providers.forEach((provider) => {
+            const link = document.createElement('a');
+            link.href = provider.login_url + (provider.login_url.includes('?') ? '&' : '?') + 'session=cookie';
+            link.className = 'oauth-button';
+            link.textContent = 'Sign in with ' + provider.display_name;
+            container.appendChild(link);
+        });
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+// Сервер возвращает результат входа через провайдера во фрагменте URL
+function handleOAuthRedirect() {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    if (!params.has('oauth') && !params.has('oauth_error')) {
+        return;
+    }
+    history.replaceState(null, '', window.location.pathname + window.location.search);
+
+    if (params.has('oauth_error')) {
+        alert('External login failed: ' + params.get('oauth_error').replace(/_/g, ' '));
+        return;
+    }
+    const email = params.get('email');
+    if (params.get('oauth') === 'mfa_required') {
+        completeTwoFactorLogin(params.get('challenge_token'), email);
+        return;
+    }
+    finishLogin({
+        token: params.get('token'),
+        refresh_token: params.get('refresh_token'),
+        expires_in: Number(params.get('expires_in')),
+        user_id: Number(params.get('user_id')),
+        is_admin: params.get('is_admin') === 'true',
+        role: params.get('role'),
+    }, email);
+}
+
+function finishLogin(data, email) {
+    storeTokens(data);
+    localStorage.setItem('currentUser', JSON.stringify({ id: data.user_id, email }));
+    window.location.href = '/index'; // Redirect to the main page
+}
+
+// Второй шаг входа: код из приложения-аутентификатора или код восстановления
+async function completeTwoFactorLogin(challengeToken, email) {
+    const input = prompt('Enter the 6-digit code from your authenticator app or a recovery code:');
+    if (!input) {
+        return;
+    }
+
+    const value = input.trim();
+    const body = /^\d{6}$/.test(value)
+        ? { challenge_token: challengeToken, code: value }
+        : { challenge_token: challengeToken, recovery_code: value };
+
+    try {
+        const response = await fetch('/api/login/2fa', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', ...SESSION_MODE_HEADERS },
+            body: JSON.stringify(body)
+        });
+
+        if (response.ok) {
+            finishLogin(await response.json(), email);
+        } else {
+            alert('Login failed: ' + await response.text());
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+// Подсказка о режиме регистрации; код из ссылки-приглашения подставляется сам
+async function loadRegistrationMode() {
+    const invite = new URLSearchParams(window.location.search).get('invite');
+    if (invite) {
+        document.getElementById('register-invite').value = invite;
+    }
+    try {
+        const response = await fetch('/api/registration');
+        if (!response.ok) {
+            return;
+        }
+        const data = await response.json();
+        const hint = document.getElementById('register-hint');
+        if (data.mode === 'invite') {
+            hint.textContent = 'Registration is by invitation only.';
+        } else if (data.mode === 'domains') {
+            hint.textContent = 'Use an address at ' + data.allowed_domains.join(', ') +
+                ', or enter an invite code.';
+        } else if (!invite) {
+            document.getElementById('register-invite').style.display = 'none';
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+loadRegistrationMode();
+loadOAuthProviders();
+handleOAuthRedirect();
+const loginToken = new URLSearchParams(window.location.search).get('login_token');
+if (loginToken) {
+    loginWithLink(loginToken);
+}
 
 document.getElementById('register-form').addEventListener('submit', register);
-document.getElementById('login-form').addEventListener('submit', login);
\ No newline at end of file
+document.getElementById('login-form').addEventListener('submit', login);
+document.getElementById('login-link-form').addEventListener('submit', requestLoginLink);
+document.getElementById('forgot-form').addEventListener('submit', forgotPassword);
+document.getElementById('reset-form').addEventListener('submit', resetPassword);
\ No newline at end of file
@@ -7,11 +7,9 @@ document.getElementById('emailForm').addEventListener('submit', async (e) => {
     users.forEach(user => formData.append('users[]', user));
 
     try {
-        const response = await fetch('/api/admin/broadcast-to-selected', {
+        // Requires the email.broadcast permission
+        const response = await authFetch('/api/admin/broadcast-to-selected', {
             method: 'POST',
-            headers: {
-                'Authorization': 'Bearer YOUR_JWT_TOKEN', // Replace with the actual token
-            },
             body: formData,
         });
 
@@ -21,7 +19,7 @@ document.getElementById('emailForm').addEventListener('submit', async (e) => {
             alert('Emails sent successfully!');
         } else {
             // Handle the error response
-            alert(`Failed to send emails: ${result.message}`);
+            alert(`Failed to send emails: ${result.message || response.statusText}`);
         }
     } catch (err) {
         // Catch and log any errors in the request or response
@@ -30,7 +28,5 @@ document.getElementById('emailForm').addEventListener('submit', async (e) => {
     }
 });
 function logout() {
-    localStorage.removeItem("token")
-    localStorage.removeItem("currentUser")
-    window.location.href = "/"
+    logoutSession()
   }
\ No newline at end of file
@@ -2,15 +2,15 @@
 let currentUser = null;
 let currentPage = 1; // Делаем переменную глобальной
 const pageSize = 10;
+const commentsPageSize = 5; // Комментарии подгружаются страницами по курсору
+let availableReactions = ['like']; // Набор реакций приходит с сервера
 
 function showContent() {
   document.getElementById("content").style.display = "block"
 }
 
 function logout() {
-  localStorage.removeItem("token")
-  localStorage.removeItem("currentUser")
-  window.location.href = "/"
+  logoutSession()
 }
 
 async function searchPosts() {
@@ -27,9 +27,8 @@ async function searchPosts() {
     await getPosts(searchParams);
 }
 async function getPosts(searchParams = {}) {
-    const token = localStorage.getItem('token');
-    if (!token) {
-        console.error('No token found');
+    if (!hasSession()) {
+        console.error('No session found');
         showAuthForms();
         return;
     }
@@ -41,9 +40,7 @@ async function getPosts(searchParams = {}) {
             ...searchParams
         });
 
-        const response = await fetch(`/api/index/posts?${queryParams}`, {
-            headers: { 'Authorization': token }
-        });
+        const response = await authFetch(`/api/index/posts?${queryParams}`);
         if (!response.ok) {
             throw new Error('Failed to fetch posts');
         }
@@ -56,6 +53,7 @@ async function getPosts(searchParams = {}) {
             div.innerHTML = `
                 <strong>${post.username}</strong>: ${post.content}<br>
                 <small>${formatDate(post.created_at)}</small>
+                ${renderReactions('post', post)}
                 <div class="post-actions">
                     ${post.user_id === currentUser.id ? `
                         <button onclick="editPost(${post.id}, '${post.content.replace(/'/g, "\\'")}')" class="edit-btn">
@@ -66,16 +64,17 @@ async function getPosts(searchParams = {}) {
                         </button>
                     ` : ''}
                 </div>
-                <h3>Comments</h3>
+                <h3>Comments <span id="comments-total-${post.id}" class="comments-total"></span></h3>
                 <div id="comments-${post.id}" class="comments-section"></div>
+                <button id="more-comments-${post.id}" class="more-comments-btn" style="display: none">Load more comments</button>
                 <textarea id="comment-${post.id}" placeholder="Write a comment..."></textarea>
                 <button class="add-comment-btn" data-post-id="${post.id}">
                     <i class="fas fa-comment"></i> Add Comment
                 </button>
             `;
             postList.appendChild(div);
-            getComments(post.id);
         });
+        loadFeedComments(posts.map(post => post.id));
 
         updatePagination();
     } catch (error) {
@@ -117,9 +116,8 @@ function formatDate(isoDate) {
 async function createPost(event) {
     event.preventDefault();
     const content = document.getElementById('post-content').value;
-    const token = localStorage.getItem('token');
-    if (!token) {
-        console.error('No token found');
+    if (!hasSession()) {
+        console.error('No session found');
         showAuthForms();
         return;
     }
@@ -129,11 +127,10 @@ async function createPost(event) {
     }
 
     try {
-        const response = await fetch('/api/index/posts/create', {
+        const response = await authFetch('/api/index/posts/create', {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json',
-                'Authorization': token
+                'Content-Type': 'application/json'
             },
             body: JSON.stringify({ content }),
         });
@@ -150,19 +147,17 @@ async function createPost(event) {
 async function editPost(postId, currentContent) {
     const newContent = prompt('Edit your post:', currentContent);
     if (newContent !== null && newContent.trim() !== '') {
-        const token = localStorage.getItem('token');
-        if (!token) {
-            console.error('No token found');
+        if (!hasSession()) {
+            console.error('No session found');
             showAuthForms();
             return;
         }
 
         try {
-            const response = await fetch('/api/index/posts/update', {
+            const response = await authFetch('/api/index/posts/update', {
                 method: 'PUT',
                 headers: {
-                    'Content-Type': 'application/json',
-                    'Authorization': token
+                    'Content-Type': 'application/json'
                 },
                 body: JSON.stringify({ id: postId, content: newContent.trim() }),
             });
@@ -178,19 +173,17 @@ async function editPost(postId, currentContent) {
 }
 
 async function deletePost(postId) {
-    const token = localStorage.getItem('token');
-    if (!token) {
-        console.error('No token found');
+    if (!hasSession()) {
+        console.error('No session found');
         showAuthForms();
         return;
     }
 
     try {
-        const response = await fetch('/api/index/posts/delete', {
+        const response = await authFetch('/api/index/posts/delete', {
             method: 'DELETE',
             headers: {
-                'Content-Type': 'application/json',
-                'Authorization': token
+                'Content-Type': 'application/json'
             },
             body: JSON.stringify({ id: postId }),
         });
@@ -204,43 +197,176 @@ async function deletePost(postId) {
     }
 }
 
-async function getComments(postId) {
-    const token = localStorage.getItem('token');
-    if (!token) {
-        console.error('No token found');
-        return;
+async function loadReactions() {
+    try {
+        const response = await authFetch('/api/reactions');
+        if (response.ok) {
+            availableReactions = (await response.json()).reactions;
+        }
+    } catch (error) {
+        console.error('Error fetching reactions:', error);
     }
+}
+
+function reactionLabel(reaction) {
+    return reaction === 'like' ? '👍' : reaction;
+}
+
+// Кнопки реакций со счётчиками; свои реакции подсвечены
+function renderReactions(kind, item) {
+    const summary = item.reactions || { counts: {}, mine: [] };
+    const buttons = availableReactions.map(reaction => {
+        const count = summary.counts[reaction] || 0;
+        const mine = summary.mine.includes(reaction);
+        return `<button class="reaction-btn${mine ? ' reacted' : ''}" onclick="toggleReaction('${kind}', ${item.id}, '${reaction}', ${mine})">${reactionLabel(reaction)} ${count || ''}</button>`;
+    });
+    return `<div class="reactions" id="reactions-${kind}-${item.id}">${buttons.join('')}</div>`;
+}
 
+async function toggleReaction(kind, id, reaction, mine) {
+    const collection = kind === 'post' ? 'posts' : 'comments';
+    const action = mine ? 'remove' : 'add';
     try {
-        const response = await fetch('/api/index/comments', {
-            headers: { 'Authorization': token }
+        const response = await authFetch(`/api/index/${collection}/reactions/${action}?id=${id}&reaction=${encodeURIComponent(reaction)}`, {
+            method: 'POST'
         });
+        if (!response.ok) {
+            throw new Error('Failed to update reaction');
+        }
+        const data = await response.json();
+        document.getElementById(`reactions-${kind}-${id}`).outerHTML = renderReactions(kind, { id, reactions: data.reactions });
+    } catch (error) {
+        console.error('Error updating reaction:', error);
+    }
+}
+
+// Первая страница комментариев для всех постов ленты одним запросом
+async function loadFeedComments(postIds) {
+    if (postIds.length === 0) {
+        return;
+    }
+
+    try {
+        const response = await authFetch(`/api/index/comments?post_ids=${postIds.join(',')}&limit=${commentsPageSize}`);
         if (!response.ok) {
             throw new Error('Failed to fetch comments');
         }
-        const comments = await response.json();
-        const commentList = document.getElementById(`comments-${postId}`);
+        const feed = await response.json();
+        feed.posts.forEach(page => renderCommentPage(page, false));
+    } catch (error) {
+        console.error('Error fetching comments:', error);
+    }
+}
+
+async function getComments(postId, cursor = '') {
+    if (!hasSession()) {
+        console.error('No session found');
+        return;
+    }
+
+    try {
+        const response = await authFetch(`/api/index/comments?post_id=${postId}&limit=${commentsPageSize}&cursor=${cursor}`);
+        if (!response.ok) {
+            throw new Error('Failed to fetch comments');
+        }
+        renderCommentPage(await response.json(), cursor !== '');
+    } catch (error) {
+        console.error('Error fetching comments:', error);
+    }
+}
+
+function renderCommentPage(page, append) {
+    const commentList = document.getElementById(`comments-${page.post_id}`);
+    if (!commentList) {
+        return;
+    }
+    if (!append) {
         commentList.innerHTML = '';
-        comments.filter(comment => comment.post_id === postId).forEach(comment => {
-            const div = document.createElement('div');
-            div.classList.add('comment');
-            div.innerHTML = `
-                <strong>${comment.username}</strong>: ${comment.content}
-                <div class="comment-actions">
-                    ${comment.user_id === currentUser.id ? `
-                        <button onclick="editComment(${comment.id}, '${comment.content.replace(/'/g, "\\'")}')" class="edit-btn">
-                            <i class="fas fa-edit"></i> 
-                        </button>
-                        <button onclick="deleteComment(${comment.id})" class="delete-btn">
-                            <i class="fas fa-trash-alt"></i> 
-                        </button>
-                    ` : ''}
-                </div>
-            `;
-            commentList.appendChild(div);
+    }
+    page.comments.forEach(comment => commentList.appendChild(renderComment(page.post_id, comment)));
+    document.getElementById(`comments-total-${page.post_id}`).textContent = page.total ? `(${page.total})` : '';
+
+    const more = document.getElementById(`more-comments-${page.post_id}`);
+    more.style.display = page.next_cursor ? '' : 'none';
+    more.onclick = () => getComments(page.post_id, page.next_cursor);
+}
+
+// Ветка обрезается по глубине: у комментария есть reply_count, но нет replies,
+// такие ответы подгружаются отдельно по кнопке
+function renderComment(postId, comment) {
+    const div = document.createElement('div');
+    div.classList.add('comment');
+    const moreReplies = comment.reply_count > 0 && !comment.replies;
+    div.innerHTML = comment.deleted ? `
+        <em class="comment-deleted">Comment deleted</em>
+    ` : `
+        <strong>${comment.username}</strong>: ${comment.content}
+        ${renderReactions('comment', comment)}
+        <div class="comment-actions">
+            <button onclick="replyToComment(${postId}, ${comment.id})" class="reply-btn">
+                <i class="fas fa-reply"></i>
+            </button>
+            ${comment.user_id === currentUser.id ? `
+                <button onclick="editComment(${comment.id}, '${comment.content.replace(/'/g, "\\'")}')" class="edit-btn">
+                    <i class="fas fa-edit"></i> 
+                </button>
+                <button onclick="deleteComment(${comment.id})" class="delete-btn">
+                    <i class="fas fa-trash-alt"></i> 
+                </button>
+            ` : ''}
+        </div>
+    `;
+    const replies = document.createElement('div');
+    replies.classList.add('comment-replies');
+    replies.id = `replies-${comment.id}`;
+    (comment.replies || []).forEach(reply => replies.appendChild(renderComment(postId, reply)));
+    if (moreReplies) {
+        const button = document.createElement('button');
+        button.classList.add('more-replies-btn');
+        button.textContent = `Show replies (${comment.reply_count})`;
+        button.addEventListener('click', () => loadReplies(postId, comment.id));
+        replies.appendChild(button);
+    }
+    div.appendChild(replies);
+    return div;
+}
+
+async function loadReplies(postId, commentId) {
+    try {
+        const response = await authFetch(`/api/index/comments/thread?post_id=${postId}&parent_id=${commentId}`);
+        if (!response.ok) {
+            throw new Error('Failed to fetch replies');
+        }
+        const thread = await response.json();
+        const replies = document.getElementById(`replies-${commentId}`);
+        replies.innerHTML = '';
+        thread.comments.forEach(reply => replies.appendChild(renderComment(postId, reply)));
+    } catch (error) {
+        console.error('Error fetching replies:', error);
+    }
+}
+
+async function replyToComment(postId, parentId) {
+    const content = prompt('Write a reply:');
+    if (content === null || content.trim() === '') {
+        return;
+    }
+
+    try {
+        const response = await authFetch('/api/index/comments/create', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ post_id: postId, parent_id: parentId, content: content.trim() }),
         });
+        if (!response.ok) {
+            throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        await getComments(postId);
     } catch (error) {
-        console.error('Error fetching comments:', error);
+        console.error('Error creating reply:', error);
+        alert('Failed to post reply. Please try again.');
     }
 }
 
@@ -254,19 +380,17 @@ async function createComment(event, postId) {
         return;
     }
 
-    const token = localStorage.getItem('token');
-    if (!token) {
-        console.error('No token found');
+    if (!hasSession()) {
+        console.error('No session found');
         showAuthForms();
         return;
     }
 
     try {
-        const response = await fetch('/api/index/comments/create', {
+        const response = await authFetch('/api/index/comments/create', {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json',
-                'Authorization': token
+                'Content-Type': 'application/json'
             },
             body: JSON.stringify({ post_id: postId, content }),
         });
@@ -288,19 +412,17 @@ async function createComment(event, postId) {
 async function editComment(commentId, currentContent) {
     const newContent = prompt('Edit your comment:', currentContent);
     if (newContent !== null && newContent.trim() !== '') {
-        const token = localStorage.getItem('token');
-        if (!token) {
-            console.error('No token found');
+        if (!hasSession()) {
+            console.error('No session found');
             showAuthForms();
             return;
         }
 
         try {
-            const response = await fetch('/api/index/comments/update', {
+            const response = await authFetch('/api/index/comments/update', {
                 method: 'PUT',
                 headers: {
-                    'Content-Type': 'application/json',
-                    'Authorization': token
+                    'Content-Type': 'application/json'
                 },
                 body: JSON.stringify({ id: commentId, content: newContent.trim() }),
             });
@@ -316,19 +438,17 @@ async function editComment(commentId, currentContent) {
 }
 
 async function deleteComment(commentId) {
-    const token = localStorage.getItem('token');
-    if (!token) {
-        console.error('No token found');
+    if (!hasSession()) {
+        console.error('No session found');
         showAuthForms();
         return;
     }
 
     try {
-        const response = await fetch('/api/index/comments/delete', {
+        const response = await authFetch('/api/index/comments/delete', {
             method: 'DELETE',
             headers: {
-                'Content-Type': 'application/json',
-                'Authorization': token
+                'Content-Type': 'application/json'
             },
             body: JSON.stringify({ id: commentId }),
         });
@@ -343,13 +463,12 @@ async function deleteComment(commentId) {
 }
 
 document.addEventListener("DOMContentLoaded", () => {
-    const token = localStorage.getItem("token")
     const storedUser = localStorage.getItem("currentUser")
-    if (token && storedUser) {
+    if (hasSession() && storedUser) {
       currentUser = JSON.parse(storedUser)
       console.log("Stored user:", currentUser)
       showContent()
-      getPosts()
+      loadReactions().then(getPosts)
     } else {
       window.location.href = "/"
     }
@@ -0,0 +1,145 @@
+// Shared helpers for the access/refresh token pair returned by /api/login.
+// Access tokens are short-lived, so authFetch transparently refreshes the
+// session once when the server answers 401.
+//
+// The pages log in in cookie mode: the tokens live in HttpOnly cookies that
+// scripts cannot read, and every request that changes state echoes the
+// csrf_token cookie in the X-CSRF-Token header. Tokens in localStorage
+// (impersonation from the admin page) are still sent as a header.
+
+// Заголовок для запросов входа, чтобы сервер выдал сессию в cookie
+const SESSION_MODE_HEADERS = { 'X-Session-Mode': 'cookie' };
+
+function storeTokens(data) {
+    if (data.token) {
+        localStorage.setItem('token', data.token);
+    } else {
+        localStorage.removeItem('token');
+    }
+    if (data.refresh_token) {
+        localStorage.setItem('refreshToken', data.refresh_token);
+    } else {
+        localStorage.removeItem('refreshToken');
+    }
+}
+
+function csrfToken() {
+    const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]+)/);
+    return match ? decodeURIComponent(match[1]) : null;
+}
+
+// Есть ли сессия: токен в localStorage или cookie-сессия (о ней говорит
+// читаемая cookie с CSRF-токеном)
+function hasSession() {
+    return !!localStorage.getItem('token') || !!csrfToken();
+}
+
+function clearTokens() {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
+    localStorage.removeItem('currentUser');
+}
+
+async function refreshSession() {
+    const refreshToken = localStorage.getItem('refreshToken');
+    const csrf = csrfToken();
+    if (!refreshToken && !csrf) {
+        return false;
+    }
+
+    // В режиме cookie refresh-токен отправит сам браузер
+    const response = await fetch('/api/token/refresh', {
+        method: 'POST',
+        headers: refreshToken
+            ? { 'Content-Type': 'application/json' }
+            : { 'X-CSRF-Token': csrf },
+        body: refreshToken ? JSON.stringify({ refresh_token: refreshToken }) : null
+    });
+    if (!response.ok) {
+        clearTokens();
+        return false;
+    }
+
+    storeTokens(await response.json());
+    return true;
+}
+
+async function authFetch(url, options = {}) {
+    const withToken = () => {
+        const headers = { ...options.headers };
+        const token = localStorage.getItem('token');
+        if (token) {
+            headers['Authorization'] = token;
+        } else {
+            delete headers['Authorization'];
+        }
+        const csrf = csrfToken();
+        if (csrf) {
+            headers['X-CSRF-Token'] = csrf;
+        }
+        return { ...options, headers, credentials: 'same-origin' };
+    };
+
+    let response = await fetch(url, withToken());
+    if (response.status === 401 && await refreshSession()) {
+        response = await fetch(url, withToken());
+    }
+    showImpersonationBanner(response);
+    return response;
+}
+
+// Сервер помечает ответы на запросы с токеном имперсонации заголовком
+// X-Impersonated-By; пока он есть, вверху страницы висит предупреждение
+function showImpersonationBanner(response) {
+    const impersonator = response.headers.get('X-Impersonated-By');
+    if (!impersonator || document.getElementById('impersonation-banner')) {
+        return;
+    }
+    const readOnly = response.headers.get('X-Impersonation-Read-Only') === 'true';
+
+    const banner = document.createElement('div');
+    banner.id = 'impersonation-banner';
+    banner.style.cssText = 'position:sticky;top:0;z-index:1000;padding:8px;text-align:center;background:#c0392b;color:#fff;';
+    banner.textContent = `You are viewing this account as admin #${impersonator}` +
+        (readOnly ? ' (read-only). ' : '. ');
+
+    const stop = document.createElement('button');
+    stop.textContent = 'Stop impersonating';
+    stop.addEventListener('click', logoutSession);
+    banner.appendChild(stop);
+    document.body.prepend(banner);
+}
+
+async function logoutSession() {
+    try {
+        await fetch('/api/logout', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': localStorage.getItem('token') || '',
+                'X-CSRF-Token': csrfToken() || ''
+            },
+            body: JSON.stringify({ refresh_token: localStorage.getItem('refreshToken') })
+        });
+    } catch (error) {
+        console.error('Error logging out:', error);
+    }
+    clearTokens();
+    window.location.href = '/';
+}
+
+// Возвращает текст нарушенных правил пароля из ответа 400, иначе null
+async function passwordPolicyError(response) {
+    if (response.status !== 400) {
+        return null;
+    }
+    try {
+        const data = await response.clone().json();
+        if (Array.isArray(data.violations)) {
+            return data.violations.map(v => v.message).join('\n');
+        }
+    } catch (error) {
+        // Ответ не JSON — это другая ошибка
+    }
+    return null;
+}
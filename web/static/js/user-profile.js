@@ -22,14 +22,19 @@ document.addEventListener("DOMContentLoaded", () => {
     // Fetch and display user data
     fetchUserData()
     fetchUserPosts()
+    fetchTwoFactorStatus()
+    fetchSessions()
 
     // Event listeners
     editProfileBtn.addEventListener("click", showEditForm)
     saveProfileBtn.addEventListener("click", saveProfile)
     cancelEditBtn.addEventListener("click", cancelEdit)
+    document.getElementById("enableTwoFactor").addEventListener("click", enrollTwoFactor)
+    document.getElementById("confirmTwoFactor").addEventListener("click", confirmTwoFactor)
+    document.getElementById("disableTwoFactor").addEventListener("click", disableTwoFactor)
 
     function fetchUserData() {
-        fetch(`/api/user-profile/data?id=${currentUser.id}`, {
+        authFetch("/api/user-profile/data", {
             method: "GET",
             headers: {
                 Authorization: `Bearer ${currentUser.token}`,
@@ -53,7 +58,9 @@ document.addEventListener("DOMContentLoaded", () => {
     function displayUserData(data) {
         document.getElementById("username").textContent = data.username
         document.getElementById("email").textContent = data.email
-        document.getElementById("role").textContent = data.is_admin ? "Admin" : "User"
+        document.getElementById("role").textContent = data.role ? data.role.charAt(0).toUpperCase() + data.role.slice(1) : (data.is_admin ? "Admin" : "User")
+        document.getElementById("followers").textContent = data.followers || 0
+        document.getElementById("following").textContent = data.following || 0
         document.getElementById("editUsername").value = data.username
     }
 
@@ -72,13 +79,12 @@ document.addEventListener("DOMContentLoaded", () => {
         }
 
         const payload = {
-            id: currentUser.id,
             username: newUsername,
             password: newPassword,
         }
 
 
-        fetch("/api/user-profile/edit", {
+        authFetch("/api/user-profile/edit", {
             method: "POST",
             headers: {
                 "Content-Type": "application/json",
@@ -86,13 +92,18 @@ document.addEventListener("DOMContentLoaded", () => {
             },
             body: JSON.stringify(payload),
         })
-            .then((response) => {
+            .then(async (response) => {
                 if (!response.ok) {
-                    throw new Error("Failed to update profile")
+                    const policyError = await passwordPolicyError(response)
+                    throw new Error(policyError || "Failed to update profile")
                 }
                 return response.json()
             })
             .then((data) => {
+                // Changing the password revokes every session and returns a new one
+                if (data.token) {
+                    storeTokens(data)
+                }
                 showMessage(data.message)
                 fetchUserData()
                 cancelEdit()
@@ -118,8 +129,159 @@ document.addEventListener("DOMContentLoaded", () => {
         }, 5000)
     }
 
+    function fetchTwoFactorStatus() {
+        authFetch("/api/2fa/status", { method: "GET" })
+            .then((response) => {
+                if (!response.ok) {
+                    throw new Error("Failed to fetch two-factor status")
+                }
+                return response.json()
+            })
+            .then((data) => {
+                document.getElementById("twoFactorStatus").textContent = data.enabled
+                    ? `Enabled (${data.recovery_codes_remaining} recovery codes left)`
+                    : "Disabled"
+                document.getElementById("enableTwoFactor").style.display = data.enabled ? "none" : "inline-block"
+                document.getElementById("twoFactorDisable").style.display = data.enabled ? "block" : "none"
+            })
+            .catch((error) => {
+                console.error("Error:", error)
+                showMessage(error.message, true)
+            })
+    }
+
+    function enrollTwoFactor() {
+        authFetch("/api/2fa/enroll", { method: "POST" })
+            .then((response) => {
+                if (!response.ok) {
+                    throw new Error("Failed to start two-factor setup")
+                }
+                return response.json()
+            })
+            .then((data) => {
+                document.getElementById("twoFactorSecret").textContent = data.secret
+                document.getElementById("twoFactorURI").href = data.otpauth_uri
+                document.getElementById("twoFactorSetup").style.display = "block"
+            })
+            .catch((error) => {
+                console.error("Error:", error)
+                showMessage(error.message, true)
+            })
+    }
+
+    function confirmTwoFactor() {
+        const code = document.getElementById("twoFactorCode").value.trim()
+        authFetch("/api/2fa/confirm", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ code }),
+        })
+            .then((response) => {
+                if (!response.ok) {
+                    throw new Error("Invalid code")
+                }
+                return response.json()
+            })
+            .then((data) => {
+                // Enabling 2FA replaces every session with a new one
+                storeTokens(data)
+                const codes = document.getElementById("recoveryCodes")
+                codes.textContent = "Save these recovery codes, they are shown only once:\n" + data.recovery_codes.join("\n")
+                codes.style.display = "block"
+                document.getElementById("twoFactorSetup").style.display = "none"
+                fetchTwoFactorStatus()
+            })
+            .catch((error) => {
+                console.error("Error:", error)
+                showMessage(error.message, true)
+            })
+    }
+
+    function disableTwoFactor() {
+        const password = document.getElementById("twoFactorPassword").value
+        const value = document.getElementById("twoFactorDisableCode").value.trim()
+        const payload = /^\d{6}$/.test(value) ? { password, code: value } : { password, recovery_code: value }
+
+        authFetch("/api/2fa/disable", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(payload),
+        })
+            .then((response) => {
+                if (!response.ok) {
+                    throw new Error("Failed to disable two-factor authentication")
+                }
+                return response.json()
+            })
+            .then((data) => {
+                storeTokens(data)
+                document.getElementById("recoveryCodes").style.display = "none"
+                fetchTwoFactorStatus()
+            })
+            .catch((error) => {
+                console.error("Error:", error)
+                showMessage(error.message, true)
+            })
+    }
+
+    function fetchSessions() {
+        authFetch("/api/sessions", { method: "GET" })
+            .then((response) => {
+                if (!response.ok) {
+                    throw new Error("Failed to fetch sessions")
+                }
+                return response.json()
+            })
+            .then((data) => displaySessions(data.sessions))
+            .catch((error) => {
+                console.error("Error:", error)
+                showMessage(error.message, true)
+            })
+    }
+
+    function displaySessions(sessions) {
+        const container = document.getElementById("sessions")
+        container.innerHTML = ""
+        sessions.forEach((session) => {
+            const element = document.createElement("div")
+            element.className = "session"
+            // user_agent приходит от клиента, поэтому только textContent
+            const device = document.createElement("p")
+            device.textContent = session.user_agent || "Unknown device"
+            if (session.current) {
+                device.textContent += " (this device)"
+            }
+            const details = document.createElement("small")
+            details.textContent = `IP ${session.ip || "unknown"}, logged in ${new Date(session.created_at).toLocaleString()}, last seen ${new Date(session.last_used_at).toLocaleString()}`
+            element.append(device, details)
+
+            if (!session.current) {
+                const revoke = document.createElement("button")
+                revoke.textContent = "Log out"
+                revoke.addEventListener("click", () => revokeSession(session.id))
+                element.appendChild(revoke)
+            }
+            container.appendChild(element)
+        })
+    }
+
+    function revokeSession(id) {
+        authFetch(`/api/sessions/revoke?id=${encodeURIComponent(id)}`, { method: "POST" })
+            .then((response) => {
+                if (!response.ok) {
+                    throw new Error("Failed to log out the session")
+                }
+                showMessage("Session logged out")
+                fetchSessions()
+            })
+            .catch((error) => {
+                console.error("Error:", error)
+                showMessage(error.message, true)
+            })
+    }
+
     function fetchUserPosts() {
-        fetch(`/api/user-profile/posts?id=${currentUser.id}`, {
+        authFetch("/api/user-profile/posts", {
             method: "GET",
             headers: {
                 Authorization: `Bearer ${currentUser.token}`,